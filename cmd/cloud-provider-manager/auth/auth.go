@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+type UserInfo struct {
+	Name   string   `json:"name"`
+	UID    string   `json:"uid"`
+	Groups []string `json:"groups"`
+}
+
+// Authenticator returns ok=false when the request does not carry the kind of
+// credential it understands, and an error when the credential is rejected.
+type Authenticator interface {
+	AuthenticateRequest(req *http.Request) (user *UserInfo, ok bool, err error)
+}
+
+type unionAuthenticator []Authenticator
+
+func (u unionAuthenticator) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	var lastErr error
+	for _, a := range u {
+		user, ok, err := a.AuthenticateRequest(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ok {
+			return user, true, nil
+		}
+	}
+	return nil, false, lastErr
+}
+
+func NewUnionAuthenticator(authenticators ...Authenticator) Authenticator {
+	return unionAuthenticator(authenticators)
+}
+
+func bearerToken(req *http.Request) (string, bool) {
+	header := req.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(parts[1])
+	return token, token != ""
+}
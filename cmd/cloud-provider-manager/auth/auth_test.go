@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func requestWithToken(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return req
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		token  string
+		ok     bool
+	}{
+		{name: "no header"},
+		{name: "bearer", header: "Bearer abc", token: "abc", ok: true},
+		{name: "scheme is case insensitive", header: "bearer abc", token: "abc", ok: true},
+		{name: "surrounding spaces", header: "Bearer  abc ", token: "abc", ok: true},
+		{name: "basic", header: "Basic abc"},
+		{name: "empty token", header: "Bearer  "},
+		{name: "no token", header: "Bearer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, ok := bearerToken(requestWithToken(tt.header))
+			if token != tt.token || ok != tt.ok {
+				t.Errorf("bearerToken = %q, %v, expected %q, %v", token, ok, tt.token, tt.ok)
+			}
+		})
+	}
+}
+
+type staticAuthenticator struct {
+	user *UserInfo
+	ok   bool
+	err  error
+}
+
+func (a staticAuthenticator) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	return a.user, a.ok, a.err
+}
+
+func TestUnionAuthenticator(t *testing.T) {
+	alice := &UserInfo{Name: "alice"}
+	bob := &UserInfo{Name: "bob"}
+	errRejected := errors.New("rejected")
+
+	tests := []struct {
+		name           string
+		authenticators []Authenticator
+		user           *UserInfo
+		ok             bool
+		err            error
+	}{
+		{name: "none"},
+		{name: "first wins", authenticators: []Authenticator{staticAuthenticator{user: alice, ok: true}, staticAuthenticator{user: bob, ok: true}}, user: alice, ok: true},
+		{name: "skips not applicable", authenticators: []Authenticator{staticAuthenticator{}, staticAuthenticator{user: bob, ok: true}}, user: bob, ok: true},
+		{name: "error does not stop the next", authenticators: []Authenticator{staticAuthenticator{err: errRejected}, staticAuthenticator{user: bob, ok: true}}, user: bob, ok: true},
+		{name: "error is returned when nobody accepts", authenticators: []Authenticator{staticAuthenticator{err: errRejected}, staticAuthenticator{}}, err: errRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, ok, err := NewUnionAuthenticator(tt.authenticators...).AuthenticateRequest(requestWithToken(""))
+			if user != tt.user || ok != tt.ok || err != tt.err {
+				t.Errorf("got %v, %v, %v, expected %v, %v, %v", user, ok, err, tt.user, tt.ok, tt.err)
+			}
+		})
+	}
+}
+
+func TestTokenFileAuthenticator(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		header  string
+		user    *UserInfo
+		err     string
+	}{
+		{
+			name:    "user with groups",
+			content: "# comment\nt1,alice,1,\"ops,dev\"\nt2,bob,2\n",
+			header:  "Bearer t1",
+			user:    &UserInfo{Name: "alice", UID: "1", Groups: []string{"ops", "dev"}},
+		},
+		{
+			name:    "user without groups",
+			content: "t1,alice,1,\"ops,dev\"\nt2,bob,2\n",
+			header:  "Bearer t2",
+			user:    &UserInfo{Name: "bob", UID: "2"},
+		},
+		{name: "unknown token", content: "t1,alice,1\n", header: "Bearer t3"},
+		{name: "no token", content: "t1,alice,1\n"},
+		{name: "missing uid", content: "t1,alice\n", err: "line 1: expected token,user,uid"},
+		{name: "empty token", content: "t1,alice,1\n ,bob,2\n", err: "line 2: empty token"},
+		{name: "duplicate token", content: "t1,alice,1\nt1,bob,2\n", err: "line 2: duplicate token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			a, err := NewTokenFileAuthenticator(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			user, ok, err := a.AuthenticateRequest(requestWithToken(tt.header))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != (tt.user != nil) || !reflect.DeepEqual(user, tt.user) {
+				t.Errorf("got %+v, %v, expected %+v", user, ok, tt.user)
+			}
+		})
+	}
+}
+
+func TestX509Authenticator(t *testing.T) {
+	cert := func(cn string, orgs ...string) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{
+			Subject:      pkix.Name{CommonName: cn, Organization: orgs},
+			SerialNumber: big.NewInt(7),
+		}}}}
+	}
+
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		user  *UserInfo
+		ok    bool
+		err   error
+	}{
+		{name: "plain http"},
+		{name: "no verified chain", state: &tls.ConnectionState{}},
+		{name: "common name and organizations", state: cert("controller", "system:controllers"), user: &UserInfo{Name: "controller", UID: "7", Groups: []string{"system:controllers"}}, ok: true},
+		{name: "no common name", state: cert(""), err: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := requestWithToken("")
+			req.TLS = tt.state
+
+			user, ok, err := NewX509Authenticator().AuthenticateRequest(req)
+			if !reflect.DeepEqual(user, tt.user) || ok != tt.ok || !errors.Is(err, tt.err) {
+				t.Errorf("got %+v, %v, %v, expected %+v, %v, %v", user, ok, err, tt.user, tt.ok, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+)
+
+const AllClusters = "*"
+
+// ClusterScope is the set of clusters a user may read and modify
+type ClusterScope struct {
+	All      bool
+	Clusters []string
+}
+
+func (s *ClusterScope) Allows(cluster string) bool {
+	if s.All {
+		return true
+	}
+	for _, c := range s.Clusters {
+		if c == cluster {
+			return true
+		}
+	}
+	return false
+}
+
+type Authorizer struct {
+	rules       []config.CloudProviderAuthorizationRule
+	quotaAdmins []config.CloudProviderAuthorizationRule
+}
+
+// NewAuthorizer grants access to clusters by rules, changing quotas additionally takes a rule of quotaAdmins
+func NewAuthorizer(rules, quotaAdmins []config.CloudProviderAuthorizationRule) *Authorizer {
+	return &Authorizer{rules: rules, quotaAdmins: quotaAdmins}
+}
+
+func (a *Authorizer) matches(rule config.CloudProviderAuthorizationRule, user *UserInfo) bool {
+	if rule.User != "" && rule.User == user.Name {
+		return true
+	}
+	if rule.Group == "" {
+		return false
+	}
+	for _, group := range user.Groups {
+		if group == rule.Group {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Authorizer) Scope(user *UserInfo) *ClusterScope {
+	return a.scope(a.rules, user)
+}
+
+// QuotaScope is the set of clusters whose quotas the user may change
+func (a *Authorizer) QuotaScope(user *UserInfo) *ClusterScope {
+	return a.scope(a.quotaAdmins, user)
+}
+
+func (a *Authorizer) scope(rules []config.CloudProviderAuthorizationRule, user *UserInfo) *ClusterScope {
+	scope := &ClusterScope{}
+	seen := map[string]bool{}
+
+	for _, rule := range rules {
+		if !a.matches(rule, user) {
+			continue
+		}
+		for _, cluster := range rule.Clusters {
+			if cluster == AllClusters {
+				return &ClusterScope{All: true}
+			}
+			if !seen[cluster] {
+				seen[cluster] = true
+				scope.Clusters = append(scope.Clusters, cluster)
+			}
+		}
+	}
+	return scope
+}
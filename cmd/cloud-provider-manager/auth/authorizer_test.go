@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAuthorizerScope(t *testing.T) {
+	authorizer := NewAuthorizer([]config.CloudProviderAuthorizationRule{
+		{User: "controller-a", Clusters: []string{"c1"}},
+		{Group: "ops", Clusters: []string{"c2", "c1"}},
+		{Group: "admins", Clusters: []string{AllClusters}},
+		{User: "controller-b", Clusters: []string{"c3"}},
+		{User: "controller-b", Clusters: []string{"c3", "c4"}},
+	}, nil)
+
+	tests := []struct {
+		name  string
+		user  *UserInfo
+		scope *ClusterScope
+	}{
+		{name: "no rule", user: &UserInfo{Name: "someone"}, scope: &ClusterScope{}},
+		{name: "user rule", user: &UserInfo{Name: "controller-a"}, scope: &ClusterScope{Clusters: []string{"c1"}}},
+		{name: "user and group rules merge", user: &UserInfo{Name: "controller-a", Groups: []string{"ops"}}, scope: &ClusterScope{Clusters: []string{"c1", "c2"}}},
+		{name: "rules of the same user merge", user: &UserInfo{Name: "controller-b"}, scope: &ClusterScope{Clusters: []string{"c3", "c4"}}},
+		{name: "wildcard", user: &UserInfo{Name: "someone", Groups: []string{"ops", "admins"}}, scope: &ClusterScope{All: true}},
+		{name: "empty user name matches no user rule", user: &UserInfo{}, scope: &ClusterScope{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if scope := authorizer.Scope(tt.user); !reflect.DeepEqual(scope, tt.scope) {
+				t.Errorf("scope = %+v, expected %+v", scope, tt.scope)
+			}
+		})
+	}
+}
+
+func TestClusterScopeAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   ClusterScope
+		cluster string
+		allowed bool
+	}{
+		{name: "all", scope: ClusterScope{All: true}, cluster: "c9", allowed: true},
+		{name: "listed", scope: ClusterScope{Clusters: []string{"c1", "c2"}}, cluster: "c2", allowed: true},
+		{name: "not listed", scope: ClusterScope{Clusters: []string{"c1"}}, cluster: "c2"},
+		{name: "empty", cluster: "c1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if allowed := tt.scope.Allows(tt.cluster); allowed != tt.allowed {
+				t.Errorf("Allows(%q) = %v, expected %v", tt.cluster, allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	authenticator := NewUnionAuthenticator(staticTokens{"t1": {Name: "controller-a"}, "t2": {Name: "stranger"}})
+	authorizer := NewAuthorizer([]config.CloudProviderAuthorizationRule{{User: "controller-a", Clusters: []string{"c1"}}}, nil)
+
+	tests := []struct {
+		name          string
+		authenticator Authenticator
+		header        string
+		cluster       string
+		code          int
+	}{
+		{name: "anonymous without authenticator", cluster: "c9", code: http.StatusOK},
+		{name: "no credentials", authenticator: authenticator, cluster: "c1", code: http.StatusUnauthorized},
+		{name: "unknown token", authenticator: authenticator, header: "Bearer t9", cluster: "c1", code: http.StatusUnauthorized},
+		{name: "allowed cluster", authenticator: authenticator, header: "Bearer t1", cluster: "c1", code: http.StatusOK},
+		{name: "other cluster", authenticator: authenticator, header: "Bearer t1", cluster: "c2", code: http.StatusForbidden},
+		{name: "user without rules", authenticator: authenticator, header: "Bearer t2", cluster: "c1", code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(Middleware(tt.authenticator, authorizer))
+			router.GET("/clusters/:cluster", func(ctx *gin.Context) {
+				if Authorize(ctx, ctx.Param("cluster")) {
+					ctx.String(http.StatusOK, User(ctx).Name)
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/clusters/"+tt.cluster, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.code {
+				t.Errorf("code = %d, expected %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthorizeQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	authenticator := NewUnionAuthenticator(staticTokens{"t1": {Name: "controller-a"}, "t2": {Name: "quota-admin", Groups: []string{"capacity"}}})
+	authorizer := NewAuthorizer(
+		[]config.CloudProviderAuthorizationRule{{User: "controller-a", Clusters: []string{"c1"}}, {User: "quota-admin", Clusters: []string{"c1"}}},
+		[]config.CloudProviderAuthorizationRule{{Group: "capacity", Clusters: []string{"c1"}}},
+	)
+
+	tests := []struct {
+		name          string
+		authenticator Authenticator
+		header        string
+		cluster       string
+		code          int
+	}{
+		{name: "anonymous without authenticator", cluster: "c1", code: http.StatusOK},
+		{name: "cluster access only", authenticator: authenticator, header: "Bearer t1", cluster: "c1", code: http.StatusForbidden},
+		{name: "quota admin", authenticator: authenticator, header: "Bearer t2", cluster: "c1", code: http.StatusOK},
+		{name: "quota admin of another cluster", authenticator: authenticator, header: "Bearer t2", cluster: "c2", code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(Middleware(tt.authenticator, authorizer))
+			router.PUT("/clusters/:cluster/quota", func(ctx *gin.Context) {
+				if AuthorizeQuota(ctx, ctx.Param("cluster")) {
+					ctx.String(http.StatusOK, User(ctx).Name)
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodPut, "/clusters/"+tt.cluster+"/quota", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.code {
+				t.Errorf("code = %d, expected %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+		})
+	}
+}
+
+// staticTokens authenticates bearer tokens from a map
+type staticTokens map[string]*UserInfo
+
+func (s staticTokens) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	token, ok := bearerToken(req)
+	if !ok {
+		return nil, false, nil
+	}
+	user, ok := s[token]
+	if !ok {
+		return nil, false, ErrInvalidCredentials
+	}
+	return user, true, nil
+}
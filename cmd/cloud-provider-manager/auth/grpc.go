@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+	"net/http"
+)
+
+type grpcContextKey struct{}
+
+type grpcIdentity struct {
+	user  *UserInfo
+	scope *ClusterScope
+}
+
+// grpcRequest presents the metadata and the verified peer certificate of a call
+// as an http request, so the authenticators of the rest api apply unchanged
+func grpcRequest(ctx context.Context) *http.Request {
+	req := &http.Request{Header: http.Header{}}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			req.Header.Add("Authorization", value)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			req.TLS = &info.State
+		}
+	}
+	return req
+}
+
+func authenticateGRPC(ctx context.Context, authenticator Authenticator, authorizer *Authorizer) (context.Context, error) {
+	if authenticator == nil {
+		return context.WithValue(ctx, grpcContextKey{}, &grpcIdentity{user: anonymous, scope: &ClusterScope{All: true}}), nil
+	}
+
+	user, ok, err := authenticator.AuthenticateRequest(grpcRequest(ctx))
+	if err != nil {
+		klog.Warningf("authenticate grpc call fail: %s", err.Error())
+	}
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return context.WithValue(ctx, grpcContextKey{}, &grpcIdentity{user: user, scope: authorizer.Scope(user)}), nil
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// GRPCServerOptions authenticates every call like Middleware does for the rest api
+func GRPCServerOptions(authenticator Authenticator, authorizer *Authorizer) []grpc.ServerOption {
+	if authenticator == nil {
+		klog.Warning("no authenticator configured, the grpc api is open to anonymous users")
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := authenticateGRPC(ctx, authenticator, authorizer)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authenticateGRPC(stream.Context(), authenticator, authorizer)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+		}),
+	}
+}
+
+// verifyGRPC checks the signature of a call over its request message, the
+// metadata carries the signature headers of the rest api
+func (v *signatureVerifier) verifyGRPC(ctx context.Context, fullMethod string, req interface{}) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(header string) string {
+		if values := md.Get(header); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	signed := requestSignature{
+		accessKey: first(signature.HeaderAccessKey),
+		timestamp: first(signature.HeaderTimestamp),
+		nonce:     first(signature.HeaderNonce),
+		signature: first(signature.HeaderSignature),
+	}
+
+	secret, msg := v.secret(signed)
+	if msg == "" {
+		m, ok := req.(proto.Message)
+		if !ok {
+			return status.Errorf(codes.Internal, "grpc call %s has no protobuf request", fullMethod)
+		}
+		stringToSign, err := signature.GRPCStringToSign(fullMethod, signed.timestamp, signed.nonce, m)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		msg = v.check(secret, signed, stringToSign)
+	}
+	if msg != "" {
+		var addr string
+		if p, ok := peer.FromContext(ctx); ok {
+			addr = p.Addr.String()
+		}
+		klog.Warningf("reject grpc call %s from %s: %s", fullMethod, addr, msg)
+		return status.Error(codes.Unauthenticated, msg)
+	}
+	return nil
+}
+
+// signedStream verifies the request message of a server streaming call, the
+// handler receives it before it starts streaming
+type signedStream struct {
+	grpc.ServerStream
+	verifier   *signatureVerifier
+	fullMethod string
+	verified   bool
+}
+
+func (s *signedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.verified {
+		return status.Error(codes.Unimplemented, "signed calls send a single request message")
+	}
+	s.verified = true
+	return s.verifier.verifyGRPC(s.Context(), s.fullMethod, m)
+}
+
+// GRPCSignatureOptions rejects grpc calls without a valid HMAC signature like
+// SignatureMiddleware does for the rest api, see signature.GRPCStringToSign.
+// They go before GRPCServerOptions, so a call is verified before it is
+// authenticated.
+func GRPCSignatureOptions(cfg config.CloudProviderSignatureConfig) ([]grpc.ServerOption, error) {
+	v, err := newSignatureVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := v.verifyGRPC(ctx, info.FullMethod, req); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if info.IsClientStream {
+				return status.Errorf(codes.Unimplemented, "signed calls send a single request message, %s streams them", info.FullMethod)
+			}
+			return handler(srv, &signedStream{ServerStream: stream, verifier: v, fullMethod: info.FullMethod})
+		}),
+	}, nil
+}
+
+// AuthorizeGRPC returns a PermissionDenied status when the caller may not access cluster
+func AuthorizeGRPC(ctx context.Context, cluster string) error {
+	identity, ok := ctx.Value(grpcContextKey{}).(*grpcIdentity)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	if !identity.scope.Allows(cluster) {
+		return status.Errorf(codes.PermissionDenied, "user %s is not allowed to access cluster %s", identity.user.Name, cluster)
+	}
+	return nil
+}
+
+// GRPCUser is the authenticated caller of a grpc call
+func GRPCUser(ctx context.Context) *UserInfo {
+	if identity, ok := ctx.Value(grpcContextKey{}).(*grpcIdentity); ok {
+		return identity.user
+	}
+	return anonymous
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	pb "github.com/YuZongYangHi/cloud-controller-manager/pkg/api/loadbalancer/v1"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type fakeLoadBalancerServer struct {
+	pb.UnimplementedLoadBalancerServiceServer
+}
+
+func (s *fakeLoadBalancerServer) Bind(ctx context.Context, req *pb.BindRequest) (*pb.LoadBalance, error) {
+	return &pb.LoadBalance{Cluster: req.Cluster, Ip: req.Ip}, nil
+}
+
+func (s *fakeLoadBalancerServer) Watch(req *pb.WatchRequest, stream pb.LoadBalancerService_WatchServer) error {
+	return stream.Send(&pb.WatchEvent{Type: "BOOKMARK", ResourceVersion: req.ResourceVersion})
+}
+
+// newSignedGRPCClient serves the fake server behind GRPCSignatureOptions with
+// the access key ak and secret secret
+func newSignedGRPCClient(t *testing.T) pb.LoadBalancerServiceClient {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "signing.yml")
+	if err := os.WriteFile(path, []byte("- accessKeyId: ak\n  secretAccessKey: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := GRPCSignatureOptions(config.CloudProviderSignatureConfig{Enabled: true, CredentialsFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(opts...)
+	pb.RegisterLoadBalancerServiceServer(s, &fakeLoadBalancerServer{})
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewLoadBalancerServiceClient(conn)
+}
+
+// signedContext carries the signature of a call of method over req
+func signedContext(t *testing.T, method string, req proto.Message, secret, nonce string) context.Context {
+	t.Helper()
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	stringToSign, err := signature.GRPCStringToSign("/"+pb.LoadBalancerService_ServiceDesc.ServiceName+"/"+method, timestamp, nonce, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(),
+		signature.HeaderAccessKey, "ak",
+		signature.HeaderTimestamp, timestamp,
+		signature.HeaderNonce, nonce,
+		signature.HeaderSignature, signature.Sign(secret, stringToSign))
+}
+
+func TestGRPCSignatureUnary(t *testing.T) {
+	client := newSignedGRPCClient(t)
+	req := &pb.BindRequest{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "web"}
+
+	steps := []struct {
+		name string
+		ctx  context.Context
+		req  *pb.BindRequest
+		code codes.Code
+	}{
+		{name: "unsigned", ctx: context.Background(), req: req, code: codes.Unauthenticated},
+		{name: "valid", ctx: signedContext(t, "Bind", req, "secret", "n1"), req: req, code: codes.OK},
+		{name: "replay", ctx: signedContext(t, "Bind", req, "secret", "n1"), req: req, code: codes.Unauthenticated},
+		{name: "wrong secret", ctx: signedContext(t, "Bind", req, "guess", "n2"), req: req, code: codes.Unauthenticated},
+		{name: "tampered message", ctx: signedContext(t, "Bind", req, "secret", "n3"), req: &pb.BindRequest{Cluster: "c1", Ip: "10.0.0.2", Namespace: "ns", ServiceName: "web"}, code: codes.Unauthenticated},
+		{name: "signed for another method", ctx: signedContext(t, "Release", req, "secret", "n4"), req: req, code: codes.Unauthenticated},
+	}
+
+	for _, step := range steps {
+		_, err := client.Bind(step.ctx, step.req)
+		if code := status.Code(err); code != step.code {
+			t.Errorf("%s: code = %v (%v), expected %v", step.name, code, err, step.code)
+		}
+	}
+}
+
+func TestGRPCSignatureStream(t *testing.T) {
+	client := newSignedGRPCClient(t)
+	req := &pb.WatchRequest{Cluster: "c1", ResourceVersion: "7"}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{name: "unsigned", ctx: context.Background(), code: codes.Unauthenticated},
+		{name: "valid", ctx: signedContext(t, "Watch", req, "secret", "w1"), code: codes.OK},
+		{name: "wrong secret", ctx: signedContext(t, "Watch", req, "guess", "w2"), code: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.Watch(tt.ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			event, err := stream.Recv()
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v (%v), expected %v", code, err, tt.code)
+			}
+			if tt.code == codes.OK && event.ResourceVersion != "7" {
+				t.Errorf("event = %v", event)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog/v2"
+)
+
+const (
+	userContextKey       = "cloudprovider.auth.user"
+	scopeContextKey      = "cloudprovider.auth.scope"
+	quotaScopeContextKey = "cloudprovider.auth.quotaScope"
+)
+
+var anonymous = &UserInfo{Name: "system:anonymous"}
+
+// NewAuthenticator builds the configured authenticators, nil means authentication is disabled
+func NewAuthenticator(cfg *config.CloudProviderConfig) (Authenticator, error) {
+	var authenticators []Authenticator
+
+	if cfg.HTTP.TLS.ClientCAFile != "" {
+		authenticators = append(authenticators, NewX509Authenticator())
+	}
+
+	if cfg.Auth.TokenFile != "" {
+		a, err := NewTokenFileAuthenticator(cfg.Auth.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+
+	if cfg.Auth.TokenReview.Enabled {
+		a, err := NewTokenReviewAuthenticator(cfg.Auth.TokenReview)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	return NewUnionAuthenticator(authenticators...), nil
+}
+
+func Middleware(authenticator Authenticator, authorizer *Authorizer) gin.HandlerFunc {
+	if authenticator == nil {
+		klog.Warning("no authenticator configured, the api is open to anonymous users")
+		return func(ctx *gin.Context) {
+			ctx.Set(userContextKey, anonymous)
+			ctx.Set(scopeContextKey, &ClusterScope{All: true})
+			ctx.Set(quotaScopeContextKey, &ClusterScope{All: true})
+		}
+	}
+
+	return func(ctx *gin.Context) {
+		user, ok, err := authenticator.AuthenticateRequest(ctx.Request)
+		if err != nil {
+			klog.Warningf("authenticate %s fail: %s", ctx.ClientIP(), err.Error())
+		}
+		if !ok {
+			base.UnauthorizedResponse(ctx, "unauthorized")
+			ctx.Abort()
+			return
+		}
+
+		ctx.Set(userContextKey, user)
+		ctx.Set(scopeContextKey, authorizer.Scope(user))
+		ctx.Set(quotaScopeContextKey, authorizer.QuotaScope(user))
+	}
+}
+
+func User(ctx *gin.Context) *UserInfo {
+	if v, ok := ctx.Get(userContextKey); ok {
+		return v.(*UserInfo)
+	}
+	return anonymous
+}
+
+func Scope(ctx *gin.Context) *ClusterScope {
+	if v, ok := ctx.Get(scopeContextKey); ok {
+		return v.(*ClusterScope)
+	}
+	return &ClusterScope{}
+}
+
+// Authorize writes a forbidden response and returns false when the caller may not access cluster
+func Authorize(ctx *gin.Context, cluster string) bool {
+	if Scope(ctx).Allows(cluster) {
+		return true
+	}
+	base.ForbiddenResponse(ctx, "user "+User(ctx).Name+" is not allowed to access cluster "+cluster)
+	return false
+}
+
+// AuthorizeQuota writes a forbidden response and returns false when the caller may not change the quotas of cluster
+func AuthorizeQuota(ctx *gin.Context, cluster string) bool {
+	if v, ok := ctx.Get(quotaScopeContextKey); ok && v.(*ClusterScope).Allows(cluster) {
+		return true
+	}
+	base.ForbiddenResponse(ctx, "user "+User(ctx).Name+" is not allowed to change the quotas of cluster "+cluster)
+	return false
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"k8s.io/klog/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxClockSkew = 5 * time.Minute
+	maxSignedBodyBytes  = 1 << 20
+
+	msgBodyTooLarge = "request body too large"
+)
+
+// signedBodyLimit is the largest body read to verify the signature of req, an
+// inventory import is read up to the limit of its handler
+func signedBodyLimit(req *http.Request) int64 {
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/loadbalance/import") {
+		return base.MaxImportBodyBytes
+	}
+	return maxSignedBodyBytes
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// nonceCache remembers nonces for twice the allowed clock skew, older requests
+// are rejected by their timestamp anyway. Every nonce lives for the same window,
+// so the queue is ordered by expiry and add only looks at its expired head.
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[string]struct{}
+	queue  []nonceEntry
+	window time.Duration
+}
+
+func newNonceCache(window time.Duration) *nonceCache {
+	return &nonceCache{seen: map[string]struct{}{}, window: window}
+}
+
+func (c *nonceCache) add(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for len(c.queue) > 0 && now.After(c.queue[0].expires) {
+		delete(c.seen, c.queue[0].nonce)
+		c.queue[0] = nonceEntry{}
+		c.queue = c.queue[1:]
+	}
+
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	c.seen[nonce] = struct{}{}
+	c.queue = append(c.queue, nonceEntry{nonce: nonce, expires: now.Add(c.window)})
+	return true
+}
+
+type signatureVerifier struct {
+	secrets map[string]string
+	skew    time.Duration
+	nonces  *nonceCache
+}
+
+func loadSigningSecrets(file string) (map[string]string, error) {
+	var list []signature.Credentials
+	if file != "" {
+		if err := parsers.ParserConfigurationByFile(parsers.YAML, file, &list); err != nil {
+			return nil, err
+		}
+	} else {
+		creds, err := signature.LoadCredentials("")
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *creds)
+	}
+
+	secrets := make(map[string]string, len(list))
+	for _, creds := range list {
+		secrets[creds.AccessKeyId] = creds.SecretAccessKey
+	}
+	return secrets, nil
+}
+
+func newSignatureVerifier(cfg config.CloudProviderSignatureConfig) (*signatureVerifier, error) {
+	secrets, err := loadSigningSecrets(cfg.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	skew := cfg.MaxClockSkew
+	if skew <= 0 {
+		skew = defaultMaxClockSkew
+	}
+
+	return &signatureVerifier{
+		secrets: secrets,
+		skew:    skew,
+		nonces:  newNonceCache(2 * skew),
+	}, nil
+}
+
+// SignatureMiddleware rejects requests without a valid HMAC signature, see
+// pkg/util/signature for the canonical request format
+func SignatureMiddleware(cfg config.CloudProviderSignatureConfig) (gin.HandlerFunc, error) {
+	v, err := newSignatureVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return v.handle, nil
+}
+
+func (v *signatureVerifier) handle(ctx *gin.Context) {
+	msg := v.verify(ctx.Request)
+	if msg == "" {
+		return
+	}
+	klog.Warningf("reject request from %s: %s", ctx.ClientIP(), msg)
+	if msg == msgBodyTooLarge {
+		base.RequestEntityTooLargeResponse(ctx, msg)
+	} else {
+		base.UnauthorizedResponse(ctx, msg)
+	}
+	ctx.Abort()
+}
+
+// requestSignature is the signature of a request, sent as headers or grpc metadata
+type requestSignature struct {
+	accessKey string
+	timestamp string
+	nonce     string
+	signature string
+}
+
+func (v *signatureVerifier) verify(req *http.Request) string {
+	signed := requestSignature{
+		accessKey: req.Header.Get(signature.HeaderAccessKey),
+		timestamp: req.Header.Get(signature.HeaderTimestamp),
+		nonce:     req.Header.Get(signature.HeaderNonce),
+		signature: req.Header.Get(signature.HeaderSignature),
+	}
+	secret, msg := v.secret(signed)
+	if msg != "" {
+		return msg
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, signedBodyLimit(req)))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return msgBodyTooLarge
+		}
+		if err != nil {
+			return "read request body fail"
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	stringToSign := signature.StringToSign(req.Method, req.URL.EscapedPath(), req.URL.Query().Encode(), signed.timestamp, signed.nonce, body)
+	return v.check(secret, signed, stringToSign)
+}
+
+// secret checks the signature fields are present and fresh, it returns the
+// secret of the access key
+func (v *signatureVerifier) secret(signed requestSignature) (string, string) {
+	if signed.accessKey == "" || signed.timestamp == "" || signed.nonce == "" || signed.signature == "" {
+		return "", "missing request signature"
+	}
+
+	secret, ok := v.secrets[signed.accessKey]
+	if !ok {
+		return "", "unknown access key"
+	}
+
+	unix, err := strconv.ParseInt(signed.timestamp, 10, 64)
+	if err != nil {
+		return "", "invalid signature timestamp"
+	}
+	if d := time.Since(time.Unix(unix, 0)); d > v.skew || d < -v.skew {
+		return "", "signature timestamp outside the allowed clock skew"
+	}
+	return secret, ""
+}
+
+// check verifies the signature over the canonical request and burns its nonce
+func (v *signatureVerifier) check(secret string, signed requestSignature, stringToSign string) string {
+	if err := signature.Verify(secret, stringToSign, signed.signature); err != nil {
+		return err.Error()
+	}
+
+	// only remember nonces of valid signatures, otherwise anyone could burn them
+	if !v.nonces.add(signed.accessKey + "/" + signed.nonce) {
+		return "replayed request nonce"
+	}
+	return ""
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"bytes"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest is signed with secret at time now, edit changes it after signing
+func signedRequest(method, target, body, accessKey, secret, nonce string, now time.Time, edit func(req *http.Request)) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader([]byte(body)))
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	stringToSign := signature.StringToSign(method, req.URL.EscapedPath(), req.URL.Query().Encode(), timestamp, nonce, []byte(body))
+
+	req.Header.Set(signature.HeaderAccessKey, accessKey)
+	req.Header.Set(signature.HeaderTimestamp, timestamp)
+	req.Header.Set(signature.HeaderNonce, nonce)
+	req.Header.Set(signature.HeaderSignature, signature.Sign(secret, stringToSign))
+	if edit != nil {
+		edit(req)
+	}
+	return req
+}
+
+func TestSignatureVerify(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		msg  string
+	}{
+		{
+			name: "valid",
+			req: func() *http.Request {
+				return signedRequest("POST", "/loadbalance/bind?cluster=c1", `{"ip":"10.0.0.1"}`, "ak", "secret", "n1", now, nil)
+			},
+		},
+		{
+			name: "query order does not matter",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list?status=0&cluster=c1", "", "ak", "secret", "n2", now, func(req *http.Request) {
+					req.URL.RawQuery = "cluster=c1&status=0"
+				})
+			},
+		},
+		{
+			name: "missing headers",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n3", now, func(req *http.Request) {
+					req.Header.Del(signature.HeaderNonce)
+				})
+			},
+			msg: "missing request signature",
+		},
+		{
+			name: "unknown access key",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list", "", "other", "secret", "n4", now, nil)
+			},
+			msg: "unknown access key",
+		},
+		{
+			name: "wrong secret",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list", "", "ak", "guess", "n5", now, nil)
+			},
+			msg: "signature mismatch",
+		},
+		{
+			name: "malformed signature",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n6", now, func(req *http.Request) {
+					req.Header.Set(signature.HeaderSignature, "zz")
+				})
+			},
+			msg: "malformed signature",
+		},
+		{
+			name: "invalid timestamp",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n7", now, func(req *http.Request) {
+					req.Header.Set(signature.HeaderTimestamp, "yesterday")
+				})
+			},
+			msg: "invalid signature timestamp",
+		},
+		{
+			name: "too old",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n8", now.Add(-6*time.Minute), nil)
+			},
+			msg: "signature timestamp outside the allowed clock skew",
+		},
+		{
+			name: "from the future",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n9", now.Add(6*time.Minute), nil)
+			},
+			msg: "signature timestamp outside the allowed clock skew",
+		},
+		{
+			name: "tampered body",
+			req: func() *http.Request {
+				return signedRequest("POST", "/loadbalance/bind", `{"ip":"10.0.0.1"}`, "ak", "secret", "n10", now, func(req *http.Request) {
+					req.Body = io.NopCloser(bytes.NewReader([]byte(`{"ip":"10.0.0.2"}`)))
+				})
+			},
+			msg: "signature mismatch",
+		},
+		{
+			name: "tampered query",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list?cluster=c1", "", "ak", "secret", "n11", now, func(req *http.Request) {
+					req.URL.RawQuery = "cluster=c2"
+				})
+			},
+			msg: "signature mismatch",
+		},
+		{
+			name: "tampered method",
+			req: func() *http.Request {
+				return signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n12", now, func(req *http.Request) {
+					req.Method = "DELETE"
+				})
+			},
+			msg: "signature mismatch",
+		},
+		{
+			name: "body too large",
+			req: func() *http.Request {
+				return signedRequest("POST", "/loadbalance/bind", strings.Repeat(" ", maxSignedBodyBytes+1), "ak", "secret", "n13", now, nil)
+			},
+			msg: msgBodyTooLarge,
+		},
+		{
+			name: "import larger than other bodies",
+			req: func() *http.Request {
+				return signedRequest("POST", "/api/v1/cloudprovider/loadbalance/import", strings.Repeat(" ", 2*maxSignedBodyBytes), "ak", "secret", "n14", now, nil)
+			},
+		},
+		{
+			name: "import too large",
+			req: func() *http.Request {
+				return signedRequest("POST", "/api/v1/cloudprovider/loadbalance/import", strings.Repeat(" ", base.MaxImportBodyBytes+1), "ak", "secret", "n15", now, nil)
+			},
+			msg: msgBodyTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &signatureVerifier{secrets: map[string]string{"ak": "secret"}, skew: defaultMaxClockSkew, nonces: newNonceCache(2 * defaultMaxClockSkew)}
+			req := tt.req()
+			if msg := v.verify(req); msg != tt.msg {
+				t.Fatalf("verify = %q, expected %q", msg, tt.msg)
+			}
+
+			// the handler still reads the body the signature covered
+			if tt.msg == "" && req.Body != nil {
+				if _, err := io.ReadAll(req.Body); err != nil {
+					t.Errorf("read body after verify: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSignatureReplay(t *testing.T) {
+	v := &signatureVerifier{secrets: map[string]string{"ak": "secret", "ak2": "secret2"}, skew: defaultMaxClockSkew, nonces: newNonceCache(2 * defaultMaxClockSkew)}
+	now := time.Now()
+
+	steps := []struct {
+		name string
+		req  *http.Request
+		msg  string
+	}{
+		{name: "first use", req: signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n1", now, nil)},
+		{name: "replay", req: signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n1", now, nil), msg: "replayed request nonce"},
+		{name: "nonce of another key", req: signedRequest("GET", "/loadbalance/list", "", "ak2", "secret2", "n1", now, nil)},
+		{name: "forged request does not burn a nonce", req: signedRequest("GET", "/loadbalance/list", "", "ak", "guess", "n2", now, nil), msg: "signature mismatch"},
+		{name: "nonce of the forged request", req: signedRequest("GET", "/loadbalance/list", "", "ak", "secret", "n2", now, nil)},
+	}
+
+	for _, step := range steps {
+		if msg := v.verify(step.req); msg != step.msg {
+			t.Errorf("%s: verify = %q, expected %q", step.name, msg, step.msg)
+		}
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	c := newNonceCache(time.Minute)
+	for _, nonce := range []string{"a", "b", "c"} {
+		if !c.add(nonce) {
+			t.Fatalf("add(%s) rejected a new nonce", nonce)
+		}
+	}
+	if c.add("b") {
+		t.Fatal("add(b) accepted a replayed nonce")
+	}
+
+	// a and b expire, c is still within the window
+	c.queue[0].expires = time.Now().Add(-time.Second)
+	c.queue[1].expires = time.Now().Add(-time.Second)
+
+	if !c.add("d") {
+		t.Fatal("add(d) rejected a new nonce")
+	}
+	if len(c.seen) != 2 || len(c.queue) != 2 {
+		t.Errorf("seen %d, queue %d after expiry, expected 2 and 2", len(c.seen), len(c.queue))
+	}
+	if !c.add("a") {
+		t.Error("add(a) rejected an expired nonce")
+	}
+	if c.add("c") {
+		t.Error("add(c) accepted a nonce within the window")
+	}
+}
+
+func TestLoadSigningSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.yml")
+	content := "- accessKeyId: ak1\n  secretAccessKey: s1\n- accessKeyId: ak2\n  secretAccessKey: s2\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	middleware, err := SignatureMiddleware(config.CloudProviderSignatureConfig{Enabled: true, CredentialsFile: path})
+	if err != nil || middleware == nil {
+		t.Fatalf("SignatureMiddleware: %v", err)
+	}
+
+	secrets, err := loadSigningSecrets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 2 || secrets["ak1"] != "s1" || secrets["ak2"] != "s2" {
+		t.Errorf("secrets = %v", secrets)
+	}
+
+	t.Setenv(signature.EnvAccessKeyId, "")
+	t.Setenv(signature.EnvSecretAccessKey, "")
+	if _, err = loadSigningSecrets(""); err == nil {
+		t.Error("expected an error without credentials file and environment")
+	}
+}
+
+func TestSignatureMiddlewareTooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	v := &signatureVerifier{secrets: map[string]string{"ak": "secret"}, skew: defaultMaxClockSkew, nonces: newNonceCache(2 * defaultMaxClockSkew)}
+	router := gin.New()
+	router.Use(v.handle)
+	router.POST("/loadbalance/bind", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		code int
+	}{
+		{name: "too large", req: signedRequest("POST", "/loadbalance/bind", strings.Repeat(" ", maxSignedBodyBytes+1), "ak", "secret", "n1", time.Now(), nil), code: http.StatusRequestEntityTooLarge},
+		{name: "unsigned", req: httptest.NewRequest("POST", "/loadbalance/bind", strings.NewReader("{}")), code: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, tt.req)
+			if rec.Code != tt.code {
+				t.Errorf("code = %d, expected %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type tokenAuthenticator struct {
+	tokens map[string]*UserInfo
+}
+
+// NewTokenFileAuthenticator reads a static token file in the kube-apiserver
+// format: token,user,uid,"group1,group2"
+func NewTokenFileAuthenticator(path string) (Authenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	tokens := map[string]*UserInfo{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 3 {
+			return nil, fmt.Errorf("token file %s line %d: expected token,user,uid", path, line)
+		}
+
+		token := strings.TrimSpace(record[0])
+		if token == "" {
+			return nil, fmt.Errorf("token file %s line %d: empty token", path, line)
+		}
+		if _, ok := tokens[token]; ok {
+			return nil, fmt.Errorf("token file %s line %d: duplicate token", path, line)
+		}
+
+		user := &UserInfo{Name: strings.TrimSpace(record[1]), UID: strings.TrimSpace(record[2])}
+		if len(record) > 3 {
+			for _, group := range strings.Split(record[3], ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					user.Groups = append(user.Groups, group)
+				}
+			}
+		}
+		tokens[token] = user
+	}
+
+	return &tokenAuthenticator{tokens: tokens}, nil
+}
+
+func (a *tokenAuthenticator) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	token, ok := bearerToken(req)
+	if !ok {
+		return nil, false, nil
+	}
+
+	for known, user := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			return user, true, nil
+		}
+	}
+	return nil, false, nil
+}
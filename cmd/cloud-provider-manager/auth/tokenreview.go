@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultTokenReviewCacheTTL = 2 * time.Minute
+
+type tokenReviewResult struct {
+	user    *UserInfo
+	err     error
+	expires time.Time
+}
+
+type tokenReviewAuthenticator struct {
+	kubeClient kubernetes.Interface
+	audiences  []string
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*tokenReviewResult
+}
+
+// NewTokenReviewAuthenticator validates bearer tokens, typically service account
+// tokens of the loadbalance-controller, with the kubernetes TokenReview api.
+func NewTokenReviewAuthenticator(cfg config.CloudProviderTokenReviewConfig) (Authenticator, error) {
+	// a bare number is read as nanoseconds, this catches cacheTTL: 120
+	if cfg.CacheTTL > 0 && cfg.CacheTTL < time.Second {
+		return nil, fmt.Errorf("tokenReview cacheTTL %s is below one second, it is a duration such as 2m", cfg.CacheTTL)
+	}
+
+	var restConfig *rest.Config
+	var err error
+
+	if cfg.KubeConfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", cfg.KubeConfig)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTokenReviewAuthenticator(kubeClient, cfg), nil
+}
+
+func newTokenReviewAuthenticator(kubeClient kubernetes.Interface, cfg config.CloudProviderTokenReviewConfig) *tokenReviewAuthenticator {
+	ttl := defaultTokenReviewCacheTTL
+	if cfg.CacheTTL > 0 {
+		ttl = cfg.CacheTTL
+	}
+
+	return &tokenReviewAuthenticator{
+		kubeClient: kubeClient,
+		audiences:  cfg.Audiences,
+		ttl:        ttl,
+		cache:      map[string]*tokenReviewResult{},
+	}
+}
+
+func (a *tokenReviewAuthenticator) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	token, ok := bearerToken(req)
+	if !ok {
+		return nil, false, nil
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.user, cached.err == nil, cached.err
+	}
+
+	user, err := a.review(req.Context(), token)
+	if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+		// do not cache errors talking to the apiserver
+		return nil, false, err
+	}
+
+	a.mu.Lock()
+	now := time.Now()
+	for k, v := range a.cache {
+		if now.After(v.expires) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = &tokenReviewResult{user: user, err: err, expires: now.Add(a.ttl)}
+	a.mu.Unlock()
+
+	return user, err == nil, err
+}
+
+func (a *tokenReviewAuthenticator) review(ctx context.Context, token string) (*UserInfo, error) {
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: a.audiences,
+		},
+	}
+
+	result, err := a.kubeClient.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.Status.Authenticated {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &UserInfo{
+		Name:   result.Status.User.Username,
+		UID:    result.Status.User.UID,
+		Groups: result.Status.User.Groups,
+	}, nil
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTokenReviews serves the TokenReview api, tokens maps a token to its user,
+// unknown tokens are not authenticated
+func fakeTokenReviews(t *testing.T, tokens map[string]authenticationv1.UserInfo, reviews *int32) kubernetes.Interface {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authentication.k8s.io/v1/tokenreviews" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(reviews, 1)
+
+		review := &authenticationv1.TokenReview{}
+		if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if review.Spec.Token == "broken" {
+			http.Error(w, "apiserver unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if user, ok := tokens[review.Spec.Token]; ok {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: user}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	}))
+	t.Cleanup(server.Close)
+
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kubeClient
+}
+
+func TestTokenReviewAuthenticator(t *testing.T) {
+	var reviews int32
+	kubeClient := fakeTokenReviews(t, map[string]authenticationv1.UserInfo{
+		"sa-token": {Username: "system:serviceaccount:kube-system:loadbalance-controller", UID: "u1", Groups: []string{"system:serviceaccounts"}},
+	}, &reviews)
+	a := newTokenReviewAuthenticator(kubeClient, config.CloudProviderTokenReviewConfig{})
+
+	tests := []struct {
+		name    string
+		header  string
+		user    *UserInfo
+		ok      bool
+		err     error
+		failed  bool
+		reviews int32
+	}{
+		{name: "no token", reviews: 0},
+		{
+			name:    "valid token",
+			header:  "Bearer sa-token",
+			user:    &UserInfo{Name: "system:serviceaccount:kube-system:loadbalance-controller", UID: "u1", Groups: []string{"system:serviceaccounts"}},
+			ok:      true,
+			reviews: 1,
+		},
+		{
+			name:    "valid token is cached",
+			header:  "Bearer sa-token",
+			user:    &UserInfo{Name: "system:serviceaccount:kube-system:loadbalance-controller", UID: "u1", Groups: []string{"system:serviceaccounts"}},
+			ok:      true,
+			reviews: 0,
+		},
+		{name: "invalid token", header: "Bearer forged", err: ErrInvalidCredentials, reviews: 1},
+		{name: "invalid token is cached", header: "Bearer forged", err: ErrInvalidCredentials, reviews: 0},
+		{name: "apiserver error", header: "Bearer broken", failed: true, reviews: 1},
+		{name: "apiserver error is not cached", header: "Bearer broken", failed: true, reviews: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := atomic.LoadInt32(&reviews)
+			user, ok, err := a.AuthenticateRequest(requestWithToken(tt.header))
+
+			if !reflect.DeepEqual(user, tt.user) || ok != tt.ok {
+				t.Errorf("got %+v, %v, expected %+v, %v", user, ok, tt.user, tt.ok)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, expected %v", err, tt.err)
+			}
+			if tt.failed && (err == nil || errors.Is(err, ErrInvalidCredentials)) {
+				t.Errorf("err = %v, expected the apiserver error", err)
+			}
+			if tt.err == nil && !tt.failed && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := atomic.LoadInt32(&reviews) - before; got != tt.reviews {
+				t.Errorf("reviews = %d, expected %d", got, tt.reviews)
+			}
+		})
+	}
+}
+
+func TestTokenReviewCacheExpires(t *testing.T) {
+	var reviews int32
+	kubeClient := fakeTokenReviews(t, map[string]authenticationv1.UserInfo{"sa-token": {Username: "controller"}}, &reviews)
+	a := newTokenReviewAuthenticator(kubeClient, config.CloudProviderTokenReviewConfig{CacheTTL: time.Second})
+
+	for i := 0; i < 2; i++ {
+		if _, ok, err := a.AuthenticateRequest(requestWithToken("Bearer sa-token")); !ok || err != nil {
+			t.Fatalf("authenticate: %v, %v", ok, err)
+		}
+	}
+	if reviews != 1 {
+		t.Fatalf("reviews = %d before expiry, expected 1", reviews)
+	}
+
+	a.mu.Lock()
+	for _, cached := range a.cache {
+		cached.expires = time.Now().Add(-time.Millisecond)
+	}
+	a.mu.Unlock()
+
+	if _, ok, err := a.AuthenticateRequest(requestWithToken("Bearer sa-token")); !ok || err != nil {
+		t.Fatalf("authenticate: %v, %v", ok, err)
+	}
+	if reviews != 2 {
+		t.Errorf("reviews = %d after expiry, expected 2", reviews)
+	}
+}
+
+func TestTokenReviewCacheTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		err  string
+	}{
+		{name: "seconds written as a number", ttl: 120, err: "it is a duration such as 2m"},
+		{name: "sub second", ttl: 500 * time.Millisecond, err: "below one second"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTokenReviewAuthenticator(config.CloudProviderTokenReviewConfig{Enabled: true, CacheTTL: tt.ttl})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	defaults := newTokenReviewAuthenticator(nil, config.CloudProviderTokenReviewConfig{})
+	if defaults.ttl != defaultTokenReviewCacheTTL {
+		t.Errorf("default ttl = %s, expected %s", defaults.ttl, defaultTokenReviewCacheTTL)
+	}
+	configured := newTokenReviewAuthenticator(nil, config.CloudProviderTokenReviewConfig{CacheTTL: 5 * time.Minute})
+	if configured.ttl != 5*time.Minute {
+		t.Errorf("configured ttl = %s, expected 5m", configured.ttl)
+	}
+}
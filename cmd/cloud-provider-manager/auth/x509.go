@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"net/http"
+)
+
+type x509Authenticator struct{}
+
+// NewX509Authenticator trusts client certificates already verified by the tls
+// listener, the common name is the user and the organizations are the groups.
+func NewX509Authenticator() Authenticator {
+	return &x509Authenticator{}
+}
+
+func (a *x509Authenticator) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, false, nil
+	}
+
+	cert := req.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName == "" {
+		return nil, false, ErrInvalidCredentials
+	}
+
+	return &UserInfo{
+		Name:   cert.Subject.CommonName,
+		UID:    cert.SerialNumber.String(),
+		Groups: cert.Subject.Organization,
+	}, true, nil
+}
@@ -2,26 +2,85 @@ package base
 
 import "github.com/gin-gonic/gin"
 
+// Reasons tell apart errors sharing an http status, clients match them instead of the message
+const (
+	ReasonBadRequest    = "BadRequest"
+	ReasonInvalid       = "Invalid"
+	ReasonUnauthorized  = "Unauthorized"
+	ReasonForbidden     = "Forbidden"
+	ReasonNotFound      = "NotFound"
+	ReasonConflict      = "Conflict"
+	ReasonAlreadyBound  = "AlreadyBound"
+	ReasonPoolExhausted = "PoolExhausted"
+	ReasonQuarantined   = "Quarantined"
+	ReasonQuotaExceeded = "QuotaExceeded"
+	ReasonReserved      = "Reserved"
+	ReasonExpired       = "Expired"
+	ReasonTooLarge      = "TooLarge"
+	ReasonInternalError = "InternalError"
+)
+
+// MaxImportBodyBytes limits the inventory document of an import, it is read
+// whole before anything is checked. 32MiB holds an export of some hundred
+// thousand addresses.
+const MaxImportBodyBytes = 32 << 20
+
 type Response struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
+	Reason  string      `json:"reason,omitempty"`
 	Data    interface{} `json:"data"`
 }
 
-func BadRequestResponse(ctx *gin.Context, msg string) {
-	ctx.JSON(400, Response{
-		Code:    400,
+func ErrorResponse(ctx *gin.Context, code int, reason, msg string) {
+	ErrorDataResponse(ctx, code, reason, msg, nil)
+}
+
+// ErrorDataResponse carries data explaining the error, e.g. every invalid entry of a request
+func ErrorDataResponse(ctx *gin.Context, code int, reason, msg string, data interface{}) {
+	ctx.JSON(code, Response{
+		Code:    code,
 		Message: msg,
-		Data:    nil,
+		Reason:  reason,
+		Data:    data,
 	})
 }
 
+func BadRequestResponse(ctx *gin.Context, msg string) {
+	ErrorResponse(ctx, 400, ReasonBadRequest, msg)
+}
+
+func UnauthorizedResponse(ctx *gin.Context, msg string) {
+	ErrorResponse(ctx, 401, ReasonUnauthorized, msg)
+}
+
+func ForbiddenResponse(ctx *gin.Context, msg string) {
+	ErrorResponse(ctx, 403, ReasonForbidden, msg)
+}
+
+func NotFoundResponse(ctx *gin.Context, msg string) {
+	ErrorResponse(ctx, 404, ReasonNotFound, msg)
+}
+
+func ConflictResponse(ctx *gin.Context, reason, msg string) {
+	ErrorResponse(ctx, 409, reason, msg)
+}
+
+func GoneResponse(ctx *gin.Context, msg string) {
+	ErrorResponse(ctx, 410, ReasonExpired, msg)
+}
+
+func RequestEntityTooLargeResponse(ctx *gin.Context, msg string) {
+	ErrorResponse(ctx, 413, ReasonTooLarge, msg)
+}
+
+// UnprocessableEntityResponse is for a well formed request with invalid fields
+func UnprocessableEntityResponse(ctx *gin.Context, msg string) {
+	ErrorResponse(ctx, 422, ReasonInvalid, msg)
+}
+
 func ServerErrorResponse(ctx *gin.Context, msg string) {
-	ctx.JSON(500, Response{
-		Code:    500,
-		Message: msg,
-		Data:    nil,
-	})
+	ErrorResponse(ctx, 500, ReasonInternalError, msg)
 }
 
 func SuccessResponse(ctx *gin.Context, data interface{}) {
@@ -0,0 +1,132 @@
+package loadbalance
+
+import (
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const maxBatchItems = 1000
+
+// BatchRequest applies to a single cluster, the cluster of the items is ignored
+type BatchRequest struct {
+	Cluster string               `json:"cluster"`
+	Items   []models.LoadBalance `json:"items"`
+}
+
+// BatchItemResult carries the http status the item would have got from the single item endpoint
+type BatchItemResult struct {
+	Ip          string `json:"ip"`
+	Namespace   string `json:"namespace"`
+	ServiceName string `json:"serviceName"`
+	Code        int    `json:"code"`
+	Reason      string `json:"reason,omitempty"`
+	Message     string `json:"message"`
+}
+
+type BatchResult struct {
+	Items []BatchItemResult `json:"items"`
+}
+
+// Batch serves POST /bind:batch and /unbind:batch, gin can not route a literal
+// colon inside a path segment so both share a parameter route
+func Batch(ctx *gin.Context) {
+	caller := actor(ctx)
+	switch ctx.Param("action") {
+	case "bind:batch":
+		batch(ctx, Valid, func(m *models.LoadBalance) error {
+			_, err := models.LoadBalanceModel.Bind(m, caller)
+			return err
+		})
+	case "unbind:batch":
+		batch(ctx, func(m *models.LoadBalance) bool {
+			return m.Namespace != "" && m.ServiceName != ""
+		}, func(m *models.LoadBalance) error {
+			return models.LoadBalanceModel.Released(m, caller)
+		})
+	default:
+		base.NotFoundResponse(ctx, fmt.Sprintf("unknown action %q", ctx.Param("action")))
+	}
+}
+
+func batch(ctx *gin.Context, valid func(m *models.LoadBalance) bool, apply func(m *models.LoadBalance) error) {
+	var req BatchRequest
+
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	if req.Cluster == "" {
+		base.BadRequestResponse(ctx, "cluster is required")
+		return
+	}
+
+	if len(req.Items) > maxBatchItems {
+		base.BadRequestResponse(ctx, fmt.Sprintf("at most %d items per batch", maxBatchItems))
+		return
+	}
+
+	if !auth.Authorize(ctx, req.Cluster) {
+		return
+	}
+
+	result := &BatchResult{Items: make([]BatchItemResult, 0, len(req.Items))}
+	for i := range req.Items {
+		m := &req.Items[i]
+		m.Cluster = req.Cluster
+
+		item := BatchItemResult{Ip: m.Ip, Namespace: m.Namespace, ServiceName: m.ServiceName, Code: http.StatusOK}
+		if !valid(m) {
+			item.Code, item.Message = http.StatusBadRequest, "invalid params"
+		} else if err = apply(m); err != nil {
+			item.Code, item.Reason = errorStatus(err)
+			item.Message = err.Error()
+		}
+		result.Items = append(result.Items, item)
+	}
+
+	base.SuccessResponse(ctx, result)
+}
+
+// Bindings lists every bound ip of a cluster in one response
+func Bindings(ctx *gin.Context) {
+	cluster := ctx.Query("cluster")
+	if cluster == "" {
+		base.BadRequestResponse(ctx, "cluster is required")
+		return
+	}
+
+	listBindings(ctx, cluster)
+}
+
+func listBindings(ctx *gin.Context, cluster string) {
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	status := models.LoadBalanceStatusBound
+	opts := &models.LoadBalanceListOptions{
+		Cluster:   cluster,
+		Status:    &status,
+		Namespace: ctx.Query("namespace"),
+		Limit:     -1,
+	}
+
+	resourceVersion := watch.Default.ResourceVersion()
+	items, total, err := models.LoadBalanceModel.List(opts)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+
+	if items == nil {
+		items = []models.LoadBalance{}
+	}
+	base.SuccessResponse(ctx, &ListResult{Items: items, Total: total, ResourceVersion: resourceVersion})
+}
@@ -0,0 +1,165 @@
+package loadbalance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   int
+		reason string
+	}{
+		{err: models.ErrNotFound, code: http.StatusNotFound, reason: base.ReasonNotFound},
+		{err: models.ErrAlreadyBound, code: http.StatusConflict, reason: base.ReasonAlreadyBound},
+		{err: models.ErrPoolExhausted, code: http.StatusConflict, reason: base.ReasonPoolExhausted},
+		{err: models.ErrQuarantined, code: http.StatusConflict, reason: base.ReasonQuarantined},
+		{err: models.ErrQuotaExceeded, code: http.StatusConflict, reason: base.ReasonQuotaExceeded},
+		{err: models.ErrReserved, code: http.StatusConflict, reason: base.ReasonReserved},
+		{err: models.ErrNotQuarantined, code: http.StatusConflict, reason: base.ReasonConflict},
+		{err: errors.New("connection reset"), code: http.StatusInternalServerError, reason: base.ReasonInternalError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			// the models wrap their errors with the ip and the service
+			err := fmt.Errorf("10.0.0.1 of ns/svc: %w", tt.err)
+			if code, reason := errorStatus(err); code != tt.code || reason != tt.reason {
+				t.Errorf("errorStatus = %d %s, expected %d %s", code, reason, tt.code, tt.reason)
+			}
+
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			errorResponse(ctx, err)
+			if ctx.Writer.Status() != tt.code {
+				t.Errorf("errorResponse status = %d, expected %d", ctx.Writer.Status(), tt.code)
+			}
+		})
+	}
+}
+
+// serveBatch runs batch for body as a caller allowed to access c1
+func serveBatch(t *testing.T, body string, apply func(m *models.LoadBalance) error) (int, *base.Response) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(auth.Middleware(
+		auth.NewUnionAuthenticator(staticUser{Name: "controller"}),
+		auth.NewAuthorizer([]config.CloudProviderAuthorizationRule{{User: "controller", Clusters: []string{"c1"}}}, nil),
+	))
+	router.POST("/batch", func(ctx *gin.Context) {
+		batch(ctx, Valid, apply)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+
+	response := &base.Response{Data: &BatchResult{}}
+	if err := json.Unmarshal(rec.Body.Bytes(), response); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	return rec.Code, response
+}
+
+type staticUser auth.UserInfo
+
+func (u staticUser) AuthenticateRequest(req *http.Request) (*auth.UserInfo, bool, error) {
+	user := auth.UserInfo(u)
+	return &user, true, nil
+}
+
+func TestBatchItemResults(t *testing.T) {
+	errs := map[string]error{
+		"10.0.0.2": fmt.Errorf("bind 10.0.0.2: %w", models.ErrAlreadyBound),
+		"10.0.0.3": models.ErrPoolExhausted,
+		"10.0.0.4": models.ErrQuotaExceeded,
+		"10.0.0.5": models.ErrNotFound,
+		"10.0.0.6": errors.New("deadlock"),
+	}
+	var applied []string
+	apply := func(m *models.LoadBalance) error {
+		if m.Cluster != "c1" {
+			t.Errorf("item of cluster %q, expected the cluster of the batch", m.Cluster)
+		}
+		applied = append(applied, m.Ip)
+		return errs[m.Ip]
+	}
+
+	items := []string{`{"ip":"10.0.0.1","namespace":"ns","serviceName":"a","cluster":"c2"}`}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"} {
+		items = append(items, `{"ip":"`+ip+`","namespace":"ns","serviceName":"a"}`)
+	}
+	items = append(items, `{"ip":"10.0.0.7"}`)
+
+	code, response := serveBatch(t, `{"cluster":"c1","items":[`+strings.Join(items, ",")+`]}`, apply)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d: %s", code, response.Message)
+	}
+
+	result := response.Data.(*BatchResult)
+	type outcome struct {
+		Code   int
+		Reason string
+	}
+	var got []outcome
+	for _, item := range result.Items {
+		got = append(got, outcome{item.Code, item.Reason})
+	}
+	expected := []outcome{
+		{http.StatusOK, ""},
+		{http.StatusConflict, base.ReasonAlreadyBound},
+		{http.StatusConflict, base.ReasonPoolExhausted},
+		{http.StatusConflict, base.ReasonQuotaExceeded},
+		{http.StatusNotFound, base.ReasonNotFound},
+		{http.StatusInternalServerError, base.ReasonInternalError},
+		{http.StatusBadRequest, ""},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("results = %v, expected %v", got, expected)
+	}
+	if len(applied) != 6 {
+		t.Errorf("applied %v, expected every valid item", applied)
+	}
+}
+
+func TestBatchRequestErrors(t *testing.T) {
+	tooMany := make([]string, maxBatchItems+1)
+	for i := range tooMany {
+		tooMany[i] = `{}`
+	}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "not json", body: "items", code: http.StatusBadRequest},
+		{name: "no cluster", body: `{"items":[]}`, code: http.StatusBadRequest},
+		{name: "too many items", body: `{"cluster":"c1","items":[` + strings.Join(tooMany, ",") + `]}`, code: http.StatusBadRequest},
+		{name: "cluster out of scope", body: `{"cluster":"c2","items":[]}`, code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := serveBatch(t, tt.body, func(m *models.LoadBalance) error {
+				t.Error("apply called for a rejected batch")
+				return nil
+			})
+			if code != tt.code {
+				t.Errorf("status = %d, expected %d", code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package loadbalance
+
+import (
+	"context"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
+	pb "github.com/YuZongYangHi/cloud-controller-manager/pkg/api/loadbalancer/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// GRPCServer serves LoadBalancerService from the same models as the rest handlers
+type GRPCServer struct {
+	pb.UnimplementedLoadBalancerServiceServer
+}
+
+func NewGRPCServer() *GRPCServer {
+	return &GRPCServer{}
+}
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrAlreadyBound):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, models.ErrQuarantined):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, models.ErrReserved):
+		return reasonError(codes.FailedPrecondition, base.ReasonReserved, err)
+	case errors.Is(err, models.ErrPoolExhausted):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, models.ErrQuotaExceeded):
+		return reasonError(codes.ResourceExhausted, base.ReasonQuotaExceeded, err)
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// reasonError attaches the reason of the rest api, it tells errors sharing a code apart
+func reasonError(code codes.Code, reason string, err error) error {
+	s := status.New(code, err.Error())
+	if detailed, detailErr := s.WithDetails(&errdetails.ErrorInfo{Reason: reason}); detailErr == nil {
+		s = detailed
+	}
+	return s.Err()
+}
+
+// grpcActor is actor for grpc calls, the request id comes from the x-request-id metadata
+func grpcActor(ctx context.Context) models.Actor {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-request-id"); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	if len(requestID) > maxRequestIDLength {
+		requestID = requestID[:maxRequestIDLength]
+	}
+	return models.Actor{User: auth.GRPCUser(ctx).Name, RequestId: requestID}
+}
+
+// toProto carries every field of the rest api
+func toProto(m *models.LoadBalance) *pb.LoadBalance {
+	return &pb.LoadBalance{
+		Id:                  m.Id,
+		Cluster:             m.Cluster,
+		Ip:                  m.Ip,
+		Carriers:            int32(m.Carriers),
+		Status:              int32(m.Status),
+		Cidr:                m.Cidr,
+		Namespace:           m.Namespace,
+		ServiceName:         m.ServiceName,
+		CreatedAt:           timestamppb.New(m.CreatedAt),
+		UpdatedAt:           timestamppb.New(m.UpdatedAt),
+		LastNamespace:       m.LastNamespace,
+		LastServiceName:     m.LastServiceName,
+		ReleasedAt:          optionalTimestamp(m.ReleasedAt),
+		QuarantineUntil:     optionalTimestamp(m.QuarantineUntil),
+		ReservedNamespace:   m.ReservedNamespace,
+		ReservedServiceName: m.ReservedServiceName,
+	}
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func requireService(cluster, namespace, name string) error {
+	if cluster == "" || namespace == "" || name == "" {
+		return status.Error(codes.InvalidArgument, "cluster, namespace and serviceName are required")
+	}
+	return nil
+}
+
+func (s *GRPCServer) Allocate(ctx context.Context, req *pb.AllocateRequest) (*pb.LoadBalance, error) {
+	if err := requireService(req.Cluster, req.Namespace, req.ServiceName); err != nil {
+		return nil, err
+	}
+	if err := auth.AuthorizeGRPC(ctx, req.Cluster); err != nil {
+		return nil, err
+	}
+
+	m, err := models.LoadBalanceModel.Allocate(req.Cluster, req.ServiceName, req.Namespace,
+		models.AllocateOptions{Sticky: req.Sticky, Reserved: req.Reserved}, grpcActor(ctx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProto(m), nil
+}
+
+func (s *GRPCServer) Bind(ctx context.Context, req *pb.BindRequest) (*pb.LoadBalance, error) {
+	m := &models.LoadBalance{Cluster: req.Cluster, Ip: req.Ip, Namespace: req.Namespace, ServiceName: req.ServiceName}
+	if !Valid(m) {
+		return nil, status.Error(codes.InvalidArgument, "invalid params")
+	}
+	if err := auth.AuthorizeGRPC(ctx, req.Cluster); err != nil {
+		return nil, err
+	}
+
+	m, err := models.LoadBalanceModel.Bind(m, grpcActor(ctx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProto(m), nil
+}
+
+func (s *GRPCServer) Release(ctx context.Context, req *pb.ReleaseRequest) (*pb.ReleaseResponse, error) {
+	if err := requireService(req.Cluster, req.Namespace, req.ServiceName); err != nil {
+		return nil, err
+	}
+	if err := auth.AuthorizeGRPC(ctx, req.Cluster); err != nil {
+		return nil, err
+	}
+
+	m := &models.LoadBalance{Cluster: req.Cluster, Namespace: req.Namespace, ServiceName: req.ServiceName}
+	if err := models.LoadBalanceModel.Released(m, grpcActor(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.ReleaseResponse{}, nil
+}
+
+// List takes the same filters as the rest list api, the cluster is required
+func (s *GRPCServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	if req.Cluster == "" {
+		return nil, status.Error(codes.InvalidArgument, "cluster is required")
+	}
+
+	query := url.Values{}
+	for field, value := range map[string]string{
+		"cluster":     req.Cluster,
+		"status":      req.Status,
+		"cidr":        req.Cidr,
+		"carrier":     req.Carrier,
+		"namespace":   req.Namespace,
+		"service":     req.ServiceName,
+		"ip":          req.IpPrefix,
+		"sort":        req.Sort,
+		"continue":    req.Continue,
+		"reservedFor": req.ReservedFor,
+	} {
+		if value != "" {
+			query.Set(field, value)
+		}
+	}
+	if req.Limit != 0 {
+		query.Set("limit", strconv.Itoa(int(req.Limit)))
+	}
+
+	opts, sort, err := parseListOptions(query)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err = auth.AuthorizeGRPC(ctx, req.Cluster); err != nil {
+		return nil, err
+	}
+
+	resourceVersion := watch.Default.ResourceVersion()
+	items, total, next, err := listPage(opts, sort)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	result := &pb.ListResponse{Total: total, Continue: next, ResourceVersion: resourceVersion}
+	for i := range items {
+		result.Items = append(result.Items, toProto(&items[i]))
+	}
+	return result, nil
+}
+
+func (s *GRPCServer) GetByService(ctx context.Context, req *pb.GetByServiceRequest) (*pb.LoadBalance, error) {
+	if err := requireService(req.Cluster, req.Namespace, req.ServiceName); err != nil {
+		return nil, err
+	}
+	if err := auth.AuthorizeGRPC(ctx, req.Cluster); err != nil {
+		return nil, err
+	}
+
+	m, err := models.LoadBalanceModel.GetByService(req.Cluster, req.ServiceName, req.Namespace)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProto(m), nil
+}
+
+func (s *GRPCServer) GetPrevious(ctx context.Context, req *pb.GetByServiceRequest) (*pb.LoadBalance, error) {
+	if err := requireService(req.Cluster, req.Namespace, req.ServiceName); err != nil {
+		return nil, err
+	}
+	if err := auth.AuthorizeGRPC(ctx, req.Cluster); err != nil {
+		return nil, err
+	}
+
+	m, err := models.LoadBalanceModel.Previous(req.Cluster, req.ServiceName, req.Namespace)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProto(m), nil
+}
+
+// Watch streams like the rest watch api, an expired resource version is OutOfRange
+func (s *GRPCServer) Watch(req *pb.WatchRequest, stream pb.LoadBalancerService_WatchServer) error {
+	if req.Cluster == "" {
+		return status.Error(codes.InvalidArgument, "cluster is required")
+	}
+	rv, err := watch.ParseResourceVersion(req.ResourceVersion)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx := stream.Context()
+	if err = auth.AuthorizeGRPC(ctx, req.Cluster); err != nil {
+		return err
+	}
+
+	watcher, err := watch.Default.Watch(req.Cluster, rv)
+	if errors.Is(err, watch.ErrGone) {
+		return status.Error(codes.OutOfRange, err.Error())
+	}
+	if err != nil {
+		return grpcError(err)
+	}
+	defer watcher.Stop()
+
+	bookmark := time.NewTicker(watch.BookmarkInterval)
+	defer bookmark.Stop()
+	deadline := time.NewTimer(watch.Timeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline.C:
+			return nil
+		case <-bookmark.C:
+			watcher.Bookmark()
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil
+			}
+			out := &pb.WatchEvent{Type: string(event.Type), ResourceVersion: event.ResourceVersion}
+			if m, ok := event.Object.(models.LoadBalance); ok {
+				out.Object = toProto(&m)
+			}
+			if err = stream.Send(out); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package loadbalance
+
+import (
+	"encoding/json"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	pb "github.com/YuZongYangHi/cloud-controller-manager/pkg/api/loadbalancer/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fromProtoModel reverses toProto
+func fromProtoModel(p *pb.LoadBalance) models.LoadBalance {
+	m := models.LoadBalance{
+		Id:                  p.Id,
+		Cluster:             p.Cluster,
+		Ip:                  p.Ip,
+		Carriers:            int(p.Carriers),
+		Status:              int(p.Status),
+		Cidr:                p.Cidr,
+		Namespace:           p.Namespace,
+		ServiceName:         p.ServiceName,
+		CreatedAt:           p.CreatedAt.AsTime(),
+		UpdatedAt:           p.UpdatedAt.AsTime(),
+		LastNamespace:       p.LastNamespace,
+		LastServiceName:     p.LastServiceName,
+		ReservedNamespace:   p.ReservedNamespace,
+		ReservedServiceName: p.ReservedServiceName,
+	}
+	if p.ReleasedAt != nil {
+		t := p.ReleasedAt.AsTime()
+		m.ReleasedAt = &t
+	}
+	if p.QuarantineUntil != nil {
+		t := p.QuarantineUntil.AsTime()
+		m.QuarantineUntil = &t
+	}
+	return m
+}
+
+func jsonKeys(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestToProto checks the grpc api returns every field of the rest api
+func TestToProto(t *testing.T) {
+	created := time.Date(2023, 4, 13, 8, 0, 0, 123456789, time.UTC)
+	released := created.Add(time.Hour)
+	until := released.Add(10 * time.Minute)
+	m := models.LoadBalance{
+		Id:                  7,
+		Cluster:             "c1",
+		Ip:                  "10.0.0.1",
+		Carriers:            2,
+		Status:              models.LoadBalanceStatusQuarantined,
+		Cidr:                "10.0.0.0/24",
+		Namespace:           "ns",
+		ServiceName:         "web",
+		CreatedAt:           created,
+		UpdatedAt:           released,
+		LastNamespace:       "ns",
+		LastServiceName:     "old",
+		ReleasedAt:          &released,
+		QuarantineUntil:     &until,
+		ReservedNamespace:   "ns",
+		ReservedServiceName: "web",
+	}
+	// a field added to the model has to be set above, and carried by toProto
+	v := reflect.ValueOf(m)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Fatalf("field %s of the test model is not set", v.Type().Field(i).Name)
+		}
+	}
+
+	rest, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wire, err := proto.Marshal(toProto(&m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded pb.LoadBalance
+	if err = proto.Unmarshal(wire, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	grpcJSON, err := protojson.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restKeys, grpcKeys := jsonKeys(t, rest), jsonKeys(t, grpcJSON); !reflect.DeepEqual(restKeys, grpcKeys) {
+		t.Errorf("grpc fields = %v, expected the rest fields %v", grpcKeys, restKeys)
+	}
+
+	roundTrip, err := json.Marshal(fromProtoModel(&decoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(roundTrip) != string(rest) {
+		t.Errorf("grpc = %s, expected %s", roundTrip, rest)
+	}
+}
+
+func TestToProtoOptional(t *testing.T) {
+	m := models.LoadBalance{Id: 1, Cluster: "c1", Ip: "10.0.0.1", Cidr: "10.0.0.0/24", CreatedAt: time.Unix(1700000000, 0).UTC(), UpdatedAt: time.Unix(1700000000, 0).UTC()}
+
+	p := toProto(&m)
+	if p.ReleasedAt != nil || p.QuarantineUntil != nil {
+		t.Errorf("released at %v and quarantine until %v, expected nil", p.ReleasedAt, p.QuarantineUntil)
+	}
+	rest, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip, err := json.Marshal(fromProtoModel(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(roundTrip) != string(rest) {
+		t.Errorf("grpc = %s, expected %s", roundTrip, rest)
+	}
+}
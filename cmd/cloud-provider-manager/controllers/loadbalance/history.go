@@ -0,0 +1,140 @@
+package loadbalance
+
+import (
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"time"
+)
+
+// historyContinueSort keeps history tokens apart from list tokens
+const historyContinueSort = "history"
+
+type HistoryResult struct {
+	Items    []models.LoadBalanceHistory `json:"items"`
+	Total    int64                       `json:"total"`
+	Continue string                      `json:"continue"`
+}
+
+func parseTime(field, value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s, expected RFC3339: %s", field, value)
+	}
+	return t, nil
+}
+
+func parseHistoryOptions(query url.Values) (*models.HistoryListOptions, error) {
+	opts := &models.HistoryListOptions{Limit: defaultListLimit}
+	var err error
+
+	for field, values := range query {
+		value := values[0]
+		switch field {
+		case "cluster":
+			opts.Cluster = value
+		case "ip":
+			opts.Ip = value
+		case "namespace":
+			opts.Namespace = value
+		case "service":
+			opts.ServiceName = value
+		case "since":
+			opts.Since, err = parseTime(field, value)
+		case "until":
+			opts.Until, err = parseTime(field, value)
+		case "continue":
+			var token *continueToken
+			if token, err = decodeContinue(value, historyContinueSort); err == nil {
+				opts.BeforeId = token.Id
+			}
+		case "limit":
+			var limit *int
+			if limit, err = parseInt(field, value); err == nil {
+				if *limit <= 0 || *limit > maxListLimit {
+					err = fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+				}
+				opts.Limit = *limit
+			}
+		default:
+			err = fmt.Errorf("unknown query parameter: %s", field)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !opts.Since.IsZero() && !opts.Until.IsZero() && !opts.Since.Before(opts.Until) {
+		return nil, fmt.Errorf("since must be before until")
+	}
+	return opts, nil
+}
+
+// History answers who held an ip or which ips a service held, newest first.
+// Without a cluster the result is limited to the clusters the caller may access.
+func History(ctx *gin.Context) {
+	opts, err := parseHistoryOptions(ctx.Request.URL.Query())
+	if err != nil {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	if opts.Cluster != "" {
+		if !auth.Authorize(ctx, opts.Cluster) {
+			return
+		}
+	} else if scope := auth.Scope(ctx); !scope.All {
+		opts.Clusters = append([]string{}, scope.Clusters...)
+	}
+
+	history(ctx, opts)
+}
+
+// ClusterHistory is History below /clusters/:cluster of /api/v2
+func ClusterHistory(ctx *gin.Context) {
+	query := ctx.Request.URL.Query()
+	if query.Has("cluster") {
+		base.UnprocessableEntityResponse(ctx, "cluster is taken from the path")
+		return
+	}
+
+	cluster := ctx.Param("cluster")
+	query.Set("cluster", cluster)
+	opts, err := parseHistoryOptions(query)
+	if err != nil {
+		base.UnprocessableEntityResponse(ctx, err.Error())
+		return
+	}
+
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	history(ctx, opts)
+}
+
+func history(ctx *gin.Context, opts *models.HistoryListOptions) {
+	// one more entry than the limit tells whether another page follows
+	limit := opts.Limit
+	opts.Limit++
+	items, total, err := models.LoadBalanceHistoryModel.List(opts)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+
+	if items == nil {
+		items = []models.LoadBalanceHistory{}
+	}
+
+	result := &HistoryResult{Items: items, Total: total}
+	if len(items) > limit {
+		result.Items = items[:limit]
+		result.Continue = encodeContinue(historyContinueSort, items[limit-1].Id, nil)
+	}
+	base.SuccessResponse(ctx, result)
+}
@@ -0,0 +1,128 @@
+package loadbalance
+
+import (
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// the content types of an inventory, json is the default
+const (
+	contentTypeJSON = "application/json"
+	contentTypeYAML = "application/yaml"
+)
+
+// Export dumps the addresses, bindings, reservations and quotas of a cluster,
+// or of every cluster the caller may access, as an inventory document. The
+// document is not wrapped in the envelope so it can be imported as it is.
+func Export(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", parsers.JSON)
+	if format != parsers.JSON && format != parsers.YAML {
+		base.BadRequestResponse(ctx, "format must be json or yaml")
+		return
+	}
+
+	var clusters []string
+	if cluster := ctx.Query("cluster"); cluster != "" {
+		if !auth.Authorize(ctx, cluster) {
+			return
+		}
+		clusters = []string{cluster}
+	} else if scope := auth.Scope(ctx); !scope.All {
+		clusters = append([]string{}, scope.Clusters...)
+	}
+
+	inventory, err := models.InventoryModel.Export(clusters)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+	data, err := models.EncodeInventory(inventory, format)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+
+	contentType := contentTypeJSON
+	if format == parsers.YAML {
+		contentType = contentTypeYAML
+	}
+	ctx.Data(200, contentType, data)
+}
+
+// Import loads an inventory document, yaml when the content type says so. The
+// caller must have access to every cluster of the document and be a quota admin
+// of every cluster it holds quotas for. A document over MaxImportBodyBytes gets
+// 413, invalid documents 422 and conflicts
+// 409 unless onConflict is skip or overwrite, a binding over a quota 409 and an
+// address the database has in a cluster out of the scope of the caller 403 in
+// every mode, all with the report as data. dryRun reports without changing anything.
+func Import(ctx *gin.Context) {
+	opts := models.ImportOptions{OnConflict: ctx.Query("onConflict")}
+	if value := ctx.Query("dryRun"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			base.BadRequestResponse(ctx, "invalid dryRun, expected true or false: "+value)
+			return
+		}
+		opts.DryRun = dryRun
+	}
+
+	format := parsers.JSON
+	if contentType := ctx.ContentType(); strings.Contains(contentType, "yaml") {
+		format = parsers.YAML
+	}
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, base.MaxImportBodyBytes)
+	data, err := ctx.GetRawData()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		base.RequestEntityTooLargeResponse(ctx, fmt.Sprintf("inventory larger than %d bytes, import it per cluster", tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
+	inventory, err := models.DecodeInventory(data, format)
+	if err != nil {
+		base.BadRequestResponse(ctx, "parse inventory fail: "+err.Error())
+		return
+	}
+
+	for _, cluster := range inventory.Clusters {
+		if cluster.Name == "" {
+			continue
+		}
+		if !auth.Authorize(ctx, cluster.Name) {
+			return
+		}
+		if len(cluster.Quotas) > 0 && !auth.AuthorizeQuota(ctx, cluster.Name) {
+			return
+		}
+	}
+	if scope := auth.Scope(ctx); !scope.All {
+		opts.Clusters = append([]string{}, scope.Clusters...)
+	}
+
+	report, err := models.InventoryModel.Import(inventory, opts, actor(ctx))
+	switch {
+	case errors.Is(err, models.ErrInventoryInvalid):
+		base.ErrorDataResponse(ctx, 422, base.ReasonInvalid, err.Error(), report)
+	case errors.Is(err, models.ErrInventoryForbidden):
+		base.ErrorDataResponse(ctx, 403, base.ReasonForbidden, err.Error(), report)
+	case errors.Is(err, models.ErrInventoryConflict):
+		base.ErrorDataResponse(ctx, 409, base.ReasonConflict, err.Error(), report)
+	case err != nil:
+		base.ServerErrorResponse(ctx, err.Error())
+	default:
+		base.SuccessResponse(ctx, report)
+	}
+}
@@ -0,0 +1,30 @@
+package loadbalance
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestImportTooLarge is refused before the document is parsed
+func TestImportTooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/import", Import)
+
+	req := httptest.NewRequest(http.MethodPost, "/import", strings.NewReader(strings.Repeat(" ", base.MaxImportBodyBytes+1)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("code = %d, expected %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), base.ReasonTooLarge) {
+		t.Errorf("body = %s, expected reason %s", rec.Body.String(), base.ReasonTooLarge)
+	}
+}
@@ -1,21 +1,61 @@
 package loadbalance
 
 import (
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
 	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
 	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
 	"github.com/gin-gonic/gin"
+	"net/http"
 )
 
+// headerRequestID is sent by the sdk with every request and recorded in the history
+const (
+	headerRequestID    = "X-Request-ID"
+	maxRequestIDLength = 64
+)
+
+// actor is the caller of the request, recorded in the history of every change
+func actor(ctx *gin.Context) models.Actor {
+	requestID := ctx.GetHeader(headerRequestID)
+	if len(requestID) > maxRequestIDLength {
+		requestID = requestID[:maxRequestIDLength]
+	}
+	return models.Actor{User: auth.User(ctx).Name, RequestId: requestID}
+}
+
 func List(ctx *gin.Context) {
-	rawQuery := ctx.Request.URL.Query()
-	query := map[string]interface{}{}
+	opts, sort, err := parseListOptions(ctx.Request.URL.Query())
+	if err != nil {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
 
-	for field, values := range rawQuery {
-		query[field] = values[0]
+	if opts.Cluster != "" {
+		if !auth.Authorize(ctx, opts.Cluster) {
+			return
+		}
+	} else if scope := auth.Scope(ctx); !scope.All {
+		opts.Clusters = append([]string{}, scope.Clusters...)
 	}
 
-	result := models.LoadBalanceModel.List(query)
-	base.SuccessResponse(ctx, result)
+	list(ctx, opts, sort)
+}
+
+func list(ctx *gin.Context, opts *models.LoadBalanceListOptions, sort string) {
+	resourceVersion := watch.Default.ResourceVersion()
+	items, total, next, err := listPage(opts, sort)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+
+	if items == nil {
+		items = []models.LoadBalance{}
+	}
+
+	base.SuccessResponse(ctx, &ListResult{Items: items, Total: total, Continue: next, ResourceVersion: resourceVersion})
 }
 
 func Bind(ctx *gin.Context) {
@@ -32,9 +72,13 @@ func Bind(ctx *gin.Context) {
 		return
 	}
 
-	response, err := models.LoadBalanceModel.Bind(&m)
+	if !auth.Authorize(ctx, m.Cluster) {
+		return
+	}
+
+	response, err := models.LoadBalanceModel.Bind(&m, actor(ctx))
 	if err != nil {
-		base.ServerErrorResponse(ctx, err.Error())
+		errorResponse(ctx, err)
 		return
 	}
 
@@ -50,15 +94,46 @@ func Released(ctx *gin.Context) {
 		return
 	}
 
-	if m.Namespace == "" || m.ServiceName == "" {
+	if m.Cluster == "" || m.Namespace == "" || m.ServiceName == "" {
 		base.BadRequestResponse(ctx, "invalid params")
 		return
 	}
 
-	err = models.LoadBalanceModel.Released(&m)
+	if !auth.Authorize(ctx, m.Cluster) {
+		return
+	}
+
+	err = models.LoadBalanceModel.Released(&m, actor(ctx))
 	if err != nil {
-		base.ServerErrorResponse(ctx, err.Error())
+		errorResponse(ctx, err)
 		return
 	}
 	base.SuccessResponse(ctx, "")
 }
+
+// errorStatus maps a model error to the http status and reason of the response,
+// the batch endpoints report it per item
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound, base.ReasonNotFound
+	case errors.Is(err, models.ErrAlreadyBound):
+		return http.StatusConflict, base.ReasonAlreadyBound
+	case errors.Is(err, models.ErrPoolExhausted):
+		return http.StatusConflict, base.ReasonPoolExhausted
+	case errors.Is(err, models.ErrQuarantined):
+		return http.StatusConflict, base.ReasonQuarantined
+	case errors.Is(err, models.ErrQuotaExceeded):
+		return http.StatusConflict, base.ReasonQuotaExceeded
+	case errors.Is(err, models.ErrReserved):
+		return http.StatusConflict, base.ReasonReserved
+	case errors.Is(err, models.ErrNotQuarantined):
+		return http.StatusConflict, base.ReasonConflict
+	}
+	return http.StatusInternalServerError, base.ReasonInternalError
+}
+
+func errorResponse(ctx *gin.Context, err error) {
+	code, reason := errorStatus(err)
+	base.ErrorResponse(ctx, code, reason, err.Error())
+}
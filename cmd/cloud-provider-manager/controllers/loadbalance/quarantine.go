@@ -0,0 +1,49 @@
+package loadbalance
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/gin-gonic/gin"
+)
+
+type ForceReleaseRequest struct {
+	Cluster string `json:"cluster"`
+	Ip      string `json:"ip"`
+}
+
+// Unquarantine makes a quarantined ip allocatable before its cooldown ends
+func Unquarantine(ctx *gin.Context) {
+	var req ForceReleaseRequest
+
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	if req.Cluster == "" || req.Ip == "" {
+		base.BadRequestResponse(ctx, "invalid params")
+		return
+	}
+
+	forceRelease(ctx, req.Cluster, req.Ip)
+}
+
+// DeleteQuarantine is Unquarantine of /api/v2
+func DeleteQuarantine(ctx *gin.Context) {
+	forceRelease(ctx, ctx.Param("cluster"), ctx.Param("ip"))
+}
+
+func forceRelease(ctx *gin.Context, cluster, ip string) {
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	m, err := models.LoadBalanceModel.ForceRelease(cluster, ip, actor(ctx))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, m)
+}
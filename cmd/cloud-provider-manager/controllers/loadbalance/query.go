@@ -0,0 +1,206 @@
+package loadbalance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultListLimit = 500
+	maxListLimit     = 1000
+)
+
+// sortFields maps the sort query value onto a column of the loadbalances table
+var sortFields = map[string]string{
+	"id":        "id",
+	"ip":        "ip",
+	"cluster":   "cluster",
+	"status":    "status",
+	"cidr":      "cidr",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+}
+
+type ListResult struct {
+	Items    []models.LoadBalance `json:"items"`
+	Total    int64                `json:"total"`
+	Continue string               `json:"continue"`
+	// ResourceVersion is where a watch continues from after this list
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// continueToken is handed back to the client base64 encoded. It holds the sort
+// key of the last row of a page and the next page starts after it, so rows
+// changing meanwhile neither shift the walk nor show up twice. The sort is kept
+// so a token can not be replayed against a different order.
+type continueToken struct {
+	Sort  string          `json:"sort"`
+	Id    int64           `json:"id"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func encodeContinue(sort string, id int64, value interface{}) string {
+	token := continueToken{Sort: sort, Id: id}
+	if value != nil {
+		token.Value, _ = json.Marshal(value)
+	}
+	b, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeContinue(in, sort string) (*continueToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(in)
+	if err != nil {
+		return nil, fmt.Errorf("invalid continue token")
+	}
+
+	var token continueToken
+	if err = json.Unmarshal(b, &token); err != nil || token.Id <= 0 {
+		return nil, fmt.Errorf("invalid continue token")
+	}
+
+	if token.Sort != sort {
+		return nil, fmt.Errorf("continue token was issued for sort %q", token.Sort)
+	}
+	return &token, nil
+}
+
+// sortValue is the value of column in m, the cursor compares it in the database
+func sortValue(m *models.LoadBalance, column string) interface{} {
+	switch column {
+	case "ip":
+		return m.Ip
+	case "cluster":
+		return m.Cluster
+	case "status":
+		return m.Status
+	case "cidr":
+		return m.Cidr
+	case "created_at":
+		return m.CreatedAt
+	case "updated_at":
+		return m.UpdatedAt
+	}
+	return nil
+}
+
+// listCursor reads the value of the token back into the type sortValue returns for column
+func listCursor(token *continueToken, column string) (*models.ListCursor, error) {
+	cursor := &models.ListCursor{Id: token.Id}
+	value := sortValue(&models.LoadBalance{}, column)
+	if value == nil {
+		return cursor, nil
+	}
+
+	ptr := reflect.New(reflect.TypeOf(value))
+	if err := json.Unmarshal(token.Value, ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("invalid continue token")
+	}
+	cursor.Value = ptr.Elem().Interface()
+	return cursor, nil
+}
+
+// listPage returns a page of opts and the token of the next one, empty on the last page
+func listPage(opts *models.LoadBalanceListOptions, sort string) ([]models.LoadBalance, int64, string, error) {
+	// one more row than the limit tells whether another page follows
+	limit := opts.Limit
+	opts.Limit++
+	items, total, err := models.LoadBalanceModel.List(opts)
+	opts.Limit = limit
+	if err != nil || len(items) <= limit {
+		return items, total, "", err
+	}
+
+	items = items[:limit]
+	last := &items[limit-1]
+	return items, total, encodeContinue(sort, last.Id, sortValue(last, opts.OrderBy)), nil
+}
+
+func parseInt(field, value string) (*int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", field, value)
+	}
+	return &v, nil
+}
+
+func parseListOptions(query url.Values) (*models.LoadBalanceListOptions, string, error) {
+	opts := &models.LoadBalanceListOptions{Limit: defaultListLimit}
+	var err error
+	var sort, token string
+
+	for field, values := range query {
+		value := values[0]
+		switch field {
+		case "cluster":
+			opts.Cluster = value
+		case "status":
+			opts.Status, err = parseInt(field, value)
+		case "cidr":
+			opts.Cidr = value
+		case "carrier":
+			opts.Carriers, err = parseInt(field, value)
+		case "namespace":
+			opts.Namespace = value
+		case "service":
+			opts.ServiceName = value
+		case "ip":
+			opts.IpPrefix = value
+		case "reserved":
+			opts.Reserved, err = strconv.ParseBool(value)
+			if err != nil {
+				err = fmt.Errorf("invalid %s: %s", field, value)
+			}
+		case "reservedFor":
+			// namespace or namespace/name, the ips a service of the namespace or the service may bind
+			opts.ReservedNamespace, opts.ReservedServiceName, _ = strings.Cut(value, "/")
+			if opts.ReservedNamespace == "" {
+				err = fmt.Errorf("invalid %s: %s", field, value)
+			}
+		case "sort":
+			sort = value
+		case "continue":
+			token = value
+		case "limit":
+			var limit *int
+			if limit, err = parseInt(field, value); err == nil {
+				if *limit <= 0 || *limit > maxListLimit {
+					err = fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+				}
+				opts.Limit = *limit
+			}
+		default:
+			err = fmt.Errorf("unknown query parameter: %s", field)
+		}
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if sort != "" {
+		column, ok := sortFields[strings.TrimPrefix(sort, "-")]
+		if !ok {
+			return nil, "", fmt.Errorf("unknown sort field: %s", sort)
+		}
+		opts.OrderBy = column
+		opts.Desc = strings.HasPrefix(sort, "-")
+	}
+
+	if token != "" {
+		t, err := decodeContinue(token, sort)
+		if err != nil {
+			return nil, "", err
+		}
+		if opts.After, err = listCursor(t, opts.OrderBy); err != nil {
+			return nil, "", err
+		}
+	}
+	return opts, sort, nil
+}
@@ -0,0 +1,184 @@
+package loadbalance
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestParseListOptions(t *testing.T) {
+	created := time.Date(2023, 4, 1, 12, 30, 0, 123456000, time.UTC)
+
+	tests := []struct {
+		name  string
+		query string
+		opts  *models.LoadBalanceListOptions
+		sort  string
+		err   string
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			opts:  &models.LoadBalanceListOptions{Limit: defaultListLimit},
+		},
+		{
+			name:  "filters",
+			query: "cluster=c1&status=1&cidr=10.0.0.0/24&carrier=2&namespace=ns&service=svc&ip=10.0.&limit=10",
+			opts: &models.LoadBalanceListOptions{Cluster: "c1", Status: intPtr(1), Cidr: "10.0.0.0/24", Carriers: intPtr(2),
+				Namespace: "ns", ServiceName: "svc", IpPrefix: "10.0.", Limit: 10},
+		},
+		{
+			name:  "reserved for a service",
+			query: "reserved=true&reservedFor=ns/svc",
+			opts:  &models.LoadBalanceListOptions{Reserved: true, ReservedNamespace: "ns", ReservedServiceName: "svc", Limit: defaultListLimit},
+		},
+		{
+			name:  "sort desc",
+			query: "sort=-createdAt",
+			opts:  &models.LoadBalanceListOptions{OrderBy: "created_at", Desc: true, Limit: defaultListLimit},
+			sort:  "-createdAt",
+		},
+		{
+			name:  "continue by id",
+			query: "continue=" + encodeContinue("", 42, nil),
+			opts:  &models.LoadBalanceListOptions{After: &models.ListCursor{Id: 42}, Limit: defaultListLimit},
+		},
+		{
+			name:  "continue by ip",
+			query: "sort=ip&continue=" + encodeContinue("ip", 7, "10.0.0.9"),
+			opts:  &models.LoadBalanceListOptions{OrderBy: "ip", After: &models.ListCursor{Id: 7, Value: "10.0.0.9"}, Limit: defaultListLimit},
+			sort:  "ip",
+		},
+		{
+			name:  "continue by status",
+			query: "sort=-status&continue=" + encodeContinue("-status", 7, 1),
+			opts:  &models.LoadBalanceListOptions{OrderBy: "status", Desc: true, After: &models.ListCursor{Id: 7, Value: 1}, Limit: defaultListLimit},
+			sort:  "-status",
+		},
+		{
+			name:  "continue by time",
+			query: "sort=createdAt&continue=" + url.QueryEscape(encodeContinue("createdAt", 7, created)),
+			opts:  &models.LoadBalanceListOptions{OrderBy: "created_at", After: &models.ListCursor{Id: 7, Value: created}, Limit: defaultListLimit},
+			sort:  "createdAt",
+		},
+		{name: "unknown parameter", query: "owner=x", err: "unknown query parameter: owner"},
+		{name: "invalid status", query: "status=bound", err: "invalid status"},
+		{name: "invalid reserved", query: "reserved=maybe", err: "invalid reserved"},
+		{name: "reserved for without namespace", query: "reservedFor=/svc", err: "invalid reservedFor"},
+		{name: "limit too large", query: "limit=1001", err: "limit must be between"},
+		{name: "limit zero", query: "limit=0", err: "limit must be between"},
+		{name: "unknown sort", query: "sort=namespace", err: "unknown sort field"},
+		{name: "sql in sort", query: "sort=id%3BDROP+TABLE+loadbalances", err: "unknown sort field"},
+		{name: "garbage token", query: "continue=%21%21%21", err: "invalid continue token"},
+		{name: "token of another sort", query: "sort=ip&continue=" + encodeContinue("", 42, nil), err: `issued for sort ""`},
+		{name: "token without id", query: "continue=" + encodeContinue("", 0, nil), err: "invalid continue token"},
+		{name: "token value of another type", query: "sort=status&continue=" + encodeContinue("status", 7, "bound"), err: "invalid continue token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parse query: %v", err)
+			}
+
+			opts, sort, err := parseListOptions(query)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sort != tt.sort {
+				t.Errorf("sort = %q, expected %q", sort, tt.sort)
+			}
+			if opts.After != nil && tt.opts.After != nil {
+				if got, ok := opts.After.Value.(time.Time); ok {
+					if !got.Equal(tt.opts.After.Value.(time.Time)) {
+						t.Errorf("cursor time = %v, expected %v", got, tt.opts.After.Value)
+					}
+					opts.After.Value = tt.opts.After.Value
+				}
+			}
+			if !reflect.DeepEqual(opts, tt.opts) {
+				t.Errorf("options = %+v, expected %+v", opts, tt.opts)
+			}
+		})
+	}
+}
+
+func TestParseHistoryOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+		opts  *models.HistoryListOptions
+		err   string
+	}{
+		{
+			name:  "defaults",
+			query: url.Values{},
+			opts:  &models.HistoryListOptions{Limit: defaultListLimit},
+		},
+		{
+			name: "filters",
+			query: url.Values{"cluster": {"c1"}, "namespace": {"ns"}, "service": {"svc"}, "limit": {"10"},
+				"since": {"2023-04-01T00:00:00Z"}, "until": {"2023-04-02T00:00:00+02:00"}},
+			opts: &models.HistoryListOptions{Cluster: "c1", Namespace: "ns", ServiceName: "svc", Limit: 10,
+				Since: time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2023, 4, 2, 0, 0, 0, 0, time.FixedZone("", 2*3600))},
+		},
+		{
+			name:  "continue",
+			query: url.Values{"ip": {"10.0.0.1"}, "continue": {encodeContinue(historyContinueSort, 9, nil)}},
+			opts:  &models.HistoryListOptions{Ip: "10.0.0.1", BeforeId: 9, Limit: defaultListLimit},
+		},
+		{
+			name:  "list token",
+			query: url.Values{"continue": {encodeContinue("", 9, nil)}},
+			err:   "continue token was issued for sort",
+		},
+		{
+			name:  "since after until",
+			query: url.Values{"since": {"2023-04-02T00:00:00Z"}, "until": {"2023-04-01T00:00:00Z"}},
+			err:   "since must be before until",
+		},
+		{
+			name:  "invalid time",
+			query: url.Values{"since": {"yesterday"}},
+			err:   "invalid since",
+		},
+		{name: "limit too large", query: url.Values{"limit": {"1001"}}, err: "limit must be between"},
+		{name: "unknown parameter", query: url.Values{"status": {"1"}}, err: "unknown query parameter: status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseHistoryOptions(tt.query)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// times compare by instant, the zone of the query is kept
+			if opts.Since.Equal(tt.opts.Since) && opts.Until.Equal(tt.opts.Until) {
+				opts.Since, opts.Until = tt.opts.Since, tt.opts.Until
+			}
+			if !reflect.DeepEqual(opts, tt.opts) {
+				t.Errorf("options = %+v, expected %+v", opts, tt.opts)
+			}
+		})
+	}
+}
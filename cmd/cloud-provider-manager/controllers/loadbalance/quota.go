@@ -0,0 +1,116 @@
+package loadbalance
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaSpec is the body of PUT quota
+type QuotaSpec struct {
+	Limit *int64 `json:"limit"`
+}
+
+func ListQuotas(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	quotas, err := models.LoadBalanceQuotaModel.List(cluster)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+	if quotas == nil {
+		quotas = []models.LoadBalanceQuota{}
+	}
+	base.SuccessResponse(ctx, quotas)
+}
+
+// GetQuota, PutQuota and DeleteQuota serve the quota of the whole cluster below
+// /clusters/:cluster/quota and the quota of a namespace below
+// /clusters/:cluster/namespaces/:namespace/quota. Changing a quota takes a
+// rule of auth.quotaAdmins, access to the cluster only reads it.
+func GetQuota(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	quota, err := models.LoadBalanceQuotaModel.Get(cluster, ctx.Param("namespace"))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, quota)
+}
+
+func PutQuota(ctx *gin.Context) {
+	var spec QuotaSpec
+
+	if err := ctx.ShouldBindJSON(&spec); err != nil {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	if spec.Limit == nil || *spec.Limit < 0 {
+		base.UnprocessableEntityResponse(ctx, "limit must be 0 or more")
+		return
+	}
+
+	cluster := ctx.Param("cluster")
+	if !auth.AuthorizeQuota(ctx, cluster) {
+		return
+	}
+
+	quota, err := models.LoadBalanceQuotaModel.Set(cluster, ctx.Param("namespace"), *spec.Limit)
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, quota)
+}
+
+func DeleteQuota(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if !auth.AuthorizeQuota(ctx, cluster) {
+		return
+	}
+
+	if err := models.LoadBalanceQuotaModel.Delete(cluster, ctx.Param("namespace")); err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, nil)
+}
+
+// Usage returns the bound ips of the cluster and of each namespace next to their quotas
+func Usage(ctx *gin.Context) {
+	cluster := ctx.Query("cluster")
+	if cluster == "" {
+		base.BadRequestResponse(ctx, "cluster is required")
+		return
+	}
+
+	usage(ctx, cluster)
+}
+
+// ClusterUsage is Usage below /clusters/:cluster of /api/v2
+func ClusterUsage(ctx *gin.Context) {
+	usage(ctx, ctx.Param("cluster"))
+}
+
+func usage(ctx *gin.Context, cluster string) {
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	result, err := models.LoadBalanceQuotaModel.Usage(cluster)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+	base.SuccessResponse(ctx, result)
+}
@@ -0,0 +1,63 @@
+package loadbalance
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestQuotaWritesForbidden covers the callers without a quota admin rule, their
+// requests are refused before the database is used
+func TestQuotaWritesForbidden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(auth.Middleware(
+		auth.NewUnionAuthenticator(staticUser{Name: "controller"}),
+		auth.NewAuthorizer(
+			[]config.CloudProviderAuthorizationRule{{User: "controller", Clusters: []string{"c1", "c2"}}},
+			[]config.CloudProviderAuthorizationRule{{User: "controller", Clusters: []string{"c2"}}},
+		),
+	))
+	router.PUT("/clusters/:cluster/quota", PutQuota)
+	router.DELETE("/clusters/:cluster/quota", DeleteQuota)
+	router.PUT("/clusters/:cluster/namespaces/:namespace/quota", PutQuota)
+	router.DELETE("/clusters/:cluster/namespaces/:namespace/quota", DeleteQuota)
+	router.POST("/import", Import)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "put cluster quota", method: http.MethodPut, path: "/clusters/c1/quota", body: `{"limit": 10}`},
+		{name: "delete cluster quota", method: http.MethodDelete, path: "/clusters/c1/quota"},
+		{name: "put namespace quota", method: http.MethodPut, path: "/clusters/c1/namespaces/ns/quota", body: `{"limit": 10}`},
+		{name: "delete namespace quota", method: http.MethodDelete, path: "/clusters/c1/namespaces/ns/quota"},
+		{name: "quota admin of another cluster", method: http.MethodPut, path: "/clusters/c3/quota", body: `{"limit": 10}`},
+		{
+			name:   "import with quotas",
+			method: http.MethodPost,
+			path:   "/import?dryRun=true",
+			body:   `{"apiVersion":"v1","kind":"Inventory","clusters":[{"name":"c2","pools":[]},{"name":"c1","pools":[],"quotas":[{"limit":10}]}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("code = %d, expected %d: %s", rec.Code, http.StatusForbidden, rec.Body.String())
+			}
+		})
+	}
+}
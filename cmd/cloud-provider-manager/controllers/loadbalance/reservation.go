@@ -0,0 +1,55 @@
+package loadbalance
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ReservationSpec is the body of PUT reservation, an empty service reserves the
+// ip for every service of the namespace
+type ReservationSpec struct {
+	Namespace   string `json:"namespace"`
+	ServiceName string `json:"serviceName"`
+}
+
+func PutReservation(ctx *gin.Context) {
+	var spec ReservationSpec
+
+	if err := ctx.ShouldBindJSON(&spec); err != nil {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	if spec.Namespace == "" {
+		base.UnprocessableEntityResponse(ctx, "namespace is required")
+		return
+	}
+
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	m, err := models.LoadBalanceModel.Reserve(cluster, ctx.Param("ip"), spec.Namespace, spec.ServiceName, actor(ctx))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, m)
+}
+
+func DeleteReservation(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	m, err := models.LoadBalanceModel.Unreserve(cluster, ctx.Param("ip"), actor(ctx))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, m)
+}
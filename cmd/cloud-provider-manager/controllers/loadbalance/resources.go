@@ -0,0 +1,161 @@
+package loadbalance
+
+import (
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net"
+)
+
+// The handlers below serve /api/v2, every resource lives below /clusters/:cluster
+// so the cluster is authorized before anything else. A well formed request with
+// invalid values gets 422, every error carries a reason.
+
+// BindingSpec is the optional body of PUT binding, an empty ip allocates a free one.
+// Sticky prefers the ip the service released last, Reserved only takes ips
+// reserved for the service or its namespace.
+type BindingSpec struct {
+	Ip       string `json:"ip"`
+	Sticky   bool   `json:"sticky"`
+	Reserved bool   `json:"reserved"`
+}
+
+func GetBinding(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	m, err := models.LoadBalanceModel.GetByService(cluster, ctx.Param("name"), ctx.Param("namespace"))
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, m)
+}
+
+func PutBinding(ctx *gin.Context) {
+	var spec BindingSpec
+
+	if err := ctx.ShouldBindJSON(&spec); err != nil && !errors.Is(err, io.EOF) {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	if spec.Ip != "" && net.ParseIP(spec.Ip) == nil {
+		base.UnprocessableEntityResponse(ctx, "invalid ip "+spec.Ip)
+		return
+	}
+
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	var m *models.LoadBalance
+	var err error
+	if spec.Ip == "" {
+		m, err = models.LoadBalanceModel.Allocate(cluster, ctx.Param("name"), ctx.Param("namespace"),
+			models.AllocateOptions{Sticky: spec.Sticky, Reserved: spec.Reserved}, actor(ctx))
+	} else {
+		m, err = models.LoadBalanceModel.Bind(&models.LoadBalance{
+			Cluster:     cluster,
+			Ip:          spec.Ip,
+			Namespace:   ctx.Param("namespace"),
+			ServiceName: ctx.Param("name"),
+		}, actor(ctx))
+	}
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, m)
+}
+
+// GetPreviousBinding returns the ip the service released last, 404 once it is
+// older than the retention or bound by someone else
+func GetPreviousBinding(ctx *gin.Context) {
+	previous(ctx, ctx.Param("cluster"), ctx.Param("namespace"), ctx.Param("name"))
+}
+
+func DeleteBinding(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	m := &models.LoadBalance{Cluster: cluster, Namespace: ctx.Param("namespace"), ServiceName: ctx.Param("name")}
+	if err := models.LoadBalanceModel.Released(m, actor(ctx)); err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, nil)
+}
+
+func ListBindings(ctx *gin.Context) {
+	listBindings(ctx, ctx.Param("cluster"))
+}
+
+func ListPools(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	pools, err := models.LoadBalanceModel.Pools(cluster)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+	if pools == nil {
+		pools = []models.Pool{}
+	}
+	base.SuccessResponse(ctx, pools)
+}
+
+// ListAddresses takes the query parameters of the v1 list, the cluster comes from the path
+func ListAddresses(ctx *gin.Context) {
+	query := ctx.Request.URL.Query()
+	if query.Has("cluster") {
+		base.UnprocessableEntityResponse(ctx, "cluster is taken from the path")
+		return
+	}
+
+	cluster := ctx.Param("cluster")
+	query.Set("cluster", cluster)
+	opts, sort, err := parseListOptions(query)
+	if err != nil {
+		base.UnprocessableEntityResponse(ctx, err.Error())
+		return
+	}
+
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	list(ctx, opts, sort)
+}
+
+func GetAddress(ctx *gin.Context) {
+	cluster := ctx.Param("cluster")
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	m, err := models.LoadBalanceModel.GetByIp(ctx.Param("ip"))
+	if err == nil && m.Cluster != cluster {
+		err = models.ErrNotFound
+	}
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, m)
+}
+
+func WatchCluster(ctx *gin.Context) {
+	watchCluster(ctx, ctx.Param("cluster"))
+}
@@ -0,0 +1,31 @@
+package loadbalance
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/stats"
+	"github.com/gin-gonic/gin"
+)
+
+// Stats counts the total, bound, free, quarantined and reserved ips of each cluster
+// and of its cidrs and carriers. Without a cluster the result is limited to the
+// clusters the caller may access.
+func Stats(ctx *gin.Context) {
+	var clusters []string
+	if cluster := ctx.Query("cluster"); cluster != "" {
+		if !auth.Authorize(ctx, cluster) {
+			return
+		}
+		clusters = []string{cluster}
+	} else if scope := auth.Scope(ctx); !scope.All {
+		clusters = append([]string{}, scope.Clusters...)
+	}
+
+	pools, err := models.LoadBalanceModel.Stats(clusters)
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+	base.SuccessResponse(ctx, stats.Summarize(pools))
+}
@@ -0,0 +1,33 @@
+package loadbalance
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Previous returns the ip the service released last within the sticky retention,
+// clients bind it before falling back to a free ip
+func Previous(ctx *gin.Context) {
+	cluster, namespace, name := ctx.Query("cluster"), ctx.Query("namespace"), ctx.Query("service")
+	if cluster == "" || namespace == "" || name == "" {
+		base.BadRequestResponse(ctx, "cluster, namespace and service are required")
+		return
+	}
+
+	previous(ctx, cluster, namespace, name)
+}
+
+func previous(ctx *gin.Context, cluster, namespace, name string) {
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	m, err := models.LoadBalanceModel.Previous(cluster, name, namespace)
+	if err != nil {
+		errorResponse(ctx, err)
+		return
+	}
+	base.SuccessResponse(ctx, m)
+}
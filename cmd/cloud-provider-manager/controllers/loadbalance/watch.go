@@ -0,0 +1,91 @@
+package loadbalance
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/base"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Watch streams the events of a cluster as one json object per line, starting
+// after resourceVersion. An expired resourceVersion gets 410 and the client
+// lists again. The stream ends after timeoutSeconds or the server timeout.
+func Watch(ctx *gin.Context) {
+	cluster := ctx.Query("cluster")
+	if cluster == "" {
+		base.BadRequestResponse(ctx, "cluster is required")
+		return
+	}
+	watchCluster(ctx, cluster)
+}
+
+func watchCluster(ctx *gin.Context, cluster string) {
+	rv, err := watch.ParseResourceVersion(ctx.Query("resourceVersion"))
+	if err != nil {
+		base.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	timeout := watch.Timeout
+	if in := ctx.Query("timeoutSeconds"); in != "" {
+		seconds, err := strconv.Atoi(in)
+		if err != nil || seconds <= 0 {
+			base.BadRequestResponse(ctx, "invalid timeoutSeconds")
+			return
+		}
+		if d := time.Duration(seconds) * time.Second; d < timeout {
+			timeout = d
+		}
+	}
+
+	if !auth.Authorize(ctx, cluster) {
+		return
+	}
+
+	watcher, err := watch.Default.Watch(cluster, rv)
+	if errors.Is(err, watch.ErrGone) {
+		base.GoneResponse(ctx, err.Error())
+		return
+	}
+	if err != nil {
+		base.ServerErrorResponse(ctx, err.Error())
+		return
+	}
+	defer watcher.Stop()
+
+	ctx.Header("Content-Type", "application/json")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	bookmark := time.NewTicker(watch.BookmarkInterval)
+	defer bookmark.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	encoder := json.NewEncoder(ctx.Writer)
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-bookmark.C:
+			watcher.Bookmark()
+		case event, ok := <-watcher.ResultChan():
+			// closed when the client fell too far behind, it resumes from its last version
+			if !ok {
+				return
+			}
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+			ctx.Writer.Flush()
+		}
+	}
+}
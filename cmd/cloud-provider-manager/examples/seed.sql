@@ -1,17 +1,4 @@
-CREATE DATABASE `cloud_privoder` DEFAULT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
-
-USE `cloud_privoder`;
-
-CREATE TABLE `loadbalances`(
-    `id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY,
-    `cluster` VARCHAR(255) NOT NULL,
-    `ip` VARCHAR(255) NOT NULL,
-    `carriers` int(10) NOT NULL,
-    `status` int(10) NOT NULL DEFAULT 0,
-    `cidr` varchar(255) NOT NULL,
-    `created_at` datetime(6) NOT NULL,
-    `updated_at` datetime(6) NOT NULL
-);
+-- demo address pool, load after `cloud-provider-manager migrate up`
 
 INSERT INTO
     loadbalances(
@@ -78,4 +65,4 @@ VALUES
         '172.28.205.200/29',
         '2023-04-13 00:00:00',
         '2023-04-13 00:00:00'
-    );
\ No newline at end of file
+    );
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/controllers/loadbalance"
+	pb "github.com/YuZongYangHi/cloud-controller-manager/pkg/api/loadbalancer/v1"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"k8s.io/klog/v2"
+	"net"
+	"os"
+)
+
+// serveGRPC listens on its own port with the tls files, signature check and
+// authenticators of the rest api
+func serveGRPC(cfg *config.CloudProviderConfig, authenticator auth.Authenticator) error {
+	if cfg.GRPC.Port == 0 {
+		return nil
+	}
+
+	var opts []grpc.ServerOption
+	if cfg.Auth.Signature.Enabled {
+		signatureOpts, err := auth.GRPCSignatureOptions(cfg.Auth.Signature)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, signatureOpts...)
+	}
+	opts = append(opts, auth.GRPCServerOptions(authenticator, auth.NewAuthorizer(cfg.Auth.Authorization, cfg.Auth.QuotaAdmins))...)
+	if cfg.HTTP.TLS.CertFile != "" {
+		tlsConfig, err := serverTLSConfig(cfg.HTTP.TLS)
+		if err != nil {
+			return err
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.GRPC.Host, cfg.GRPC.Port))
+	if err != nil {
+		return err
+	}
+
+	s := grpc.NewServer(opts...)
+	pb.RegisterLoadBalancerServiceServer(s, loadbalance.NewGRPCServer())
+	go func() {
+		if err := s.Serve(listener); err != nil {
+			klog.Errorf("grpc server: %s", err.Error())
+			os.Exit(3)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const exportUsage = `usage: cloud-provider-manager [--config path] export [flags]
+
+writes the inventory of every cluster, or of --cluster, to stdout or --output`
+
+const importUsage = `usage: cloud-provider-manager [--config path] import [flags] <file>
+
+loads an inventory, - reads stdin. the report is printed as json`
+
+// inventoryFormat is the format flag, or the extension of path
+func inventoryFormat(format, path string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return parsers.YAML
+	}
+	return parsers.JSON
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	cluster := fs.String("cluster", "", "export a single cluster")
+	format := fs.String("format", "", "json or yaml, default the extension of --output or json")
+	output := fs.String("output", "", "file to write, default stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), exportUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New(exportUsage)
+	}
+
+	var clusters []string
+	if *cluster != "" {
+		clusters = []string{*cluster}
+	}
+	inventory, err := models.InventoryModel.Export(clusters)
+	if err != nil {
+		return err
+	}
+	data, err := models.EncodeInventory(inventory, inventoryFormat(*format, *output))
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0600)
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without changing anything")
+	onConflict := fs.String("on-conflict", models.ImportConflictFail, "fail, skip or overwrite")
+	format := fs.String("format", "", "json or yaml, default the extension of the file or json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), importUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+
+	path := fs.Arg(0)
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	inventory, err := models.DecodeInventory(data, inventoryFormat(*format, path))
+	if err != nil {
+		return err
+	}
+
+	// imported from the command line, not by a user of the api
+	actor := models.Actor{User: "cli"}
+	report, importErr := models.InventoryModel.Import(inventory, models.ImportOptions{DryRun: *dryRun, OnConflict: *onConflict}, actor)
+	if report != nil {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	}
+	return importErr
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/auth"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/migrations"
 	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
 	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/routers"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/stats"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/webhook"
 	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/gin-gonic/gin"
 	"k8s.io/klog/v2"
 	"net/http"
 	"os"
@@ -45,14 +53,110 @@ func main() {
 		os.Exit(1)
 	}
 
+	args := flag.Args()
+	if len(args) > 0 && args[0] != "migrate" && args[0] != "export" && args[0] != "import" {
+		klog.Errorf("unknown command %s", args[0])
+		os.Exit(2)
+	}
+	// migrate is the only command that runs on an outdated or dirty schema
+	if len(args) > 0 && args[0] == "migrate" {
+		if err = runMigrate(args[1:]); err != nil {
+			klog.Errorf("%s fail: %s", args[0], err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	migrator, err := migrations.NewMigrator(models.Cursor())
+	if err != nil {
+		klog.Errorf("load migrations fail: %s", err.Error())
+		os.Exit(1)
+	}
+
+	if err = migrator.Check(); err != nil {
+		klog.Errorf("refusing to start: %s", err.Error())
+		os.Exit(1)
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			err = runExport(args[1:])
+		case "import":
+			// bindings the import changes are queued for the subscribers
+			models.SetupWebhook(cfg.Webhook)
+			err = runImport(args[1:])
+		}
+		if err != nil {
+			klog.Errorf("%s fail: %s", args[0], err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	watch.Setup(cfg.Watch)
+	models.SetupQuarantine(cfg.Quarantine)
+	models.SetupSticky(cfg.Sticky)
+
+	dispatcher, err := webhook.NewDispatcher(cfg.Webhook)
+	if err != nil {
+		klog.Errorf("parser webhook config fail: %s", err.Error())
+		os.Exit(1)
+	}
+	models.SetupWebhook(cfg.Webhook)
+
+	reporter, err := stats.NewReporter(cfg.Stats)
+	if err != nil {
+		klog.Errorf("parser stats config fail: %s", err.Error())
+		os.Exit(1)
+	}
+
+	authenticator, err := auth.NewAuthenticator(cfg)
+	if err != nil {
+		klog.Errorf("build authenticator fail: %s", err.Error())
+		os.Exit(1)
+	}
+
+	var middlewares []gin.HandlerFunc
+	if cfg.Auth.Signature.Enabled {
+		verifier, err := auth.SignatureMiddleware(cfg.Auth.Signature)
+		if err != nil {
+			klog.Errorf("load signing credentials fail: %s", err.Error())
+			os.Exit(1)
+		}
+		middlewares = append(middlewares, verifier)
+	}
+	middlewares = append(middlewares, auth.Middleware(authenticator, auth.NewAuthorizer(cfg.Auth.Authorization, cfg.Auth.QuotaAdmins)))
+
+	if err = serveGRPC(cfg, authenticator); err != nil {
+		klog.Errorf("start grpc server fail: %s", err.Error())
+		os.Exit(1)
+	}
+
+	go runQuarantineExpiry()
+	go reporter.Run()
+	dispatcher.Run()
+
+	router := routers.NewRouter(middlewares...)
+
 	s := &http.Server{
 		Addr: fmt.Sprintf("%s", fmt.Sprintf("%s:%d", cfg.HTTP.Host,
 			cfg.HTTP.Port)),
-		Handler:        routers.NewRouter(),
+		Handler:        router,
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	if err = s.ListenAndServe(); err != nil {
+	if cfg.HTTP.TLS.CertFile != "" {
+		if s.TLSConfig, err = serverTLSConfig(cfg.HTTP.TLS); err != nil {
+			klog.Errorf("load tls config fail: %s", err.Error())
+			os.Exit(1)
+		}
+		err = s.ListenAndServeTLS(cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile)
+	} else {
+		err = s.ListenAndServe()
+	}
+
+	if err != nil {
 		klog.Errorf(err.Error())
 		os.Exit(3)
 	}
@@ -62,3 +166,25 @@ func main() {
 	<-sics
 
 }
+
+func serverTLSConfig(cfg config.CloudProviderTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", cfg.ClientCAFile)
+	}
+
+	// clients without a certificate may still authenticate with a bearer token
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
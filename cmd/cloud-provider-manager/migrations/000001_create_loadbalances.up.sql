@@ -0,0 +1,12 @@
+CREATE TABLE `loadbalances`(
+    `id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    `cluster` VARCHAR(255) NOT NULL,
+    `ip` VARCHAR(255) NOT NULL,
+    `carriers` int(10) NOT NULL,
+    `status` int(10) NOT NULL DEFAULT 0,
+    `cidr` varchar(255) NOT NULL,
+    `namespace` varchar(255) NOT NULL DEFAULT '',
+    `service_name` varchar(255) NOT NULL DEFAULT '',
+    `created_at` datetime(6) NOT NULL,
+    `updated_at` datetime(6) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
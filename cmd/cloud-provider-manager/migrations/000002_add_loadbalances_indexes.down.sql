@@ -0,0 +1,5 @@
+DROP INDEX `uniq_loadbalances_ip` ON `loadbalances`;
+
+DROP INDEX `idx_loadbalances_cluster_service` ON `loadbalances`;
+
+DROP INDEX `idx_loadbalances_cluster_status` ON `loadbalances`;
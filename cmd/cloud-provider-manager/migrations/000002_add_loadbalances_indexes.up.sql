@@ -0,0 +1,5 @@
+CREATE INDEX `idx_loadbalances_cluster_status` ON `loadbalances` (`cluster`, `status`);
+
+CREATE INDEX `idx_loadbalances_cluster_service` ON `loadbalances` (`cluster`, `namespace`, `service_name`);
+
+CREATE UNIQUE INDEX `uniq_loadbalances_ip` ON `loadbalances` (`ip`);
@@ -0,0 +1,15 @@
+CREATE TABLE `loadbalance_history`(
+    `id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    `cluster` VARCHAR(255) NOT NULL,
+    `ip` VARCHAR(255) NOT NULL,
+    `action` VARCHAR(32) NOT NULL,
+    `namespace` varchar(255) NOT NULL DEFAULT '',
+    `service_name` varchar(255) NOT NULL DEFAULT '',
+    `user` varchar(255) NOT NULL DEFAULT '',
+    `request_id` varchar(64) NOT NULL DEFAULT '',
+    `created_at` datetime(6) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX `idx_loadbalance_history_ip` ON `loadbalance_history` (`ip`, `created_at`);
+
+CREATE INDEX `idx_loadbalance_history_service` ON `loadbalance_history` (`cluster`, `namespace`, `service_name`, `created_at`);
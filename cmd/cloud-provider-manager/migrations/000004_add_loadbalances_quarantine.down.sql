@@ -0,0 +1,7 @@
+DROP INDEX `idx_loadbalances_status_quarantine` ON `loadbalances`;
+
+ALTER TABLE `loadbalances`
+    DROP COLUMN `last_namespace`,
+    DROP COLUMN `last_service_name`,
+    DROP COLUMN `released_at`,
+    DROP COLUMN `quarantine_until`;
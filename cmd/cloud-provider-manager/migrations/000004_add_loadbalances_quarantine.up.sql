@@ -0,0 +1,7 @@
+ALTER TABLE `loadbalances`
+    ADD COLUMN `last_namespace` varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN `last_service_name` varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN `released_at` datetime(6) NULL,
+    ADD COLUMN `quarantine_until` datetime(6) NULL;
+
+CREATE INDEX `idx_loadbalances_status_quarantine` ON `loadbalances` (`status`, `quarantine_until`);
@@ -0,0 +1 @@
+DROP INDEX `idx_loadbalances_last_owner` ON `loadbalances`;
@@ -0,0 +1 @@
+CREATE INDEX `idx_loadbalances_last_owner` ON `loadbalances` (`cluster`, `last_namespace`, `last_service_name`, `released_at`);
@@ -0,0 +1,9 @@
+CREATE TABLE `loadbalance_quotas`(
+    `id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    `cluster` VARCHAR(255) NOT NULL,
+    `namespace` varchar(255) NOT NULL DEFAULT '',
+    `max_ips` bigint(20) NOT NULL,
+    `created_at` datetime(6) NOT NULL,
+    `updated_at` datetime(6) NOT NULL,
+    UNIQUE KEY `uk_loadbalance_quotas_namespace` (`cluster`, `namespace`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
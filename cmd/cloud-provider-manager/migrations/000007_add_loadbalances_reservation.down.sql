@@ -0,0 +1,5 @@
+DROP INDEX `idx_loadbalances_reservation` ON `loadbalances`;
+
+ALTER TABLE `loadbalances`
+    DROP COLUMN `reserved_namespace`,
+    DROP COLUMN `reserved_service_name`;
@@ -0,0 +1,5 @@
+ALTER TABLE `loadbalances`
+    ADD COLUMN `reserved_namespace` varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN `reserved_service_name` varchar(255) NOT NULL DEFAULT '';
+
+CREATE INDEX `idx_loadbalances_reservation` ON `loadbalances` (`cluster`, `reserved_namespace`, `reserved_service_name`);
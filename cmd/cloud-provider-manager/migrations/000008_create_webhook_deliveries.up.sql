@@ -0,0 +1,17 @@
+CREATE TABLE `webhook_deliveries`(
+    `id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    `event_id` varchar(64) NOT NULL,
+    `event_type` varchar(64) NOT NULL,
+    `cluster` VARCHAR(255) NOT NULL DEFAULT '',
+    `subscriber` varchar(255) NOT NULL,
+    `payload` mediumtext NOT NULL,
+    `status` int(10) NOT NULL DEFAULT 0,
+    `attempts` int(10) NOT NULL DEFAULT 0,
+    `next_attempt_at` datetime(6) NOT NULL,
+    `locked_until` datetime(6) NULL,
+    `last_error` varchar(1024) NOT NULL DEFAULT '',
+    `created_at` datetime(6) NOT NULL,
+    `updated_at` datetime(6) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX `idx_webhook_deliveries_subscriber` ON `webhook_deliveries` (`subscriber`, `status`, `id`);
@@ -0,0 +1,8 @@
+CREATE TABLE `pool_watermarks`(
+    `id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    `rule` varchar(255) NOT NULL,
+    `cluster` VARCHAR(255) NOT NULL,
+    `low` tinyint(1) NOT NULL DEFAULT 0,
+    `updated_at` datetime(6) NOT NULL,
+    UNIQUE KEY `uk_pool_watermarks_rule` (`rule`, `cluster`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"fmt"
+	"k8s.io/klog/v2"
+	"strings"
+	"time"
+)
+
+const baselineTable = "loadbalances"
+
+// baselineColumns are the columns of the loadbalances table created by the
+// 01_init.sql schema, before the schema was versioned
+var baselineColumns = []string{"id", "cluster", "ip", "carriers", "status", "cidr", "created_at", "updated_at"}
+
+// baselineUpgrade adds the columns migration 1 has on top of the 01_init.sql
+// schema, keyed by column
+var baselineUpgrade = map[string]string{
+	"namespace":    "ALTER TABLE `loadbalances` ADD COLUMN `namespace` varchar(255) NOT NULL DEFAULT ''",
+	"service_name": "ALTER TABLE `loadbalances` ADD COLUMN `service_name` varchar(255) NOT NULL DEFAULT ''",
+}
+
+// baseline records migration 1 as applied to a loadbalances table that
+// exists without it, created by 01_init.sql or by hand. The table must have
+// every column of the 01_init.sql schema, the columns migration 1 adds are
+// added, the indexes are left to migration 2.
+func (m *Migrator) baseline(migration Migration) error {
+	row := SchemaMigration{
+		Version:   migration.Version,
+		Name:      migration.Name,
+		Dirty:     true,
+		AppliedAt: time.Now(),
+	}
+
+	columns, err := m.db.Migrator().ColumnTypes(baselineTable)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, column := range columns {
+		existing[strings.ToLower(column.Name())] = true
+	}
+	var missing []string
+	for _, column := range baselineColumns {
+		if !existing[column] {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("table %s exists without migration %d_%s and lacks columns %s, move it away before migrating",
+			baselineTable, migration.Version, migration.Name, strings.Join(missing, ", "))
+	}
+
+	if err = m.db.Create(&row).Error; err != nil {
+		return err
+	}
+	for _, column := range []string{"namespace", "service_name"} {
+		if existing[column] {
+			continue
+		}
+		if err = m.exec(baselineUpgrade[column]); err != nil {
+			return fmt.Errorf("baseline migration %d_%s fail: %w", migration.Version, migration.Name, err)
+		}
+	}
+	if err = m.db.Model(&row).Update("dirty", false).Error; err != nil {
+		return err
+	}
+	klog.Infof("baselined existing table %s as migration %d_%s", baselineTable, migration.Version, migration.Name)
+	return nil
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"regexp"
+	"strings"
+)
+
+// the mysql syntax of the migrations sqlite does not accept
+var (
+	sqliteTableOptions  = regexp.MustCompile(`\)\s*ENGINE=[^)]*$`)
+	sqliteAutoIncrement = regexp.MustCompile(`\w+(\(\d+\))? NOT NULL AUTO_INCREMENT PRIMARY KEY`)
+	sqliteDatetime      = regexp.MustCompile(`datetime\(\d+\)`)
+	sqliteUniqueKey     = regexp.MustCompile("UNIQUE KEY (`\\w+`)")
+	sqliteDropIndex     = regexp.MustCompile("^(DROP INDEX `\\w+`) ON `\\w+`$")
+	sqliteAlterTable    = regexp.MustCompile("^(ALTER TABLE `\\w+`)\\s+")
+	sqliteAlterClause   = regexp.MustCompile(`,\s*((?:ADD|DROP) COLUMN)`)
+)
+
+// sqliteStatements rewrites a statement of the migrations for sqlite, which the
+// tests run them on. An ALTER TABLE with several clauses becomes one statement
+// per clause.
+func sqliteStatements(stmt string) []string {
+	stmt = sqliteTableOptions.ReplaceAllString(stmt, ")")
+	stmt = sqliteAutoIncrement.ReplaceAllString(stmt, "INTEGER PRIMARY KEY AUTOINCREMENT")
+	// the driver reads a time only from a column declared datetime
+	stmt = sqliteDatetime.ReplaceAllString(stmt, "datetime")
+	stmt = sqliteUniqueKey.ReplaceAllString(stmt, "CONSTRAINT $1 UNIQUE")
+	stmt = sqliteDropIndex.ReplaceAllString(stmt, "$1")
+
+	match := sqliteAlterTable.FindStringSubmatch(stmt)
+	if match == nil {
+		return []string{stmt}
+	}
+	clauses := sqliteAlterClause.ReplaceAllString(stmt[len(match[0]):], ";$1")
+	var result []string
+	for _, clause := range strings.Split(clauses, ";") {
+		result = append(result, match[1]+" "+strings.TrimSpace(clause))
+	}
+	return result
+}
@@ -0,0 +1,325 @@
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io/fs"
+	"k8s.io/klog/v2"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TableNameSchemaMigration = "schema_migrations"
+
+//go:embed *.sql
+var files embed.FS
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type SchemaMigration struct {
+	Version   int64     `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"column:name"`
+	Dirty     bool      `gorm:"column:dirty"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (*SchemaMigration) TableName() string {
+	return TableNameSchemaMigration
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// Load returns the migrations embedded in this binary ordered by version
+func Load() ([]Migration, error) {
+	return load(files)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names: %s, %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		result = append(result, *m)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	return m.exec("CREATE TABLE IF NOT EXISTS `" + TableNameSchemaMigration + "`(" +
+		"`version` bigint(20) NOT NULL PRIMARY KEY, " +
+		"`name` varchar(255) NOT NULL, " +
+		"`dirty` tinyint(1) NOT NULL DEFAULT 0, " +
+		"`applied_at` datetime(6) NOT NULL" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci")
+}
+
+// applied reads the applied migrations, none while the table does not exist
+// yet. Only Up creates the table, so Check and Status leave the database alone.
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	if !m.db.Migrator().HasTable(TableNameSchemaMigration) {
+		return map[int64]SchemaMigration{}, nil
+	}
+
+	var rows []SchemaMigration
+	if err := m.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+	return result, nil
+}
+
+// statements splits a migration file into single statements, the mysql
+// driver is not opened with multiStatements.
+func statements(sql string) []string {
+	var result []string
+	for _, stmt := range strings.Split(sql, ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			result = append(result, stmt)
+		}
+	}
+	return result
+}
+
+func (m *Migrator) exec(sql string) error {
+	for _, stmt := range statements(sql) {
+		rewritten := []string{stmt}
+		if m.db.Dialector.Name() == "sqlite" {
+			rewritten = sqliteStatements(stmt)
+		}
+		for _, stmt := range rewritten {
+			if err := m.db.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) checkDirty(applied map[int64]SchemaMigration) error {
+	for _, row := range applied {
+		if row.Dirty {
+			return fmt.Errorf("migration %d_%s is dirty, fix the schema by hand and delete its row from %s",
+				row.Version, row.Name, TableNameSchemaMigration)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) Up() error {
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+
+	if err = m.checkDirty(applied); err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		// the migrations create their tables without IF NOT EXISTS, only the
+		// loadbalances table of the unversioned schema is taken over.
+		if migration.Version == 1 && m.db.Migrator().HasTable(baselineTable) {
+			if err = m.baseline(migration); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// mysql commits ddl implicitly, so the row is written as dirty first
+		// and only cleared once every statement succeeded.
+		row := &SchemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Dirty:     true,
+			AppliedAt: time.Now(),
+		}
+		if err = m.db.Create(row).Error; err != nil {
+			return err
+		}
+
+		if err = m.exec(migration.Up); err != nil {
+			return fmt.Errorf("apply migration %d_%s fail: %w", migration.Version, migration.Name, err)
+		}
+
+		if err = m.db.Model(row).Update("dirty", false).Error; err != nil {
+			return err
+		}
+		klog.Infof("applied migration %d_%s", migration.Version, migration.Name)
+	}
+	return nil
+}
+
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return errors.New("down steps must be greater than 0")
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+
+	if err = m.checkDirty(applied); err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := m.migrations[i]
+		row, ok := applied[migration.Version]
+		if !ok {
+			continue
+		}
+
+		if err = m.db.Model(&row).Update("dirty", true).Error; err != nil {
+			return err
+		}
+
+		if err = m.exec(migration.Down); err != nil {
+			return fmt.Errorf("revert migration %d_%s fail: %w", migration.Version, migration.Name, err)
+		}
+
+		if err = m.db.Delete(&row).Error; err != nil {
+			return err
+		}
+		klog.Infof("reverted migration %d_%s", migration.Version, migration.Name)
+		steps--
+	}
+	return nil
+}
+
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.Dirty = row.Dirty
+			status.AppliedAt = row.AppliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Check returns an error if the database schema does not match the
+// migrations embedded in this binary. It only reads the database.
+func (m *Migrator) Check() error {
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+
+	if err = m.checkDirty(applied); err != nil {
+		return err
+	}
+
+	var pending []string
+	known := map[int64]bool{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, fmt.Sprintf("%d_%s", migration.Version, migration.Name))
+		}
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is out of date, pending migrations: %s", strings.Join(pending, ", "))
+	}
+
+	for version, row := range applied {
+		if !known[version] {
+			return fmt.Errorf("database schema is newer than this binary, unknown migration: %d_%s", version, row.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package migrations
+
+import (
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("load embedded migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: versions must have no gaps, expected %d", m.Version, m.Name, i+1)
+		}
+		if len(statements(m.Up)) == 0 || len(statements(m.Down)) == 0 {
+			t.Errorf("migration %d_%s: up and down must hold at least one statement", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		err      string
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"000010_b.up.sql":   {Data: []byte("CREATE TABLE b (id int)")},
+				"000010_b.down.sql": {Data: []byte("DROP TABLE b")},
+				"000002_a.up.sql":   {Data: []byte("CREATE TABLE a (id int)")},
+				"000002_a.down.sql": {Data: []byte("DROP TABLE a")},
+			},
+			versions: []int64{2, 10},
+		},
+		{
+			name: "invalid file name",
+			files: fstest.MapFS{
+				"init.sql": {Data: []byte("CREATE TABLE a (id int)")},
+			},
+			err: "invalid migration file name: init.sql",
+		},
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"000001_a.up.sql": {Data: []byte("CREATE TABLE a (id int)")},
+			},
+			err: "must have both up and down files",
+		},
+		{
+			name: "conflicting names",
+			files: fstest.MapFS{
+				"000001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int)")},
+				"000001_b.down.sql": {Data: []byte("DROP TABLE a")},
+			},
+			err: "conflicting names",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := load(tt.files)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			if !reflect.DeepEqual(versions, tt.versions) {
+				t.Errorf("versions = %v, expected %v", versions, tt.versions)
+			}
+		})
+	}
+}
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{name: "empty", sql: " \n ", want: nil},
+		{name: "single without semicolon", sql: "DROP TABLE a", want: []string{"DROP TABLE a"}},
+		{
+			name: "several with blank lines",
+			sql:  "CREATE INDEX a ON t (a);\n\nCREATE INDEX b ON t (b);\n",
+			want: []string{"CREATE INDEX a ON t (a)", "CREATE INDEX b ON t (b)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements(%q) = %q, expected %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSqliteStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		stmt string
+		want []string
+	}{
+		{
+			name: "table options and auto increment",
+			stmt: "CREATE TABLE `a`(\n    `id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY,\n    `b` int(10) NOT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci",
+			want: []string{"CREATE TABLE `a`(\n    `id` INTEGER PRIMARY KEY AUTOINCREMENT,\n    `b` int(10) NOT NULL\n)"},
+		},
+		{
+			name: "datetime precision",
+			stmt: "ALTER TABLE `a` ADD COLUMN `b` datetime(6) NULL",
+			want: []string{"ALTER TABLE `a` ADD COLUMN `b` datetime NULL"},
+		},
+		{
+			name: "unique key",
+			stmt: "CREATE TABLE `a`(\n    `b` int(10) NOT NULL,\n    UNIQUE KEY `uk_a_b` (`b`)\n)",
+			want: []string{"CREATE TABLE `a`(\n    `b` int(10) NOT NULL,\n    CONSTRAINT `uk_a_b` UNIQUE (`b`)\n)"},
+		},
+		{name: "drop index", stmt: "DROP INDEX `idx_a_b` ON `a`", want: []string{"DROP INDEX `idx_a_b`"}},
+		{
+			name: "alter table clauses",
+			stmt: "ALTER TABLE `a`\n    ADD COLUMN `b` varchar(255) NOT NULL DEFAULT '',\n    DROP COLUMN `c`",
+			want: []string{"ALTER TABLE `a` ADD COLUMN `b` varchar(255) NOT NULL DEFAULT ''", "ALTER TABLE `a` DROP COLUMN `c`"},
+		},
+		{name: "unchanged", stmt: "CREATE INDEX `idx_a_b` ON `a` (`b`)", want: []string{"CREATE INDEX `idx_a_b` ON `a` (`b`)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqliteStatements(tt.stmt); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sqliteStatements(%q) = %q, expected %q", tt.stmt, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestMigrator runs the embedded migrations on an empty sqlite database
+func newTestMigrator(t *testing.T) *Migrator {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	m, err := NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// appliedVersions is the versions Status reports as applied
+func appliedVersions(t *testing.T, m *Migrator) []int64 {
+	t.Helper()
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []int64
+	for _, s := range status {
+		if s.Dirty {
+			t.Errorf("migration %d_%s is dirty", s.Version, s.Name)
+		}
+		if s.Applied {
+			result = append(result, s.Version)
+		}
+	}
+	return result
+}
+
+func TestUpDown(t *testing.T) {
+	m := newTestMigrator(t)
+	var all []int64
+	for _, migration := range m.migrations {
+		all = append(all, migration.Version)
+	}
+	last := len(all)
+
+	if got := appliedVersions(t, m); got != nil {
+		t.Fatalf("applied before up = %v", got)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.Up(); err != nil {
+			t.Fatalf("up %d: %v", i+1, err)
+		}
+		if got := appliedVersions(t, m); !reflect.DeepEqual(got, all) {
+			t.Fatalf("applied after up %d = %v, expected %v", i+1, got, all)
+		}
+	}
+	for _, table := range []string{"loadbalances", "loadbalance_history", "loadbalance_quotas", "webhook_deliveries", "pool_watermarks"} {
+		if !m.db.Migrator().HasTable(table) {
+			t.Errorf("table %s missing after up", table)
+		}
+	}
+	for _, column := range []string{"quarantine_until", "reserved_namespace"} {
+		if !m.db.Migrator().HasColumn("loadbalances", column) {
+			t.Errorf("column loadbalances.%s missing after up", column)
+		}
+	}
+
+	if err := m.Down(0); err == nil {
+		t.Error("down 0 steps succeeded")
+	}
+	if err := m.Down(2); err != nil {
+		t.Fatalf("down 2: %v", err)
+	}
+	if got := appliedVersions(t, m); !reflect.DeepEqual(got, all[:last-2]) {
+		t.Errorf("applied after down 2 = %v, expected %v", got, all[:last-2])
+	}
+	if m.db.Migrator().HasTable("pool_watermarks") || m.db.Migrator().HasTable("webhook_deliveries") {
+		t.Error("tables of the reverted migrations are left")
+	}
+
+	// every down file reverts its up file, up works again from scratch
+	if err := m.Down(last); err != nil {
+		t.Fatalf("down all: %v", err)
+	}
+	if m.db.Migrator().HasTable("loadbalances") {
+		t.Error("loadbalances is left after reverting every migration")
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("up after down: %v", err)
+	}
+}
+
+func TestDirty(t *testing.T) {
+	m := newTestMigrator(t)
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.db.Model(&SchemaMigration{}).Where("version = ?", 3).Update("dirty", true).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{name: "up", run: m.Up},
+		{name: "down", run: func() error { return m.Down(1) }},
+		{name: "check", run: m.Check},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); err == nil || !strings.Contains(err.Error(), "migration 3_create_loadbalance_history is dirty") {
+				t.Errorf("err = %v, expected the dirty migration", err)
+			}
+		})
+	}
+	if !m.db.Migrator().HasTable("pool_watermarks") {
+		t.Error("down reverted a migration while another is dirty")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, m *Migrator)
+		err     string
+	}{
+		{name: "empty database", err: "pending migrations: 1_create_loadbalances"},
+		{
+			name: "up to date",
+			prepare: func(t *testing.T, m *Migrator) {
+				if err := m.Up(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "out of date",
+			prepare: func(t *testing.T, m *Migrator) {
+				if err := m.Up(); err != nil {
+					t.Fatal(err)
+				}
+				if err := m.Down(1); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "pending migrations: 9_create_pool_watermarks",
+		},
+		{
+			name: "newer than the binary",
+			prepare: func(t *testing.T, m *Migrator) {
+				if err := m.Up(); err != nil {
+					t.Fatal(err)
+				}
+				if err := m.db.Create(&SchemaMigration{Version: 100, Name: "future", AppliedAt: time.Now()}).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "unknown migration: 100_future",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMigrator(t)
+			if tt.prepare != nil {
+				tt.prepare(t, m)
+			}
+			hadTable := m.db.Migrator().HasTable(TableNameSchemaMigration)
+
+			err := m.Check()
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("err = %v, expected %q", err, tt.err)
+			}
+			// the check is read only
+			if hasTable := m.db.Migrator().HasTable(TableNameSchemaMigration); hasTable != hadTable {
+				t.Errorf("check changed the existence of %s to %v", TableNameSchemaMigration, hasTable)
+			}
+		})
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		err   string
+	}{
+		{
+			name:  "01_init schema",
+			table: "CREATE TABLE `loadbalances`(`id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY, `cluster` VARCHAR(255) NOT NULL, `ip` VARCHAR(255) NOT NULL, `carriers` int(10) NOT NULL, `status` int(10) NOT NULL DEFAULT 0, `cidr` varchar(255) NOT NULL, `created_at` datetime(6) NOT NULL, `updated_at` datetime(6) NOT NULL)",
+		},
+		{
+			name:  "migration 1 schema",
+			table: "CREATE TABLE `loadbalances`(`id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY, `cluster` VARCHAR(255) NOT NULL, `ip` VARCHAR(255) NOT NULL, `carriers` int(10) NOT NULL, `status` int(10) NOT NULL DEFAULT 0, `cidr` varchar(255) NOT NULL, `namespace` varchar(255) NOT NULL DEFAULT '', `service_name` varchar(255) NOT NULL DEFAULT '', `created_at` datetime(6) NOT NULL, `updated_at` datetime(6) NOT NULL)",
+		},
+		{
+			name:  "unknown schema",
+			table: "CREATE TABLE `loadbalances`(`id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY, `ip` VARCHAR(255) NOT NULL)",
+			err:   "table loadbalances exists without migration 1_create_loadbalances and lacks columns cluster, carriers, status, cidr, created_at, updated_at",
+		},
+		{
+			name:  "other unversioned table",
+			table: "CREATE TABLE `loadbalance_history`(`id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY)",
+			err:   "apply migration 3_create_loadbalance_history fail",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMigrator(t)
+			if err := m.exec(tt.table); err != nil {
+				t.Fatal(err)
+			}
+			if tt.err == "" {
+				if err := m.db.Exec("INSERT INTO `loadbalances` (`cluster`, `ip`, `carriers`, `status`, `cidr`, `created_at`, `updated_at`) VALUES ('c1', '10.0.0.1', 1, 0, '10.0.0.0/24', ?, ?)", time.Now(), time.Now()).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := m.Up()
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("err = %v, expected %q", err, tt.err)
+			}
+			if tt.err != "" {
+				return
+			}
+			if err = m.Check(); err != nil {
+				t.Errorf("check after baseline: %v", err)
+			}
+			var count int64
+			if err = m.db.Table("loadbalances").Where("ip = ? AND namespace = ''", "10.0.0.1").Count(&count).Error; err != nil || count != 1 {
+				t.Errorf("rows kept = %d (%v), expected 1", count, err)
+			}
+			if !m.db.Migrator().HasIndex("loadbalances", "uniq_loadbalances_ip") {
+				t.Error("migration 2 did not index the baselined table")
+			}
+		})
+	}
+}
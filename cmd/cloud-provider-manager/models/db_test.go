@@ -0,0 +1,63 @@
+package models
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/migrations"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	testDB, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=5000"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	// the embedded migrations, so the suite runs on the schema the server checks for
+	migrator, err := migrations.NewMigrator(testDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = migrator.Up(); err != nil {
+		t.Fatalf("create test schema: %v", err)
+	}
+
+	previous := db
+	db = testDB
+	t.Cleanup(func() {
+		db = previous
+		if sqlDB, err := testDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// seedAddresses inserts available ips of cluster in cidr 10.0.0.0/24, ids follow the order of ips
+func seedAddresses(t *testing.T, cluster string, ips ...string) []LoadBalance {
+	t.Helper()
+
+	now := time.Now()
+	rows := make([]LoadBalance, 0, len(ips))
+	for _, ip := range ips {
+		rows = append(rows, LoadBalance{Cluster: cluster, Ip: ip, Carriers: 1, Cidr: "10.0.0.0/24", CreatedAt: now, UpdatedAt: now})
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatalf("seed addresses: %v", err)
+	}
+	return rows
+}
+
+func mustGetByIp(t *testing.T, ip string) *LoadBalance {
+	t.Helper()
+
+	obj, err := LoadBalanceModel.GetByIp(ip)
+	if err != nil {
+		t.Fatalf("get %s: %v", ip, err)
+	}
+	return obj
+}
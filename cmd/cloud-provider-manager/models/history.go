@@ -0,0 +1,112 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const TableNameLoadBalanceHistory = "loadbalance_history"
+
+const (
+	HistoryActionBind    = "bind"
+	HistoryActionRelease = "release"
+	// HistoryActionForceRelease ends a quarantine early, expired quarantines are not recorded
+	HistoryActionForceRelease = "force-release"
+	// reservations are recorded with the namespace and service they apply to
+	HistoryActionReserve   = "reserve"
+	HistoryActionUnreserve = "unreserve"
+	// HistoryActionImport is an address created or overwritten by an import
+	HistoryActionImport = "import"
+)
+
+// Actor is who changed a row, recorded with every history entry
+type Actor struct {
+	User      string
+	RequestId string
+}
+
+// LoadBalanceHistory is append only, a row is written in the transaction of every bind and release
+type LoadBalanceHistory struct {
+	Id          int64     `json:"id"`
+	Cluster     string    `json:"cluster"`
+	Ip          string    `json:"ip"`
+	Action      string    `json:"action"`
+	Namespace   string    `json:"namespace"`
+	ServiceName string    `json:"serviceName"`
+	User        string    `json:"user"`
+	RequestId   string    `json:"requestId"`
+	CreatedAt   time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+func (*LoadBalanceHistory) TableName() string {
+	return TableNameLoadBalanceHistory
+}
+
+type HistoryListOptions struct {
+	Cluster string
+	// Clusters restricts the result to the clusters the caller may access, nil means no restriction
+	Clusters    []string
+	Ip          string
+	Namespace   string
+	ServiceName string
+	// Since is inclusive and Until exclusive, zero values do not filter
+	Since time.Time
+	Until time.Time
+
+	Limit int
+	// BeforeId continues after the last entry of the previous page, 0 starts at the newest
+	BeforeId int64
+}
+
+type loadBalanceHistoryModel struct{}
+
+func recordHistory(tx *gorm.DB, action string, obj *LoadBalance, actor Actor) error {
+	return tx.Create(&LoadBalanceHistory{
+		Cluster:     obj.Cluster,
+		Ip:          obj.Ip,
+		Action:      action,
+		Namespace:   obj.Namespace,
+		ServiceName: obj.ServiceName,
+		User:        actor.User,
+		RequestId:   actor.RequestId,
+		CreatedAt:   obj.UpdatedAt,
+	}).Error
+}
+
+// List returns the newest entries first
+func (c *loadBalanceHistoryModel) List(opts *HistoryListOptions) (result []LoadBalanceHistory, total int64, err error) {
+	tx := db.Model(&LoadBalanceHistory{})
+
+	if opts.Cluster != "" {
+		tx = tx.Where("cluster = ?", opts.Cluster)
+	}
+	if opts.Clusters != nil {
+		tx = tx.Where("cluster IN ?", opts.Clusters)
+	}
+	if opts.Ip != "" {
+		tx = tx.Where("ip = ?", opts.Ip)
+	}
+	if opts.Namespace != "" {
+		tx = tx.Where("namespace = ?", opts.Namespace)
+	}
+	if opts.ServiceName != "" {
+		tx = tx.Where("service_name = ?", opts.ServiceName)
+	}
+	if !opts.Since.IsZero() {
+		tx = tx.Where("created_at >= ?", opts.Since)
+	}
+	if !opts.Until.IsZero() {
+		tx = tx.Where("created_at < ?", opts.Until)
+	}
+
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if opts.BeforeId > 0 {
+		tx = tx.Where("id < ?", opts.BeforeId)
+	}
+
+	err = tx.Order("id DESC").Limit(opts.Limit).Find(&result).Error
+	return
+}
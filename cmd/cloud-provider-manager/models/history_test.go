@@ -0,0 +1,117 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryRecorded(t *testing.T) {
+	setupTestDB(t)
+	seedAddresses(t, "c1", "10.0.0.1")
+
+	steps := []func() error{
+		func() error {
+			_, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "a"}, Actor{User: "controller", RequestId: "r1"})
+			return err
+		},
+		func() error {
+			// a retried bind of the same service is not recorded again
+			_, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "a"}, Actor{User: "controller", RequestId: "r2"})
+			return err
+		},
+		func() error {
+			return LoadBalanceModel.Released(&LoadBalance{Cluster: "c1", Namespace: "ns", ServiceName: "a"}, Actor{User: "controller", RequestId: "r3"})
+		},
+		func() error {
+			_, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "b"}, Actor{User: "admin", RequestId: "r4"})
+			return err
+		},
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+
+	items, total, err := LoadBalanceHistoryModel.List(&HistoryListOptions{Ip: "10.0.0.1", Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type entry struct {
+		Action, Service, User, RequestId string
+	}
+	var got []entry
+	for _, item := range items {
+		if item.Cluster != "c1" || item.Namespace != "ns" || item.CreatedAt.IsZero() {
+			t.Errorf("entry %+v, expected cluster c1, namespace ns and a time", item)
+		}
+		got = append(got, entry{item.Action, item.ServiceName, item.User, item.RequestId})
+	}
+	expected := []entry{
+		{HistoryActionBind, "b", "admin", "r4"},
+		{HistoryActionRelease, "a", "controller", "r3"},
+		{HistoryActionBind, "a", "controller", "r1"},
+	}
+	if !reflect.DeepEqual(got, expected) || total != 3 {
+		t.Errorf("history = %+v (total %d), expected %+v newest first", got, total, expected)
+	}
+}
+
+func TestHistoryList(t *testing.T) {
+	setupTestDB(t)
+
+	start := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	rows := []LoadBalanceHistory{
+		{Cluster: "c1", Ip: "10.0.0.1", Action: HistoryActionBind, Namespace: "ns", ServiceName: "a"},
+		{Cluster: "c1", Ip: "10.0.0.1", Action: HistoryActionRelease, Namespace: "ns", ServiceName: "a"},
+		{Cluster: "c1", Ip: "10.0.0.2", Action: HistoryActionBind, Namespace: "ns", ServiceName: "b"},
+		{Cluster: "c2", Ip: "10.0.1.1", Action: HistoryActionBind, Namespace: "ns", ServiceName: "a"},
+		{Cluster: "c1", Ip: "10.0.0.1", Action: HistoryActionBind, Namespace: "other", ServiceName: "a"},
+	}
+	for i := range rows {
+		rows[i].CreatedAt = start.Add(time.Duration(i) * time.Hour)
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  HistoryListOptions
+		ids   []int64
+		total int64
+	}{
+		{name: "all", ids: []int64{5, 4, 3, 2, 1}, total: 5},
+		{name: "cluster", opts: HistoryListOptions{Cluster: "c2"}, ids: []int64{4}, total: 1},
+		{name: "clusters", opts: HistoryListOptions{Clusters: []string{"c1"}}, ids: []int64{5, 3, 2, 1}, total: 4},
+		{name: "no clusters", opts: HistoryListOptions{Clusters: []string{}}, total: 0},
+		{name: "ip", opts: HistoryListOptions{Ip: "10.0.0.1"}, ids: []int64{5, 2, 1}, total: 3},
+		{name: "service", opts: HistoryListOptions{Namespace: "ns", ServiceName: "a"}, ids: []int64{4, 2, 1}, total: 3},
+		{name: "since is inclusive", opts: HistoryListOptions{Since: start.Add(3 * time.Hour)}, ids: []int64{5, 4}, total: 2},
+		{name: "until is exclusive", opts: HistoryListOptions{Until: start.Add(time.Hour)}, ids: []int64{1}, total: 1},
+		{name: "first page", opts: HistoryListOptions{Limit: 2}, ids: []int64{5, 4}, total: 5},
+		{name: "next page", opts: HistoryListOptions{Limit: 2, BeforeId: 4}, ids: []int64{3, 2}, total: 5},
+		{name: "last page", opts: HistoryListOptions{Limit: 2, BeforeId: 2}, ids: []int64{1}, total: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts.Limit == 0 {
+				opts.Limit = -1
+			}
+			items, total, err := LoadBalanceHistoryModel.List(&opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, item := range items {
+				ids = append(ids, item.Id)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) || total != tt.total {
+				t.Errorf("ids = %v (total %d), expected %v (total %d)", ids, total, tt.ids, tt.total)
+			}
+		})
+	}
+}
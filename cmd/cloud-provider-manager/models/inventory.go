@@ -0,0 +1,668 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"gopkg.in/yaml.v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net"
+	"time"
+)
+
+// the version and kind of an inventory document, Import refuses any other
+const (
+	InventoryAPIVersion = "loadbalance.cloudprovider.io/v1"
+	InventoryKind       = "Inventory"
+)
+
+// the status of an address in an inventory, the names of the LoadBalanceStatus values
+const (
+	InventoryStatusAvailable   = "available"
+	InventoryStatusBound       = "bound"
+	InventoryStatusQuarantined = "quarantined"
+	InventoryStatusReserved    = "reserved"
+)
+
+var inventoryStatuses = map[string]int{
+	InventoryStatusAvailable:   LoadBalanceStatusAvailable,
+	InventoryStatusBound:       LoadBalanceStatusBound,
+	InventoryStatusQuarantined: LoadBalanceStatusQuarantined,
+	InventoryStatusReserved:    LoadBalanceStatusReserved,
+}
+
+// the conflict modes of Import
+const (
+	// ImportConflictFail applies nothing while any conflict is left, the default
+	ImportConflictFail = "fail"
+	// ImportConflictSkip keeps the rows of the database
+	ImportConflictSkip = "skip"
+	// ImportConflictOverwrite replaces the rows of the database with the document
+	ImportConflictOverwrite = "overwrite"
+)
+
+var (
+	ErrInventoryInvalid  = errors.New("invalid inventory")
+	ErrInventoryConflict = errors.New("inventory conflicts with the database")
+	// ErrInventoryForbidden is returned in every conflict mode
+	ErrInventoryForbidden = errors.New("inventory takes addresses of clusters out of scope")
+)
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// Inventory is the address pool of some clusters: their addresses grouped by
+// pool with bindings and reservations, and their quotas
+type Inventory struct {
+	APIVersion string             `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string             `json:"kind" yaml:"kind"`
+	ExportedAt *time.Time         `json:"exportedAt,omitempty" yaml:"exportedAt,omitempty"`
+	Clusters   []InventoryCluster `json:"clusters" yaml:"clusters"`
+}
+
+type InventoryCluster struct {
+	Name   string           `json:"name" yaml:"name"`
+	Pools  []InventoryPool  `json:"pools" yaml:"pools"`
+	Quotas []InventoryQuota `json:"quotas,omitempty" yaml:"quotas,omitempty"`
+}
+
+type InventoryPool struct {
+	Cidr      string             `json:"cidr" yaml:"cidr"`
+	Carriers  int                `json:"carriers" yaml:"carriers"`
+	Addresses []InventoryAddress `json:"addresses" yaml:"addresses"`
+}
+
+// InventoryAddress is bound to Binding, reserved for Reservation and was last
+// released from LastBinding
+type InventoryAddress struct {
+	Ip              string            `json:"ip" yaml:"ip"`
+	Status          string            `json:"status" yaml:"status"`
+	Binding         *InventoryService `json:"binding,omitempty" yaml:"binding,omitempty"`
+	Reservation     *InventoryService `json:"reservation,omitempty" yaml:"reservation,omitempty"`
+	LastBinding     *InventoryService `json:"lastBinding,omitempty" yaml:"lastBinding,omitempty"`
+	ReleasedAt      *time.Time        `json:"releasedAt,omitempty" yaml:"releasedAt,omitempty"`
+	QuarantineUntil *time.Time        `json:"quarantineUntil,omitempty" yaml:"quarantineUntil,omitempty"`
+}
+
+// InventoryService is a service, or every service of the namespace for a reservation without ServiceName
+type InventoryService struct {
+	Namespace   string `json:"namespace" yaml:"namespace"`
+	ServiceName string `json:"serviceName,omitempty" yaml:"serviceName,omitempty"`
+}
+
+// InventoryQuota without a namespace is the quota of the cluster
+type InventoryQuota struct {
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Limit     int64  `json:"limit" yaml:"limit"`
+}
+
+// ImportOptions.Clusters are the clusters the caller may change, nil for every cluster
+type ImportOptions struct {
+	DryRun     bool
+	OnConflict string
+	Clusters   []string
+}
+
+func (o *ImportOptions) allows(cluster string) bool {
+	if o.Clusters == nil {
+		return true
+	}
+	for _, c := range o.Clusters {
+		if c == cluster {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportIssue is an invalid or conflicting entry of the document, Ip is empty for quotas
+type ImportIssue struct {
+	Cluster   string `json:"cluster"`
+	Ip        string `json:"ip,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Message   string `json:"message"`
+}
+
+type ImportCounts struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+}
+
+// ImportReport tells what an import changed, or would change when DryRun is set.
+// Applied is false for a dry run and whenever Errors or Conflicts stopped it.
+type ImportReport struct {
+	DryRun    bool          `json:"dryRun"`
+	Applied   bool          `json:"applied"`
+	Addresses ImportCounts  `json:"addresses"`
+	Quotas    ImportCounts  `json:"quotas"`
+	Errors    []ImportIssue `json:"errors"`
+	Conflicts []ImportIssue `json:"conflicts"`
+}
+
+// EncodeInventory writes the document as parsers.JSON or parsers.YAML
+func EncodeInventory(inv *Inventory, format string) ([]byte, error) {
+	switch format {
+	case parsers.JSON:
+		return json.MarshalIndent(inv, "", "  ")
+	case parsers.YAML:
+		return yaml.Marshal(inv)
+	}
+	return nil, fmt.Errorf("unknown format %s, expected json or yaml", format)
+}
+
+// DecodeInventory reads a parsers.JSON or parsers.YAML document, unknown fields are an error
+func DecodeInventory(data []byte, format string) (*Inventory, error) {
+	inv := &Inventory{}
+	switch format {
+	case parsers.JSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(inv); err != nil {
+			return nil, err
+		}
+	case parsers.YAML:
+		if err := yaml.UnmarshalStrict(data, inv); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %s, expected json or yaml", format)
+	}
+	return inv, nil
+}
+
+func inventoryService(namespace, name string) *InventoryService {
+	if namespace == "" && name == "" {
+		return nil
+	}
+	return &InventoryService{Namespace: namespace, ServiceName: name}
+}
+
+func (s *InventoryService) names() (string, string) {
+	if s == nil {
+		return "", ""
+	}
+	return s.Namespace, s.ServiceName
+}
+
+func inventoryStatus(status int) string {
+	for name, value := range inventoryStatuses {
+		if value == status {
+			return name
+		}
+	}
+	return fmt.Sprintf("%d", status)
+}
+
+func inventoryAddress(m *LoadBalance) InventoryAddress {
+	return InventoryAddress{
+		Ip:              m.Ip,
+		Status:          inventoryStatus(m.Status),
+		Binding:         inventoryService(m.Namespace, m.ServiceName),
+		Reservation:     inventoryService(m.ReservedNamespace, m.ReservedServiceName),
+		LastBinding:     inventoryService(m.LastNamespace, m.LastServiceName),
+		ReleasedAt:      m.ReleasedAt,
+		QuarantineUntil: m.QuarantineUntil,
+	}
+}
+
+type inventoryModel struct{}
+
+// Export returns the inventory of the given clusters, of all when nil
+func (c *inventoryModel) Export(clusters []string) (*Inventory, error) {
+	var addresses []LoadBalance
+	tx := db.Order("cluster, cidr, carriers, id")
+	if clusters != nil {
+		tx = tx.Where("cluster IN ?", clusters)
+	}
+	if err := tx.Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+
+	var quotas []LoadBalanceQuota
+	tx = db.Order("cluster, namespace")
+	if clusters != nil {
+		tx = tx.Where("cluster IN ?", clusters)
+	}
+	if err := tx.Find(&quotas).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	inventory := &Inventory{APIVersion: InventoryAPIVersion, Kind: InventoryKind, ExportedAt: &now, Clusters: []InventoryCluster{}}
+	byName := map[string]*InventoryCluster{}
+	cluster := func(name string) *InventoryCluster {
+		if byName[name] == nil {
+			inventory.Clusters = append(inventory.Clusters, InventoryCluster{Name: name, Pools: []InventoryPool{}})
+			// the slice may have moved, refresh every pointer
+			for i := range inventory.Clusters {
+				byName[inventory.Clusters[i].Name] = &inventory.Clusters[i]
+			}
+		}
+		return byName[name]
+	}
+
+	for i := range addresses {
+		m := &addresses[i]
+		ic := cluster(m.Cluster)
+		if n := len(ic.Pools); n == 0 || ic.Pools[n-1].Cidr != m.Cidr || ic.Pools[n-1].Carriers != m.Carriers {
+			ic.Pools = append(ic.Pools, InventoryPool{Cidr: m.Cidr, Carriers: m.Carriers})
+		}
+		pool := &ic.Pools[len(ic.Pools)-1]
+		pool.Addresses = append(pool.Addresses, inventoryAddress(m))
+	}
+	for _, quota := range quotas {
+		ic := cluster(quota.Cluster)
+		ic.Quotas = append(ic.Quotas, InventoryQuota{Namespace: quota.Namespace, Limit: quota.Limit})
+	}
+	return inventory, nil
+}
+
+// Validate checks the document on its own, the database is not consulted
+func (inv *Inventory) Validate() []ImportIssue {
+	issues := make([]ImportIssue, 0)
+	invalid := func(cluster, ip, namespace, format string, args ...interface{}) {
+		issues = append(issues, ImportIssue{Cluster: cluster, Ip: ip, Namespace: namespace, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if inv.APIVersion != InventoryAPIVersion || inv.Kind != InventoryKind {
+		invalid("", "", "", "expected apiVersion %s and kind %s, got %q and %q", InventoryAPIVersion, InventoryKind, inv.APIVersion, inv.Kind)
+		return issues
+	}
+
+	clusters := map[string]bool{}
+	ips := map[string]string{}
+	for _, cluster := range inv.Clusters {
+		if cluster.Name == "" {
+			invalid("", "", "", "cluster without a name")
+			continue
+		}
+		if clusters[cluster.Name] {
+			invalid(cluster.Name, "", "", "cluster listed twice")
+		}
+		clusters[cluster.Name] = true
+
+		services := map[string]string{}
+		for _, pool := range cluster.Pools {
+			_, network, err := net.ParseCIDR(pool.Cidr)
+			if err != nil {
+				invalid(cluster.Name, "", "", "invalid cidr %q", pool.Cidr)
+			}
+
+			for _, address := range pool.Addresses {
+				ip := net.ParseIP(address.Ip)
+				switch {
+				case ip == nil:
+					invalid(cluster.Name, address.Ip, "", "invalid ip")
+					continue
+				case network != nil && !network.Contains(ip):
+					invalid(cluster.Name, address.Ip, "", "ip is outside of cidr %s", pool.Cidr)
+				}
+				if other, ok := ips[address.Ip]; ok {
+					invalid(cluster.Name, address.Ip, "", "ip listed twice, also in cluster %s", other)
+				}
+				ips[address.Ip] = cluster.Name
+
+				status, ok := inventoryStatuses[address.Status]
+				if !ok {
+					invalid(cluster.Name, address.Ip, "", "unknown status %q", address.Status)
+					continue
+				}
+				if (status == LoadBalanceStatusBound) != (address.Binding != nil) {
+					invalid(cluster.Name, address.Ip, "", "a binding is required for status bound and only allowed for it")
+				}
+				if address.Binding != nil {
+					if address.Binding.Namespace == "" || address.Binding.ServiceName == "" {
+						invalid(cluster.Name, address.Ip, "", "a binding needs namespace and serviceName")
+					}
+					key := address.Binding.Namespace + "/" + address.Binding.ServiceName
+					if other, ok := services[key]; ok {
+						invalid(cluster.Name, address.Ip, address.Binding.Namespace, "service %s is also bound to %s", key, other)
+					}
+					services[key] = address.Ip
+				}
+				if status == LoadBalanceStatusReserved && address.Reservation == nil {
+					invalid(cluster.Name, address.Ip, "", "a reservation is required for status reserved")
+				}
+				if address.Reservation != nil && address.Reservation.Namespace == "" {
+					invalid(cluster.Name, address.Ip, "", "a reservation needs a namespace")
+				}
+				if (status == LoadBalanceStatusQuarantined) != (address.QuarantineUntil != nil) {
+					invalid(cluster.Name, address.Ip, "", "quarantineUntil is required for status quarantined and only allowed for it")
+				}
+			}
+		}
+
+		namespaces := map[string]bool{}
+		for _, quota := range cluster.Quotas {
+			if namespaces[quota.Namespace] {
+				invalid(cluster.Name, "", quota.Namespace, "quota listed twice")
+			}
+			namespaces[quota.Namespace] = true
+			if quota.Limit < 0 {
+				invalid(cluster.Name, "", quota.Namespace, "limit must not be negative")
+			}
+		}
+	}
+	return issues
+}
+
+// row is the database row the address describes, Id and CreatedAt are left to the caller
+func (a *InventoryAddress) row(cluster string, pool *InventoryPool) *LoadBalance {
+	m := &LoadBalance{
+		Cluster:         cluster,
+		Ip:              a.Ip,
+		Carriers:        pool.Carriers,
+		Status:          inventoryStatuses[a.Status],
+		Cidr:            pool.Cidr,
+		ReleasedAt:      a.ReleasedAt,
+		QuarantineUntil: a.QuarantineUntil,
+	}
+	m.Namespace, m.ServiceName = a.Binding.names()
+	m.ReservedNamespace, m.ReservedServiceName = a.Reservation.names()
+	m.LastNamespace, m.LastServiceName = a.LastBinding.names()
+	return m
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	// the database keeps microseconds
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
+
+// sameAddress compares everything an inventory holds
+func sameAddress(a, b *LoadBalance) bool {
+	return a.Cluster == b.Cluster && a.Ip == b.Ip && a.Carriers == b.Carriers && a.Status == b.Status &&
+		a.Cidr == b.Cidr && a.Namespace == b.Namespace && a.ServiceName == b.ServiceName &&
+		a.ReservedNamespace == b.ReservedNamespace && a.ReservedServiceName == b.ReservedServiceName &&
+		a.LastNamespace == b.LastNamespace && a.LastServiceName == b.LastServiceName &&
+		sameTime(a.ReleasedAt, b.ReleasedAt) && sameTime(a.QuarantineUntil, b.QuarantineUntil)
+}
+
+// Import loads the document in one transaction. Rows equal to the document are
+// left alone, a row that differs is a conflict handled as opts.OnConflict says.
+// A service the document binds is a conflict too while the database binds it to
+// an ip the import does not rebind, that address is never overwritten. An address
+// the database has in a cluster outside opts.Clusters fails the import with
+// ErrInventoryForbidden whatever the conflict mode, a binding over the quota of
+// its namespace or cluster with ErrInventoryConflict. Bindings the import adds
+// or removes queue Bound and Released webhook events.
+func (c *inventoryModel) Import(inv *Inventory, opts ImportOptions, actor Actor) (*ImportReport, error) {
+	report := &ImportReport{DryRun: opts.DryRun, Errors: inv.Validate(), Conflicts: make([]ImportIssue, 0)}
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = ImportConflictFail
+	case ImportConflictFail, ImportConflictSkip, ImportConflictOverwrite:
+	default:
+		report.Errors = append(report.Errors, ImportIssue{Message: "unknown conflict mode " + opts.OnConflict})
+	}
+	if len(report.Errors) > 0 {
+		return report, ErrInventoryInvalid
+	}
+
+	var changed []LoadBalance
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if changed, err = c.importAddresses(tx, inv, opts, actor, report); err != nil {
+			return err
+		}
+		if err = c.importQuotas(tx, inv, opts, report); err != nil {
+			return err
+		}
+		exceeded, err := checkImportQuotas(tx, changed, report)
+		if err != nil {
+			return err
+		}
+		if exceeded || opts.OnConflict == ImportConflictFail && len(report.Conflicts) > 0 {
+			return ErrInventoryConflict
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+
+	report.Applied = true
+	for _, m := range changed {
+		watch.Default.Publish(m.Cluster, watch.Modified, m)
+	}
+	return report, nil
+}
+
+func (c *inventoryModel) importAddresses(tx *gorm.DB, inv *Inventory, opts ImportOptions, actor Actor, report *ImportReport) ([]LoadBalance, error) {
+	documented := map[string]*LoadBalance{}
+	var ips []string
+	for _, cluster := range inv.Clusters {
+		for i := range cluster.Pools {
+			for _, address := range cluster.Pools[i].Addresses {
+				documented[address.Ip] = address.row(cluster.Name, &cluster.Pools[i])
+				ips = append(ips, address.Ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, nil
+	}
+
+	var rows []LoadBalance
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("ip IN ?", ips).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*LoadBalance, len(rows))
+	for i := range rows {
+		existing[rows[i].Ip] = &rows[i]
+	}
+
+	now := time.Now()
+	var changed []LoadBalance
+	forbidden := false
+	for _, ip := range ips {
+		m, current := documented[ip], existing[ip]
+		conflict := func(format string, args ...interface{}) {
+			report.Conflicts = append(report.Conflicts, ImportIssue{Cluster: m.Cluster, Ip: ip, Namespace: m.Namespace, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if current != nil && sameAddress(m, current) {
+			report.Addresses.Unchanged++
+			continue
+		}
+
+		// the caller can not take an address from a cluster it has no access to
+		if current != nil && !opts.allows(current.Cluster) {
+			conflict("belongs to cluster %s in the database, which the caller may not change", current.Cluster)
+			report.Addresses.Skipped++
+			forbidden = true
+			continue
+		}
+
+		// overwriting would bind the service twice, it is skipped in every mode
+		if m.Status == LoadBalanceStatusBound {
+			other, err := boundElsewhere(tx, m, documented)
+			if err != nil {
+				return nil, err
+			}
+			if other != "" {
+				conflict("service %s/%s is bound to %s in the database, release it first", m.Namespace, m.ServiceName, other)
+				report.Addresses.Skipped++
+				continue
+			}
+		}
+
+		if current != nil {
+			conflict("differs from the database, which has it %s in cluster %s", describeAddress(current), current.Cluster)
+			if opts.OnConflict != ImportConflictOverwrite {
+				report.Addresses.Skipped++
+				continue
+			}
+		}
+
+		m.UpdatedAt = now
+		if current == nil {
+			m.CreatedAt = now
+			report.Addresses.Created++
+		} else {
+			m.Id, m.CreatedAt = current.Id, current.CreatedAt
+			report.Addresses.Updated++
+		}
+		if err := tx.Save(m).Error; err != nil {
+			return nil, err
+		}
+		if err := recordHistory(tx, HistoryActionImport, m, actor); err != nil {
+			return nil, err
+		}
+		for _, event := range importEvents(current, m, actor) {
+			if err := enqueueEvent(tx, event); err != nil {
+				return nil, err
+			}
+		}
+		changed = append(changed, *m)
+	}
+	if forbidden {
+		return nil, ErrInventoryForbidden
+	}
+	return changed, nil
+}
+
+// importEvents are the webhook events of importing m over current. A binding
+// the import ends is Released with the row it had, one it starts is Bound.
+func importEvents(current, m *LoadBalance, actor Actor) []*WebhookEvent {
+	wasBound := current != nil && current.Status == LoadBalanceStatusBound
+	isBound := m.Status == LoadBalanceStatusBound
+	if wasBound && isBound && current.Namespace == m.Namespace && current.ServiceName == m.ServiceName {
+		return nil
+	}
+
+	var events []*WebhookEvent
+	if wasBound {
+		released := *m
+		if isBound {
+			released = *current
+			released.UpdatedAt = m.UpdatedAt
+		}
+		events = append(events, addressEvent(EventReleased, &released, actor))
+	}
+	if isBound {
+		events = append(events, addressEvent(EventBound, m, actor))
+	}
+	return events
+}
+
+// checkImportQuotas reports every quota the bindings of changed exceed as a
+// conflict, skipping or overwriting does not resolve them
+func checkImportQuotas(tx *gorm.DB, changed []LoadBalance, report *ImportReport) (bool, error) {
+	checked := map[string]bool{}
+	reported := map[string]bool{}
+	for _, m := range changed {
+		if m.Status != LoadBalanceStatusBound || checked[m.Cluster+"/"+m.Namespace] {
+			continue
+		}
+		checked[m.Cluster+"/"+m.Namespace] = true
+
+		excess, err := exceededQuota(tx, m.Cluster, m.Namespace)
+		if err != nil {
+			return false, err
+		}
+		if excess == nil || reported[m.Cluster+"/"+excess.scope] {
+			continue
+		}
+		reported[m.Cluster+"/"+excess.scope] = true
+		report.Conflicts = append(report.Conflicts, ImportIssue{
+			Cluster:   m.Cluster,
+			Namespace: m.Namespace,
+			Message:   fmt.Sprintf("%s: %s would use %d of %d ips", ErrQuotaExceeded, excess.scope, excess.used, excess.limit),
+		})
+	}
+	return len(reported) > 0, nil
+}
+
+// boundElsewhere returns the ip the database binds the service of m to, unless
+// it is m itself or the document gives that ip another binding
+func boundElsewhere(tx *gorm.DB, m *LoadBalance, documented map[string]*LoadBalance) (string, error) {
+	var bound []LoadBalance
+	err := tx.Where("cluster = ? AND namespace = ? AND service_name = ? AND status = ?",
+		m.Cluster, m.Namespace, m.ServiceName, LoadBalanceStatusBound).Find(&bound).Error
+	if err != nil {
+		return "", err
+	}
+	for _, row := range bound {
+		if row.Ip == m.Ip {
+			continue
+		}
+		if other, ok := documented[row.Ip]; ok && (other.Namespace != m.Namespace || other.ServiceName != m.ServiceName) {
+			continue
+		}
+		return row.Ip, nil
+	}
+	return "", nil
+}
+
+func describeAddress(m *LoadBalance) string {
+	switch m.Status {
+	case LoadBalanceStatusBound:
+		return fmt.Sprintf("bound to %s/%s", m.Namespace, m.ServiceName)
+	case LoadBalanceStatusReserved:
+		return fmt.Sprintf("reserved for %s/%s", m.ReservedNamespace, m.ReservedServiceName)
+	}
+	return fmt.Sprintf("%s in pool %s", inventoryStatus(m.Status), m.Cidr)
+}
+
+func (c *inventoryModel) importQuotas(tx *gorm.DB, inv *Inventory, opts ImportOptions, report *ImportReport) error {
+	now := time.Now()
+	for _, cluster := range inv.Clusters {
+		for _, quota := range cluster.Quotas {
+			var current *LoadBalanceQuota
+			err := tx.Where("cluster = ? AND namespace = ?", cluster.Name, quota.Namespace).First(&current).Error
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+
+			if err == nil {
+				if current.Limit == quota.Limit {
+					report.Quotas.Unchanged++
+					continue
+				}
+				report.Conflicts = append(report.Conflicts, ImportIssue{
+					Cluster:   cluster.Name,
+					Namespace: quota.Namespace,
+					Message:   fmt.Sprintf("quota limit %d differs from %d in the database", quota.Limit, current.Limit),
+				})
+				if opts.OnConflict != ImportConflictOverwrite {
+					report.Quotas.Skipped++
+					continue
+				}
+				current.Limit, current.UpdatedAt = quota.Limit, now
+				if err = tx.Save(current).Error; err != nil {
+					return err
+				}
+				report.Quotas.Updated++
+				continue
+			}
+
+			err = tx.Create(&LoadBalanceQuota{
+				Cluster:   cluster.Name,
+				Namespace: quota.Namespace,
+				Limit:     quota.Limit,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			report.Quotas.Created++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testInventory documents a single address of cluster c1 in pool 10.0.0.0/24
+func testInventory(address InventoryAddress, quotas ...InventoryQuota) *Inventory {
+	return &Inventory{
+		APIVersion: InventoryAPIVersion,
+		Kind:       InventoryKind,
+		Clusters: []InventoryCluster{{
+			Name:   "c1",
+			Pools:  []InventoryPool{{Cidr: "10.0.0.0/24", Carriers: 1, Addresses: []InventoryAddress{address}}},
+			Quotas: quotas,
+		}},
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	available := InventoryAddress{Ip: "10.0.0.1", Status: InventoryStatusAvailable}
+	bound := InventoryAddress{Ip: "10.0.0.1", Status: InventoryStatusBound, Binding: &InventoryService{Namespace: "ns", ServiceName: "web"}}
+
+	tests := []struct {
+		name    string
+		cluster string
+		// boundElsewhere binds ns/web to 10.0.0.2 in the database
+		boundElsewhere bool
+		address        InventoryAddress
+		opts           ImportOptions
+		err            error
+		counts         ImportCounts
+		conflicts      int
+		// status and cluster of 10.0.0.1 after the import
+		status     int
+		rowCluster string
+		applied    bool
+	}{
+		{name: "equal", cluster: "c1", address: available, counts: ImportCounts{Unchanged: 1}, status: LoadBalanceStatusAvailable, rowCluster: "c1", applied: true},
+		{name: "new address", address: available, counts: ImportCounts{Created: 1}, status: LoadBalanceStatusAvailable, rowCluster: "c1", applied: true},
+		{name: "differs", cluster: "c1", address: bound, err: ErrInventoryConflict, counts: ImportCounts{Skipped: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c1"},
+		{name: "differs skipped", cluster: "c1", address: bound, opts: ImportOptions{OnConflict: ImportConflictSkip}, counts: ImportCounts{Skipped: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c1", applied: true},
+		{name: "differs overwritten", cluster: "c1", address: bound, opts: ImportOptions{OnConflict: ImportConflictOverwrite}, counts: ImportCounts{Updated: 1}, conflicts: 1, status: LoadBalanceStatusBound, rowCluster: "c1", applied: true},
+		{name: "dry run", cluster: "c1", address: bound, opts: ImportOptions{OnConflict: ImportConflictOverwrite, DryRun: true}, counts: ImportCounts{Updated: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c1"},
+		{name: "service bound elsewhere", cluster: "c1", boundElsewhere: true, address: bound, opts: ImportOptions{OnConflict: ImportConflictOverwrite}, counts: ImportCounts{Skipped: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c1", applied: true},
+		{name: "other cluster in scope", cluster: "c2", address: available, opts: ImportOptions{OnConflict: ImportConflictOverwrite, Clusters: []string{"c1", "c2"}}, counts: ImportCounts{Updated: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c1", applied: true},
+		{name: "other cluster overwritten without scope", cluster: "c2", address: available, opts: ImportOptions{OnConflict: ImportConflictOverwrite}, counts: ImportCounts{Updated: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c1", applied: true},
+		{name: "other cluster out of scope", cluster: "c2", address: available, opts: ImportOptions{OnConflict: ImportConflictOverwrite, Clusters: []string{"c1"}}, err: ErrInventoryForbidden, counts: ImportCounts{Skipped: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c2"},
+		{name: "other cluster out of scope skipped", cluster: "c2", address: available, opts: ImportOptions{OnConflict: ImportConflictSkip, Clusters: []string{"c1"}}, err: ErrInventoryForbidden, counts: ImportCounts{Skipped: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c2"},
+		{name: "other cluster out of empty scope", cluster: "c2", address: available, opts: ImportOptions{OnConflict: ImportConflictOverwrite, Clusters: []string{}}, err: ErrInventoryForbidden, counts: ImportCounts{Skipped: 1}, conflicts: 1, status: LoadBalanceStatusAvailable, rowCluster: "c2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			if tt.cluster != "" {
+				seedAddresses(t, tt.cluster, "10.0.0.1")
+			}
+			if tt.boundElsewhere {
+				seedAddresses(t, "c1", "10.0.0.2")
+				if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.2", Namespace: "ns", ServiceName: "web"}, Actor{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			report, err := InventoryModel.Import(testInventory(tt.address), tt.opts, Actor{User: "test"})
+			if tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if report.Addresses != tt.counts || len(report.Conflicts) != tt.conflicts || report.Applied != tt.applied {
+				t.Errorf("report = %+v, expected counts %+v, %d conflicts and applied %v", report, tt.counts, tt.conflicts, tt.applied)
+			}
+			if row := mustGetByIp(t, "10.0.0.1"); row.Status != tt.status || row.Cluster != tt.rowCluster {
+				t.Errorf("row = status %d in %s, expected status %d in %s", row.Status, row.Cluster, tt.status, tt.rowCluster)
+			}
+		})
+	}
+}
+
+func TestImportQuotaConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   ImportOptions
+		err    error
+		counts ImportCounts
+		limit  int64
+	}{
+		{name: "differs", err: ErrInventoryConflict, counts: ImportCounts{Skipped: 1}, limit: 5},
+		{name: "differs skipped", opts: ImportOptions{OnConflict: ImportConflictSkip}, counts: ImportCounts{Skipped: 1}, limit: 5},
+		{name: "differs overwritten", opts: ImportOptions{OnConflict: ImportConflictOverwrite}, counts: ImportCounts{Updated: 1}, limit: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			seedAddresses(t, "c1", "10.0.0.1")
+			mustSetQuota(t, "c1", "ns", 5)
+
+			inv := testInventory(InventoryAddress{Ip: "10.0.0.1", Status: InventoryStatusAvailable}, InventoryQuota{Namespace: "ns", Limit: 10})
+			report, err := InventoryModel.Import(inv, tt.opts, Actor{User: "test"})
+			if tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if report.Quotas != tt.counts || len(report.Conflicts) != 1 {
+				t.Errorf("report = %+v, expected quota counts %+v and a conflict", report, tt.counts)
+			}
+			var quota LoadBalanceQuota
+			if err = db.Where("cluster = ? AND namespace = ?", "c1", "ns").First(&quota).Error; err != nil {
+				t.Fatal(err)
+			}
+			if quota.Limit != tt.limit {
+				t.Errorf("limit = %d, expected %d", quota.Limit, tt.limit)
+			}
+		})
+	}
+}
+
+func TestImportEvents(t *testing.T) {
+	available := InventoryAddress{Ip: "10.0.0.1", Status: InventoryStatusAvailable}
+	bound := InventoryAddress{Ip: "10.0.0.1", Status: InventoryStatusBound, Binding: &InventoryService{Namespace: "ns", ServiceName: "web"}}
+	overwrite := ImportOptions{OnConflict: ImportConflictOverwrite}
+
+	tests := []struct {
+		name string
+		// seed creates 10.0.0.1 in the database, bound to ns/<seedBinding> when set
+		seed        bool
+		seedBinding string
+		address     InventoryAddress
+		opts        ImportOptions
+		events      []string
+	}{
+		{name: "new binding", address: bound, events: []string{EventBound}},
+		{name: "new available address", address: available, events: []string{}},
+		{name: "bound by overwrite", seed: true, address: bound, opts: overwrite, events: []string{EventBound}},
+		{name: "released by overwrite", seed: true, seedBinding: "web", address: available, opts: overwrite, events: []string{EventReleased}},
+		{name: "rebound by overwrite", seed: true, seedBinding: "api", address: bound, opts: overwrite, events: []string{EventReleased, EventBound}},
+		{name: "equal binding", seed: true, seedBinding: "web", address: bound, events: []string{}},
+		{name: "dry run", address: bound, opts: ImportOptions{DryRun: true}, events: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			if tt.seed {
+				seedAddresses(t, "c1", "10.0.0.1")
+			}
+			if tt.seedBinding != "" {
+				if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: tt.seedBinding}, Actor{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			setSubscribers(t)
+
+			if _, err := InventoryModel.Import(testInventory(tt.address), tt.opts, Actor{User: "test"}); err != nil {
+				t.Fatal(err)
+			}
+			if events := deliveryTypes(t); !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("events = %v, expected %v", events, tt.events)
+			}
+		})
+	}
+}
+
+func TestImportQuota(t *testing.T) {
+	bound := InventoryAddress{Ip: "10.0.0.1", Status: InventoryStatusBound, Binding: &InventoryService{Namespace: "ns", ServiceName: "web"}}
+
+	tests := []struct {
+		name   string
+		quotas []InventoryQuota
+		opts   ImportOptions
+		err    error
+		// conflicts is the number of conflicts, quota the message of the last one
+		conflicts int
+		quota     string
+		applied   bool
+	}{
+		{name: "over the namespace quota", err: ErrInventoryConflict, conflicts: 1, quota: "namespace ns would use 2 of 1 ips"},
+		{name: "over the namespace quota skipped", opts: ImportOptions{OnConflict: ImportConflictSkip}, err: ErrInventoryConflict, conflicts: 1, quota: "namespace ns would use 2 of 1 ips"},
+		{name: "over the cluster quota of the document", quotas: []InventoryQuota{{Limit: 1}}, opts: ImportOptions{OnConflict: ImportConflictOverwrite}, err: ErrInventoryConflict, conflicts: 1, quota: "cluster c1 would use 2 of 1 ips"},
+		{name: "quota raised by the document", quotas: []InventoryQuota{{Namespace: "ns", Limit: 2}}, opts: ImportOptions{OnConflict: ImportConflictOverwrite}, conflicts: 1, quota: "quota limit 2 differs from 1", applied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			seedAddresses(t, "c1", "10.0.0.2")
+			mustSetQuota(t, "c1", "ns", 1)
+			if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.2", Namespace: "ns", ServiceName: "api"}, Actor{}); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := InventoryModel.Import(testInventory(bound, tt.quotas...), tt.opts, Actor{User: "test"})
+			if tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if len(report.Conflicts) != tt.conflicts || !strings.Contains(report.Conflicts[len(report.Conflicts)-1].Message, tt.quota) {
+				t.Errorf("conflicts = %+v, expected %d, the last naming %q", report.Conflicts, tt.conflicts, tt.quota)
+			}
+			if report.Applied != tt.applied {
+				t.Errorf("applied = %v, expected %v", report.Applied, tt.applied)
+			}
+			var count int64
+			if err = db.Model(&LoadBalance{}).Where("ip = ?", "10.0.0.1").Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			expected := int64(0)
+			if tt.applied {
+				expected = 1
+			}
+			if count != expected {
+				t.Errorf("10.0.0.1 has %d rows, expected %d", count, expected)
+			}
+		})
+	}
+}
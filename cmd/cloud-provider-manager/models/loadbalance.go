@@ -2,11 +2,38 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
+	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
 const TableNameLoadBalance = "loadbalances"
 
+const (
+	LoadBalanceStatusAvailable = 0
+	LoadBalanceStatusBound     = 1
+	// LoadBalanceStatusQuarantined is a released ip held back until QuarantineUntil
+	LoadBalanceStatusQuarantined = 2
+	// LoadBalanceStatusReserved is an unbound ip only its reservation may bind
+	LoadBalanceStatusReserved = 3
+)
+
+// allocateCandidates is how many free ips one allocation tries before giving up
+const allocateCandidates = 5
+
+var (
+	ErrAlreadyBound = errors.New("ip has been bound")
+	ErrQuarantined  = errors.New("ip is quarantined")
+	// ErrNotQuarantined is returned by ForceRelease for an ip that is bound or available
+	ErrNotQuarantined = errors.New("ip is not quarantined")
+	ErrPoolExhausted  = errors.New("no available ip")
+	ErrReserved       = errors.New("ip is reserved")
+	// ErrNotFound is returned when no row matches, handlers match it instead of the gorm error
+	ErrNotFound = gorm.ErrRecordNotFound
+)
+
 type LoadBalance struct {
 	Id          int64     `json:"id"`
 	Cluster     string    `json:"cluster"`
@@ -18,56 +45,382 @@ type LoadBalance struct {
 	ServiceName string    `json:"serviceName"`
 	CreatedAt   time.Time `json:"createdAt" gorm:"column:created_at"`
 	UpdatedAt   time.Time `json:"updatedAt" gorm:"column:updated_at"`
+
+	// the service the ip was last released from
+	LastNamespace   string     `json:"lastNamespace,omitempty"`
+	LastServiceName string     `json:"lastServiceName,omitempty"`
+	ReleasedAt      *time.Time `json:"releasedAt,omitempty"`
+	QuarantineUntil *time.Time `json:"quarantineUntil,omitempty"`
+
+	// the reservation, an empty service lets every service of the namespace bind
+	// the ip. It is kept while the ip is bound and restored on release.
+	ReservedNamespace   string `json:"reservedNamespace,omitempty"`
+	ReservedServiceName string `json:"reservedServiceName,omitempty"`
+}
+
+// reservedFor reports whether the reservation lets the service bind the ip
+func (m *LoadBalance) reservedFor(namespace, name string) bool {
+	return m.ReservedNamespace == namespace && (m.ReservedServiceName == "" || m.ReservedServiceName == name)
 }
 
 func (*LoadBalance) TableName() string {
 	return TableNameLoadBalance
 }
 
+type LoadBalanceListOptions struct {
+	Cluster string
+	// Clusters restricts the result to the clusters the caller may access, nil means no restriction
+	Clusters    []string
+	Status      *int
+	Cidr        string
+	Carriers    *int
+	Namespace   string
+	ServiceName string
+	IpPrefix    string
+	// Reserved only matches reserved ips, ReservedNamespace and ReservedServiceName
+	// the ips a service of the namespace may bind
+	Reserved            bool
+	ReservedNamespace   string
+	ReservedServiceName string
+
+	// OrderBy is a column name, Desc reverses it, id is always the tie breaker
+	OrderBy string
+	Desc    bool
+
+	Limit int
+	// After continues the order after a row of the previous page, nil starts at the first row
+	After *ListCursor
+}
+
+// ListCursor is the last row of a page: its id and the value of the OrderBy column
+type ListCursor struct {
+	Id    int64
+	Value interface{}
+}
+
 type loadBalanceModel struct{}
 
-func (c *loadBalanceModel) List(values map[string]interface{}) (result *[]LoadBalance) {
-	db.Where(values).Find(&result)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (c *loadBalanceModel) List(opts *LoadBalanceListOptions) (result []LoadBalance, total int64, err error) {
+	tx := db.Model(&LoadBalance{})
+
+	if opts.Cluster != "" {
+		tx = tx.Where("cluster = ?", opts.Cluster)
+	}
+	if opts.Clusters != nil {
+		tx = tx.Where("cluster IN ?", opts.Clusters)
+	}
+	if opts.Status != nil {
+		tx = tx.Where("status = ?", *opts.Status)
+	}
+	if opts.Cidr != "" {
+		tx = tx.Where("cidr = ?", opts.Cidr)
+	}
+	if opts.Carriers != nil {
+		tx = tx.Where("carriers = ?", *opts.Carriers)
+	}
+	if opts.Namespace != "" {
+		tx = tx.Where("namespace = ?", opts.Namespace)
+	}
+	if opts.ServiceName != "" {
+		tx = tx.Where("service_name = ?", opts.ServiceName)
+	}
+	if opts.IpPrefix != "" {
+		tx = tx.Where("ip LIKE ?", likeEscaper.Replace(opts.IpPrefix)+"%")
+	}
+	if opts.Reserved {
+		tx = tx.Where("reserved_namespace <> ''")
+	}
+	if opts.ReservedNamespace != "" {
+		tx = tx.Where("reserved_namespace = ?", opts.ReservedNamespace)
+	}
+	if opts.ReservedServiceName != "" {
+		tx = tx.Where("reserved_service_name IN ?", []string{"", opts.ReservedServiceName})
+	}
+
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "id"
+	if opts.OrderBy != "" && opts.OrderBy != "id" {
+		order = opts.OrderBy + ", id"
+	}
+	if opts.Desc {
+		order = strings.ReplaceAll(order, ",", " DESC,") + " DESC"
+	}
+
+	// the rows after the cursor in the order, the total above is not affected
+	if opts.After != nil {
+		op := ">"
+		if opts.Desc {
+			op = "<"
+		}
+		if order == "id" || order == "id DESC" {
+			tx = tx.Where("id "+op+" ?", opts.After.Id)
+		} else {
+			tx = tx.Where(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", opts.OrderBy, op),
+				opts.After.Value, opts.After.Value, opts.After.Id)
+		}
+	}
+
+	err = tx.Order(order).Limit(opts.Limit).Find(&result).Error
 	return
 }
 
+// Pool counts the ips of a cidr and carrier of a cluster by status
+type Pool struct {
+	Cidr        string `json:"cidr"`
+	Carriers    int    `json:"carriers"`
+	Total       int64  `json:"total"`
+	Available   int64  `json:"available"`
+	Bound       int64  `json:"bound"`
+	Quarantined int64  `json:"quarantined"`
+	Reserved    int64  `json:"reserved"`
+}
+
+func (c *loadBalanceModel) Pools(cluster string) ([]Pool, error) {
+	var result []Pool
+	err := db.Model(&LoadBalance{}).
+		Select("cidr, carriers, COUNT(*) AS total, SUM(status = ?) AS available, SUM(status = ?) AS bound, SUM(status = ?) AS quarantined, SUM(status = ?) AS reserved",
+			LoadBalanceStatusAvailable, LoadBalanceStatusBound, LoadBalanceStatusQuarantined, LoadBalanceStatusReserved).
+		Where("cluster = ?", cluster).
+		Group("cidr, carriers").
+		Order("cidr, carriers").
+		Scan(&result).Error
+	return result, err
+}
+
+// PoolStats is Pool of any cluster
+type PoolStats struct {
+	Cluster string `json:"cluster"`
+	Pool
+}
+
+// Stats counts the ips of every cidr and carrier, of the given clusters or of all when nil
+func (c *loadBalanceModel) Stats(clusters []string) ([]PoolStats, error) {
+	var result []PoolStats
+	tx := db.Model(&LoadBalance{}).
+		Select("cluster, cidr, carriers, COUNT(*) AS total, SUM(status = ?) AS available, SUM(status = ?) AS bound, SUM(status = ?) AS quarantined, SUM(status = ?) AS reserved",
+			LoadBalanceStatusAvailable, LoadBalanceStatusBound, LoadBalanceStatusQuarantined, LoadBalanceStatusReserved)
+	if clusters != nil {
+		tx = tx.Where("cluster IN ?", clusters)
+	}
+	err := tx.Group("cluster, cidr, carriers").
+		Order("cluster, cidr, carriers").
+		Scan(&result).Error
+	return result, err
+}
+
 func (c *loadBalanceModel) GetByIp(ip string) (*LoadBalance, error) {
 	var result *LoadBalance
 	err := db.Where("ip = ?", ip).First(&result).Error
 	return result, err
 }
 
-func (c *loadBalanceModel) GetByService(name, namespace string) (*LoadBalance, error) {
+func (c *loadBalanceModel) GetByService(cluster, name, namespace string) (*LoadBalance, error) {
 	var result *LoadBalance
-	err := db.Where("service_name = ? AND namespace = ?", name, namespace).First(&result).Error
+	err := db.Where("cluster = ? AND service_name = ? AND namespace = ? AND status = ?",
+		cluster, name, namespace, LoadBalanceStatusBound).First(&result).Error
 	return result, err
 }
 
-func (c *loadBalanceModel) Bind(m *LoadBalance) (*LoadBalance, error) {
+func (c *loadBalanceModel) Bind(m *LoadBalance, actor Actor) (*LoadBalance, error) {
 	obj, err := c.GetByIp(m.Ip)
 	if err != nil {
 		return nil, err
 	}
 
-	if obj.Status == 1 {
-		return nil, errors.New("ip has been bound")
+	if obj.Cluster != m.Cluster {
+		return nil, fmt.Errorf("ip %s does not belong to cluster %s: %w", m.Ip, m.Cluster, ErrNotFound)
+	}
+
+	switch obj.Status {
+	case LoadBalanceStatusBound:
+		// binding again to the same service is a no-op so clients can safely retry
+		if obj.Namespace == m.Namespace && obj.ServiceName == m.ServiceName {
+			return obj, nil
+		}
+		return nil, ErrAlreadyBound
+	case LoadBalanceStatusQuarantined:
+		// the quarantine protects other services, the service it was released from may take it back
+		if obj.LastNamespace != m.Namespace || obj.LastServiceName != m.ServiceName {
+			return nil, fmt.Errorf("ip %s: %w", m.Ip, ErrQuarantined)
+		}
+	case LoadBalanceStatusReserved:
+		if !obj.reservedFor(m.Namespace, m.ServiceName) {
+			return nil, fmt.Errorf("ip %s: %w", m.Ip, ErrReserved)
+		}
+	}
+
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// the state checked above must still hold, a concurrent bind, release or
+		// reservation of the ip leaves it unchanged
+		result := tx.Model(&LoadBalance{}).
+			Where("id = ? AND status = ? AND last_namespace = ? AND last_service_name = ? AND reserved_namespace = ? AND reserved_service_name = ?",
+				obj.Id, obj.Status, obj.LastNamespace, obj.LastServiceName, obj.ReservedNamespace, obj.ReservedServiceName).
+			Updates(map[string]interface{}{
+				"status":           LoadBalanceStatusBound,
+				"quarantine_until": nil,
+				"namespace":        m.Namespace,
+				"service_name":     m.ServiceName,
+				"updated_at":       now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("ip %s changed concurrently: %w", m.Ip, ErrAlreadyBound)
+		}
+		// counted after the conditional update, the ip is bound in tx whatever was read above
+		if err := checkQuota(tx, obj.Cluster, m.Namespace); err != nil {
+			return err
+		}
+
+		obj.UpdatedAt = now
+		obj.Status = LoadBalanceStatusBound
+		obj.QuarantineUntil = nil
+		obj.Namespace = m.Namespace
+		obj.ServiceName = m.ServiceName
+		if err := recordHistory(tx, HistoryActionBind, obj, actor); err != nil {
+			return err
+		}
+		return enqueueEvent(tx, addressEvent(EventBound, obj, actor))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	watch.Default.Publish(obj.Cluster, watch.Bound, *obj)
+	return obj, nil
+}
+
+// AllocateOptions change where Allocate takes the ip from
+type AllocateOptions struct {
+	// Sticky prefers the ip the service released within StickyRetention
+	Sticky bool
+	// Reserved only takes ips reserved for the service or its namespace
+	Reserved bool
+}
+
+// Allocate binds a free ip of the cluster to the service, a service that already
+// holds an ip gets it back. A candidate bound, quarantined or reserved by someone
+// else after it was listed is skipped.
+func (c *loadBalanceModel) Allocate(cluster, name, namespace string, opts AllocateOptions, actor Actor) (*LoadBalance, error) {
+	obj, err := c.GetByService(cluster, name, namespace)
+	if err == nil {
+		return obj, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	if opts.Sticky {
+		obj, err = c.Previous(cluster, name, namespace)
+		if err == nil {
+			obj, err = c.Bind(&LoadBalance{Cluster: cluster, Ip: obj.Ip, Namespace: namespace, ServiceName: name}, actor)
+		}
+		if err == nil {
+			return obj, nil
+		}
+		if !errors.Is(err, ErrNotFound) && !taken(err) {
+			return nil, err
+		}
+	}
+
+	status := LoadBalanceStatusAvailable
+	listOptions := &LoadBalanceListOptions{Cluster: cluster, Status: &status, Limit: allocateCandidates}
+	if opts.Reserved {
+		status = LoadBalanceStatusReserved
+		listOptions.ReservedNamespace, listOptions.ReservedServiceName = namespace, name
+	}
+	candidates, _, err := c.List(listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		obj, err = c.Bind(&LoadBalance{Cluster: cluster, Ip: candidate.Ip, Namespace: namespace, ServiceName: name}, actor)
+		if err == nil {
+			return obj, nil
+		}
+		if !taken(err) {
+			return nil, err
+		}
 	}
+	notifyPoolExhausted(cluster, name, namespace, opts, actor)
+	if opts.Reserved {
+		return nil, fmt.Errorf("%w reserved for service %s/%s in cluster %s", ErrPoolExhausted, namespace, name, cluster)
+	}
+	return nil, fmt.Errorf("%w in cluster %s", ErrPoolExhausted, cluster)
+}
 
-	obj.UpdatedAt = time.Now()
-	obj.Status = 1
-	obj.Namespace = m.Namespace
-	obj.ServiceName = m.ServiceName
-	return obj, db.Save(&obj).Error
+// taken reports whether Bind failed because the ip is held by another service
+func taken(err error) bool {
+	return errors.Is(err, ErrAlreadyBound) || errors.Is(err, ErrQuarantined) || errors.Is(err, ErrReserved)
 }
 
-func (c *loadBalanceModel) Released(m *LoadBalance) error {
-	obj, err := c.GetByService(m.ServiceName, m.Namespace)
+func (c *loadBalanceModel) Released(m *LoadBalance, actor Actor) error {
+	obj, err := c.GetByService(m.Cluster, m.ServiceName, m.Namespace)
+	if err != nil {
+		return err
+	}
+
+	// the history keeps the service the ip was released from
+	now := time.Now()
+	released := *obj
+	released.UpdatedAt = now
+	released.LastNamespace, released.LastServiceName = obj.Namespace, obj.ServiceName
+	released.ReleasedAt = &now
+	released.Namespace = ""
+	released.ServiceName = ""
+	released.Status = LoadBalanceStatusAvailable
+	switch {
+	case obj.ReservedNamespace != "":
+		// only the reservation may bind it again, a quarantine would not add anything
+		released.Status = LoadBalanceStatusReserved
+	case QuarantineCooldown > 0:
+		until := now.Add(QuarantineCooldown)
+		released.Status = LoadBalanceStatusQuarantined
+		released.QuarantineUntil = &until
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// a concurrent release or rebind of the ip leaves it unchanged
+		result := tx.Model(&LoadBalance{}).
+			Where("id = ? AND status = ? AND namespace = ? AND service_name = ?",
+				obj.Id, LoadBalanceStatusBound, obj.Namespace, obj.ServiceName).
+			Updates(map[string]interface{}{
+				"status":            released.Status,
+				"namespace":         "",
+				"service_name":      "",
+				"last_namespace":    released.LastNamespace,
+				"last_service_name": released.LastServiceName,
+				"released_at":       now,
+				"quarantine_until":  released.QuarantineUntil,
+				"updated_at":        now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("ip %s of service %s/%s released concurrently: %w", obj.Ip, obj.Namespace, obj.ServiceName, ErrNotFound)
+		}
+
+		entry := *obj
+		entry.UpdatedAt = now
+		if err := recordHistory(tx, HistoryActionRelease, &entry, actor); err != nil {
+			return err
+		}
+		return enqueueEvent(tx, addressEvent(EventReleased, &released, actor))
+	})
 	if err != nil {
 		return err
 	}
-	obj.Namespace = ""
-	obj.ServiceName = ""
-	obj.Status = 0
-	obj.UpdatedAt = time.Now()
-	return db.Save(&obj).Error
+
+	obj = &released
+	watch.Default.Publish(obj.Cluster, watch.Released, *obj)
+	return nil
 }
@@ -0,0 +1,268 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func ips(items []LoadBalance) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.Ip)
+	}
+	return result
+}
+
+func TestListFilters(t *testing.T) {
+	setupTestDB(t)
+	seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2", "10.0.1.1")
+	seedAddresses(t, "c2", "10.0.0.3")
+	if err := db.Model(&LoadBalance{}).Where("ip = ?", "10.0.0.2").
+		Updates(map[string]interface{}{"status": LoadBalanceStatusBound, "namespace": "ns", "service_name": "svc"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	bound := LoadBalanceStatusBound
+	tests := []struct {
+		name  string
+		opts  LoadBalanceListOptions
+		ips   []string
+		total int64
+	}{
+		{name: "cluster", opts: LoadBalanceListOptions{Cluster: "c1"}, ips: []string{"10.0.0.1", "10.0.0.2", "10.0.1.1"}, total: 3},
+		{name: "clusters", opts: LoadBalanceListOptions{Clusters: []string{"c2"}}, ips: []string{"10.0.0.3"}, total: 1},
+		{name: "no clusters", opts: LoadBalanceListOptions{Clusters: []string{}}, ips: []string{}, total: 0},
+		{name: "status", opts: LoadBalanceListOptions{Status: &bound}, ips: []string{"10.0.0.2"}, total: 1},
+		{name: "service", opts: LoadBalanceListOptions{Namespace: "ns", ServiceName: "svc"}, ips: []string{"10.0.0.2"}, total: 1},
+		{name: "ip prefix", opts: LoadBalanceListOptions{IpPrefix: "10.0.1."}, ips: []string{"10.0.1.1"}, total: 1},
+		{name: "ip prefix is not a pattern", opts: LoadBalanceListOptions{IpPrefix: "10_0"}, ips: []string{}, total: 0},
+		{name: "limit", opts: LoadBalanceListOptions{Limit: 2}, ips: []string{"10.0.0.1", "10.0.0.2"}, total: 4},
+		{name: "sort desc", opts: LoadBalanceListOptions{Cluster: "c1", OrderBy: "ip", Desc: true}, ips: []string{"10.0.1.1", "10.0.0.2", "10.0.0.1"}, total: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts.Limit == 0 {
+				opts.Limit = -1
+			}
+			items, total, err := LoadBalanceModel.List(&opts)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if got := ips(items); !reflect.DeepEqual(got, tt.ips) {
+				t.Errorf("ips = %v, expected %v", got, tt.ips)
+			}
+			if total != tt.total {
+				t.Errorf("total = %d, expected %d", total, tt.total)
+			}
+		})
+	}
+}
+
+// TestListAfterCursor walks the free ips two at a time while the first of them
+// is bound between the pages, the walk must neither skip nor repeat a row
+func TestListAfterCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		orderBy string
+		desc    bool
+		value   func(m *LoadBalance) interface{}
+		ips     []string
+	}{
+		{name: "id", value: func(m *LoadBalance) interface{} { return nil }, ips: []string{"10.0.0.5", "10.0.0.1", "10.0.0.4", "10.0.0.2", "10.0.0.3"}},
+		{name: "ip", orderBy: "ip", value: func(m *LoadBalance) interface{} { return m.Ip }, ips: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}},
+		{name: "ip desc", orderBy: "ip", desc: true, value: func(m *LoadBalance) interface{} { return m.Ip }, ips: []string{"10.0.0.5", "10.0.0.4", "10.0.0.3", "10.0.0.2", "10.0.0.1"}},
+		{name: "cidr ties", orderBy: "cidr", value: func(m *LoadBalance) interface{} { return m.Cidr }, ips: []string{"10.0.0.5", "10.0.0.1", "10.0.0.4", "10.0.0.2", "10.0.0.3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			seedAddresses(t, "c1", "10.0.0.5", "10.0.0.1", "10.0.0.4", "10.0.0.2", "10.0.0.3")
+
+			available := LoadBalanceStatusAvailable
+			opts := &LoadBalanceListOptions{Cluster: "c1", Status: &available, OrderBy: tt.orderBy, Desc: tt.desc, Limit: 2}
+			var walked []string
+			for {
+				items, _, err := LoadBalanceModel.List(opts)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				if len(items) == 0 {
+					break
+				}
+				walked = append(walked, ips(items)...)
+
+				// the first row of the page leaves the filter
+				if err = db.Model(&LoadBalance{}).Where("id = ?", items[0].Id).Update("status", LoadBalanceStatusBound).Error; err != nil {
+					t.Fatal(err)
+				}
+				last := &items[len(items)-1]
+				opts.After = &ListCursor{Id: last.Id, Value: tt.value(last)}
+			}
+
+			if !reflect.DeepEqual(walked, tt.ips) {
+				t.Errorf("walked %v, expected %v", walked, tt.ips)
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare map[string]interface{}
+		bind    LoadBalance
+		err     error
+	}{
+		{name: "available", bind: LoadBalance{Cluster: "c1", Namespace: "ns", ServiceName: "a"}},
+		{
+			name:    "bound to the same service",
+			prepare: map[string]interface{}{"status": LoadBalanceStatusBound, "namespace": "ns", "service_name": "a"},
+			bind:    LoadBalance{Cluster: "c1", Namespace: "ns", ServiceName: "a"},
+		},
+		{
+			name:    "bound to another service",
+			prepare: map[string]interface{}{"status": LoadBalanceStatusBound, "namespace": "ns", "service_name": "b"},
+			bind:    LoadBalance{Cluster: "c1", Namespace: "ns", ServiceName: "a"},
+			err:     ErrAlreadyBound,
+		},
+		{name: "other cluster", bind: LoadBalance{Cluster: "c2", Namespace: "ns", ServiceName: "a"}, err: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			seedAddresses(t, "c1", "10.0.0.1")
+			if tt.prepare != nil {
+				if err := db.Model(&LoadBalance{}).Where("ip = ?", "10.0.0.1").Updates(tt.prepare).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m := tt.bind
+			m.Ip = "10.0.0.1"
+			obj, err := LoadBalanceModel.Bind(&m, Actor{User: "test"})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			stored := mustGetByIp(t, "10.0.0.1")
+			if obj.Status != LoadBalanceStatusBound || stored.Status != LoadBalanceStatusBound || stored.ServiceName != m.ServiceName {
+				t.Errorf("bound %+v, stored %+v, expected both bound to %s", obj, stored, m.ServiceName)
+			}
+		})
+	}
+}
+
+// serializeDB gives the test database a single connection, the reads outside
+// the transactions still interleave but sqlite does not fail with busy errors
+func serializeDB(t *testing.T) {
+	t.Helper()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+}
+
+func TestConcurrentAllocate(t *testing.T) {
+	setupTestDB(t)
+	serializeDB(t)
+	seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+
+	const services = 8
+	var wg sync.WaitGroup
+	errs := make([]error, services)
+	for i := 0; i < services; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = LoadBalanceModel.Allocate("c1", fmt.Sprintf("svc-%d", i), "ns", AllocateOptions{}, Actor{})
+		}(i)
+	}
+	wg.Wait()
+
+	allocated := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			allocated++
+		case !errors.Is(err, ErrPoolExhausted):
+			t.Errorf("service %d: %v", i, err)
+		}
+	}
+	if allocated != 3 {
+		t.Errorf("%d services got an ip, expected 3", allocated)
+	}
+
+	// every ip is bound once and recorded once
+	bound := LoadBalanceStatusBound
+	items, _, err := LoadBalanceModel.List(&LoadBalanceListOptions{Status: &bound, Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, _, err := LoadBalanceHistoryModel.List(&HistoryListOptions{Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || len(history) != 3 {
+		t.Errorf("%d bound ips with %d history entries, expected 3 of each", len(items), len(history))
+	}
+	holders := map[string]bool{}
+	for _, entry := range history {
+		if holders[entry.Ip] {
+			t.Errorf("ip %s was bound twice", entry.Ip)
+		}
+		holders[entry.Ip] = true
+	}
+}
+
+func TestConcurrentRelease(t *testing.T) {
+	setupTestDB(t)
+	serializeDB(t)
+	seedAddresses(t, "c1", "10.0.0.1")
+	if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "a"}, Actor{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = LoadBalanceModel.Released(&LoadBalance{Cluster: "c1", Namespace: "ns", ServiceName: "a"}, Actor{})
+		}(i)
+	}
+	wg.Wait()
+
+	released := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			released++
+		case !errors.Is(err, ErrNotFound):
+			t.Errorf("release %d: %v", i, err)
+		}
+	}
+	history, _, err := LoadBalanceHistoryModel.List(&HistoryListOptions{Ip: "10.0.0.1", Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released != 1 || len(history) != 2 {
+		t.Errorf("released %d times with %d history entries, expected once after the bind", released, len(history))
+	}
+
+	obj := mustGetByIp(t, "10.0.0.1")
+	if obj.Status == LoadBalanceStatusBound || obj.LastServiceName != "a" || obj.ServiceName != "" {
+		t.Errorf("ip after release = %+v", obj)
+	}
+}
@@ -1,9 +1,19 @@
 package models
 
 var (
-	LoadBalanceModel *loadBalanceModel
+	LoadBalanceModel        *loadBalanceModel
+	LoadBalanceHistoryModel *loadBalanceHistoryModel
+	LoadBalanceQuotaModel   *loadBalanceQuotaModel
+	WebhookDeliveryModel    *webhookDeliveryModel
+	PoolWatermarkModel      *poolWatermarkModel
+	InventoryModel          *inventoryModel
 )
 
 func init() {
 	LoadBalanceModel = &loadBalanceModel{}
+	LoadBalanceHistoryModel = &loadBalanceHistoryModel{}
+	LoadBalanceQuotaModel = &loadBalanceQuotaModel{}
+	WebhookDeliveryModel = &webhookDeliveryModel{}
+	PoolWatermarkModel = &poolWatermarkModel{}
+	InventoryModel = &inventoryModel{}
 }
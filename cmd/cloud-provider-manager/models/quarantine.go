@@ -0,0 +1,111 @@
+package models
+
+import (
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"gorm.io/gorm"
+	"time"
+)
+
+const defaultQuarantineInterval = 10 * time.Second
+
+var (
+	// QuarantineCooldown is how long a released ip stays out of allocation, 0 frees it at once
+	QuarantineCooldown time.Duration
+	// QuarantineInterval is how often expired quarantines are freed
+	QuarantineInterval = defaultQuarantineInterval
+)
+
+func SetupQuarantine(cfg config.CloudProviderQuarantineConfig) {
+	QuarantineCooldown = cfg.Cooldown
+	if cfg.Interval > 0 {
+		QuarantineInterval = cfg.Interval
+	}
+}
+
+// free makes a quarantined ip available, the status condition keeps a concurrent
+// bind or a second manager from being overwritten
+func (c *loadBalanceModel) free(tx *gorm.DB, obj *LoadBalance) (bool, error) {
+	now := time.Now()
+	result := tx.Model(&LoadBalance{}).
+		Where("id = ? AND status = ?", obj.Id, LoadBalanceStatusQuarantined).
+		Updates(map[string]interface{}{
+			"status":           LoadBalanceStatusAvailable,
+			"quarantine_until": nil,
+			"updated_at":       now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	obj.Status = LoadBalanceStatusAvailable
+	obj.QuarantineUntil = nil
+	obj.UpdatedAt = now
+	return true, nil
+}
+
+// ExpireQuarantine frees every ip whose quarantine ended before now and returns them
+func (c *loadBalanceModel) ExpireQuarantine(now time.Time) ([]LoadBalance, error) {
+	var expired []LoadBalance
+	err := db.Where("status = ? AND quarantine_until <= ?", LoadBalanceStatusQuarantined, now).
+		Order("quarantine_until").Find(&expired).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]LoadBalance, 0, len(expired))
+	for i := range expired {
+		var ok bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if ok, err = c.free(tx, &expired[i]); err != nil || !ok {
+				return err
+			}
+			return enqueueEvent(tx, addressEvent(EventQuarantineExpired, &expired[i], Actor{}))
+		})
+		if err != nil {
+			return result, err
+		}
+		if ok {
+			watch.Default.Publish(expired[i].Cluster, watch.Modified, expired[i])
+			result = append(result, expired[i])
+		}
+	}
+	return result, nil
+}
+
+// ForceRelease ends the quarantine of an ip of the cluster at once
+func (c *loadBalanceModel) ForceRelease(cluster, ip string, actor Actor) (*LoadBalance, error) {
+	obj, err := c.GetByIp(ip)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Cluster != cluster {
+		return nil, fmt.Errorf("ip %s does not belong to cluster %s: %w", ip, cluster, ErrNotFound)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		ok, err := c.free(tx, obj)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("ip %s: %w", ip, ErrNotQuarantined)
+		}
+		// recorded against the service the ip was quarantined from
+		entry := *obj
+		entry.Namespace, entry.ServiceName = obj.LastNamespace, obj.LastServiceName
+		if err := recordHistory(tx, HistoryActionForceRelease, &entry, actor); err != nil {
+			return err
+		}
+		// ended early, the user tells it from an expiry
+		return enqueueEvent(tx, addressEvent(EventQuarantineExpired, obj, actor))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	watch.Default.Publish(obj.Cluster, watch.Modified, *obj)
+	return obj, nil
+}
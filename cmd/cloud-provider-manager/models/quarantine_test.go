@@ -0,0 +1,203 @@
+package models
+
+import (
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"testing"
+	"time"
+)
+
+// setCooldown quarantines the ips released during the test
+func setCooldown(t *testing.T, cooldown time.Duration) {
+	t.Helper()
+
+	previous := QuarantineCooldown
+	QuarantineCooldown = cooldown
+	t.Cleanup(func() {
+		QuarantineCooldown = previous
+	})
+}
+
+// bindAndRelease leaves ip released by service a of namespace ns
+func bindAndRelease(t *testing.T, ip string) {
+	t.Helper()
+
+	if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: ip, Namespace: "ns", ServiceName: "a"}, Actor{}); err != nil {
+		t.Fatalf("bind %s: %v", ip, err)
+	}
+	if err := LoadBalanceModel.Released(&LoadBalance{Cluster: "c1", Namespace: "ns", ServiceName: "a"}, Actor{}); err != nil {
+		t.Fatalf("release %s: %v", ip, err)
+	}
+}
+
+func TestQuarantineTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		action   func() error
+		err      error
+		status   int
+	}{
+		{
+			name:   "released without cooldown",
+			action: func() error { return nil },
+			status: LoadBalanceStatusAvailable,
+		},
+		{
+			name:     "released with cooldown",
+			cooldown: time.Hour,
+			action:   func() error { return nil },
+			status:   LoadBalanceStatusQuarantined,
+		},
+		{
+			name:     "other service binds",
+			cooldown: time.Hour,
+			action: func() error {
+				_, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "b"}, Actor{})
+				return err
+			},
+			err:    ErrQuarantined,
+			status: LoadBalanceStatusQuarantined,
+		},
+		{
+			name:     "last service takes it back",
+			cooldown: time.Hour,
+			action: func() error {
+				_, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "a"}, Actor{})
+				return err
+			},
+			status: LoadBalanceStatusBound,
+		},
+		{
+			name:     "allocation skips it",
+			cooldown: time.Hour,
+			action: func() error {
+				_, err := LoadBalanceModel.Allocate("c1", "b", "ns", AllocateOptions{}, Actor{})
+				return err
+			},
+			err:    ErrPoolExhausted,
+			status: LoadBalanceStatusQuarantined,
+		},
+		{
+			name:     "force release",
+			cooldown: time.Hour,
+			action: func() error {
+				_, err := LoadBalanceModel.ForceRelease("c1", "10.0.0.1", Actor{User: "admin"})
+				return err
+			},
+			status: LoadBalanceStatusAvailable,
+		},
+		{
+			name:     "force release of another cluster",
+			cooldown: time.Hour,
+			action: func() error {
+				_, err := LoadBalanceModel.ForceRelease("c2", "10.0.0.1", Actor{})
+				return err
+			},
+			err:    ErrNotFound,
+			status: LoadBalanceStatusQuarantined,
+		},
+		{
+			name: "force release of a free ip",
+			action: func() error {
+				_, err := LoadBalanceModel.ForceRelease("c1", "10.0.0.1", Actor{})
+				return err
+			},
+			err:    ErrNotQuarantined,
+			status: LoadBalanceStatusAvailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			setCooldown(t, tt.cooldown)
+			seedAddresses(t, "c1", "10.0.0.1")
+			bindAndRelease(t, "10.0.0.1")
+
+			if err := tt.action(); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			obj := mustGetByIp(t, "10.0.0.1")
+			if obj.Status != tt.status {
+				t.Errorf("status = %d, expected %d", obj.Status, tt.status)
+			}
+			if (obj.Status == LoadBalanceStatusQuarantined) != (obj.QuarantineUntil != nil) {
+				t.Errorf("status %d with quarantine until %v", obj.Status, obj.QuarantineUntil)
+			}
+			if obj.LastNamespace != "ns" || obj.LastServiceName != "a" || obj.ReleasedAt == nil {
+				t.Errorf("the release of ns/a is not kept: %+v", obj)
+			}
+		})
+	}
+}
+
+func TestExpireQuarantine(t *testing.T) {
+	setupTestDB(t)
+	setCooldown(t, time.Hour)
+	seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	bindAndRelease(t, "10.0.0.1")
+	bindAndRelease(t, "10.0.0.2")
+
+	// 10.0.0.1 ends first, 10.0.0.2 is still quarantined at now
+	now := time.Now()
+	if err := db.Model(&LoadBalance{}).Where("ip = ?", "10.0.0.1").Update("quarantine_until", now.Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := LoadBalanceModel.ExpireQuarantine(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].Ip != "10.0.0.1" || expired[0].Status != LoadBalanceStatusAvailable {
+		t.Errorf("expired %+v, expected 10.0.0.1 freed", expired)
+	}
+	if obj := mustGetByIp(t, "10.0.0.2"); obj.Status != LoadBalanceStatusQuarantined {
+		t.Errorf("10.0.0.2 status = %d, expected quarantined", obj.Status)
+	}
+
+	// a quarantined ip taken back by its service is not freed by a late expiry
+	if _, err = LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.2", Namespace: "ns", ServiceName: "a"}, Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	if expired, err = LoadBalanceModel.ExpireQuarantine(now.Add(2 * time.Hour)); err != nil || len(expired) != 0 {
+		t.Errorf("expired %+v, %v, expected nothing", expired, err)
+	}
+	if obj := mustGetByIp(t, "10.0.0.2"); obj.Status != LoadBalanceStatusBound {
+		t.Errorf("10.0.0.2 status = %d, expected bound", obj.Status)
+	}
+}
+
+func TestForceReleaseHistory(t *testing.T) {
+	setupTestDB(t)
+	setCooldown(t, time.Hour)
+	seedAddresses(t, "c1", "10.0.0.1")
+	bindAndRelease(t, "10.0.0.1")
+
+	if _, err := LoadBalanceModel.ForceRelease("c1", "10.0.0.1", Actor{User: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	items, _, err := LoadBalanceHistoryModel.List(&HistoryListOptions{Ip: "10.0.0.1", Limit: 1})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("history %v, %v", items, err)
+	}
+	if entry := items[0]; entry.Action != HistoryActionForceRelease || entry.ServiceName != "a" || entry.User != "admin" {
+		t.Errorf("entry = %+v, expected a force release of ns/a by admin", entry)
+	}
+}
+
+func TestSetupQuarantine(t *testing.T) {
+	previous, previousInterval := QuarantineCooldown, QuarantineInterval
+	defer func() {
+		QuarantineCooldown, QuarantineInterval = previous, previousInterval
+	}()
+
+	SetupQuarantine(config.CloudProviderQuarantineConfig{Cooldown: time.Minute})
+	if QuarantineCooldown != time.Minute || QuarantineInterval != defaultQuarantineInterval {
+		t.Errorf("cooldown %s interval %s, expected 1m and the default interval", QuarantineCooldown, QuarantineInterval)
+	}
+	SetupQuarantine(config.CloudProviderQuarantineConfig{Interval: time.Second})
+	if QuarantineCooldown != 0 || QuarantineInterval != time.Second {
+		t.Errorf("cooldown %s interval %s, expected 0 and 1s", QuarantineCooldown, QuarantineInterval)
+	}
+}
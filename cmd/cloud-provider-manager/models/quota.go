@@ -0,0 +1,180 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const TableNameLoadBalanceQuota = "loadbalance_quotas"
+
+var ErrQuotaExceeded = errors.New("ip quota exceeded")
+
+// LoadBalanceQuota limits the ips bound in a namespace of a cluster, an empty
+// namespace limits the whole cluster
+type LoadBalanceQuota struct {
+	Id        int64     `json:"id"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Limit     int64     `json:"limit" gorm:"column:max_ips"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+func (*LoadBalanceQuota) TableName() string {
+	return TableNameLoadBalanceQuota
+}
+
+// NamespaceUsage is the number of bound ips of a namespace, Limit is nil without a quota
+type NamespaceUsage struct {
+	Namespace string `json:"namespace"`
+	Used      int64  `json:"used"`
+	Limit     *int64 `json:"limit"`
+}
+
+type QuotaUsage struct {
+	Cluster    string           `json:"cluster"`
+	Used       int64            `json:"used"`
+	Limit      *int64           `json:"limit"`
+	Namespaces []NamespaceUsage `json:"namespaces"`
+}
+
+type loadBalanceQuotaModel struct{}
+
+func (c *loadBalanceQuotaModel) List(cluster string) ([]LoadBalanceQuota, error) {
+	var result []LoadBalanceQuota
+	err := db.Where("cluster = ?", cluster).Order("namespace").Find(&result).Error
+	return result, err
+}
+
+func (c *loadBalanceQuotaModel) Get(cluster, namespace string) (*LoadBalanceQuota, error) {
+	var result *LoadBalanceQuota
+	err := db.Where("cluster = ? AND namespace = ?", cluster, namespace).First(&result).Error
+	return result, err
+}
+
+// Set creates or replaces a quota, a limit below the current usage only stops new binds
+func (c *loadBalanceQuotaModel) Set(cluster, namespace string, limit int64) (*LoadBalanceQuota, error) {
+	now := time.Now()
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cluster"}, {Name: "namespace"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_ips", "updated_at"}),
+	}).Create(&LoadBalanceQuota{
+		Cluster:   cluster,
+		Namespace: namespace,
+		Limit:     limit,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(cluster, namespace)
+}
+
+func (c *loadBalanceQuotaModel) Delete(cluster, namespace string) error {
+	result := db.Where("cluster = ? AND namespace = ?", cluster, namespace).Delete(&LoadBalanceQuota{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Usage counts the bound ips of every namespace of the cluster, namespaces with
+// a quota but no ip are included
+func (c *loadBalanceQuotaModel) Usage(cluster string) (*QuotaUsage, error) {
+	var counts []NamespaceUsage
+	err := db.Model(&LoadBalance{}).
+		Select("namespace, COUNT(*) AS used").
+		Where("cluster = ? AND status = ?", cluster, LoadBalanceStatusBound).
+		Group("namespace").
+		Order("namespace").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	quotas, err := c.List(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QuotaUsage{Cluster: cluster, Namespaces: make([]NamespaceUsage, 0, len(counts))}
+	limits := make(map[string]int64, len(quotas))
+	for _, quota := range quotas {
+		if quota.Namespace == "" {
+			limit := quota.Limit
+			result.Limit = &limit
+			continue
+		}
+		limits[quota.Namespace] = quota.Limit
+	}
+
+	for _, usage := range counts {
+		result.Used += usage.Used
+		if limit, ok := limits[usage.Namespace]; ok {
+			usage.Limit = &limit
+			delete(limits, usage.Namespace)
+		}
+		result.Namespaces = append(result.Namespaces, usage)
+	}
+	for _, quota := range quotas {
+		if limit, ok := limits[quota.Namespace]; ok {
+			result.Namespaces = append(result.Namespaces, NamespaceUsage{Namespace: quota.Namespace, Limit: &limit})
+		}
+	}
+	return result, nil
+}
+
+// checkQuota fails when the bound ips exceed the quota of the namespace or the
+// cluster, the ip just bound in tx is counted. The quota rows are locked so
+// concurrent binds count one after the other, binds without a quota take no lock.
+func checkQuota(tx *gorm.DB, cluster, namespace string) error {
+	excess, err := exceededQuota(tx, cluster, namespace)
+	if err != nil || excess == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s uses %d of %d ips", ErrQuotaExceeded, excess.scope, excess.used-1, excess.limit)
+}
+
+// quotaExcess is a quota the bound ips exceed
+type quotaExcess struct {
+	scope string
+	used  int64
+	limit int64
+}
+
+// exceededQuota returns the quota of the namespace or the cluster the bound ips
+// of tx exceed, nil when there is none
+func exceededQuota(tx *gorm.DB, cluster, namespace string) (*quotaExcess, error) {
+	var quotas []LoadBalanceQuota
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("cluster = ? AND namespace IN ?", cluster, []string{"", namespace}).
+		Find(&quotas).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, quota := range quotas {
+		used := tx.Model(&LoadBalance{}).Where("cluster = ? AND status = ?", cluster, LoadBalanceStatusBound)
+		scope := "cluster " + cluster
+		if quota.Namespace != "" {
+			used = used.Where("namespace = ?", quota.Namespace)
+			scope = "namespace " + quota.Namespace
+		}
+
+		var count int64
+		if err = used.Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > quota.Limit {
+			return &quotaExcess{scope: scope, used: count, limit: quota.Limit}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func mustSetQuota(t *testing.T, cluster, namespace string, limit int64) {
+	t.Helper()
+
+	if _, err := LoadBalanceQuotaModel.Set(cluster, namespace, limit); err != nil {
+		t.Fatalf("set quota %s/%s: %v", cluster, namespace, err)
+	}
+}
+
+func TestBindQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		quotas    map[string]int64
+		err       error
+	}{
+		{name: "no quota", namespace: "ns"},
+		{name: "namespace below its quota", namespace: "ns", quotas: map[string]int64{"ns": 2}},
+		{name: "namespace at its quota", namespace: "ns", quotas: map[string]int64{"ns": 1}, err: ErrQuotaExceeded},
+		{name: "quota of another namespace", namespace: "other", quotas: map[string]int64{"ns": 1}},
+		{name: "cluster at its quota", namespace: "other", quotas: map[string]int64{"": 1}, err: ErrQuotaExceeded},
+		{name: "cluster below its quota", namespace: "other", quotas: map[string]int64{"": 2, "other": 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2")
+			if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "a"}, Actor{}); err != nil {
+				t.Fatal(err)
+			}
+			for namespace, limit := range tt.quotas {
+				mustSetQuota(t, "c1", namespace, limit)
+			}
+
+			_, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.2", Namespace: tt.namespace, ServiceName: "b"}, Actor{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			// a rejected bind is rolled back
+			expected := LoadBalanceStatusBound
+			if tt.err != nil {
+				expected = LoadBalanceStatusAvailable
+			}
+			if obj := mustGetByIp(t, "10.0.0.2"); obj.Status != expected {
+				t.Errorf("status = %d, expected %d", obj.Status, expected)
+			}
+		})
+	}
+}
+
+func TestBindQuotaRetry(t *testing.T) {
+	setupTestDB(t)
+	seedAddresses(t, "c1", "10.0.0.1")
+	mustSetQuota(t, "c1", "ns", 1)
+
+	for i := 0; i < 2; i++ {
+		// the retried bind of the ip the service holds is not counted twice
+		if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "a"}, Actor{}); err != nil {
+			t.Fatalf("bind %d: %v", i, err)
+		}
+	}
+}
+
+func TestConcurrentBindQuota(t *testing.T) {
+	setupTestDB(t)
+	serializeDB(t)
+	seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4")
+	mustSetQuota(t, "c1", "ns", 2)
+
+	const services = 6
+	var wg sync.WaitGroup
+	errs := make([]error, services)
+	for i := 0; i < services; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = LoadBalanceModel.Allocate("c1", fmt.Sprintf("svc-%d", i), "ns", AllocateOptions{}, Actor{})
+		}(i)
+	}
+	wg.Wait()
+
+	allocated := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			allocated++
+		case !errors.Is(err, ErrQuotaExceeded) && !errors.Is(err, ErrPoolExhausted):
+			t.Errorf("service %d: %v", i, err)
+		}
+	}
+	usage, err := LoadBalanceQuotaModel.Usage("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocated != 2 || usage.Used != 2 {
+		t.Errorf("%d services got an ip with %d bound, expected the quota of 2", allocated, usage.Used)
+	}
+}
+
+func TestQuotaUsage(t *testing.T) {
+	setupTestDB(t)
+	seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	seedAddresses(t, "c2", "10.0.1.1")
+	for _, m := range []LoadBalance{
+		{Cluster: "c1", Ip: "10.0.0.1", Namespace: "a", ServiceName: "x"},
+		{Cluster: "c1", Ip: "10.0.0.2", Namespace: "b", ServiceName: "x"},
+		{Cluster: "c1", Ip: "10.0.0.3", Namespace: "b", ServiceName: "y"},
+		{Cluster: "c2", Ip: "10.0.1.1", Namespace: "a", ServiceName: "x"},
+	} {
+		m := m
+		if _, err := LoadBalanceModel.Bind(&m, Actor{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustSetQuota(t, "c1", "", 10)
+	mustSetQuota(t, "c1", "b", 3)
+	mustSetQuota(t, "c1", "idle", 1)
+	// Set replaces the limit of an existing quota
+	mustSetQuota(t, "c1", "b", 4)
+
+	usage, err := LoadBalanceQuotaModel.Usage("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Used != 3 || usage.Limit == nil || *usage.Limit != 10 {
+		t.Errorf("cluster usage %d of %v, expected 3 of 10", usage.Used, usage.Limit)
+	}
+
+	type namespace struct {
+		name  string
+		used  int64
+		limit int64
+	}
+	expected := []namespace{{"a", 1, -1}, {"b", 2, 4}, {"idle", 0, 1}}
+	if len(usage.Namespaces) != len(expected) {
+		t.Fatalf("namespaces = %+v, expected %+v", usage.Namespaces, expected)
+	}
+	for i, item := range usage.Namespaces {
+		limit := int64(-1)
+		if item.Limit != nil {
+			limit = *item.Limit
+		}
+		if got := (namespace{item.Namespace, item.Used, limit}); got != expected[i] {
+			t.Errorf("namespace %d = %+v, expected %+v", i, got, expected[i])
+		}
+	}
+
+	if err = LoadBalanceQuotaModel.Delete("c1", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err = LoadBalanceQuotaModel.Delete("c1", "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete err = %v, expected %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/watch"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Reserve pins an ip of the cluster to a namespace, or to a single service of it
+// when name is set. An available ip leaves general allocation, a bound ip keeps
+// its binding if the reservation covers the service holding it.
+func (c *loadBalanceModel) Reserve(cluster, ip, namespace, name string, actor Actor) (*LoadBalance, error) {
+	obj, err := c.GetByIp(ip)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Cluster != cluster {
+		return nil, fmt.Errorf("ip %s does not belong to cluster %s: %w", ip, cluster, ErrNotFound)
+	}
+
+	status := obj.Status
+	switch obj.Status {
+	case LoadBalanceStatusAvailable, LoadBalanceStatusReserved:
+		status = LoadBalanceStatusReserved
+	case LoadBalanceStatusBound:
+		if obj.Namespace != namespace || (name != "" && obj.ServiceName != name) {
+			return nil, fmt.Errorf("ip %s is bound by service %s/%s: %w", ip, obj.Namespace, obj.ServiceName, ErrAlreadyBound)
+		}
+	case LoadBalanceStatusQuarantined:
+		return nil, fmt.Errorf("ip %s: %w", ip, ErrQuarantined)
+	}
+
+	return c.updateReservation(obj, status, namespace, name, HistoryActionReserve, actor)
+}
+
+// Unreserve returns a reserved ip to general allocation, a bound ip stays bound
+func (c *loadBalanceModel) Unreserve(cluster, ip string, actor Actor) (*LoadBalance, error) {
+	obj, err := c.GetByIp(ip)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Cluster != cluster {
+		return nil, fmt.Errorf("ip %s does not belong to cluster %s: %w", ip, cluster, ErrNotFound)
+	}
+	if obj.ReservedNamespace == "" {
+		return nil, fmt.Errorf("ip %s is not reserved: %w", ip, ErrNotFound)
+	}
+
+	status := obj.Status
+	if status == LoadBalanceStatusReserved {
+		status = LoadBalanceStatusAvailable
+	}
+	return c.updateReservation(obj, status, "", "", HistoryActionUnreserve, actor)
+}
+
+// updateReservation only applies while the status is unchanged, so a concurrent
+// bind or release is not overwritten
+func (c *loadBalanceModel) updateReservation(obj *LoadBalance, status int, namespace, name, action string, actor Actor) (*LoadBalance, error) {
+	now := time.Now()
+	// recorded against the reservation that was set or removed
+	entry := *obj
+	entry.UpdatedAt = now
+	entry.Namespace, entry.ServiceName = namespace, name
+	if action == HistoryActionUnreserve {
+		entry.Namespace, entry.ServiceName = obj.ReservedNamespace, obj.ReservedServiceName
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&LoadBalance{}).
+			Where("id = ? AND status = ?", obj.Id, obj.Status).
+			Updates(map[string]interface{}{
+				"status":                status,
+				"reserved_namespace":    namespace,
+				"reserved_service_name": name,
+				"updated_at":            now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("ip %s changed concurrently: %w", obj.Ip, ErrAlreadyBound)
+		}
+		return recordHistory(tx, action, &entry, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	obj.Status = status
+	obj.ReservedNamespace, obj.ReservedServiceName = namespace, name
+	obj.UpdatedAt = now
+	watch.Default.Publish(obj.Cluster, watch.Modified, *obj)
+	return obj, nil
+}
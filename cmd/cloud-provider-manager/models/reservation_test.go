@@ -0,0 +1,219 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		cooldown  time.Duration
+		prepare   func(t *testing.T)
+		namespace string
+		service   string
+		err       error
+		status    int
+	}{
+		{name: "available", namespace: "team", status: LoadBalanceStatusReserved},
+		{
+			name:      "moved to another namespace",
+			prepare:   func(t *testing.T) { mustReserve(t, "other", "") },
+			namespace: "team",
+			status:    LoadBalanceStatusReserved,
+		},
+		{name: "bound by the namespace", prepare: bind("team", "a"), namespace: "team", status: LoadBalanceStatusBound},
+		{name: "bound by the service", prepare: bind("team", "a"), namespace: "team", service: "a", status: LoadBalanceStatusBound},
+		{name: "bound by another service", prepare: bind("team", "a"), namespace: "team", service: "b", err: ErrAlreadyBound, status: LoadBalanceStatusBound},
+		{name: "bound by another namespace", prepare: bind("ns", "a"), namespace: "team", err: ErrAlreadyBound, status: LoadBalanceStatusBound},
+		{
+			name:      "quarantined",
+			cooldown:  time.Hour,
+			prepare:   func(t *testing.T) { bindAndRelease(t, "10.0.0.1") },
+			namespace: "team",
+			err:       ErrQuarantined,
+			status:    LoadBalanceStatusQuarantined,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			setCooldown(t, tt.cooldown)
+			seedAddresses(t, "c1", "10.0.0.1")
+			if tt.prepare != nil {
+				tt.prepare(t)
+			}
+
+			_, err := LoadBalanceModel.Reserve("c1", "10.0.0.1", tt.namespace, tt.service, Actor{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			obj := mustGetByIp(t, "10.0.0.1")
+			if obj.Status != tt.status {
+				t.Errorf("status = %d, expected %d", obj.Status, tt.status)
+			}
+			if tt.err == nil && (obj.ReservedNamespace != tt.namespace || obj.ReservedServiceName != tt.service) {
+				t.Errorf("reserved for %s/%s, expected %s/%s", obj.ReservedNamespace, obj.ReservedServiceName, tt.namespace, tt.service)
+			}
+		})
+	}
+}
+
+func TestBindReserved(t *testing.T) {
+	tests := []struct {
+		name      string
+		service   string
+		namespace string
+		bind      string
+		err       error
+	}{
+		{name: "namespace reservation", namespace: "team", bind: "team/a"},
+		{name: "service reservation", namespace: "team", service: "a", bind: "team/a"},
+		{name: "other service of the namespace", namespace: "team", service: "a", bind: "team/b", err: ErrReserved},
+		{name: "other namespace", namespace: "team", bind: "ns/a", err: ErrReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			seedAddresses(t, "c1", "10.0.0.1")
+			mustReserve(t, tt.namespace, tt.service)
+
+			namespace, service, _ := strings.Cut(tt.bind, "/")
+			_, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: namespace, ServiceName: service}, Actor{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			// the release gives the ip back to its reservation, not to general allocation
+			if err = LoadBalanceModel.Released(&LoadBalance{Cluster: "c1", Namespace: namespace, ServiceName: service}, Actor{}); err != nil {
+				t.Fatal(err)
+			}
+			obj := mustGetByIp(t, "10.0.0.1")
+			if obj.Status != LoadBalanceStatusReserved || obj.ReservedNamespace != tt.namespace || obj.ReservedServiceName != tt.service {
+				t.Errorf("ip after release = %+v, expected reserved for %s/%s", obj, tt.namespace, tt.service)
+			}
+		})
+	}
+}
+
+func TestReleaseReservedSkipsQuarantine(t *testing.T) {
+	setupTestDB(t)
+	setCooldown(t, time.Hour)
+	seedAddresses(t, "c1", "10.0.0.1")
+	mustReserve(t, "ns", "")
+	bindAndRelease(t, "10.0.0.1")
+
+	if obj := mustGetByIp(t, "10.0.0.1"); obj.Status != LoadBalanceStatusReserved || obj.QuarantineUntil != nil {
+		t.Errorf("ip after release = %+v, expected reserved without quarantine", obj)
+	}
+}
+
+func TestUnreserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T)
+		err     error
+		status  int
+	}{
+		{name: "reserved", prepare: func(t *testing.T) { mustReserve(t, "team", "") }, status: LoadBalanceStatusAvailable},
+		{
+			name: "bound by the reservation",
+			prepare: func(t *testing.T) {
+				mustReserve(t, "team", "")
+				bind("team", "a")(t)
+			},
+			status: LoadBalanceStatusBound,
+		},
+		{name: "not reserved", err: ErrNotFound, status: LoadBalanceStatusAvailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			seedAddresses(t, "c1", "10.0.0.1")
+			if tt.prepare != nil {
+				tt.prepare(t)
+			}
+
+			if _, err := LoadBalanceModel.Unreserve("c1", "10.0.0.1", Actor{}); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			obj := mustGetByIp(t, "10.0.0.1")
+			if obj.Status != tt.status || obj.ReservedNamespace != "" {
+				t.Errorf("ip after unreserve = %+v, expected status %d without a reservation", obj, tt.status)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			// the unreserve is recorded against the reservation it removed
+			items, _, err := LoadBalanceHistoryModel.List(&HistoryListOptions{Ip: "10.0.0.1", Limit: 1})
+			if err != nil || len(items) != 1 {
+				t.Fatalf("history %v, %v", items, err)
+			}
+			if entry := items[0]; entry.Action != HistoryActionUnreserve || entry.Namespace != "team" {
+				t.Errorf("entry = %+v, expected an unreserve of team", entry)
+			}
+		})
+	}
+}
+
+func TestAllocateReserved(t *testing.T) {
+	setupTestDB(t)
+	seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	mustReserveIp(t, "10.0.0.1", "team", "b")
+	mustReserveIp(t, "10.0.0.2", "team", "")
+
+	// general allocation passes over every reserved ip
+	obj, err := LoadBalanceModel.Allocate("c1", "a", "team", AllocateOptions{}, Actor{})
+	if err != nil || obj.Ip != "10.0.0.3" {
+		t.Fatalf("allocate = %v, %v, expected the unreserved 10.0.0.3", obj, err)
+	}
+	if _, err = LoadBalanceModel.Allocate("c1", "c", "ns", AllocateOptions{}, Actor{}); !errors.Is(err, ErrPoolExhausted) {
+		t.Fatalf("err = %v, expected %v", err, ErrPoolExhausted)
+	}
+
+	// the reservation of another service of the namespace is not taken
+	obj, err = LoadBalanceModel.Allocate("c1", "c", "team", AllocateOptions{Reserved: true}, Actor{})
+	if err != nil || obj.Ip != "10.0.0.2" {
+		t.Fatalf("reserved allocate = %v, %v, expected the namespace reservation 10.0.0.2", obj, err)
+	}
+	obj, err = LoadBalanceModel.Allocate("c1", "b", "team", AllocateOptions{Reserved: true}, Actor{})
+	if err != nil || obj.Ip != "10.0.0.1" {
+		t.Fatalf("reserved allocate = %v, %v, expected the service reservation 10.0.0.1", obj, err)
+	}
+	if _, err = LoadBalanceModel.Allocate("c1", "d", "team", AllocateOptions{Reserved: true}, Actor{}); !errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("err = %v, expected %v", err, ErrPoolExhausted)
+	}
+}
+
+// bind binds 10.0.0.1 of c1 to the service
+func bind(namespace, name string) func(t *testing.T) {
+	return func(t *testing.T) {
+		t.Helper()
+
+		if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: namespace, ServiceName: name}, Actor{}); err != nil {
+			t.Fatalf("bind %s/%s: %v", namespace, name, err)
+		}
+	}
+}
+
+func mustReserve(t *testing.T, namespace, name string) {
+	t.Helper()
+	mustReserveIp(t, "10.0.0.1", namespace, name)
+}
+
+func mustReserveIp(t *testing.T, ip, namespace, name string) {
+	t.Helper()
+
+	if _, err := LoadBalanceModel.Reserve("c1", ip, namespace, name, Actor{}); err != nil {
+		t.Fatalf("reserve %s: %v", ip, err)
+	}
+}
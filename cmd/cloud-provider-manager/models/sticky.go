@@ -0,0 +1,37 @@
+package models
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"time"
+)
+
+const defaultStickyRetention = 24 * time.Hour
+
+// StickyRetention is how long a released ip is remembered for its last service, 0 disables it
+var StickyRetention = defaultStickyRetention
+
+func SetupSticky(cfg config.CloudProviderStickyConfig) {
+	switch {
+	case cfg.Retention > 0:
+		StickyRetention = cfg.Retention
+	case cfg.Retention < 0:
+		StickyRetention = 0
+	}
+}
+
+// Previous returns the ip the service released last if it was released within
+// StickyRetention and nobody bound it since, quarantined ips included
+func (c *loadBalanceModel) Previous(cluster, name, namespace string) (*LoadBalance, error) {
+	if StickyRetention <= 0 {
+		return nil, ErrNotFound
+	}
+
+	var result *LoadBalance
+	err := db.Where("cluster = ? AND last_namespace = ? AND last_service_name = ? AND status IN ? AND released_at >= ?",
+		cluster, namespace, name,
+		[]int{LoadBalanceStatusAvailable, LoadBalanceStatusQuarantined},
+		time.Now().Add(-StickyRetention)).
+		Order("released_at DESC").
+		First(&result).Error
+	return result, err
+}
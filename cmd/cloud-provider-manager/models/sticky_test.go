@@ -0,0 +1,141 @@
+package models
+
+import (
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"testing"
+	"time"
+)
+
+// setRetention remembers released ips for retention during the test
+func setRetention(t *testing.T, retention time.Duration) {
+	t.Helper()
+
+	previous := StickyRetention
+	StickyRetention = retention
+	t.Cleanup(func() {
+		StickyRetention = previous
+	})
+}
+
+func TestPrevious(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		cooldown  time.Duration
+		prepare   func(t *testing.T)
+		ip        string
+		err       error
+	}{
+		{name: "released last", retention: time.Hour, ip: "10.0.0.2"},
+		{name: "quarantined", retention: time.Hour, cooldown: time.Hour, ip: "10.0.0.2"},
+		{name: "disabled", err: ErrNotFound},
+		{
+			name:      "retention elapsed",
+			retention: time.Hour,
+			prepare: func(t *testing.T) {
+				if err := db.Model(&LoadBalance{}).Where("last_service_name = ?", "a").Update("released_at", time.Now().Add(-2*time.Hour)).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: ErrNotFound,
+		},
+		{
+			name:      "bound by another service since",
+			retention: time.Hour,
+			prepare: func(t *testing.T) {
+				if _, err := LoadBalanceModel.Bind(&LoadBalance{Cluster: "c1", Ip: "10.0.0.2", Namespace: "ns", ServiceName: "b"}, Actor{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			// the earlier release of the service is still remembered
+			ip: "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			setRetention(t, tt.retention)
+			setCooldown(t, tt.cooldown)
+			seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2")
+			bindAndRelease(t, "10.0.0.1")
+			// the release of .2 comes later, released_at is compared to the second
+			if err := db.Model(&LoadBalance{}).Where("ip = ?", "10.0.0.1").Update("released_at", time.Now().Add(-time.Minute)).Error; err != nil {
+				t.Fatal(err)
+			}
+			bindAndRelease(t, "10.0.0.2")
+			if tt.prepare != nil {
+				tt.prepare(t)
+			}
+
+			obj, err := LoadBalanceModel.Previous("c1", "a", "ns")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if err == nil && obj.Ip != tt.ip {
+				t.Errorf("previous = %s, expected %s", obj.Ip, tt.ip)
+			}
+		})
+	}
+}
+
+func TestAllocateSticky(t *testing.T) {
+	setupTestDB(t)
+	setRetention(t, time.Hour)
+	setCooldown(t, time.Hour)
+	seedAddresses(t, "c1", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	bindAndRelease(t, "10.0.0.2")
+
+	// another service passes over the quarantined ip
+	obj, err := LoadBalanceModel.Allocate("c1", "other", "ns", AllocateOptions{Sticky: true}, Actor{})
+	if err != nil || obj.Ip != "10.0.0.1" {
+		t.Fatalf("allocate for another service = %v, %v, expected 10.0.0.1", obj, err)
+	}
+
+	obj, err = LoadBalanceModel.Allocate("c1", "a", "ns", AllocateOptions{Sticky: true}, Actor{})
+	if err != nil || obj.Ip != "10.0.0.2" {
+		t.Fatalf("sticky allocate = %v, %v, expected the quarantined 10.0.0.2 back", obj, err)
+	}
+	if obj.QuarantineUntil != nil {
+		t.Errorf("quarantine kept after the rebind: %v", obj.QuarantineUntil)
+	}
+
+	// the previous ip reserved for someone else since falls back to a free one
+	if err = LoadBalanceModel.Released(&LoadBalance{Cluster: "c1", Namespace: "ns", ServiceName: "a"}, Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadBalanceModel.ForceRelease("c1", "10.0.0.2", Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadBalanceModel.Reserve("c1", "10.0.0.2", "team", "", Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	obj, err = LoadBalanceModel.Allocate("c1", "a", "ns", AllocateOptions{Sticky: true}, Actor{})
+	if err != nil || obj.Ip != "10.0.0.3" {
+		t.Fatalf("sticky allocate of a reserved ip = %v, %v, expected the free 10.0.0.3", obj, err)
+	}
+}
+
+func TestSetupSticky(t *testing.T) {
+	previous := StickyRetention
+	defer func() {
+		StickyRetention = previous
+	}()
+
+	tests := []struct {
+		retention time.Duration
+		expected  time.Duration
+	}{
+		{retention: time.Hour, expected: time.Hour},
+		// 0 keeps the current retention
+		{retention: 0, expected: time.Hour},
+		{retention: -1, expected: 0},
+	}
+	for _, tt := range tests {
+		SetupSticky(config.CloudProviderStickyConfig{Retention: tt.retention})
+		if StickyRetention != tt.expected {
+			t.Errorf("retention %s: StickyRetention = %s, expected %s", tt.retention, StickyRetention, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const TableNamePoolWatermark = "pool_watermarks"
+
+// PoolWatermark is the last state of a low watermark rule for a cluster, every
+// manager shares it so a crossing is reported once and survives restarts. A
+// missing row is not low.
+type PoolWatermark struct {
+	Id        int64     `json:"id"`
+	Rule      string    `json:"rule"`
+	Cluster   string    `json:"cluster"`
+	Low       bool      `json:"low"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+func (*PoolWatermark) TableName() string {
+	return TableNamePoolWatermark
+}
+
+type poolWatermarkModel struct{}
+
+// Transition sets the state of the rule for the cluster to low and queues event
+// in the same transaction, false means the state already was low, set by this
+// or by another manager, and nothing was queued
+func (c *poolWatermarkModel) Transition(rule, cluster string, low bool, event *WebhookEvent) (bool, error) {
+	changed := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&PoolWatermark{}).
+			Where("rule = ? AND cluster = ? AND low = ?", rule, cluster, !low).
+			Updates(map[string]interface{}{"low": low, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if !low {
+				return nil
+			}
+			// the first crossing of the rule, a manager inserting it concurrently wins
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&PoolWatermark{Rule: rule, Cluster: cluster, Low: true, UpdatedAt: now})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+		}
+
+		if err := enqueueEvent(tx, event); err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	return changed, err
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"sync"
+	"testing"
+)
+
+func deliveryTypes(t *testing.T) []string {
+	t.Helper()
+
+	var deliveries []WebhookDelivery
+	if err := db.Order("id").Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	result := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		result = append(result, delivery.EventType)
+	}
+	return result
+}
+
+func TestWatermarkTransition(t *testing.T) {
+	setupTestDB(t)
+	setSubscribers(t)
+
+	steps := []struct {
+		name    string
+		rule    string
+		low     bool
+		changed bool
+	}{
+		{name: "not low without a row", rule: "r1", low: false, changed: false},
+		{name: "first crossing", rule: "r1", low: true, changed: true},
+		{name: "still low", rule: "r1", low: true, changed: false},
+		{name: "another rule", rule: "r2", low: true, changed: true},
+		{name: "recovered", rule: "r1", low: false, changed: true},
+		{name: "still recovered", rule: "r1", low: false, changed: false},
+		{name: "low again", rule: "r1", low: true, changed: true},
+	}
+
+	var expected []string
+	for _, step := range steps {
+		event := &WebhookEvent{Type: EventPoolRecovered, Cluster: "c1"}
+		if step.low {
+			event.Type = EventPoolLowWatermark
+		}
+		changed, err := PoolWatermarkModel.Transition(step.rule, "c1", step.low, event)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if changed != step.changed {
+			t.Errorf("%s: changed = %v, expected %v", step.name, changed, step.changed)
+		}
+		if step.changed {
+			expected = append(expected, event.Type)
+		}
+	}
+
+	// an event is queued for every change only
+	got := deliveryTypes(t)
+	if len(got) != len(expected) {
+		t.Fatalf("deliveries = %v, expected %v", got, expected)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("delivery %d = %s, expected %s", i, got[i], expected[i])
+		}
+	}
+}
+
+// TestWatermarkTransitionClaimed runs the reporters of several managers seeing
+// the same crossing, a single one queues the event
+func TestWatermarkTransitionClaimed(t *testing.T) {
+	for _, existing := range []bool{false, true} {
+		setupTestDB(t)
+		serializeDB(t)
+		setSubscribers(t)
+		if existing {
+			// recovered before, the crossing updates the row instead of inserting it
+			if _, err := PoolWatermarkModel.Transition("r1", "c1", true, &WebhookEvent{Type: EventPoolLowWatermark}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := PoolWatermarkModel.Transition("r1", "c1", false, &WebhookEvent{Type: EventPoolRecovered}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Where("1 = 1").Delete(&WebhookDelivery{}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		const managers = 4
+		var wg sync.WaitGroup
+		changed := make([]bool, managers)
+		for i := 0; i < managers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var err error
+				changed[i], err = PoolWatermarkModel.Transition("r1", "c1", true, &WebhookEvent{Type: EventPoolLowWatermark, Cluster: "c1"})
+				if err != nil {
+					t.Errorf("manager %d: %v", i, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		claimed := 0
+		for _, c := range changed {
+			if c {
+				claimed++
+			}
+		}
+		if deliveries := deliveryTypes(t); claimed != 1 || len(deliveries) != 1 {
+			t.Errorf("existing row %v: %d managers changed the state with deliveries %v, expected one", existing, claimed, deliveries)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+	"sync"
+	"time"
+)
+
+const TableNameWebhookDelivery = "webhook_deliveries"
+
+// the types of WebhookEvent
+const (
+	EventBound             = "Bound"
+	EventReleased          = "Released"
+	EventQuarantineExpired = "QuarantineExpired"
+	EventPoolExhausted     = "PoolExhausted"
+	EventPoolLowWatermark  = "PoolLowWatermark"
+	EventPoolRecovered     = "PoolRecovered"
+)
+
+var EventTypes = []string{EventBound, EventReleased, EventQuarantineExpired, EventPoolExhausted, EventPoolLowWatermark, EventPoolRecovered}
+
+const (
+	WebhookDeliveryStatusPending = 0
+	// WebhookDeliveryStatusFailed is kept for inspection once MaxAttempts is reached
+	WebhookDeliveryStatusFailed = 1
+)
+
+// poolExhaustedInterval keeps a controller retrying against an empty pool from
+// queueing an event per attempt, it is per cluster and per process
+const poolExhaustedInterval = time.Minute
+
+// maxLastError bounds the last_error column
+const maxLastError = 1024
+
+// WebhookEvent is the json body posted to the subscribers, Id is the same for
+// every subscriber and every attempt so receivers can drop duplicates
+type WebhookEvent struct {
+	Id        string      `json:"id"`
+	Type      string      `json:"type"`
+	Cluster   string      `json:"cluster"`
+	Time      time.Time   `json:"time"`
+	User      string      `json:"user,omitempty"`
+	RequestId string      `json:"requestId,omitempty"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDelivery is one event queued for one subscriber, it is deleted once delivered
+type WebhookDelivery struct {
+	Id            int64      `json:"id"`
+	EventId       string     `json:"eventId"`
+	EventType     string     `json:"eventType"`
+	Cluster       string     `json:"cluster"`
+	Subscriber    string     `json:"subscriber"`
+	Payload       string     `json:"payload"`
+	Status        int        `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" gorm:"column:next_attempt_at"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty" gorm:"column:locked_until"`
+	LastError     string     `json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt     time.Time  `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+func (*WebhookDelivery) TableName() string {
+	return TableNameWebhookDelivery
+}
+
+type webhookSubscriber struct {
+	name   string
+	events map[string]bool
+}
+
+func (s *webhookSubscriber) receives(eventType string) bool {
+	return len(s.events) == 0 || s.events[eventType]
+}
+
+var (
+	// webhookSubscribers decide which deliveries an event queues, none queues nothing
+	webhookSubscribers []webhookSubscriber
+
+	poolExhaustedMu       sync.Mutex
+	poolExhaustedNotified = map[string]time.Time{}
+)
+
+// SetupWebhook sets the subscribers events are queued for, the webhook package validates them
+func SetupWebhook(cfg config.CloudProviderWebhookConfig) {
+	webhookSubscribers = nil
+	for _, subscriber := range cfg.Subscribers {
+		s := webhookSubscriber{name: subscriber.Name, events: map[string]bool{}}
+		for _, event := range subscriber.Events {
+			s.events[event] = true
+		}
+		webhookSubscribers = append(webhookSubscribers, s)
+	}
+}
+
+func newEventId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// enqueueEvent queues the event for every subscriber of its type, in the
+// transaction of the change it reports so neither gets lost without the other
+func enqueueEvent(tx *gorm.DB, event *WebhookEvent) error {
+	if event.Id == "" {
+		event.Id = newEventId()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	var deliveries []WebhookDelivery
+	var payload []byte
+	for _, subscriber := range webhookSubscribers {
+		if !subscriber.receives(event.Type) {
+			continue
+		}
+
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			EventId:       event.Id,
+			EventType:     event.Type,
+			Cluster:       event.Cluster,
+			Subscriber:    subscriber.name,
+			Payload:       string(payload),
+			NextAttemptAt: event.Time,
+			CreatedAt:     event.Time,
+			UpdatedAt:     event.Time,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.Create(&deliveries).Error
+}
+
+func addressEvent(eventType string, obj *LoadBalance, actor Actor) *WebhookEvent {
+	return &WebhookEvent{
+		Type:      eventType,
+		Cluster:   obj.Cluster,
+		Time:      obj.UpdatedAt,
+		User:      actor.User,
+		RequestId: actor.RequestId,
+		Data:      *obj,
+	}
+}
+
+// notifyPoolExhausted queues at most one PoolExhausted event per cluster and
+// poolExhaustedInterval, failing to queue it does not fail the allocation
+func notifyPoolExhausted(cluster, name, namespace string, opts AllocateOptions, actor Actor) {
+	now := time.Now()
+	poolExhaustedMu.Lock()
+	if last, ok := poolExhaustedNotified[cluster]; ok && now.Sub(last) < poolExhaustedInterval {
+		poolExhaustedMu.Unlock()
+		return
+	}
+	poolExhaustedNotified[cluster] = now
+	poolExhaustedMu.Unlock()
+
+	err := enqueueEvent(db, &WebhookEvent{
+		Type:      EventPoolExhausted,
+		Cluster:   cluster,
+		Time:      now,
+		User:      actor.User,
+		RequestId: actor.RequestId,
+		Data: map[string]interface{}{
+			"namespace":   namespace,
+			"serviceName": name,
+			"reserved":    opts.Reserved,
+		},
+	})
+	if err != nil {
+		klog.Errorf("queue %s event of cluster %s fail: %s", EventPoolExhausted, cluster, err.Error())
+	}
+}
+
+type webhookDeliveryModel struct{}
+
+// Enqueue queues an event that is not part of a change to the pool
+func (c *webhookDeliveryModel) Enqueue(event *WebhookEvent) error {
+	return enqueueEvent(db, event)
+}
+
+// Next returns the oldest pending delivery of the subscriber, deliveries behind
+// it wait so every subscriber sees the events in order
+func (c *webhookDeliveryModel) Next(subscriber string) (*WebhookDelivery, error) {
+	var result *WebhookDelivery
+	err := db.Where("subscriber = ? AND status = ?", subscriber, WebhookDeliveryStatusPending).
+		Order("id").First(&result).Error
+	return result, err
+}
+
+// Claim locks a due delivery until lockedUntil, false means it is not due or
+// another manager holds it
+func (c *webhookDeliveryModel) Claim(obj *WebhookDelivery, now, lockedUntil time.Time) (bool, error) {
+	result := db.Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)",
+			obj.Id, WebhookDeliveryStatusPending, now, now).
+		Update("locked_until", lockedUntil)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	obj.LockedUntil = &lockedUntil
+	return true, nil
+}
+
+func (c *webhookDeliveryModel) Delivered(obj *WebhookDelivery) error {
+	return db.Delete(&WebhookDelivery{}, obj.Id).Error
+}
+
+// Failed records a failed attempt, the delivery is retried at next unless
+// giveUp marks it failed for good
+func (c *webhookDeliveryModel) Failed(obj *WebhookDelivery, lastError string, next time.Time, giveUp bool) error {
+	if len(lastError) > maxLastError {
+		lastError = lastError[:maxLastError]
+	}
+
+	obj.Attempts++
+	obj.LastError = lastError
+	obj.NextAttemptAt = next
+	obj.LockedUntil = nil
+	obj.UpdatedAt = time.Now()
+	if giveUp {
+		obj.Status = WebhookDeliveryStatusFailed
+	}
+	return db.Model(&WebhookDelivery{}).Where("id = ?", obj.Id).
+		Updates(map[string]interface{}{
+			"attempts":        obj.Attempts,
+			"last_error":      obj.LastError,
+			"next_attempt_at": obj.NextAttemptAt,
+			"locked_until":    nil,
+			"status":          obj.Status,
+			"updated_at":      obj.UpdatedAt,
+		}).Error
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setSubscribers queues the events of the test for a single subscriber
+func setSubscribers(t *testing.T) {
+	t.Helper()
+
+	previous := webhookSubscribers
+	SetupWebhook(config.CloudProviderWebhookConfig{Subscribers: []config.CloudProviderWebhookSubscriberConfig{{Name: "ops"}}})
+	t.Cleanup(func() {
+		webhookSubscribers = previous
+	})
+}
+
+func TestEnqueueEvent(t *testing.T) {
+	setupTestDB(t)
+	previous := webhookSubscribers
+	defer func() {
+		webhookSubscribers = previous
+	}()
+	SetupWebhook(config.CloudProviderWebhookConfig{Subscribers: []config.CloudProviderWebhookSubscriberConfig{
+		{Name: "all"},
+		{Name: "pools", Events: []string{EventPoolExhausted}},
+	}})
+
+	for _, eventType := range []string{EventBound, EventPoolExhausted} {
+		if err := WebhookDeliveryModel.Enqueue(&WebhookEvent{Type: eventType, Cluster: "c1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var deliveries []WebhookDelivery
+	if err := db.Order("id").Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, delivery := range deliveries {
+		got = append(got, delivery.Subscriber+" "+delivery.EventType)
+		if delivery.EventId == "" || delivery.NextAttemptAt.IsZero() || delivery.Payload == "" {
+			t.Errorf("delivery %+v, expected an event id, a payload and a first attempt", delivery)
+		}
+	}
+	expected := []string{"all Bound", "all PoolExhausted", "pools PoolExhausted"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("deliveries = %v, expected %v", got, expected)
+	}
+	// the subscribers of an event share its id
+	if deliveries[1].EventId != deliveries[2].EventId {
+		t.Errorf("event ids %s and %s differ", deliveries[1].EventId, deliveries[2].EventId)
+	}
+}
+
+func TestDeliveryClaim(t *testing.T) {
+	now := time.Now()
+	lockedUntil := now.Add(time.Minute)
+
+	tests := []struct {
+		name    string
+		prepare map[string]interface{}
+		claimed bool
+	}{
+		{name: "due", claimed: true},
+		{name: "not due", prepare: map[string]interface{}{"next_attempt_at": now.Add(time.Second)}},
+		{name: "claimed by another manager", prepare: map[string]interface{}{"locked_until": now.Add(time.Second)}},
+		{name: "claim of another manager expired", prepare: map[string]interface{}{"locked_until": now.Add(-time.Second)}, claimed: true},
+		{name: "given up", prepare: map[string]interface{}{"status": WebhookDeliveryStatusFailed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			setSubscribers(t)
+			if err := WebhookDeliveryModel.Enqueue(&WebhookEvent{Type: EventBound, Time: now.Add(-time.Minute)}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.prepare != nil {
+				if err := db.Model(&WebhookDelivery{}).Where("1 = 1").Updates(tt.prepare).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var delivery WebhookDelivery
+			if err := db.First(&delivery).Error; err != nil {
+				t.Fatal(err)
+			}
+			claimed, err := WebhookDeliveryModel.Claim(&delivery, now, lockedUntil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claimed != tt.claimed {
+				t.Errorf("claimed = %v, expected %v", claimed, tt.claimed)
+			}
+			// the second claim of the same round always loses
+			if claimed {
+				if again, err := WebhookDeliveryModel.Claim(&delivery, now, lockedUntil); err != nil || again {
+					t.Errorf("second claim = %v, %v, expected it to lose", again, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeliveryFailed(t *testing.T) {
+	setupTestDB(t)
+	setSubscribers(t)
+	now := time.Now()
+	for _, eventType := range []string{EventBound, EventReleased} {
+		if err := WebhookDeliveryModel.Enqueue(&WebhookEvent{Type: eventType, Time: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	delivery, err := WebhookDeliveryModel.Next("ops")
+	if err != nil || delivery.EventType != EventBound {
+		t.Fatalf("next = %v, %v, expected the Bound event first", delivery, err)
+	}
+	if _, err = WebhookDeliveryModel.Claim(delivery, now, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a retried delivery stays at the head of the queue and is unlocked
+	next := now.Add(5 * time.Second)
+	if err = WebhookDeliveryModel.Failed(delivery, "connection refused", next, false); err != nil {
+		t.Fatal(err)
+	}
+	head, err := WebhookDeliveryModel.Next("ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Id != delivery.Id || head.Attempts != 1 || head.LastError != "connection refused" || head.LockedUntil != nil || !head.NextAttemptAt.Equal(next) {
+		t.Errorf("head after a failure = %+v", head)
+	}
+	if claimed, err := WebhookDeliveryModel.Claim(head, now, now.Add(time.Minute)); err != nil || claimed {
+		t.Errorf("claim before the retry = %v, %v, expected it not due", claimed, err)
+	}
+
+	// giving up keeps the delivery for inspection and lets the next one through
+	if err = WebhookDeliveryModel.Failed(head, strings.Repeat("x", 2*maxLastError), next, true); err != nil {
+		t.Fatal(err)
+	}
+	var failed WebhookDelivery
+	if err = db.First(&failed, head.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != WebhookDeliveryStatusFailed || failed.Attempts != 2 || len(failed.LastError) != maxLastError {
+		t.Errorf("given up delivery = status %d, %d attempts, %d bytes of error", failed.Status, failed.Attempts, len(failed.LastError))
+	}
+	if head, err = WebhookDeliveryModel.Next("ops"); err != nil || head.EventType != EventReleased {
+		t.Fatalf("next = %v, %v, expected the Released event", head, err)
+	}
+
+	if err = WebhookDeliveryModel.Delivered(head); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = WebhookDeliveryModel.Next("ops"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, expected an empty queue", err)
+	}
+}
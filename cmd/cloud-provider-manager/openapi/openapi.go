@@ -0,0 +1,121 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Path is where the document is served, it is the only undocumented route
+const Path = "/openapi.json"
+
+//go:embed openapi.json
+var document []byte
+
+// Handler serves the document without authentication so other tools can fetch it
+func Handler(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json", document)
+}
+
+type operation struct {
+	method string
+	path   string
+}
+
+func (o operation) String() string {
+	return o.method + " " + o.path
+}
+
+func documented() ([]operation, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi document: %w", err)
+	}
+
+	var result []operation
+	for path, item := range doc.Paths {
+		for method := range item {
+			switch method {
+			case "parameters", "summary", "description", "servers":
+				continue
+			}
+			result = append(result, operation{method: strings.ToUpper(method), path: path})
+		}
+	}
+	return result, nil
+}
+
+// matches reports whether a documented path is served by a gin route, {name}
+// matches :name and a parameter route also serves literal segments like
+// bind:batch, since gin can not route a colon inside a segment
+func matches(documented, route string) bool {
+	docSegments := strings.Split(documented, "/")
+	routeSegments := strings.Split(route, "/")
+	if len(docSegments) != len(routeSegments) {
+		return false
+	}
+
+	for i, segment := range routeSegments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			if d := docSegments[i]; strings.HasPrefix(d, "{") && d != "{"+segment[1:]+"}" {
+				return false
+			}
+		case segment != docSegments[i]:
+			return false
+		}
+	}
+	return true
+}
+
+// Check fails when a route of the engine is not in the document or the document
+// describes an operation no route serves, the router tests run it
+func Check(routes gin.RoutesInfo) error {
+	operations, err := documented()
+	if err != nil {
+		return err
+	}
+
+	var missing, stale []string
+	for _, route := range routes {
+		if route.Path == Path {
+			continue
+		}
+		found := false
+		for _, op := range operations {
+			if op.method == route.Method && matches(op.path, route.Path) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+
+	for _, op := range operations {
+		found := false
+		for _, route := range routes {
+			if op.method == route.Method && matches(op.path, route.Path) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			stale = append(stale, op.String())
+		}
+	}
+
+	if len(missing) == 0 && len(stale) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	return fmt.Errorf("openapi document out of sync with the router, undocumented routes: %v, operations without a route: %v", missing, stale)
+}
@@ -0,0 +1,50 @@
+package openapi
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+	"testing"
+)
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		documented string
+		route      string
+		matches    bool
+	}{
+		{documented: "/api/v1/list", route: "/api/v1/list", matches: true},
+		{documented: "/api/v1/list", route: "/api/v1/bind", matches: false},
+		{documented: "/clusters/{cluster}/ips", route: "/clusters/:cluster/ips", matches: true},
+		{documented: "/clusters/{cluster}/ips", route: "/clusters/:name/ips", matches: false},
+		{documented: "/clusters/{cluster}/bindings:batch", route: "/clusters/:cluster/:action", matches: true},
+		{documented: "/clusters/{cluster}", route: "/clusters/:cluster/ips", matches: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.documented+" "+tt.route, func(t *testing.T) {
+			if got := matches(tt.documented, tt.route); got != tt.matches {
+				t.Errorf("matches = %v, expected %v", got, tt.matches)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	operations, err := documented()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var routes gin.RoutesInfo
+	for _, op := range operations {
+		routes = append(routes, gin.RouteInfo{Method: op.method, Path: strings.NewReplacer("{", ":", "}", "").Replace(op.path)})
+	}
+	routes = append(routes, gin.RouteInfo{Method: "GET", Path: Path})
+	if err = Check(routes); err != nil {
+		t.Fatalf("every documented operation served: %v", err)
+	}
+
+	err = Check(append(routes[1:], gin.RouteInfo{Method: "DELETE", Path: "/undocumented"}))
+	if err == nil || !strings.Contains(err.Error(), "DELETE /undocumented") || !strings.Contains(err.Error(), operations[0].String()) {
+		t.Errorf("err = %v, expected the undocumented route and the operation without a route", err)
+	}
+}
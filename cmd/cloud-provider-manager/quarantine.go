@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"k8s.io/klog/v2"
+	"time"
+)
+
+// runQuarantineExpiry frees quarantined ips once their cooldown ended, it runs
+// even without a cooldown so ips quarantined under an earlier config expire
+func runQuarantineExpiry() {
+	ticker := time.NewTicker(models.QuarantineInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		expired, err := models.LoadBalanceModel.ExpireQuarantine(now)
+		if err != nil {
+			klog.Errorf("expire quarantined ips fail: %s", err.Error())
+		}
+		for _, m := range expired {
+			klog.V(2).Infof("quarantine of ip %s in cluster %s expired, released from %s/%s",
+				m.Ip, m.Cluster, m.LastNamespace, m.LastServiceName)
+		}
+	}
+}
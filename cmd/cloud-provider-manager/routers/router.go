@@ -2,18 +2,64 @@ package routers
 
 import (
 	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/controllers/loadbalance"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/openapi"
 	"github.com/gin-gonic/gin"
+	"k8s.io/component-base/metrics/legacyregistry"
 )
 
-func NewRouter() *gin.Engine {
+// NewRouter applies middlewares to every api route, in order
+func NewRouter(middlewares ...gin.HandlerFunc) *gin.Engine {
 	r := gin.Default()
+	r.GET(openapi.Path, openapi.Handler)
+	r.GET("/metrics", gin.WrapH(legacyregistry.Handler()))
+
 	apiGroup := r.Group("/api/v1/cloudprovider")
+	apiGroup.Use(middlewares...)
 
 	{
 		loadBalanceGroup := apiGroup.Group("/loadbalance")
 		loadBalanceGroup.GET("/list", loadbalance.List)
 		loadBalanceGroup.POST("/unbind", loadbalance.Released)
 		loadBalanceGroup.POST("/bind", loadbalance.Bind)
+		loadBalanceGroup.GET("/bindings", loadbalance.Bindings)
+		loadBalanceGroup.GET("/watch", loadbalance.Watch)
+		loadBalanceGroup.GET("/history", loadbalance.History)
+		loadBalanceGroup.POST("/unquarantine", loadbalance.Unquarantine)
+		loadBalanceGroup.GET("/previous", loadbalance.Previous)
+		loadBalanceGroup.GET("/usage", loadbalance.Usage)
+		loadBalanceGroup.GET("/stats", loadbalance.Stats)
+		loadBalanceGroup.GET("/export", loadbalance.Export)
+		loadBalanceGroup.POST("/import", loadbalance.Import)
+		// bind:batch and unbind:batch
+		loadBalanceGroup.POST("/:action", loadbalance.Batch)
+	}
+
+	v2Group := r.Group("/api/v2/cloudprovider")
+	v2Group.Use(middlewares...)
+
+	{
+		clusterGroup := v2Group.Group("/clusters/:cluster")
+		clusterGroup.GET("/bindings", loadbalance.ListBindings)
+		clusterGroup.GET("/bindings/:namespace/:name", loadbalance.GetBinding)
+		clusterGroup.PUT("/bindings/:namespace/:name", loadbalance.PutBinding)
+		clusterGroup.DELETE("/bindings/:namespace/:name", loadbalance.DeleteBinding)
+		clusterGroup.GET("/bindings/:namespace/:name/previous", loadbalance.GetPreviousBinding)
+		clusterGroup.GET("/pools", loadbalance.ListPools)
+		clusterGroup.GET("/addresses", loadbalance.ListAddresses)
+		clusterGroup.GET("/addresses/:ip", loadbalance.GetAddress)
+		clusterGroup.DELETE("/addresses/:ip/quarantine", loadbalance.DeleteQuarantine)
+		clusterGroup.PUT("/addresses/:ip/reservation", loadbalance.PutReservation)
+		clusterGroup.DELETE("/addresses/:ip/reservation", loadbalance.DeleteReservation)
+		clusterGroup.GET("/watch", loadbalance.WatchCluster)
+		clusterGroup.GET("/history", loadbalance.ClusterHistory)
+		clusterGroup.GET("/usage", loadbalance.ClusterUsage)
+		clusterGroup.GET("/quotas", loadbalance.ListQuotas)
+		clusterGroup.GET("/quota", loadbalance.GetQuota)
+		clusterGroup.PUT("/quota", loadbalance.PutQuota)
+		clusterGroup.DELETE("/quota", loadbalance.DeleteQuota)
+		clusterGroup.GET("/namespaces/:namespace/quota", loadbalance.GetQuota)
+		clusterGroup.PUT("/namespaces/:namespace/quota", loadbalance.PutQuota)
+		clusterGroup.DELETE("/namespaces/:namespace/quota", loadbalance.DeleteQuota)
 	}
 
 	return r
@@ -0,0 +1,14 @@
+package routers
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/openapi"
+	"github.com/gin-gonic/gin"
+	"testing"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if err := openapi.Check(NewRouter().Routes()); err != nil {
+		t.Error(err)
+	}
+}
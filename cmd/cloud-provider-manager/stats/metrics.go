@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"sync"
+)
+
+const metricsSubsystem = "cloud_provider_manager"
+
+var poolLabels = []string{"cluster", "cidr", "carrier"}
+
+var (
+	poolIPs = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "pool_ips",
+		Help:           "Number of ips of a cidr and carrier of a cluster",
+		StabilityLevel: metrics.ALPHA,
+	}, poolLabels)
+
+	poolBoundIPs = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "pool_bound_ips",
+		Help:           "Number of ips bound to a service",
+		StabilityLevel: metrics.ALPHA,
+	}, poolLabels)
+
+	poolFreeIPs = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "pool_free_ips",
+		Help:           "Number of ips available to general allocation",
+		StabilityLevel: metrics.ALPHA,
+	}, poolLabels)
+
+	poolQuarantinedIPs = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "pool_quarantined_ips",
+		Help:           "Number of released ips held back until their quarantine ends",
+		StabilityLevel: metrics.ALPHA,
+	}, poolLabels)
+
+	poolReservedIPs = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "pool_reserved_ips",
+		Help:           "Number of unbound ips only their reservation may bind",
+		StabilityLevel: metrics.ALPHA,
+	}, poolLabels)
+
+	lastRefresh = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "pool_stats_last_refresh_timestamp_seconds",
+		Help:           "Unix time the pool gauges were last refreshed",
+		StabilityLevel: metrics.ALPHA,
+	})
+)
+
+var registerMetrics sync.Once
+
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(poolIPs)
+		legacyregistry.MustRegister(poolBoundIPs)
+		legacyregistry.MustRegister(poolFreeIPs)
+		legacyregistry.MustRegister(poolQuarantinedIPs)
+		legacyregistry.MustRegister(poolReservedIPs)
+		legacyregistry.MustRegister(lastRefresh)
+	})
+}
@@ -0,0 +1,167 @@
+package stats
+
+import (
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"k8s.io/klog/v2"
+	"strconv"
+	"time"
+)
+
+const defaultInterval = 30 * time.Second
+
+// Summary adds up the pools of a cluster, Free is what general allocation can take
+type Summary struct {
+	Cluster     string        `json:"cluster"`
+	Total       int64         `json:"total"`
+	Bound       int64         `json:"bound"`
+	Free        int64         `json:"free"`
+	Quarantined int64         `json:"quarantined"`
+	Reserved    int64         `json:"reserved"`
+	Pools       []models.Pool `json:"pools"`
+}
+
+// Summarize groups pools ordered by cluster into one summary per cluster
+func Summarize(pools []models.PoolStats) []Summary {
+	result := make([]Summary, 0)
+	for _, pool := range pools {
+		if len(result) == 0 || result[len(result)-1].Cluster != pool.Cluster {
+			result = append(result, Summary{Cluster: pool.Cluster, Pools: []models.Pool{}})
+		}
+		summary := &result[len(result)-1]
+		summary.Total += pool.Total
+		summary.Bound += pool.Bound
+		summary.Free += pool.Available
+		summary.Quarantined += pool.Quarantined
+		summary.Reserved += pool.Reserved
+		summary.Pools = append(summary.Pools, pool.Pool)
+	}
+	return result
+}
+
+// Watermark is the data of the PoolLowWatermark and PoolRecovered events, Cidr
+// is empty when the rule covers the whole cluster
+type Watermark struct {
+	Cidr           string  `json:"cidr,omitempty"`
+	Free           int64   `json:"free"`
+	Total          int64   `json:"total"`
+	MinFree        int64   `json:"minFree,omitempty"`
+	MinFreePercent float64 `json:"minFreePercent,omitempty"`
+}
+
+func (w *Watermark) low() bool {
+	if w.Free < w.MinFree {
+		return true
+	}
+	return w.MinFreePercent > 0 && float64(w.Free)*100 < w.MinFreePercent*float64(w.Total)
+}
+
+// ruleKey identifies a low watermark rule in the database, editing the rule
+// starts it over as not low
+func ruleKey(rule config.CloudProviderLowWatermarkConfig) string {
+	return fmt.Sprintf("%s/%s/%d/%g", rule.Cluster, rule.Cidr, rule.MinFree, rule.MinFreePercent)
+}
+
+// Reporter refreshes the pool gauges and queues a webhook event when a pool
+// crosses a low watermark, in either direction. The state of the watermarks is
+// kept in the database, so every manager may run a reporter.
+type Reporter struct {
+	interval   time.Duration
+	watermarks []config.CloudProviderLowWatermarkConfig
+}
+
+func NewReporter(cfg config.CloudProviderStatsConfig) (*Reporter, error) {
+	for i, watermark := range cfg.LowWatermarks {
+		if watermark.Cluster == "" {
+			return nil, fmt.Errorf("low watermark %d: cluster is required, * matches every cluster", i)
+		}
+		if watermark.MinFree <= 0 && watermark.MinFreePercent <= 0 {
+			return nil, fmt.Errorf("low watermark %d: minFree or minFreePercent is required", i)
+		}
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	RegisterMetrics()
+	return &Reporter{
+		interval:   interval,
+		watermarks: cfg.LowWatermarks,
+	}, nil
+}
+
+func (r *Reporter) Run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.refresh(); err != nil {
+			klog.Errorf("refresh pool stats fail: %s", err.Error())
+		}
+		<-ticker.C
+	}
+}
+
+func (r *Reporter) refresh() error {
+	pools, err := models.LoadBalanceModel.Stats(nil)
+	if err != nil {
+		return err
+	}
+
+	// pools that disappeared must not keep their last value
+	for _, gauge := range []interface{ Reset() }{poolIPs, poolBoundIPs, poolFreeIPs, poolQuarantinedIPs, poolReservedIPs} {
+		gauge.Reset()
+	}
+	for _, pool := range pools {
+		labels := []string{pool.Cluster, pool.Cidr, strconv.Itoa(pool.Carriers)}
+		poolIPs.WithLabelValues(labels...).Set(float64(pool.Total))
+		poolBoundIPs.WithLabelValues(labels...).Set(float64(pool.Bound))
+		poolFreeIPs.WithLabelValues(labels...).Set(float64(pool.Available))
+		poolQuarantinedIPs.WithLabelValues(labels...).Set(float64(pool.Quarantined))
+		poolReservedIPs.WithLabelValues(labels...).Set(float64(pool.Reserved))
+	}
+	lastRefresh.Set(float64(time.Now().Unix()))
+
+	r.checkWatermarks(Summarize(pools))
+	return nil
+}
+
+func (r *Reporter) checkWatermarks(summaries []Summary) {
+	for _, rule := range r.watermarks {
+		key := ruleKey(rule)
+		for _, summary := range summaries {
+			if rule.Cluster != "*" && rule.Cluster != summary.Cluster {
+				continue
+			}
+
+			watermark := Watermark{Cidr: rule.Cidr, MinFree: rule.MinFree, MinFreePercent: rule.MinFreePercent}
+			for _, pool := range summary.Pools {
+				if rule.Cidr == "" || rule.Cidr == pool.Cidr {
+					watermark.Free += pool.Available
+					watermark.Total += pool.Total
+				}
+			}
+			if watermark.Total == 0 {
+				continue
+			}
+
+			low := watermark.low()
+			event := &models.WebhookEvent{Type: models.EventPoolRecovered, Cluster: summary.Cluster, Data: watermark}
+			if low {
+				event.Type = models.EventPoolLowWatermark
+			}
+			changed, err := models.PoolWatermarkModel.Transition(key, summary.Cluster, low, event)
+			if err != nil {
+				klog.Errorf("queue %s event of cluster %s fail: %s", event.Type, summary.Cluster, err.Error())
+				continue
+			}
+			if changed && low {
+				klog.Warningf("pool of cluster %s cidr %q below its low watermark, %d of %d ips free",
+					summary.Cluster, rule.Cidr, watermark.Free, watermark.Total)
+			}
+		}
+	}
+}
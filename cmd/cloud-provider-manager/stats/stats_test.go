@@ -0,0 +1,72 @@
+package stats
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"testing"
+)
+
+func TestWatermarkLow(t *testing.T) {
+	tests := []struct {
+		name      string
+		watermark Watermark
+		low       bool
+	}{
+		{name: "above min free", watermark: Watermark{Free: 10, Total: 100, MinFree: 5}},
+		{name: "at min free", watermark: Watermark{Free: 5, Total: 100, MinFree: 5}},
+		{name: "below min free", watermark: Watermark{Free: 4, Total: 100, MinFree: 5}, low: true},
+		{name: "at min percent", watermark: Watermark{Free: 10, Total: 100, MinFreePercent: 10}},
+		{name: "below min percent", watermark: Watermark{Free: 9, Total: 100, MinFreePercent: 10}, low: true},
+		{name: "either rule", watermark: Watermark{Free: 9, Total: 100, MinFree: 1, MinFreePercent: 10}, low: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if low := tt.watermark.low(); low != tt.low {
+				t.Errorf("low = %v, expected %v", low, tt.low)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	pools := []models.PoolStats{
+		{Cluster: "c1", Pool: models.Pool{Cidr: "10.0.0.0/24", Total: 10, Available: 4, Bound: 3, Quarantined: 2, Reserved: 1}},
+		{Cluster: "c1", Pool: models.Pool{Cidr: "10.0.1.0/24", Total: 5, Available: 5}},
+		{Cluster: "c2", Pool: models.Pool{Cidr: "10.1.0.0/24", Total: 2, Bound: 2}},
+	}
+
+	summaries := Summarize(pools)
+	if len(summaries) != 2 {
+		t.Fatalf("summaries = %+v, expected one per cluster", summaries)
+	}
+	first := summaries[0]
+	if first.Cluster != "c1" || first.Total != 15 || first.Free != 9 || first.Bound != 3 || first.Quarantined != 2 || first.Reserved != 1 || len(first.Pools) != 2 {
+		t.Errorf("c1 = %+v", first)
+	}
+	if second := summaries[1]; second.Cluster != "c2" || second.Total != 2 || second.Free != 0 || len(second.Pools) != 1 {
+		t.Errorf("c2 = %+v", second)
+	}
+}
+
+func TestRuleKey(t *testing.T) {
+	rule := config.CloudProviderLowWatermarkConfig{Cluster: "*", MinFreePercent: 10}
+	tests := []struct {
+		name  string
+		other config.CloudProviderLowWatermarkConfig
+		equal bool
+	}{
+		{name: "same rule", other: rule, equal: true},
+		{name: "other cluster", other: config.CloudProviderLowWatermarkConfig{Cluster: "c1", MinFreePercent: 10}},
+		{name: "other cidr", other: config.CloudProviderLowWatermarkConfig{Cluster: "*", Cidr: "10.0.0.0/24", MinFreePercent: 10}},
+		{name: "other limit", other: config.CloudProviderLowWatermarkConfig{Cluster: "*", MinFreePercent: 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if equal := ruleKey(tt.other) == ruleKey(rule); equal != tt.equal {
+				t.Errorf("%s and %s equal = %v, expected %v", ruleKey(tt.other), ruleKey(rule), equal, tt.equal)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package watch
+
+import (
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBufferSize       = 1000
+	defaultTimeout          = 5 * time.Minute
+	defaultBookmarkInterval = 30 * time.Second
+	watcherBuffer           = 256
+)
+
+// ErrGone is returned when the requested resource version is no longer held in
+// the history, the client has to list again and watch from the new version
+var ErrGone = errors.New("resource version too old")
+
+type EventType string
+
+const (
+	Added    EventType = "ADDED"
+	Modified EventType = "MODIFIED"
+	Deleted  EventType = "DELETED"
+	Bound    EventType = "BOUND"
+	Released EventType = "RELEASED"
+	// Bookmark only carries a resource version, watching from it skips nothing
+	Bookmark EventType = "BOOKMARK"
+)
+
+type Event struct {
+	Type            EventType   `json:"type"`
+	ResourceVersion string      `json:"resourceVersion"`
+	Object          interface{} `json:"object,omitempty"`
+
+	rv      uint64
+	cluster string
+}
+
+// Broadcaster keeps the last events of this process in a ring buffer and fans
+// them out to watchers. Resource versions start at the unix time in nanoseconds
+// of the process start, so every version handed out by an earlier process is
+// older than the history and gets ErrGone instead of silently missing events.
+// Writes made by other replicas of the manager are not seen.
+type Broadcaster struct {
+	mu       sync.Mutex
+	history  []Event
+	next     int
+	full     bool
+	rv       uint64
+	watchers map[*Watcher]struct{}
+}
+
+func NewBroadcaster(size int) *Broadcaster {
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	return &Broadcaster{
+		history:  make([]Event, size),
+		rv:       uint64(time.Now().UnixNano()),
+		watchers: map[*Watcher]struct{}{},
+	}
+}
+
+var (
+	Default = NewBroadcaster(defaultBufferSize)
+
+	// Timeout closes a watch so clients reconnect, BookmarkInterval keeps idle watches alive
+	Timeout          = defaultTimeout
+	BookmarkInterval = defaultBookmarkInterval
+)
+
+// Setup replaces Default, call it before serving
+func Setup(cfg config.CloudProviderWatchConfig) {
+	Default = NewBroadcaster(cfg.BufferSize)
+	if cfg.Timeout > 0 {
+		Timeout = cfg.Timeout
+	}
+	if cfg.BookmarkInterval > 0 {
+		BookmarkInterval = cfg.BookmarkInterval
+	}
+}
+
+// ParseResourceVersion parses a version handed out by the api, empty means now
+func ParseResourceVersion(in string) (uint64, error) {
+	if in == "" {
+		return 0, nil
+	}
+	rv, err := strconv.ParseUint(in, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid resource version")
+	}
+	return rv, nil
+}
+
+// ResourceVersion is the version of the last published event, take it before
+// reading the database so a list followed by a watch from it misses nothing
+func (b *Broadcaster) ResourceVersion() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strconv.FormatUint(b.rv, 10)
+}
+
+func (b *Broadcaster) Publish(cluster string, eventType EventType, obj interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rv++
+	event := Event{
+		Type:            eventType,
+		ResourceVersion: strconv.FormatUint(b.rv, 10),
+		Object:          obj,
+		rv:              b.rv,
+		cluster:         cluster,
+	}
+
+	b.history[b.next] = event
+	b.next = (b.next + 1) % len(b.history)
+	if b.next == 0 {
+		b.full = true
+	}
+
+	for w := range b.watchers {
+		if w.cluster == event.cluster {
+			b.send(w, event)
+		}
+	}
+}
+
+// send drops a watcher that can not keep up, it resumes from its last version
+func (b *Broadcaster) send(w *Watcher, event Event) {
+	select {
+	case w.ch <- event:
+	default:
+		delete(b.watchers, w)
+		close(w.ch)
+	}
+}
+
+func (b *Broadcaster) oldest() uint64 {
+	if b.full {
+		return b.history[b.next].rv
+	}
+	if b.next == 0 {
+		return b.rv + 1
+	}
+	return b.history[0].rv
+}
+
+// Watch returns the events of cluster published after rv, 0 means from now on
+func (b *Broadcaster) Watch(cluster string, rv uint64) (*Watcher, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if rv == 0 {
+		rv = b.rv
+	}
+	if rv > b.rv || rv+1 < b.oldest() {
+		return nil, ErrGone
+	}
+
+	var replay []Event
+	for i := 0; i < len(b.history); i++ {
+		event := b.history[(b.next+i)%len(b.history)]
+		if event.rv > rv && event.cluster == cluster {
+			replay = append(replay, event)
+		}
+	}
+
+	w := &Watcher{
+		ch:          make(chan Event, len(replay)+watcherBuffer),
+		cluster:     cluster,
+		broadcaster: b,
+	}
+	for _, event := range replay {
+		w.ch <- event
+	}
+	b.watchers[w] = struct{}{}
+	return w, nil
+}
+
+// Watcher receives events until it is stopped or falls behind, either closes the channel
+type Watcher struct {
+	ch          chan Event
+	cluster     string
+	broadcaster *Broadcaster
+}
+
+func (w *Watcher) ResultChan() <-chan Event {
+	return w.ch
+}
+
+// Bookmark queues the current resource version behind every event already queued
+func (w *Watcher) Bookmark() {
+	b := w.broadcaster
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.watchers[w]; ok {
+		b.send(w, Event{Type: Bookmark, ResourceVersion: strconv.FormatUint(b.rv, 10), rv: b.rv, cluster: w.cluster})
+	}
+}
+
+func (w *Watcher) Stop() {
+	b := w.broadcaster
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.watchers[w]; ok {
+		delete(b.watchers, w)
+		close(w.ch)
+	}
+}
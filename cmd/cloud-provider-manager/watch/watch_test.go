@@ -0,0 +1,178 @@
+package watch
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseResourceVersion(t *testing.T) {
+	tests := []struct {
+		in  string
+		rv  uint64
+		err bool
+	}{
+		{in: "", rv: 0},
+		{in: "42", rv: 42},
+		{in: "-1", err: true},
+		{in: "abc", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			rv, err := ParseResourceVersion(tt.in)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, expected error %v", err, tt.err)
+			}
+			if rv != tt.rv {
+				t.Errorf("rv = %d, expected %d", rv, tt.rv)
+			}
+		})
+	}
+}
+
+// drain returns the objects queued for w without blocking
+func drain(w *Watcher) []interface{} {
+	var objects []interface{}
+	for {
+		select {
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return objects
+			}
+			objects = append(objects, event.Object)
+		default:
+			return objects
+		}
+	}
+}
+
+func TestWatchReplay(t *testing.T) {
+	b := NewBroadcaster(4)
+	start, _ := ParseResourceVersion(b.ResourceVersion())
+
+	// c1 gets 1 2 4 5 6, c2 gets 3, the history keeps the last four events
+	for i := 1; i <= 6; i++ {
+		cluster := "c1"
+		if i == 3 {
+			cluster = "c2"
+		}
+		b.Publish(cluster, Modified, i)
+	}
+
+	tests := []struct {
+		name    string
+		cluster string
+		rv      uint64
+		objects []interface{}
+		err     error
+	}{
+		{name: "from now on", cluster: "c1", rv: 0},
+		{name: "latest version", cluster: "c1", rv: start + 6},
+		{name: "after the oldest held event", cluster: "c1", rv: start + 3, objects: []interface{}{4, 5, 6}},
+		{name: "just before the oldest held event", cluster: "c1", rv: start + 2, objects: []interface{}{4, 5, 6}},
+		{name: "other cluster", cluster: "c2", rv: start + 2, objects: []interface{}{3}},
+		{name: "evicted", cluster: "c1", rv: start + 1, err: ErrGone},
+		{name: "earlier process", cluster: "c1", rv: start - 1, err: ErrGone},
+		{name: "future", cluster: "c1", rv: start + 7, err: ErrGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := b.Watch(tt.cluster, tt.rv)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			defer w.Stop()
+
+			if objects := drain(w); !reflect.DeepEqual(objects, tt.objects) {
+				t.Errorf("replayed %v, expected %v", objects, tt.objects)
+			}
+		})
+	}
+}
+
+func TestWatchEmptyHistory(t *testing.T) {
+	b := NewBroadcaster(4)
+	rv, _ := ParseResourceVersion(b.ResourceVersion())
+
+	w, err := b.Watch("c1", rv)
+	if err != nil {
+		t.Fatalf("watch from the start version: %v", err)
+	}
+	defer w.Stop()
+
+	b.Publish("c1", Added, "a")
+	event := <-w.ResultChan()
+	if event.Type != Added || event.ResourceVersion != strconv.FormatUint(rv+1, 10) {
+		t.Errorf("event = %s %s, expected ADDED %d", event.Type, event.ResourceVersion, rv+1)
+	}
+	if b.ResourceVersion() != event.ResourceVersion {
+		t.Errorf("resource version = %s, expected the version of the last event", b.ResourceVersion())
+	}
+}
+
+func TestWatchLive(t *testing.T) {
+	b := NewBroadcaster(16)
+	w, err := b.Watch("c1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Publish("c2", Added, "other")
+	b.Publish("c1", Bound, "a")
+	w.Bookmark()
+	b.Publish("c1", Released, "a")
+
+	var types []EventType
+	for _, event := range []Event{<-w.ResultChan(), <-w.ResultChan(), <-w.ResultChan()} {
+		types = append(types, event.Type)
+	}
+	if expected := []EventType{Bound, Bookmark, Released}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("events = %v, expected %v", types, expected)
+	}
+
+	w.Stop()
+	if _, ok := <-w.ResultChan(); ok {
+		t.Error("the channel is open after Stop")
+	}
+	// stopping twice and bookmarking a stopped watcher are no-ops
+	w.Stop()
+	w.Bookmark()
+	b.Publish("c1", Added, "b")
+}
+
+func TestSlowWatcherDropped(t *testing.T) {
+	b := NewBroadcaster(16)
+	slow, err := b.Watch("c1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := b.Watch("c2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+
+	for i := 0; i <= watcherBuffer; i++ {
+		b.Publish("c1", Modified, i)
+	}
+
+	if objects := drain(slow); len(objects) != watcherBuffer {
+		t.Errorf("received %d events, expected the %d buffered before the drop", len(objects), watcherBuffer)
+	}
+	if _, ok := <-slow.ResultChan(); ok {
+		t.Error("the slow watcher is still open")
+	}
+	if _, ok := b.watchers[slow]; ok {
+		t.Error("the slow watcher is still registered")
+	}
+	if _, ok := b.watchers[other]; !ok {
+		t.Error("a watcher of another cluster was dropped")
+	}
+	slow.Stop()
+}
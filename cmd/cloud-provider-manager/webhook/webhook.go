@@ -0,0 +1,234 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"io"
+	"k8s.io/klog/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout          = 10 * time.Second
+	defaultInterval         = 5 * time.Second
+	defaultRetryInterval    = 5 * time.Second
+	defaultMaxRetryInterval = 10 * time.Minute
+	defaultMaxAttempts      = 10
+)
+
+// the headers of every post, the signature is the hex hmac-sha256 of
+// StringToSign keyed with the secret of the subscriber
+const (
+	HeaderEventId   = "X-CloudProvider-Event-Id"
+	HeaderEventType = "X-CloudProvider-Event"
+	HeaderTimestamp = "X-CloudProvider-Timestamp"
+	HeaderSignature = "X-CloudProvider-Signature"
+)
+
+// maxResponseBody bounds how much of a failed response ends up in last_error
+const maxResponseBody = 256
+
+// StringToSign binds the signature to the event and the time it was sent so a
+// receiver can refuse replays, the timestamp is unix seconds
+func StringToSign(timestamp, eventId string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{timestamp, eventId, hex.EncodeToString(sum[:])}, "\n")
+}
+
+type subscriber struct {
+	name   string
+	url    string
+	secret string
+}
+
+// Dispatcher posts the queued deliveries of every subscriber in order. Every
+// manager sharing the database may run one, a delivery is claimed before it is
+// posted.
+type Dispatcher struct {
+	subscribers      []subscriber
+	client           *http.Client
+	interval         time.Duration
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+	maxAttempts      int
+}
+
+func NewDispatcher(cfg config.CloudProviderWebhookConfig) (*Dispatcher, error) {
+	known := map[string]bool{}
+	for _, eventType := range models.EventTypes {
+		known[eventType] = true
+	}
+
+	d := &Dispatcher{
+		client:           &http.Client{Timeout: cfg.Timeout},
+		interval:         cfg.Interval,
+		retryInterval:    cfg.RetryInterval,
+		maxRetryInterval: cfg.MaxRetryInterval,
+		maxAttempts:      cfg.MaxAttempts,
+	}
+	if d.client.Timeout <= 0 {
+		d.client.Timeout = defaultTimeout
+	}
+	if d.interval <= 0 {
+		d.interval = defaultInterval
+	}
+	if d.retryInterval <= 0 {
+		d.retryInterval = defaultRetryInterval
+	}
+	if d.maxRetryInterval <= 0 {
+		d.maxRetryInterval = defaultMaxRetryInterval
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = defaultMaxAttempts
+	}
+
+	names := map[string]bool{}
+	for i, s := range cfg.Subscribers {
+		if s.Name == "" {
+			return nil, fmt.Errorf("webhook subscriber %d: name is required", i)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("webhook subscriber %s: duplicate name", s.Name)
+		}
+		names[s.Name] = true
+
+		if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook subscriber %s: invalid url %q", s.Name, s.URL)
+		}
+		for _, eventType := range s.Events {
+			if !known[eventType] {
+				return nil, fmt.Errorf("webhook subscriber %s: unknown event %s", s.Name, eventType)
+			}
+		}
+
+		secret := s.Secret
+		if s.SecretFile != "" {
+			data, err := os.ReadFile(s.SecretFile)
+			if err != nil {
+				return nil, fmt.Errorf("webhook subscriber %s: %w", s.Name, err)
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("webhook subscriber %s: secret or secretFile is required", s.Name)
+		}
+
+		d.subscribers = append(d.subscribers, subscriber{name: s.Name, url: s.URL, secret: secret})
+	}
+	return d, nil
+}
+
+// Run delivers the queue of every subscriber until the process exits
+func (d *Dispatcher) Run() {
+	for i := range d.subscribers {
+		go d.run(&d.subscribers[i])
+	}
+}
+
+func (d *Dispatcher) run(s *subscriber) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		// drain what is due, a failure waits for the next tick
+		for d.deliverNext(s) {
+		}
+		<-ticker.C
+	}
+}
+
+// deliverNext posts the oldest pending delivery of the subscriber once it is
+// due, true means it was delivered or given up and the next one may follow
+func (d *Dispatcher) deliverNext(s *subscriber) bool {
+	delivery, err := models.WebhookDeliveryModel.Next(s.name)
+	if err != nil {
+		if !errors.Is(err, models.ErrNotFound) {
+			klog.Errorf("read webhook queue of %s fail: %s", s.name, err.Error())
+		}
+		return false
+	}
+
+	now := time.Now()
+	ok, err := models.WebhookDeliveryModel.Claim(delivery, now, now.Add(2*d.client.Timeout))
+	if err != nil {
+		klog.Errorf("claim webhook delivery %d of %s fail: %s", delivery.Id, s.name, err.Error())
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	if err = d.post(s, delivery); err == nil {
+		if err = models.WebhookDeliveryModel.Delivered(delivery); err != nil {
+			klog.Errorf("dequeue webhook delivery %d of %s fail: %s", delivery.Id, s.name, err.Error())
+			return false
+		}
+		return true
+	}
+
+	giveUp := delivery.Attempts+1 >= d.maxAttempts
+	next := now.Add(d.backoff(delivery.Attempts))
+	if giveUp {
+		klog.Errorf("giving up %s event %s for webhook %s after %d attempts: %s",
+			delivery.EventType, delivery.EventId, s.name, delivery.Attempts+1, err.Error())
+	} else {
+		klog.Warningf("post %s event %s to webhook %s fail, retrying at %s: %s",
+			delivery.EventType, delivery.EventId, s.name, next.Format(time.RFC3339), err.Error())
+	}
+	if err = models.WebhookDeliveryModel.Failed(delivery, err.Error(), next, giveUp); err != nil {
+		klog.Errorf("record failed webhook delivery %d of %s fail: %s", delivery.Id, s.name, err.Error())
+		return false
+	}
+	return giveUp
+}
+
+// backoff doubles retryInterval with every attempt made so far
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.retryInterval
+	for i := 0; i < attempts && wait < d.maxRetryInterval; i++ {
+		wait *= 2
+	}
+	if wait > d.maxRetryInterval {
+		wait = d.maxRetryInterval
+	}
+	return wait
+}
+
+func (d *Dispatcher) post(s *subscriber, delivery *models.WebhookDelivery) error {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventId, delivery.EventId)
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, signature.Sign(s.secret, StringToSign(timestamp, delivery.EventId, body)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
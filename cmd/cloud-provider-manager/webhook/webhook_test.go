@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/cmd/cloud-provider-manager/models"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDispatcher(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		subscribers []config.CloudProviderWebhookSubscriberConfig
+		err         string
+		secret      string
+	}{
+		{name: "secret", subscribers: []config.CloudProviderWebhookSubscriberConfig{{Name: "ops", URL: "https://ops.example.com/hook", Secret: "s"}}, secret: "s"},
+		{name: "secret file", subscribers: []config.CloudProviderWebhookSubscriberConfig{{Name: "ops", URL: "http://ops:8080/hook", SecretFile: secretFile}}, secret: "from-file"},
+		{name: "missing name", subscribers: []config.CloudProviderWebhookSubscriberConfig{{URL: "https://ops.example.com", Secret: "s"}}, err: "name is required"},
+		{
+			name: "duplicate name",
+			subscribers: []config.CloudProviderWebhookSubscriberConfig{
+				{Name: "ops", URL: "https://ops.example.com", Secret: "s"},
+				{Name: "ops", URL: "https://other.example.com", Secret: "s"},
+			},
+			err: "duplicate name",
+		},
+		{name: "invalid url", subscribers: []config.CloudProviderWebhookSubscriberConfig{{Name: "ops", URL: "ops.example.com", Secret: "s"}}, err: "invalid url"},
+		{name: "unknown event", subscribers: []config.CloudProviderWebhookSubscriberConfig{{Name: "ops", URL: "https://ops.example.com", Secret: "s", Events: []string{"Bound", "Deleted"}}}, err: "unknown event Deleted"},
+		{name: "missing secret", subscribers: []config.CloudProviderWebhookSubscriberConfig{{Name: "ops", URL: "https://ops.example.com"}}, err: "secret or secretFile is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDispatcher(config.CloudProviderWebhookConfig{Subscribers: tt.subscribers})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.subscribers[0].secret != tt.secret {
+				t.Errorf("secret = %q, expected %q", d.subscribers[0].secret, tt.secret)
+			}
+			if d.client.Timeout != defaultTimeout || d.maxAttempts != defaultMaxAttempts {
+				t.Errorf("timeout %s and %d attempts, expected the defaults", d.client.Timeout, d.maxAttempts)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{retryInterval: 5 * time.Second, maxRetryInterval: time.Minute}
+
+	tests := []struct {
+		attempts int
+		wait     time.Duration
+	}{
+		{attempts: 0, wait: 5 * time.Second},
+		{attempts: 1, wait: 10 * time.Second},
+		{attempts: 3, wait: 40 * time.Second},
+		{attempts: 4, wait: time.Minute},
+		{attempts: 100, wait: time.Minute},
+	}
+	for _, tt := range tests {
+		if wait := d.backoff(tt.attempts); wait != tt.wait {
+			t.Errorf("backoff(%d) = %s, expected %s", tt.attempts, wait, tt.wait)
+		}
+	}
+}
+
+func TestPost(t *testing.T) {
+	delivery := &models.WebhookDelivery{EventId: "e1", EventType: models.EventBound, Payload: `{"id":"e1","type":"Bound"}`}
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{name: "delivered", status: http.StatusNoContent},
+		{name: "refused", status: http.StatusBadRequest, body: "stale timestamp\n", err: "webhook answered 400 Bad Request: stale timestamp"},
+		{name: "long answer is cut", status: http.StatusInternalServerError, body: strings.Repeat("x", 2*maxResponseBody), err: strings.Repeat("x", maxResponseBody)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != delivery.Payload || r.Header.Get(HeaderEventId) != "e1" || r.Header.Get(HeaderEventType) != models.EventBound {
+					t.Errorf("received %s with event %s %s", body, r.Header.Get(HeaderEventType), r.Header.Get(HeaderEventId))
+				}
+				stringToSign := StringToSign(r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderEventId), body)
+				if err := signature.Verify("secret", stringToSign, r.Header.Get(HeaderSignature)); err != nil {
+					t.Errorf("signature: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			d := &Dispatcher{client: server.Client()}
+			err := d.post(&subscriber{name: "ops", url: server.URL, secret: "secret"}, delivery)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.HasSuffix(err.Error(), tt.err) || strings.Contains(err.Error(), tt.err+"x") {
+				t.Errorf("err = %v, expected it to end with %q", err, tt.err)
+			}
+		})
+	}
+}
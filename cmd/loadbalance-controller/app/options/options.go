@@ -12,6 +12,8 @@ type LoadBalanceFlags struct {
 	LeaseLockId        string
 	LeaseLockName      string
 	LeaseLockNamespace string
+	MetricsBindAddress string
+	Workers            int
 }
 
 type LoadBalanceServer struct {
@@ -34,6 +36,8 @@ func (l *LoadBalanceFlags) AddFlags(mainfs *pflag.FlagSet) {
 	fs.StringVar(&l.LeaseLockId, "lease-lock", l.LeaseLockId, "the lease lock id. should unique")
 	fs.StringVar(&l.LeaseLockName, "lease-lock-name", l.LeaseLockName, "the lease lock resource name")
 	fs.StringVar(&l.LeaseLockNamespace, "lease-lock-namespace", l.LeaseLockNamespace, "the lease lock resource namespace")
+	fs.IntVar(&l.Workers, "workers", l.Workers, "the number of services synced concurrently")
+	fs.StringVar(&l.MetricsBindAddress, "metrics-bind-address", l.MetricsBindAddress, "the address serving /metrics, /healthz and /readyz, empty disables it")
 }
 
 func (l *LoadBalanceFlags) SetDefaultRequiredValue() {
@@ -45,6 +49,10 @@ func (l *LoadBalanceFlags) SetDefaultRequiredValue() {
 		l.LeaseLockNamespace = "kube-system"
 	}
 
+	if l.Workers <= 0 {
+		l.Workers = 1
+	}
+
 	if l.LeaseLockId == "" {
 		id, _ := os.Hostname()
 		l.LeaseLockId = id
@@ -57,6 +65,8 @@ func NewLoadBalanceServer() *LoadBalanceServer {
 			LoadBalanceConfig:  "config.yml",
 			LeaseLockName:      "loadbalance-controller",
 			LeaseLockNamespace: "kube-system",
+			MetricsBindAddress: ":10280",
+			Workers:            1,
 		},
 	}
 
@@ -16,7 +16,9 @@ import (
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -99,6 +101,28 @@ func buildKubeConfig(kubeconfig string) (*rest.Config, error) {
 	return cfg, err
 }
 
+func serveMetrics(address string, ready func() error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", legacyregistry.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	go func() {
+		klog.Infof("serving metrics on %s", address)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			klog.Errorf("metrics server error: %s", err.Error())
+		}
+	}()
+}
+
 func run(server *options.LoadBalanceServer) error {
 
 	kubeClientConfig, err := buildKubeConfig(server.KubeConfig)
@@ -123,13 +147,14 @@ func run(server *options.LoadBalanceServer) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	loadbalanceController, err := controllers.NewLoaBalanceController(kubeClient, loadbalanceConfig)
+	loadbalanceController, err := controllers.NewLoaBalanceController(ctx, kubeClient, loadbalanceConfig)
 	if err != nil {
 		return err
 	}
 
-	// main service blocking signal
-	stop := make(chan struct{})
+	if server.MetricsBindAddress != "" {
+		serveMetrics(server.MetricsBindAddress, loadbalanceController.Ready)
+	}
 
 	// listen for interrupts or the Linux SIGTERM signal and cancel
 	// our context, which the leader election code will observe and
@@ -139,15 +164,13 @@ func run(server *options.LoadBalanceServer) error {
 	go func() {
 		<-ch
 		klog.Info("Received termination, signaling shutdown")
-		close(stop)
 		cancel()
 	}()
 
 	runFunc := func(ctx context.Context) {
 		// complete your controller loop here
 		klog.Info("Controller loop...")
-		go loadbalanceController.Run(1, stop)
-		select {}
+		loadbalanceController.Run(ctx, server.Workers)
 	}
 
 	// we use the Lease lock type since edits to Leases are less common
@@ -0,0 +1,5 @@
+// Package loadbalancerv1 holds the messages and the LoadBalancerService stubs
+// generated from loadbalancer.proto, run go generate after changing it.
+package loadbalancerv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative loadbalancer.proto
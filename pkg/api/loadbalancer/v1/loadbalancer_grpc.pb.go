@@ -0,0 +1,353 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: loadbalancer.proto
+
+package loadbalancerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// LoadBalancerServiceClient is the client API for LoadBalancerService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LoadBalancerServiceClient interface {
+	// Allocate binds a free ip of the cluster to the service
+	Allocate(ctx context.Context, in *AllocateRequest, opts ...grpc.CallOption) (*LoadBalance, error)
+	Bind(ctx context.Context, in *BindRequest, opts ...grpc.CallOption) (*LoadBalance, error)
+	Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*ReleaseResponse, error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	GetByService(ctx context.Context, in *GetByServiceRequest, opts ...grpc.CallOption) (*LoadBalance, error)
+	// GetPrevious returns the ip the service released last within the sticky retention
+	GetPrevious(ctx context.Context, in *GetByServiceRequest, opts ...grpc.CallOption) (*LoadBalance, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (LoadBalancerService_WatchClient, error)
+}
+
+type loadBalancerServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLoadBalancerServiceClient(cc grpc.ClientConnInterface) LoadBalancerServiceClient {
+	return &loadBalancerServiceClient{cc}
+}
+
+func (c *loadBalancerServiceClient) Allocate(ctx context.Context, in *AllocateRequest, opts ...grpc.CallOption) (*LoadBalance, error) {
+	out := new(LoadBalance)
+	err := c.cc.Invoke(ctx, "/cloudprovider.loadbalancer.v1.LoadBalancerService/Allocate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loadBalancerServiceClient) Bind(ctx context.Context, in *BindRequest, opts ...grpc.CallOption) (*LoadBalance, error) {
+	out := new(LoadBalance)
+	err := c.cc.Invoke(ctx, "/cloudprovider.loadbalancer.v1.LoadBalancerService/Bind", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loadBalancerServiceClient) Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*ReleaseResponse, error) {
+	out := new(ReleaseResponse)
+	err := c.cc.Invoke(ctx, "/cloudprovider.loadbalancer.v1.LoadBalancerService/Release", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loadBalancerServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/cloudprovider.loadbalancer.v1.LoadBalancerService/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loadBalancerServiceClient) GetByService(ctx context.Context, in *GetByServiceRequest, opts ...grpc.CallOption) (*LoadBalance, error) {
+	out := new(LoadBalance)
+	err := c.cc.Invoke(ctx, "/cloudprovider.loadbalancer.v1.LoadBalancerService/GetByService", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loadBalancerServiceClient) GetPrevious(ctx context.Context, in *GetByServiceRequest, opts ...grpc.CallOption) (*LoadBalance, error) {
+	out := new(LoadBalance)
+	err := c.cc.Invoke(ctx, "/cloudprovider.loadbalancer.v1.LoadBalancerService/GetPrevious", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loadBalancerServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (LoadBalancerService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LoadBalancerService_ServiceDesc.Streams[0], "/cloudprovider.loadbalancer.v1.LoadBalancerService/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &loadBalancerServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LoadBalancerService_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type loadBalancerServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *loadBalancerServiceWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadBalancerServiceServer is the server API for LoadBalancerService service.
+// All implementations must embed UnimplementedLoadBalancerServiceServer
+// for forward compatibility
+type LoadBalancerServiceServer interface {
+	// Allocate binds a free ip of the cluster to the service
+	Allocate(context.Context, *AllocateRequest) (*LoadBalance, error)
+	Bind(context.Context, *BindRequest) (*LoadBalance, error)
+	Release(context.Context, *ReleaseRequest) (*ReleaseResponse, error)
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	GetByService(context.Context, *GetByServiceRequest) (*LoadBalance, error)
+	// GetPrevious returns the ip the service released last within the sticky retention
+	GetPrevious(context.Context, *GetByServiceRequest) (*LoadBalance, error)
+	Watch(*WatchRequest, LoadBalancerService_WatchServer) error
+	mustEmbedUnimplementedLoadBalancerServiceServer()
+}
+
+// UnimplementedLoadBalancerServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedLoadBalancerServiceServer struct {
+}
+
+func (UnimplementedLoadBalancerServiceServer) Allocate(context.Context, *AllocateRequest) (*LoadBalance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Allocate not implemented")
+}
+func (UnimplementedLoadBalancerServiceServer) Bind(context.Context, *BindRequest) (*LoadBalance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Bind not implemented")
+}
+func (UnimplementedLoadBalancerServiceServer) Release(context.Context, *ReleaseRequest) (*ReleaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Release not implemented")
+}
+func (UnimplementedLoadBalancerServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedLoadBalancerServiceServer) GetByService(context.Context, *GetByServiceRequest) (*LoadBalance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetByService not implemented")
+}
+func (UnimplementedLoadBalancerServiceServer) GetPrevious(context.Context, *GetByServiceRequest) (*LoadBalance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPrevious not implemented")
+}
+func (UnimplementedLoadBalancerServiceServer) Watch(*WatchRequest, LoadBalancerService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedLoadBalancerServiceServer) mustEmbedUnimplementedLoadBalancerServiceServer() {}
+
+// UnsafeLoadBalancerServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LoadBalancerServiceServer will
+// result in compilation errors.
+type UnsafeLoadBalancerServiceServer interface {
+	mustEmbedUnimplementedLoadBalancerServiceServer()
+}
+
+func RegisterLoadBalancerServiceServer(s grpc.ServiceRegistrar, srv LoadBalancerServiceServer) {
+	s.RegisterService(&LoadBalancerService_ServiceDesc, srv)
+}
+
+func _LoadBalancerService_Allocate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AllocateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoadBalancerServiceServer).Allocate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloudprovider.loadbalancer.v1.LoadBalancerService/Allocate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoadBalancerServiceServer).Allocate(ctx, req.(*AllocateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoadBalancerService_Bind_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BindRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoadBalancerServiceServer).Bind(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloudprovider.loadbalancer.v1.LoadBalancerService/Bind",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoadBalancerServiceServer).Bind(ctx, req.(*BindRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoadBalancerService_Release_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoadBalancerServiceServer).Release(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloudprovider.loadbalancer.v1.LoadBalancerService/Release",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoadBalancerServiceServer).Release(ctx, req.(*ReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoadBalancerService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoadBalancerServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloudprovider.loadbalancer.v1.LoadBalancerService/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoadBalancerServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoadBalancerService_GetByService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetByServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoadBalancerServiceServer).GetByService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloudprovider.loadbalancer.v1.LoadBalancerService/GetByService",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoadBalancerServiceServer).GetByService(ctx, req.(*GetByServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoadBalancerService_GetPrevious_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetByServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoadBalancerServiceServer).GetPrevious(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cloudprovider.loadbalancer.v1.LoadBalancerService/GetPrevious",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoadBalancerServiceServer).GetPrevious(ctx, req.(*GetByServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoadBalancerService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LoadBalancerServiceServer).Watch(m, &loadBalancerServiceWatchServer{stream})
+}
+
+type LoadBalancerService_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type loadBalancerServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *loadBalancerServiceWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// LoadBalancerService_ServiceDesc is the grpc.ServiceDesc for LoadBalancerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LoadBalancerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cloudprovider.loadbalancer.v1.LoadBalancerService",
+	HandlerType: (*LoadBalancerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Allocate",
+			Handler:    _LoadBalancerService_Allocate_Handler,
+		},
+		{
+			MethodName: "Bind",
+			Handler:    _LoadBalancerService_Bind_Handler,
+		},
+		{
+			MethodName: "Release",
+			Handler:    _LoadBalancerService_Release_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _LoadBalancerService_List_Handler,
+		},
+		{
+			MethodName: "GetByService",
+			Handler:    _LoadBalancerService_GetByService_Handler,
+		},
+		{
+			MethodName: "GetPrevious",
+			Handler:    _LoadBalancerService_GetPrevious_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _LoadBalancerService_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "loadbalancer.proto",
+}
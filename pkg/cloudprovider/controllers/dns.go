@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/cloudprovider/dns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"net"
+	"strings"
+)
+
+// AnnotationHostname asks for an A or AAAA record of the hostname pointing at the
+// ip of the service, in the zone of the dns config. The hostname is also set in
+// the ingress status, which is how the controller finds the record to remove
+// once the annotation changes or the service is deleted.
+const AnnotationHostname = "loadbalance.cloudprovider.io/hostname"
+
+// FinalizerDNSRecord keeps a service with a record until the controller removed
+// the record, so a service deleted while the controller is down loses it too
+// once the controller is back
+const FinalizerDNSRecord = "loadbalance.cloudprovider.io/dns-record"
+
+const (
+	EventReasonDNSUpdateFailed  = "DNSUpdateFailed"
+	EventReasonDNSHostnameTaken = "DNSHostnameTaken"
+)
+
+// hostname is the annotated hostname, empty without dns or when it is outside the zone
+func (c *LoadBalanceController) hostname(service *corev1.Service) string {
+	hostname := strings.TrimSuffix(strings.ToLower(service.Annotations[AnnotationHostname]), ".")
+	if c.dns == nil || hostname == "" {
+		return ""
+	}
+	if !c.dns.InZone(hostname) {
+		c.recorder.Eventf(service, corev1.EventTypeWarning, EventReasonDNSUpdateFailed,
+			"hostname %s is not in zone %s, no record is created", hostname, c.LoadBalanceConfig.DNS.Zone)
+		return ""
+	}
+	return hostname
+}
+
+func ingressHostname(service *corev1.Service) string {
+	if len(service.Status.LoadBalancer.Ingress) == 0 {
+		return ""
+	}
+	return service.Status.LoadBalancer.Ingress[0].Hostname
+}
+
+// dnsOwner is the text of the owner record of the hostname of the service
+func (c *LoadBalanceController) dnsOwner(service *corev1.Service) string {
+	return fmt.Sprintf("heritage=%s,cluster=%s,service=%s/%s", componentName, c.LoadBalanceConfig.Region, service.Namespace, service.Name)
+}
+
+func hasFinalizer(service *corev1.Service) bool {
+	for _, finalizer := range service.Finalizers {
+		if finalizer == FinalizerDNSRecord {
+			return true
+		}
+	}
+	return false
+}
+
+// addFinalizer is called before the first record of the service is created
+func (c *LoadBalanceController) addFinalizer(ctx context.Context, service *corev1.Service) (*corev1.Service, error) {
+	if hasFinalizer(service) {
+		return service, nil
+	}
+	service = service.DeepCopy()
+	service.Finalizers = append(service.Finalizers, FinalizerDNSRecord)
+	return c.kubeClient.CoreV1().Services(service.Namespace).Update(ctx, service, metav1.UpdateOptions{})
+}
+
+// syncRecord removes the record of the hostname the status still names and
+// points hostname at ip. It returns the hostname for the status, empty when the
+// hostname has records of another owner.
+func (c *LoadBalanceController) syncRecord(ctx context.Context, service *corev1.Service, ip, hostname string) (string, error) {
+	if c.dns == nil {
+		return "", nil
+	}
+
+	owner := c.dnsOwner(service)
+	if current := ingressHostname(service); current != "" && current != hostname && c.dns.InZone(current) {
+		if err := c.deleteRecord(ctx, service, current); err != nil {
+			return "", err
+		}
+	}
+
+	if hostname == "" {
+		return "", nil
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", fmt.Errorf("invalid ip %s for dns record %s", ip, hostname)
+	}
+	err := c.dns.Set(ctx, hostname, owner, addr)
+	if errors.Is(err, dns.ErrNotOwner) {
+		c.recorder.Eventf(service, corev1.EventTypeWarning, EventReasonDNSHostnameTaken,
+			"hostname %s has records of another owner, no record is created", hostname)
+		return "", nil
+	}
+	if err != nil {
+		c.recorder.Event(service, corev1.EventTypeWarning, EventReasonDNSUpdateFailed, err.Error())
+		return "", err
+	}
+	klog.Infof("dns record %s points at %s of service %s/%s", hostname, ip, service.Namespace, service.Name)
+	return hostname, nil
+}
+
+// deleteRecord removes the record of hostname, a hostname of another owner is left alone
+func (c *LoadBalanceController) deleteRecord(ctx context.Context, service *corev1.Service, hostname string) error {
+	err := c.dns.Delete(ctx, hostname, c.dnsOwner(service))
+	if errors.Is(err, dns.ErrNotOwner) {
+		klog.Warningf("dns record %s of service %s/%s has another owner, not removed", hostname, service.Namespace, service.Name)
+		return nil
+	}
+	if err != nil {
+		c.recorder.Event(service, corev1.EventTypeWarning, EventReasonDNSUpdateFailed, err.Error())
+		return err
+	}
+	klog.Infof("dns record %s of service %s/%s removed", hostname, service.Namespace, service.Name)
+	return nil
+}
+
+// finalizeRecord removes the record of a service that is deleted or no longer
+// of type LoadBalancer, then its finalizer. Without dns the record is left.
+func (c *LoadBalanceController) finalizeRecord(ctx context.Context, service *corev1.Service) error {
+	if !hasFinalizer(service) {
+		return nil
+	}
+	if hostname := ingressHostname(service); hostname != "" {
+		if c.dns == nil || !c.dns.InZone(hostname) {
+			klog.Warningf("dns record %s of service %s/%s is not removed, dns is disabled or the zone changed",
+				hostname, service.Namespace, service.Name)
+		} else if err := c.deleteRecord(ctx, service, hostname); err != nil {
+			return err
+		}
+	}
+
+	service = service.DeepCopy()
+	finalizers := service.Finalizers[:0]
+	for _, finalizer := range service.Finalizers {
+		if finalizer != FinalizerDNSRecord {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	service.Finalizers = finalizers
+	_, err := c.kubeClient.CoreV1().Services(service.Namespace).Update(ctx, service, metav1.UpdateOptions{})
+	return err
+}
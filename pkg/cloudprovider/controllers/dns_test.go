@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"context"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/cloudprovider/dns"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/cloudprovider/dns/dnstest"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"golang.org/x/net/dns/dnsmessage"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testOwner = "heritage=loadbalance-controller,cluster=c1,service=ns/web"
+
+func newTestService(hostname string, finalizers ...string) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", Finalizers: finalizers},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+	}
+	if hostname != "" {
+		service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1", Hostname: hostname}}
+	}
+	return service
+}
+
+// newTestController returns a controller with the service in a fake cluster and
+// a dns client of an in-process server, without dns when server is nil
+func newTestController(t *testing.T, server *dnstest.Server, service *corev1.Service) (*LoadBalanceController, *record.FakeRecorder) {
+	t.Helper()
+
+	recorder := record.NewFakeRecorder(10)
+	c := &LoadBalanceController{
+		LoadBalanceConfig: &config.LoadBalanceConfig{Region: "c1"},
+		kubeClient:        fake.NewSimpleClientset(service),
+		serviceQueue:      workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		recorder:          recorder,
+	}
+	t.Cleanup(c.serviceQueue.ShutDown)
+	if server != nil {
+		c.LoadBalanceConfig.DNS = config.LoadBalanceDNSConfig{Enabled: true, Server: server.Addr, Zone: "lb.example.com", TTL: time.Minute, Timeout: time.Second}
+		var err error
+		if c.dns, err = dns.NewClient(c.LoadBalanceConfig.DNS); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c, recorder
+}
+
+func newTestServer(t *testing.T, records ...dnstest.Record) *dnstest.Server {
+	t.Helper()
+
+	server, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+	})
+	for _, r := range records {
+		server.Add(r)
+	}
+	return server
+}
+
+// sameRecords compares the zone with the expected records, nil matches an empty zone
+func sameRecords(got, expected []dnstest.Record) bool {
+	return len(got) == 0 && len(expected) == 0 || reflect.DeepEqual(got, expected)
+}
+
+func events(recorder *record.FakeRecorder) []string {
+	var result []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			result = append(result, event)
+		default:
+			return result
+		}
+	}
+}
+
+func TestSyncRecord(t *testing.T) {
+	owned := []dnstest.Record{
+		{Name: "old.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.1"},
+		{Name: "old.lb.example.com.", Type: dnsmessage.TypeTXT, Data: testOwner},
+	}
+	other := []dnstest.Record{
+		{Name: "old.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.9"},
+		{Name: "old.lb.example.com.", Type: dnsmessage.TypeTXT, Data: "service=ns/other"},
+	}
+	created := []dnstest.Record{
+		{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.2"},
+		{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: testOwner},
+	}
+
+	tests := []struct {
+		name     string
+		records  []dnstest.Record
+		current  string
+		hostname string
+		result   string
+		event    string
+		expect   []dnstest.Record
+	}{
+		{name: "claim a free hostname", hostname: "web.lb.example.com", result: "web.lb.example.com", expect: created},
+		{name: "move the record", records: owned, current: "old.lb.example.com", hostname: "web.lb.example.com", result: "web.lb.example.com", expect: created},
+		{name: "old hostname of another owner is left", records: other, current: "old.lb.example.com", hostname: "web.lb.example.com", result: "web.lb.example.com", expect: append(append([]dnstest.Record{}, other...), created...)},
+		{name: "annotation removed", records: owned, current: "old.lb.example.com"},
+		{name: "hostname taken", records: other, hostname: "old.lb.example.com", event: EventReasonDNSHostnameTaken, expect: other},
+		{name: "hostname without owner record", records: other[:1], hostname: "old.lb.example.com", event: EventReasonDNSHostnameTaken, expect: other[:1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.records...)
+			service := newTestService(tt.current)
+			c, recorder := newTestController(t, server, service)
+
+			result, err := c.syncRecord(context.Background(), service, "10.0.0.2", tt.hostname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.result {
+				t.Errorf("hostname = %q, expected %q", result, tt.result)
+			}
+			if got := server.Records(); !sameRecords(got, tt.expect) {
+				t.Errorf("records = %v, expected %v", got, tt.expect)
+			}
+			got := events(recorder)
+			if tt.event == "" && len(got) != 0 || tt.event != "" && (len(got) != 1 || !strings.Contains(got[0], tt.event)) {
+				t.Errorf("events = %v, expected %q", got, tt.event)
+			}
+		})
+	}
+}
+
+func TestAddFinalizer(t *testing.T) {
+	for _, service := range []*corev1.Service{newTestService(""), newTestService("", "other", FinalizerDNSRecord)} {
+		c, _ := newTestController(t, nil, service)
+
+		updated, err := c.addFinalizer(context.Background(), service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := c.kubeClient.CoreV1().Services("ns").Get(context.Background(), "web", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasFinalizer(updated) || !reflect.DeepEqual(stored.Finalizers, updated.Finalizers) {
+			t.Errorf("finalizers = %v stored %v, expected %s once", updated.Finalizers, stored.Finalizers, FinalizerDNSRecord)
+		}
+	}
+}
+
+func TestFinalizeRecord(t *testing.T) {
+	owned := []dnstest.Record{
+		{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.1"},
+		{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: testOwner},
+	}
+	other := []dnstest.Record{
+		{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.9"},
+		{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: "service=ns/other"},
+	}
+
+	tests := []struct {
+		name       string
+		dns        bool
+		records    []dnstest.Record
+		hostname   string
+		finalizers []string
+		expect     []dnstest.Record
+		remaining  []string
+	}{
+		{name: "record removed", dns: true, records: owned, hostname: "web.lb.example.com", finalizers: []string{"other", FinalizerDNSRecord}, remaining: []string{"other"}},
+		{name: "record of another owner is left", dns: true, records: other, hostname: "web.lb.example.com", finalizers: []string{FinalizerDNSRecord}, expect: other},
+		{name: "hostname outside the zone", dns: true, records: owned, hostname: "web.example.org", finalizers: []string{FinalizerDNSRecord}, expect: owned},
+		{name: "dns disabled", records: owned, hostname: "web.lb.example.com", finalizers: []string{FinalizerDNSRecord}, expect: owned},
+		{name: "without finalizer", dns: true, records: owned, hostname: "web.lb.example.com", finalizers: []string{"other"}, expect: owned, remaining: []string{"other"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.records...)
+			service := newTestService(tt.hostname, tt.finalizers...)
+			c, _ := newTestController(t, server, service)
+			if !tt.dns {
+				c.dns = nil
+			}
+
+			if err := c.finalizeRecord(context.Background(), service); err != nil {
+				t.Fatal(err)
+			}
+			if got := server.Records(); !sameRecords(got, tt.expect) {
+				t.Errorf("records = %v, expected %v", got, tt.expect)
+			}
+			stored, err := c.kubeClient.CoreV1().Services("ns").Get(context.Background(), "web", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored.Finalizers) != len(tt.remaining) || len(tt.remaining) != 0 && !reflect.DeepEqual(stored.Finalizers, tt.remaining) {
+				t.Errorf("finalizers = %v, expected %v", stored.Finalizers, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestAddService(t *testing.T) {
+	clusterIP := func(finalizers ...string) *corev1.Service {
+		service := newTestService("", finalizers...)
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+		return service
+	}
+
+	tests := []struct {
+		name    string
+		service *corev1.Service
+		queued  bool
+	}{
+		{name: "load balancer", service: newTestService(""), queued: true},
+		{name: "cluster ip", service: clusterIP()},
+		{name: "cluster ip with a record to remove", service: clusterIP(FinalizerDNSRecord), queued: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestController(t, nil, tt.service)
+			c.addService(tt.service)
+			if queued := c.serviceQueue.Len() == 1; queued != tt.queued {
+				t.Errorf("queued = %v, expected %v", queued, tt.queued)
+			}
+		})
+	}
+}
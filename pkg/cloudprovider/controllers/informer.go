@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/cloudprovider/sdk"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sync/atomic"
+)
+
+const ingressIPIndex = "ingressIP"
+
+func ingressIPIndexFunc(obj interface{}) ([]string, error) {
+	service, ok := obj.(*corev1.Service)
+	if !ok {
+		return nil, nil
+	}
+
+	var ips []string
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	return ips, nil
+}
+
+// loadBalanceChanged requeues the services holding an ip that was released or
+// bound to another owner behind the back of this controller
+func (c *LoadBalanceController) loadBalanceChanged(event sdk.WatchEvent, old *sdk.LoadBalance) {
+	lb := event.Object
+	owner := lb.Namespace + "/" + lb.ServiceName
+
+	objs, err := c.serviceIndexer.ByIndex(ingressIPIndex, lb.Ip)
+	if err != nil {
+		klog.Errorf("lookup services of ip %s error: %s", lb.Ip, err.Error())
+	}
+	for _, obj := range objs {
+		service := obj.(*corev1.Service)
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+
+		key, err := cache.MetaNamespaceKeyFunc(service)
+		if err != nil {
+			continue
+		}
+		if event.Type != sdk.WatchDeleted && lb.Status == sdk.StatusBound && owner == key {
+			continue
+		}
+
+		klog.Infof("ip %s of service %s is %s by the cloud provider (owner %q), resyncing", lb.Ip, key, event.Type, owner)
+		c.serviceQueue.Add(key)
+	}
+
+	c.checkPool()
+}
+
+// checkPool records one event when the pool of the cluster runs dry and one when
+// it has free ips again, services still waiting for an ip are retried right away
+func (c *LoadBalanceController) checkPool() {
+	free := c.informer.FreeCount()
+
+	if free == 0 && atomic.CompareAndSwapInt32(&c.poolDrained, 0, 1) {
+		klog.Warningf("ip pool of cluster %s drained", c.LoadBalanceConfig.Region)
+		c.recorder.Eventf(c.clusterRef, corev1.EventTypeWarning, EventReasonPoolExhausted,
+			"no available ip left in cluster %s", c.LoadBalanceConfig.Region)
+		return
+	}
+
+	if free > 0 && atomic.CompareAndSwapInt32(&c.poolDrained, 1, 0) {
+		c.recorder.Eventf(c.clusterRef, corev1.EventTypeNormal, EventReasonPoolAvailable,
+			"%d ips available in cluster %s", free, c.LoadBalanceConfig.Region)
+		c.requeuePending()
+	}
+}
+
+// requeuePending adds every LoadBalancer service without an ip
+func (c *LoadBalanceController) requeuePending() {
+	services, err := c.servicesLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("list services error: %s", err.Error())
+		return
+	}
+
+	for _, service := range services {
+		if service.Spec.Type == corev1.ServiceTypeLoadBalancer && len(service.Status.LoadBalancer.Ingress) == 0 {
+			c.serviceQueue.Add(fmt.Sprintf("%s/%s", service.Namespace, service.Name))
+		}
+	}
+}
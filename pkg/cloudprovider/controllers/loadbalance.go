@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/cloudprovider/dns"
 	"github.com/YuZongYangHi/cloud-controller-manager/pkg/cloudprovider/sdk"
 	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
 	corev1 "k8s.io/api/core/v1"
@@ -13,8 +14,11 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	v1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	"time"
@@ -22,6 +26,37 @@ import (
 
 const (
 	defaultSyncPeriod = 30 * time.Second
+
+	componentName = "loadbalance-controller"
+
+	// circuitOpenRequeue is the minimum delay before a service paused by the open breaker is synced again
+	circuitOpenRequeue = 5 * time.Second
+)
+
+// AnnotationStickyIP "true" asks for the ip the service released last when it needs
+// a new one, so a deleted and recreated service keeps its address within the
+// retention of the manager
+const AnnotationStickyIP = "loadbalance.cloudprovider.io/sticky-ip"
+
+// AnnotationPool "reserved" only allocates ips reserved for the service or its
+// namespace, the service gets no ip while none is left
+const (
+	AnnotationPool = "loadbalance.cloudprovider.io/pool"
+	PoolReserved   = "reserved"
+)
+
+const (
+	EventReasonBound         = "LoadBalancerIPBound"
+	EventReasonIPConflict    = "LoadBalancerIPConflict"
+	EventReasonIPNotFound    = "LoadBalancerIPNotFound"
+	EventReasonPoolExhausted = "PoolExhausted"
+	EventReasonQuotaExceeded = "QuotaExceeded"
+	EventReasonUnauthorized  = "CloudProviderUnauthorized"
+	EventReasonSyncFailed    = "SyncLoadBalancerFailed"
+
+	EventReasonCloudProviderUnavailable = "CloudProviderUnavailable"
+	EventReasonCloudProviderRecovered   = "CloudProviderRecovered"
+	EventReasonPoolAvailable            = "PoolAvailable"
 )
 
 type LoadBalanceController struct {
@@ -35,26 +70,73 @@ type LoadBalanceController struct {
 	kubeInformerFactory informers.SharedInformerFactory
 
 	servicesLister v1.ServiceLister
+	serviceIndexer cache.Indexer
 	serviceSynced  cache.InformerSynced
 	serviceQueue   workqueue.RateLimitingInterface
+
+	recorder record.EventRecorder
+
+	// clusterRef is the object cluster level events are recorded on
+	clusterRef *corev1.ObjectReference
+
+	confirmed confirmedBindings
+
+	// informer watches the pool of the cluster, nil when the backend can not watch
+	informer    *sdk.LoadBalanceInformer
+	poolDrained int32
+
+	// dns keeps the records of annotated services, nil when dns is disabled
+	dns *dns.Client
 }
 
-func NewLoaBalanceController(kubeClient kubernetes.Interface, loadBalanceConfig *config.LoadBalanceConfig) (*LoadBalanceController, error) {
+func NewLoaBalanceController(ctx context.Context, kubeClient kubernetes.Interface, loadBalanceConfig *config.LoadBalanceConfig) (*LoadBalanceController, error) {
+	loadBalanceClient, err := sdk.NewLoadBalance(loadBalanceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartStructuredLogging(0)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+
 	sharedInformerFactory := informers.NewSharedInformerFactory(kubeClient, defaultSyncPeriod)
 	serviceInformer := sharedInformerFactory.Core().V1().Services()
 
 	c := &LoadBalanceController{
 		LoadBalanceConfig:   loadBalanceConfig,
-		LoadBalanceClient:   sdk.NewLoadBalance(loadBalanceConfig),
+		LoadBalanceClient:   loadBalanceClient,
 		kubeClient:          kubeClient,
 		kubeInformerFactory: sharedInformerFactory,
 		servicesLister:      serviceInformer.Lister(),
+		serviceIndexer:      serviceInformer.Informer().GetIndexer(),
 		serviceSynced:       serviceInformer.Informer().HasSynced,
 		serviceQueue:        workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		recorder:            eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: componentName}),
+		clusterRef: &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       metav1.NamespaceSystem,
+		},
+	}
+	c.LoadBalanceClient.Breaker().OnStateChange(c.breakerStateChanged)
+
+	if loadBalanceConfig.DNS.Enabled {
+		if c.dns, err = dns.NewClient(loadBalanceConfig.DNS); err != nil {
+			return nil, err
+		}
+	}
+
+	if loadBalanceClient.CanWatch() {
+		err = serviceInformer.Informer().AddIndexers(cache.Indexers{ingressIPIndex: ingressIPIndexFunc})
+		if err != nil {
+			return nil, err
+		}
+		c.informer = sdk.NewLoadBalanceInformer(loadBalanceClient)
+		c.informer.AddEventHandler(c.loadBalanceChanged)
 	}
 
 	// wait for cache by lb list
-	if !c.LoadBalanceClient.WaitForCacheSync() {
+	if !c.LoadBalanceClient.WaitForCacheSync(ctx) {
 		return nil, errors.New("full sync loadbalances ip list fail")
 	}
 
@@ -66,34 +148,45 @@ func NewLoaBalanceController(kubeClient kubernetes.Interface, loadBalanceConfig
 	return c, nil
 }
 
-func (c *LoadBalanceController) Run(workers int, stopCh chan struct{}) {
+// Run blocks until ctx is cancelled, in-flight cloud provider calls are cancelled with it
+func (c *LoadBalanceController) Run(ctx context.Context, workers int) {
 	defer runtime.HandleCrash()
 
 	// Let the workers stop when we are done
-	defer c.serviceQueue.ShuttingDown()
+	defer c.serviceQueue.ShutDown()
 
-	go c.kubeInformerFactory.Start(stopCh)
+	go c.kubeInformerFactory.Start(ctx.Done())
+	go c.LoadBalanceClient.RunCacheResync(ctx)
+	if c.informer != nil {
+		go c.informer.Run(ctx)
+	}
 
 	// Wait for all involved caches to be synced, before processing items from the queue is started
-	if !cache.WaitForCacheSync(stopCh, c.serviceSynced) {
+	if !cache.WaitForCacheSync(ctx.Done(), c.serviceSynced) {
 		runtime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
 		return
 	}
 
+	if err := c.reconcile(ctx); errors.Is(err, sdk.ErrBatchNotConfigured) {
+		klog.V(2).Info("batch endpoints not configured, syncing services one by one")
+	} else if err != nil {
+		klog.Errorf("reconcile loadbalances at startup fail, syncing services one by one: %s", err.Error())
+	}
+
 	for i := 0; i < workers; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
 	}
 
-	<-stopCh
+	<-ctx.Done()
 	klog.Info("Stopping loadbalance controller")
 }
 
-func (c *LoadBalanceController) runWorker() {
-	for c.processNextItem() {
+func (c *LoadBalanceController) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
 	}
 }
 
-func (c *LoadBalanceController) processNextItem() bool {
+func (c *LoadBalanceController) processNextItem(ctx context.Context) bool {
 	key, quit := c.serviceQueue.Get()
 	if quit {
 		return false
@@ -101,70 +194,188 @@ func (c *LoadBalanceController) processNextItem() bool {
 
 	defer c.serviceQueue.Done(key)
 
+	// pause while the cloud provider is down instead of failing every service one by one
+	if c.LoadBalanceClient.Breaker().State() == sdk.BreakerOpen {
+		c.requeuePaused(key)
+		return true
+	}
+
 	namespace, name, err := cache.SplitMetaNamespaceKey(key.(string))
 	if err != nil {
 		klog.Errorf("split service namespace error: %s", key)
-		return false
+		c.serviceQueue.Forget(key)
+		return true
 	}
 
-	if err = c.syncLoadBalance(namespace, name); err != nil {
-		klog.Errorf("sync loadbalance fail name: %s, namespace: %s, err: %s", name, namespace, err.Error())
-		return false
-	}
+	err = c.syncLoadBalance(ctx, namespace, name)
+	c.handleErr(err, key)
 	return true
 }
 
-func (c *LoadBalanceController) syncLoadBalance(namespace, name string) error {
+func (c *LoadBalanceController) handleErr(err error, key interface{}) {
+	if err == nil {
+		c.serviceQueue.Forget(key)
+		return
+	}
+
+	if errors.Is(err, sdk.ErrCircuitOpen) {
+		c.requeuePaused(key)
+		return
+	}
+
+	// the requested ip is not part of the pool, wait for the service to change
+	if errors.Is(err, sdk.ErrNotFound) {
+		klog.Errorf("sync loadbalance %s fail, not retrying: %s", key, err.Error())
+		c.serviceQueue.Forget(key)
+		return
+	}
+
+	klog.Errorf("sync loadbalance %s fail, requeue: %s", key, err.Error())
+	c.serviceQueue.AddRateLimited(key)
+}
+
+func (c *LoadBalanceController) requeuePaused(key interface{}) {
+	delay := c.LoadBalanceClient.Breaker().RetryAfter()
+	if delay < circuitOpenRequeue {
+		delay = circuitOpenRequeue
+	}
+	klog.V(4).Infof("cloud provider unavailable, sync loadbalance %s paused for %s", key, delay)
+	c.serviceQueue.AddAfter(key, delay)
+}
+
+// breakerStateChanged records one event per outage of the cloud provider instead of one per service
+func (c *LoadBalanceController) breakerStateChanged(from, to sdk.BreakerState) {
+	switch {
+	case from == sdk.BreakerClosed && to == sdk.BreakerOpen:
+		klog.Warningf("cloud provider of cluster %s unavailable, pausing allocation", c.LoadBalanceConfig.Region)
+		c.recorder.Eventf(c.clusterRef, corev1.EventTypeWarning, EventReasonCloudProviderUnavailable,
+			"cloud provider of cluster %s unavailable, loadbalance allocation paused", c.LoadBalanceConfig.Region)
+	case to == sdk.BreakerClosed:
+		klog.Infof("cloud provider of cluster %s recovered, resuming allocation", c.LoadBalanceConfig.Region)
+		c.recorder.Eventf(c.clusterRef, corev1.EventTypeNormal, EventReasonCloudProviderRecovered,
+			"cloud provider of cluster %s recovered, loadbalance allocation resumed", c.LoadBalanceConfig.Region)
+	}
+}
+
+// Ready fails while the circuit breaker to the cloud provider is not closed
+func (c *LoadBalanceController) Ready() error {
+	if state := c.LoadBalanceClient.Breaker().State(); state != sdk.BreakerClosed {
+		return fmt.Errorf("cloud provider circuit breaker %s", state)
+	}
+	return nil
+}
+
+func (c *LoadBalanceController) syncLoadBalance(ctx context.Context, namespace, name string) error {
 	service, err := c.servicesLister.Services(namespace).Get(name)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
-			return c.LoadBalanceClient.Unbind(name, namespace)
+			err = c.LoadBalanceClient.Unbind(ctx, name, namespace)
+			if errors.Is(err, sdk.ErrNotFound) {
+				return nil
+			}
+			return err
 		}
 		return err
 	}
 
-	var lb string
+	// the record goes before the service, so it never points at an ip someone else got
+	if service.DeletionTimestamp != nil || service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return c.finalizeRecord(ctx, service)
+	}
+
+	var current string
 
 	if len(service.Status.LoadBalancer.Ingress) > 0 {
-		lb = service.Status.LoadBalancer.Ingress[0].IP
+		current = service.Status.LoadBalancer.Ingress[0].IP
 	}
+	hostname := c.hostname(service)
 
-	if service.Spec.LoadBalancerIP != "" {
-		lb = service.Spec.LoadBalancerIP
+	// the startup reconcile already verified this binding
+	requested := service.Spec.LoadBalancerIP
+	if current != "" && (requested == "" || requested == current) && hostname == ingressHostname(service) &&
+		c.confirmed.take(namespace+"/"+name, current) {
+		return nil
 	}
 
-	bindRequest := sdk.LoadBalance{
-		Namespace:   namespace,
-		ServiceName: name,
+	lb, err := c.bind(ctx, service, requested, current)
+	if err != nil {
+		c.recordBindError(service, err)
+		return err
 	}
 
-	if lb == "" {
-		lb, err = c.LoadBalanceClient.GetAvailableIp()
-		if err != nil {
+	if current != lb || ingressHostname(service) != hostname {
+		if hostname != "" {
+			if service, err = c.addFinalizer(ctx, service); err != nil {
+				return err
+			}
+		}
+		if hostname, err = c.syncRecord(ctx, service, lb, hostname); err != nil {
 			return err
 		}
 	}
 
-	bindRequest.Ip = lb
-	if err = c.LoadBalanceClient.Bind(name, namespace, lb); err != nil {
-		return err
-	}
-
-	if len(service.Status.LoadBalancer.Ingress) == 0 || service.Status.LoadBalancer.Ingress[0].IP != lb {
-		service.Status.LoadBalancer = corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: lb}}}
-		_, err = c.kubeClient.CoreV1().Services(namespace).UpdateStatus(context.Background(), service, metav1.UpdateOptions{})
+	// the status is left as is when the hostname turned out to be taken
+	if current != lb || ingressHostname(service) != hostname {
+		service = service.DeepCopy()
+		service.Status.LoadBalancer = corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: lb, Hostname: hostname}}}
+		_, err = c.kubeClient.CoreV1().Services(namespace).UpdateStatus(ctx, service, metav1.UpdateOptions{})
 		if err != nil {
 			klog.Errorf("update service %s namespace: %s ip: %s error: %s", name, namespace, lb, err.Error())
 			return err
 		}
+		c.recorder.Eventf(service, corev1.EventTypeNormal, EventReasonBound, "ip %s bound", lb)
 		klog.Infof("ip: %s bound by service: %s, namespace: %s", lb, name, namespace)
 	}
 	return nil
 }
 
+// bind binds the requested ip, or keeps the current one, or allocates a new one from the pool
+func (c *LoadBalanceController) bind(ctx context.Context, service *corev1.Service, requested, current string) (string, error) {
+	if requested != "" {
+		return requested, c.LoadBalanceClient.Bind(ctx, service.Name, service.Namespace, requested)
+	}
+
+	if current != "" {
+		err := c.LoadBalanceClient.Bind(ctx, service.Name, service.Namespace, current)
+		if err == nil {
+			return current, nil
+		}
+		if !errors.Is(err, sdk.ErrConflict) && !errors.Is(err, sdk.ErrNotFound) {
+			return "", err
+		}
+		c.recorder.Eventf(service, corev1.EventTypeWarning, EventReasonIPConflict,
+			"ip %s is no longer available to this service, allocating a new one: %s", current, err.Error())
+	}
+
+	return c.LoadBalanceClient.Allocate(ctx, service.Name, service.Namespace, sdk.AllocateOptions{
+		Sticky:   service.Annotations[AnnotationStickyIP] == "true",
+		Reserved: service.Annotations[AnnotationPool] == PoolReserved,
+	})
+}
+
+func (c *LoadBalanceController) recordBindError(service *corev1.Service, err error) {
+	switch {
+	case errors.Is(err, sdk.ErrPoolExhausted):
+		c.recorder.Event(service, corev1.EventTypeWarning, EventReasonPoolExhausted, err.Error())
+	case errors.Is(err, sdk.ErrQuotaExceeded):
+		c.recorder.Event(service, corev1.EventTypeWarning, EventReasonQuotaExceeded, err.Error())
+	case errors.Is(err, sdk.ErrConflict):
+		c.recorder.Event(service, corev1.EventTypeWarning, EventReasonIPConflict, err.Error())
+	case errors.Is(err, sdk.ErrNotFound):
+		c.recorder.Event(service, corev1.EventTypeWarning, EventReasonIPNotFound, err.Error())
+	case errors.Is(err, sdk.ErrUnauthorized):
+		c.recorder.Event(service, corev1.EventTypeWarning, EventReasonUnauthorized, err.Error())
+	case sdk.IsRetryable(err), errors.Is(err, sdk.ErrCircuitOpen), errors.Is(err, context.Canceled):
+		// retried with backoff, an event per attempt would only be noise
+	default:
+		c.recorder.Event(service, corev1.EventTypeWarning, EventReasonSyncFailed, err.Error())
+	}
+}
+
 func (c *LoadBalanceController) addService(obj interface{}) {
 	service := obj.(*corev1.Service)
-	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+	// a service that changed its type still needs its record removed
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer && !hasFinalizer(service) {
 		return
 	}
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
@@ -194,11 +405,11 @@ func (c *LoadBalanceController) deleteService(obj interface{}) {
 		return
 	}
 
-	_, ok = tombstone.Obj.(*corev1.Service)
+	service, ok := tombstone.Obj.(*corev1.Service)
 	if !ok {
 		klog.Errorf("Tombstone contained object that is not a Service: %#v", obj)
 		return
 	}
-	c.addService(obj)
+	c.addService(service)
 	return
 }
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/cloudprovider/sdk"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sync"
+)
+
+// confirmedBindings holds the bindings the startup reconcile verified against the
+// cloud provider, the first sync of such a service skips its own bind call
+type confirmedBindings struct {
+	mu    sync.Mutex
+	byKey map[string]string
+}
+
+func (b *confirmedBindings) set(key, ip string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.byKey == nil {
+		b.byKey = map[string]string{}
+	}
+	b.byKey[key] = ip
+}
+
+// take reports whether ip was confirmed for key, a confirmation is only used once
+func (b *confirmedBindings) take(key, ip string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	confirmed, ok := b.byKey[key]
+	delete(b.byKey, key)
+	return ok && confirmed == ip
+}
+
+// reconcile compares every LoadBalancer service with the bindings of the cluster
+// in a few batch calls: services whose ip is already bound to them are confirmed,
+// services holding an ip the cloud provider does not know about are bound again
+// and bindings of deleted services are released. Anything left over is handled
+// by the workers service by service.
+func (c *LoadBalanceController) reconcile(ctx context.Context) error {
+	bindings, err := c.LoadBalanceClient.Bindings(ctx)
+	if err != nil {
+		return err
+	}
+
+	bound := make(map[string]string, len(bindings))
+	for _, binding := range bindings {
+		bound[binding.Namespace+"/"+binding.ServiceName] = binding.Ip
+	}
+
+	services, err := c.servicesLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	var rebind []sdk.BatchItem
+	exists := make(map[string]bool, len(services))
+	for _, service := range services {
+		key, err := cache.MetaNamespaceKeyFunc(service)
+		if err != nil {
+			continue
+		}
+		exists[key] = true
+
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer || len(service.Status.LoadBalancer.Ingress) == 0 {
+			continue
+		}
+		current := service.Status.LoadBalancer.Ingress[0].IP
+		if current == "" || (service.Spec.LoadBalancerIP != "" && service.Spec.LoadBalancerIP != current) {
+			continue
+		}
+
+		switch ip, ok := bound[key]; {
+		case ok && ip == current:
+			c.confirmed.set(key, current)
+		case !ok:
+			rebind = append(rebind, sdk.BatchItem{Ip: current, Namespace: service.Namespace, ServiceName: service.Name})
+		}
+	}
+
+	var release []sdk.BatchItem
+	for _, binding := range bindings {
+		if !exists[binding.Namespace+"/"+binding.ServiceName] {
+			release = append(release, sdk.BatchItem{Namespace: binding.Namespace, ServiceName: binding.ServiceName})
+		}
+	}
+
+	if len(rebind) > 0 {
+		results, err := c.LoadBalanceClient.BindBatch(ctx, rebind)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if result.Err() == nil {
+				c.confirmed.set(result.Namespace+"/"+result.ServiceName, result.Ip)
+			}
+		}
+	}
+
+	if len(release) > 0 {
+		results, err := c.LoadBalanceClient.UnbindBatch(ctx, release)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if err := result.Err(); err != nil && !errors.Is(err, sdk.ErrNotFound) {
+				klog.Errorf("release ip of deleted service %s/%s error: %s", result.Namespace, result.ServiceName, err.Error())
+			}
+		}
+	}
+
+	klog.Infof("reconciled %d services against %d bindings: %d rebound, %d released",
+		len(services), len(bindings), len(rebind), len(release))
+	return nil
+}
@@ -0,0 +1,373 @@
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPort    = "53"
+	defaultTTL     = 5 * time.Minute
+	defaultTimeout = 5 * time.Second
+
+	// opCodeUpdate is the opcode of RFC 2136
+	opCodeUpdate = dnsmessage.OpCode(5)
+
+	// maxUDPSize is the message size every server accepts over udp
+	maxUDPSize = 512
+
+	// classNONE deletes a single record from an rrset, or asks for a name not in use
+	classNONE = dnsmessage.Class(254)
+)
+
+// the rcodes of RFC 2136 a failed prerequisite answers
+const (
+	rcodeYXDomain = dnsmessage.RCode(6)
+	rcodeNXRRSet  = dnsmessage.RCode(8)
+)
+
+var (
+	ErrNotInZone = errors.New("hostname is not in the zone")
+	ErrNotOwner  = errors.New("hostname has records of another owner")
+)
+
+// RCodeError is a dynamic update the server refused
+type RCodeError struct {
+	Name  string
+	RCode dnsmessage.RCode
+}
+
+func (e *RCodeError) Error() string {
+	return fmt.Sprintf("dns update of %s refused: %s", e.Name, rcodeName(e.RCode))
+}
+
+// the rcodes of RFC 2136 next to the ones dnsmessage knows
+func rcodeName(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case rcodeYXDomain:
+		return "YXDomain"
+	case 7:
+		return "YXRRSet"
+	case rcodeNXRRSet:
+		return "NXRRSet"
+	case 9:
+		return "NotAuth"
+	case 10:
+		return "NotZone"
+	}
+	return strings.TrimPrefix(rcode.String(), "RCode")
+}
+
+// Client sends RFC 2136 dynamic updates to the primary server of a zone. Every
+// hostname owns its A and AAAA records: setting one replaces both. A TXT record
+// of the hostname names its owner, the server checks it as a prerequisite of
+// every update so an owner never changes the records of another. It must be the
+// only TXT record of the hostname.
+type Client struct {
+	server  string
+	network string
+	zone    dnsmessage.Name
+	ttl     uint32
+	timeout time.Duration
+	// key is nil when the updates are not signed
+	key *tsigKey
+}
+
+func NewClient(cfg config.LoadBalanceDNSConfig) (*Client, error) {
+	if cfg.Server == "" || cfg.Zone == "" {
+		return nil, errors.New("dns needs server and zone")
+	}
+
+	c := &Client{
+		server:  cfg.Server,
+		network: cfg.Network,
+		ttl:     uint32(cfg.TTL / time.Second),
+		timeout: cfg.Timeout,
+	}
+	if _, _, err := net.SplitHostPort(c.server); err != nil {
+		c.server = net.JoinHostPort(c.server, defaultPort)
+	}
+	switch c.network {
+	case "":
+		c.network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("dns network must be udp or tcp, got %s", cfg.Network)
+	}
+	if cfg.TTL <= 0 {
+		c.ttl = uint32(defaultTTL / time.Second)
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+
+	var err error
+	if c.zone, err = newName(cfg.Zone); err != nil {
+		return nil, err
+	}
+	if cfg.TSIG.KeyName != "" {
+		if c.key, err = newTSIGKey(cfg.TSIG); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// InZone reports whether hostname belongs to the zone of the client
+func (c *Client) InZone(hostname string) bool {
+	name := strings.ToLower(fqdn(hostname))
+	zone := strings.ToLower(c.zone.String())
+	return name != zone && strings.HasSuffix(name, "."+zone)
+}
+
+// Set points hostname at ip for owner, any other A or AAAA record of hostname is
+// removed. A hostname without any record is claimed for owner, one with records
+// of another owner, or without an owner record, fails with ErrNotOwner.
+func (c *Client) Set(ctx context.Context, hostname, owner string, ip net.IP) error {
+	err := c.update(ctx, hostname, owner, true, ip)
+	if !isRCode(err, rcodeNXRRSet) {
+		return err
+	}
+	err = c.update(ctx, hostname, owner, false, ip)
+	if isRCode(err, rcodeYXDomain) {
+		return fmt.Errorf("%s: %w", hostname, ErrNotOwner)
+	}
+	return err
+}
+
+// Delete removes the A, AAAA and owner records of hostname when owner holds it,
+// a hostname without any record is no error and one of another owner fails
+// with ErrNotOwner
+func (c *Client) Delete(ctx context.Context, hostname, owner string) error {
+	err := c.update(ctx, hostname, owner, true, nil)
+	if !isRCode(err, rcodeNXRRSet) {
+		return err
+	}
+	// an update of nothing that only checks the name is not in use
+	err = c.send(ctx, hostname, func(b *dnsmessage.Builder, name dnsmessage.Name) error {
+		return prerequisites(b, name, "", false)
+	})
+	if isRCode(err, rcodeYXDomain) {
+		return fmt.Errorf("%s: %w", hostname, ErrNotOwner)
+	}
+	return err
+}
+
+// update requires owner to hold hostname, or hostname to have no record when
+// owned is false. It deletes both rrsets of hostname, then points it at ip and
+// records owner, or deletes the owner record when ip is nil.
+func (c *Client) update(ctx context.Context, hostname, owner string, owned bool, ip net.IP) error {
+	return c.send(ctx, hostname, func(b *dnsmessage.Builder, name dnsmessage.Name) error {
+		if err := prerequisites(b, name, owner, owned); err != nil {
+			return err
+		}
+		return c.updates(b, name, owner, ip)
+	})
+}
+
+func (c *Client) send(ctx context.Context, hostname string, build func(b *dnsmessage.Builder, name dnsmessage.Name) error) error {
+	if !c.InZone(hostname) {
+		return fmt.Errorf("%s: %w %s", hostname, ErrNotInZone, c.zone.String())
+	}
+	name, err := newName(hostname)
+	if err != nil {
+		return err
+	}
+
+	id, err := newId()
+	if err != nil {
+		return err
+	}
+	msg, err := c.pack(id, name, build)
+	if err != nil {
+		return err
+	}
+	var mac []byte
+	if c.key != nil {
+		msg, mac = c.key.sign(msg, id, time.Now())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.exchange(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("dns update of %s: %w", hostname, err)
+	}
+	var p dnsmessage.Parser
+	header, err := p.Start(resp)
+	if err != nil {
+		return fmt.Errorf("dns update of %s: %w", hostname, err)
+	}
+	if header.ID != id {
+		return fmt.Errorf("dns update of %s: response id %d does not match %d", hostname, header.ID, id)
+	}
+	if c.key != nil {
+		// only a refusal of the signature may come unsigned
+		var tsigErr *TSIGError
+		err = c.key.verify(resp, mac, time.Now())
+		if errors.As(err, &tsigErr) && header.RCode != dnsmessage.RCodeSuccess {
+			return fmt.Errorf("%w, %v", &RCodeError{Name: hostname, RCode: header.RCode}, err)
+		}
+		if err != nil {
+			return fmt.Errorf("dns update of %s: %w", hostname, err)
+		}
+	}
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return &RCodeError{Name: hostname, RCode: header.RCode}
+	}
+	return nil
+}
+
+func isRCode(err error, rcode dnsmessage.RCode) bool {
+	var rcodeErr *RCodeError
+	return errors.As(err, &rcodeErr) && rcodeErr.RCode == rcode
+}
+
+// pack builds the update, the zone section names the zone and build adds the
+// prerequisites and the updates
+func (c *Client) pack(id uint16, name dnsmessage.Name, build func(b *dnsmessage.Builder, name dnsmessage.Name) error) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, maxUDPSize), dnsmessage.Header{ID: id, OpCode: opCodeUpdate})
+
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: c.zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	if err := build(&b, name); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// prerequisites asks for the owner record of name when owned, or for name
+// without any record otherwise
+func prerequisites(b *dnsmessage.Builder, name dnsmessage.Name, owner string, owned bool) error {
+	if err := b.StartAnswers(); err != nil {
+		return err
+	}
+	if owned {
+		return b.TXTResource(dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET}, dnsmessage.TXTResource{TXT: []string{owner}})
+	}
+	return b.UnknownResource(dnsmessage.ResourceHeader{Name: name, Class: classNONE}, dnsmessage.UnknownResource{Type: dnsmessage.TypeALL})
+}
+
+// updates deletes both rrsets of name, then adds ip and the owner record, or
+// deletes the owner record when ip is nil
+func (c *Client) updates(b *dnsmessage.Builder, name dnsmessage.Name, owner string, ip net.IP) error {
+	if err := b.StartAuthorities(); err != nil {
+		return err
+	}
+	for _, t := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		// class ANY without data deletes the whole rrset
+		h := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassANY}
+		if err := b.UnknownResource(h, dnsmessage.UnknownResource{Type: t}); err != nil {
+			return err
+		}
+	}
+
+	txt := dnsmessage.TXTResource{TXT: []string{owner}}
+	if ip == nil {
+		// class NONE deletes the record with this data only
+		return b.TXTResource(dnsmessage.ResourceHeader{Name: name, Class: classNONE}, txt)
+	}
+
+	h := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: c.ttl}
+	if err := b.TXTResource(h, txt); err != nil {
+		return err
+	}
+	if v4 := ip.To4(); v4 != nil {
+		r := dnsmessage.AResource{}
+		copy(r.A[:], v4)
+		return b.AResource(h, r)
+	}
+	r := dnsmessage.AAAAResource{}
+	copy(r.AAAA[:], ip.To16())
+	return b.AAAAResource(h, r)
+}
+
+// exchange sends msg and returns the response
+func (c *Client) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if c.network == "tcp" {
+		return exchangeTCP(conn, msg)
+	}
+	return exchangeUDP(conn, msg)
+}
+
+func exchangeUDP(conn net.Conn, msg []byte) ([]byte, error) {
+	if len(msg) > maxUDPSize {
+		return nil, fmt.Errorf("update of %d bytes is too large for udp, use tcp", len(msg))
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// exchangeTCP prefixes every message with its length
+func exchangeTCP(conn net.Conn, msg []byte) ([]byte, error) {
+	out := make([]byte, 2, len(msg)+2)
+	binary.BigEndian.PutUint16(out, uint16(len(msg)))
+	if _, err := conn.Write(append(out, msg...)); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func newId() (uint16, error) {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b[:]), nil
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func newName(name string) (dnsmessage.Name, error) {
+	n, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return n, fmt.Errorf("invalid dns name %s: %w", name, err)
+	}
+	return n, nil
+}
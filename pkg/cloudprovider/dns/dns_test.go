@@ -0,0 +1,497 @@
+package dns
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/cloudprovider/dns/dnstest"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"golang.org/x/net/dns/dnsmessage"
+	"hash"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) *dnstest.Server {
+	t.Helper()
+
+	server, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+	})
+	return server
+}
+
+func newTestClient(t *testing.T, server *dnstest.Server, tsig config.DNSTSIGConfig) *Client {
+	t.Helper()
+
+	c, err := NewClient(config.LoadBalanceDNSConfig{Server: server.Addr, Zone: "lb.example.com", TTL: time.Minute, Timeout: time.Second, TSIG: tsig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.LoadBalanceDNSConfig
+		server  string
+		network string
+		ttl     uint32
+		err     string
+	}{
+		{name: "defaults", cfg: config.LoadBalanceDNSConfig{Server: "10.0.0.53", Zone: "lb.example.com"}, server: "10.0.0.53:53", network: "udp", ttl: 300},
+		{name: "port and tcp", cfg: config.LoadBalanceDNSConfig{Server: "10.0.0.53:5353", Zone: "lb.example.com", Network: "tcp", TTL: time.Minute}, server: "10.0.0.53:5353", network: "tcp", ttl: 60},
+		{name: "missing zone", cfg: config.LoadBalanceDNSConfig{Server: "10.0.0.53"}, err: "needs server and zone"},
+		{name: "unknown network", cfg: config.LoadBalanceDNSConfig{Server: "10.0.0.53", Zone: "lb.example.com", Network: "quic"}, err: "must be udp or tcp"},
+		{
+			name: "unknown tsig algorithm",
+			cfg:  config.LoadBalanceDNSConfig{Server: "10.0.0.53", Zone: "lb.example.com", TSIG: config.DNSTSIGConfig{KeyName: "k", Algorithm: "hmac-md5", Secret: "c2VjcmV0"}},
+			err:  "unsupported tsig algorithm",
+		},
+		{
+			name: "tsig secret not base64",
+			cfg:  config.LoadBalanceDNSConfig{Server: "10.0.0.53", Zone: "lb.example.com", TSIG: config.DNSTSIGConfig{KeyName: "k", Secret: "not base64!"}},
+			err:  "not base64",
+		},
+		{
+			name: "tsig without secret",
+			cfg:  config.LoadBalanceDNSConfig{Server: "10.0.0.53", Zone: "lb.example.com", TSIG: config.DNSTSIGConfig{KeyName: "k"}},
+			err:  "needs secret or secretFile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(tt.cfg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.server != tt.server || c.network != tt.network || c.ttl != tt.ttl {
+				t.Errorf("server %s network %s ttl %d, expected %s %s %d", c.server, c.network, c.ttl, tt.server, tt.network, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestInZone(t *testing.T) {
+	c, err := NewClient(config.LoadBalanceDNSConfig{Server: "10.0.0.53", Zone: "lb.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hostname string
+		inZone   bool
+	}{
+		{hostname: "web.lb.example.com", inZone: true},
+		{hostname: "Web.LB.example.com.", inZone: true},
+		{hostname: "a.b.lb.example.com", inZone: true},
+		{hostname: "lb.example.com"},
+		{hostname: "weblb.example.com"},
+		{hostname: "web.example.com"},
+	}
+	for _, tt := range tests {
+		if inZone := c.InZone(tt.hostname); inZone != tt.inZone {
+			t.Errorf("InZone(%s) = %v, expected %v", tt.hostname, inZone, tt.inZone)
+		}
+	}
+}
+
+func TestSetAndDelete(t *testing.T) {
+	const (
+		owner = "service=ns/web"
+		other = "service=ns/other"
+	)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		records []dnstest.Record
+		action  func(c *Client) error
+		err     error
+		expect  []dnstest.Record
+	}{
+		{
+			name:   "claim a free hostname",
+			action: func(c *Client) error { return c.Set(ctx, "web.lb.example.com", owner, net.ParseIP("10.0.0.1")) },
+			expect: []dnstest.Record{
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.1"},
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: owner},
+			},
+		},
+		{
+			name: "replace the records of the owner",
+			records: []dnstest.Record{
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.1"},
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: owner},
+			},
+			action: func(c *Client) error { return c.Set(ctx, "web.lb.example.com", owner, net.ParseIP("fd00::1")) },
+			expect: []dnstest.Record{
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeAAAA, Data: "fd00::1"},
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: owner},
+			},
+		},
+		{
+			name: "hostname of another owner",
+			records: []dnstest.Record{
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.9"},
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: other},
+			},
+			action: func(c *Client) error { return c.Set(ctx, "web.lb.example.com", owner, net.ParseIP("10.0.0.1")) },
+			err:    ErrNotOwner,
+			expect: []dnstest.Record{
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.9"},
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: other},
+			},
+		},
+		{
+			name:    "hostname without an owner record",
+			records: []dnstest.Record{{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.9"}},
+			action:  func(c *Client) error { return c.Set(ctx, "web.lb.example.com", owner, net.ParseIP("10.0.0.1")) },
+			err:     ErrNotOwner,
+			expect:  []dnstest.Record{{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.9"}},
+		},
+		{
+			name: "delete the records of the owner",
+			records: []dnstest.Record{
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.1"},
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: owner},
+				{Name: "db.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.2"},
+			},
+			action: func(c *Client) error { return c.Delete(ctx, "web.lb.example.com", owner) },
+			expect: []dnstest.Record{{Name: "db.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.2"}},
+		},
+		{
+			name:   "delete a hostname without records",
+			action: func(c *Client) error { return c.Delete(ctx, "web.lb.example.com", owner) },
+		},
+		{
+			name: "delete the hostname of another owner",
+			records: []dnstest.Record{
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.9"},
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: other},
+			},
+			action: func(c *Client) error { return c.Delete(ctx, "web.lb.example.com", owner) },
+			err:    ErrNotOwner,
+			expect: []dnstest.Record{
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeA, Data: "10.0.0.9"},
+				{Name: "web.lb.example.com.", Type: dnsmessage.TypeTXT, Data: other},
+			},
+		},
+		{
+			name:   "hostname outside the zone",
+			action: func(c *Client) error { return c.Set(ctx, "web.example.com", owner, net.ParseIP("10.0.0.1")) },
+			err:    ErrNotInZone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			for _, r := range tt.records {
+				server.Add(r)
+			}
+			c := newTestClient(t, server, config.DNSTSIGConfig{})
+
+			if err := tt.action(c); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if err := server.Err(); err != nil {
+				t.Fatalf("server: %v", err)
+			}
+			// the expected records are in the order of the zone
+			if got := server.Records(); len(got)+len(tt.expect) > 0 && !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("zone = %v, expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+// TestUpdateMessage checks the sections of the update that claims a hostname
+func TestUpdateMessage(t *testing.T) {
+	server := newTestServer(t)
+	c := newTestClient(t, server, config.DNSTSIGConfig{})
+	if err := c.Set(context.Background(), "web.lb.example.com", "service=ns/web", net.ParseIP("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the owner prerequisite fails first, then the hostname is claimed
+	updates := server.Updates()
+	if len(updates) != 2 {
+		t.Fatalf("%d updates sent, expected 2", len(updates))
+	}
+	expected := [][]string{
+		{"lb.example.com. SOA INET", "prerequisite web.lb.example.com. TXT INET service=ns/web", "update web.lb.example.com. A ANY", "update web.lb.example.com. AAAA ANY", "update web.lb.example.com. TXT INET service=ns/web", "update web.lb.example.com. A INET 10.0.0.1"},
+		{"lb.example.com. SOA INET", "prerequisite web.lb.example.com. ALL 254", "update web.lb.example.com. A ANY", "update web.lb.example.com. AAAA ANY", "update web.lb.example.com. TXT INET service=ns/web", "update web.lb.example.com. A INET 10.0.0.1"},
+	}
+	for i, msg := range updates {
+		var p dnsmessage.Parser
+		header, err := p.Start(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.OpCode != opCodeUpdate || header.Response {
+			t.Errorf("update %d: opcode %d response %v, expected an update request", i, header.OpCode, header.Response)
+		}
+		if got := describe(t, &p); !reflect.DeepEqual(got, expected[i]) {
+			t.Errorf("update %d = %q, expected %q", i, got, expected[i])
+		}
+	}
+}
+
+// describe lists the zone, prerequisite and update sections of a message
+func describe(t *testing.T, p *dnsmessage.Parser) []string {
+	t.Helper()
+
+	name := func(v interface{ String() string }, prefix string) string {
+		return strings.TrimPrefix(v.String(), prefix)
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, q := range questions {
+		result = append(result, strings.Join([]string{q.Name.String(), name(q.Type, "Type"), name(q.Class, "Class")}, " "))
+	}
+	for _, section := range []struct {
+		label string
+		next  func() (dnsmessage.ResourceHeader, error)
+	}{{"prerequisite", p.AnswerHeader}, {"update", p.AuthorityHeader}} {
+		for {
+			h, err := section.next()
+			if errors.Is(err, dnsmessage.ErrSectionDone) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := p.UnknownResource()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := []string{section.label, h.Name.String(), name(h.Type, "Type"), name(h.Class, "Class")}
+			switch {
+			case len(r.Data) == 0:
+			case h.Type == dnsmessage.TypeTXT:
+				fields = append(fields, string(r.Data[1:]))
+			default:
+				fields = append(fields, net.IP(r.Data).String())
+			}
+			result = append(result, strings.Join(fields, " "))
+		}
+	}
+	return result
+}
+
+func TestTSIG(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	encoded := base64.StdEncoding.EncodeToString(secret)
+
+	tests := []struct {
+		algorithm string
+		hash      func() hash.Hash
+		secret    string
+		err       bool
+	}{
+		{algorithm: "", hash: sha256.New, secret: encoded},
+		{algorithm: "hmac-sha1", hash: sha1.New, secret: encoded},
+		{algorithm: "HMAC-SHA512.", hash: sha512.New, secret: encoded},
+		{algorithm: "hmac-sha256", hash: sha256.New, secret: base64.StdEncoding.EncodeToString([]byte("another secret")), err: true},
+		{algorithm: "hmac-sha1", hash: sha256.New, secret: encoded, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			server := newTestServer(t)
+			server.RequireTSIG("loadbalance-controller", secret, tt.hash)
+			c := newTestClient(t, server, config.DNSTSIGConfig{KeyName: "loadbalance-controller", Algorithm: tt.algorithm, Secret: tt.secret})
+
+			err := c.Set(context.Background(), "web.lb.example.com", "service=ns/web", net.ParseIP("10.0.0.1"))
+			if !tt.err {
+				if err != nil {
+					t.Fatalf("set: %v (server: %v)", err, server.Err())
+				}
+				return
+			}
+			var rcodeErr *RCodeError
+			if !errors.As(err, &rcodeErr) || rcodeErr.RCode != dnstest.RCodeNotAuth {
+				t.Errorf("err = %v, expected NotAuth", err)
+			}
+		})
+	}
+}
+
+// TestTSIGSign checks the mac of a fixed message against one computed by hand
+func TestTSIGSign(t *testing.T) {
+	key, err := newTSIGKey(config.DNSTSIGConfig{KeyName: "Key.", Secret: base64.StdEncoding.EncodeToString([]byte("secret"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte{0x12, 0x34, 0x28, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 6, 0, 1}
+	signed, requestMAC := key.sign(msg, 0x1234, time.Unix(1700000000, 0))
+
+	// key name, class ANY, ttl 0, algorithm, time signed, fudge 300, error and other len
+	variables := []byte{3, 'k', 'e', 'y', 0, 0, 255, 0, 0, 0, 0}
+	variables = append(variables, 11)
+	variables = append(variables, "hmac-sha256"...)
+	variables = append(variables, 0, 0, 0, 0x65, 0x53, 0xf1, 0x00, 0x01, 0x2c, 0, 0, 0, 0)
+	h := hmac.New(sha256.New, []byte("secret"))
+	h.Write(msg)
+	h.Write(variables)
+	mac := h.Sum(nil)
+
+	if !hmac.Equal(requestMAC, mac) {
+		t.Errorf("request mac = %x, expected %x", requestMAC, mac)
+	}
+	if len(signed) <= len(msg) || signed[11] != 1 {
+		t.Fatalf("signed message %x, expected one additional record", signed)
+	}
+	if !strings.Contains(string(signed[len(msg):]), string(mac)) {
+		t.Errorf("signed message %x does not hold the mac %x", signed, mac)
+	}
+	// the message itself is unchanged but for the additional count
+	if string(signed[:10]) != string(msg[:10]) || string(signed[12:len(msg)]) != string(msg[12:]) {
+		t.Errorf("signed message %x does not start with %x", signed, msg)
+	}
+}
+
+// signResponse appends a tsig of key to resp as a server does, over the mac of
+// the request
+func signResponse(key *tsigKey, resp, requestMAC []byte, id uint16, now time.Time, tsigError uint16) []byte {
+	timeSigned := uint64(now.Unix())
+	var sum []byte
+	if tsigError == 0 {
+		mac := hmac.New(key.hash, key.secret)
+		mac.Write(appendUint16(nil, uint16(len(requestMAC))))
+		mac.Write(requestMAC)
+		mac.Write(resp)
+		mac.Write(key.variables(timeSigned, tsigFudge, 0, nil))
+		sum = mac.Sum(nil)
+	}
+
+	rdata := appendName(nil, key.algorithm)
+	rdata = appendTime(rdata, timeSigned)
+	rdata = appendUint16(rdata, tsigFudge)
+	rdata = appendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = appendUint16(rdata, id)
+	rdata = appendUint16(rdata, tsigError)
+	rdata = appendUint16(rdata, 0)
+
+	signed := appendName(append([]byte{}, resp...), key.name)
+	signed = appendUint16(signed, uint16(typeTSIG))
+	signed = appendUint16(signed, uint16(dnsmessage.ClassANY))
+	signed = appendUint32(signed, 0)
+	signed = appendUint16(signed, uint16(len(rdata)))
+	signed = append(signed, rdata...)
+	signed[11]++
+	return signed
+}
+
+func TestTSIGVerify(t *testing.T) {
+	newKey := func(name, secret string) *tsigKey {
+		key, err := newTSIGKey(config.DNSTSIGConfig{KeyName: name, Secret: base64.StdEncoding.EncodeToString([]byte(secret))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	key := newKey("loadbalance-controller", "secret")
+	now := time.Unix(1700000000, 0)
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 0x1234, Response: true, OpCode: opCodeUpdate})
+	resp, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, requestMAC := key.sign([]byte{0x12, 0x34, 0x28, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 0x1234, now)
+
+	tests := []struct {
+		name string
+		resp []byte
+		err  string
+	}{
+		{name: "signed", resp: signResponse(key, resp, requestMAC, 0x1234, now, 0)},
+		{name: "unsigned", resp: resp, err: "response is not signed"},
+		{name: "without the request mac", resp: signResponse(key, resp, nil, 0x1234, now, 0), err: "mac of the response does not match"},
+		{name: "other request", resp: signResponse(key, resp, []byte("other mac"), 0x1234, now, 0), err: "mac of the response does not match"},
+		{name: "other secret", resp: signResponse(newKey("loadbalance-controller", "guess"), resp, requestMAC, 0x1234, now, 0), err: "mac of the response does not match"},
+		{name: "other key", resp: signResponse(newKey("other", "secret"), resp, requestMAC, 0x1234, now, 0), err: "response is signed by other."},
+		{name: "outside the fudge", resp: signResponse(key, resp, requestMAC, 0x1234, now.Add(-time.Hour), 0), err: "outside the fudge"},
+		{name: "refused", resp: signResponse(key, resp, requestMAC, 0x1234, now, tsigBadSig), err: "tsig BADSIG"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := key.verify(tt.resp, requestMAC, now)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("err = %v, expected %q", err, tt.err)
+			}
+		})
+	}
+
+	// a change of the signed response breaks the mac
+	tampered := signResponse(key, resp, requestMAC, 0x1234, now, 0)
+	tampered[3] |= byte(dnstest.RCodeNotAuth)
+	if err = key.verify(tampered, requestMAC, now); err == nil {
+		t.Error("tampered response verified")
+	}
+}
+
+// TestSpoofedResponse answers every update with an unsigned success, as an
+// attacker racing the server over udp would
+func TestSpoofedResponse(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 2 {
+				continue
+			}
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: uint16(buf[0])<<8 | uint16(buf[1]), Response: true, OpCode: opCodeUpdate})
+			if resp, err := b.Finish(); err == nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+
+	secret := base64.StdEncoding.EncodeToString([]byte("secret"))
+	for _, tsig := range []config.DNSTSIGConfig{{}, {KeyName: "loadbalance-controller", Secret: secret}} {
+		c, err := NewClient(config.LoadBalanceDNSConfig{Server: conn.LocalAddr().String(), Zone: "lb.example.com", Timeout: time.Second, TSIG: tsig})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Set(context.Background(), "web.lb.example.com", "service=ns/web", net.ParseIP("10.0.0.1"))
+		if signed := tsig.KeyName != ""; signed != (err != nil) {
+			t.Errorf("signed %v: err = %v", signed, err)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+// Package dnstest runs an in-process dns server for the tests of dynamic update
+// clients, it applies RFC 2136 updates to a zone kept in memory
+package dnstest
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+	"hash"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	typeTSIG  = dnsmessage.Type(250)
+	classNONE = dnsmessage.Class(254)
+
+	// tsigBadSig is the tsig error of an update whose mac does not match
+	tsigBadSig = 16
+)
+
+// the rcodes of RFC 2136
+const (
+	RCodeYXDomain = dnsmessage.RCode(6)
+	RCodeNXRRSet  = dnsmessage.RCode(8)
+	RCodeNotAuth  = dnsmessage.RCode(9)
+)
+
+// Record is a record of the zone, Name is a lower case fqdn and Data the ip of
+// an A or AAAA record or the text of a TXT record
+type Record struct {
+	Name string
+	Type dnsmessage.Type
+	Data string
+}
+
+func (r Record) String() string {
+	return fmt.Sprintf("%s %s %s", r.Name, strings.TrimPrefix(r.Type.String(), "Type"), r.Data)
+}
+
+// Server answers updates over udp on Addr until it is closed
+type Server struct {
+	Addr string
+
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	records []Record
+	updates [][]byte
+	err     error
+
+	keyName string
+	secret  []byte
+	hash    func() hash.Hash
+}
+
+func NewServer() (*Server, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Addr: conn.LocalAddr().String(), conn: conn}
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// RequireTSIG refuses every update without a valid tsig of the key with NotAuth,
+// the responses to signed updates are signed
+func (s *Server) RequireTSIG(keyName string, secret []byte, h func() hash.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyName = strings.ToLower(strings.TrimSuffix(keyName, ".") + ".")
+	s.secret, s.hash = secret, h
+}
+
+// Add puts a record in the zone
+func (s *Server) Add(r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+}
+
+// Records returns the zone sorted by name, type and data
+func (s *Server) Records() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := append([]Record{}, s.records...)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+	return result
+}
+
+// Updates returns every message received, in order
+func (s *Server) Updates() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte{}, s.updates...)
+}
+
+// Err is the first message the server could not parse or whose tsig it refused
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Server) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg := append([]byte{}, buf[:n]...)
+
+		id, rcode, tsig := s.handle(msg)
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, OpCode: 5, RCode: rcode})
+		resp, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		if tsig != nil {
+			resp = s.sign(resp, id, tsig)
+		}
+		s.conn.WriteTo(resp, addr)
+	}
+}
+
+// responseTSIG is how the response of a signed update is signed
+type responseTSIG struct {
+	algorithm string
+	// requestMAC is covered by the mac of the response, none when the request
+	// failed verification
+	requestMAC []byte
+	// error is BADSIG when the request failed verification, the response then
+	// carries no mac
+	error uint16
+}
+
+// resource is a record of the prerequisite or update section
+type resource struct {
+	header dnsmessage.ResourceHeader
+	data   []byte
+}
+
+func (s *Server) handle(msg []byte) (uint16, dnsmessage.RCode, *responseTSIG) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, msg)
+
+	var p dnsmessage.Parser
+	header, err := p.Start(msg)
+	if err != nil {
+		return 0, s.fail(err), nil
+	}
+	if _, err = p.AllQuestions(); err != nil {
+		return header.ID, s.fail(err), nil
+	}
+	prerequisites, err := resources(&p, p.AnswerHeader)
+	if err != nil {
+		return header.ID, s.fail(err), nil
+	}
+	updates, err := resources(&p, p.AuthorityHeader)
+	if err != nil {
+		return header.ID, s.fail(err), nil
+	}
+	additionals, err := resources(&p, p.AdditionalHeader)
+	if err != nil {
+		return header.ID, s.fail(err), nil
+	}
+
+	var tsig *responseTSIG
+	if s.keyName != "" {
+		if tsig, err = s.verify(msg, additionals); err != nil {
+			s.fail(err)
+			return header.ID, RCodeNotAuth, tsig
+		}
+	}
+
+	for _, r := range prerequisites {
+		if rcode := s.check(r); rcode != dnsmessage.RCodeSuccess {
+			return header.ID, rcode, tsig
+		}
+	}
+	for _, r := range updates {
+		s.apply(r)
+	}
+	return header.ID, dnsmessage.RCodeSuccess, tsig
+}
+
+func (s *Server) fail(err error) dnsmessage.RCode {
+	if s.err == nil {
+		s.err = err
+	}
+	return dnsmessage.RCodeFormatError
+}
+
+func resources(p *dnsmessage.Parser, next func() (dnsmessage.ResourceHeader, error)) ([]resource, error) {
+	var result []resource
+	for {
+		h, err := next()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r, err := p.UnknownResource()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, resource{header: h, data: r.Data})
+	}
+}
+
+// check evaluates a prerequisite: the exact TXT rrset, or a name not in use
+func (s *Server) check(r resource) dnsmessage.RCode {
+	name := strings.ToLower(r.header.Name.String())
+	switch {
+	case r.header.Class == classNONE && r.header.Type == dnsmessage.TypeALL:
+		for _, record := range s.records {
+			if record.Name == name {
+				return RCodeYXDomain
+			}
+		}
+		return dnsmessage.RCodeSuccess
+	case r.header.Class == dnsmessage.ClassINET && r.header.Type == dnsmessage.TypeTXT:
+		var rrset []string
+		for _, record := range s.records {
+			if record.Name == name && record.Type == dnsmessage.TypeTXT {
+				rrset = append(rrset, record.Data)
+			}
+		}
+		if len(rrset) != 1 || rrset[0] != txt(r.data) {
+			return RCodeNXRRSet
+		}
+		return dnsmessage.RCodeSuccess
+	}
+	return dnsmessage.RCodeNotImplemented
+}
+
+// apply deletes an rrset with class ANY, a single record with class NONE and adds one otherwise
+func (s *Server) apply(r resource) {
+	record := Record{Name: strings.ToLower(r.header.Name.String()), Type: r.header.Type, Data: data(r)}
+
+	kept := s.records[:0]
+	for _, existing := range s.records {
+		sameRRSet := existing.Name == record.Name && existing.Type == record.Type
+		if sameRRSet && (r.header.Class == dnsmessage.ClassANY || existing.Data == record.Data) {
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	s.records = kept
+
+	if r.header.Class == dnsmessage.ClassINET {
+		s.records = append(s.records, record)
+	}
+}
+
+func data(r resource) string {
+	switch {
+	case len(r.data) == 0:
+		return ""
+	case r.header.Type == dnsmessage.TypeTXT:
+		return txt(r.data)
+	case r.header.Type == dnsmessage.TypeA, r.header.Type == dnsmessage.TypeAAAA:
+		return net.IP(r.data).String()
+	}
+	return fmt.Sprintf("%x", r.data)
+}
+
+// txt joins the character strings of a TXT record
+func txt(data []byte) string {
+	var result strings.Builder
+	for len(data) > 0 {
+		n := int(data[0])
+		if n+1 > len(data) {
+			break
+		}
+		result.Write(data[1 : n+1])
+		data = data[n+1:]
+	}
+	return result.String()
+}
+
+// verify checks the tsig record that ends the message as in RFC 8945, it
+// returns how to sign the response, nil when the message has no tsig to answer
+func (s *Server) verify(msg []byte, additionals []resource) (*responseTSIG, error) {
+	if len(additionals) == 0 {
+		return nil, errors.New("update without tsig")
+	}
+	tsig := additionals[len(additionals)-1]
+	keyName := strings.ToLower(tsig.header.Name.String())
+	if tsig.header.Type != typeTSIG || keyName != s.keyName {
+		return nil, fmt.Errorf("update signed by %s type %s, expected a tsig of %s", keyName, tsig.header.Type, s.keyName)
+	}
+
+	// the unsigned message ends before the tsig record, which is not compressed
+	length := len(wireName(keyName)) + 10 + len(tsig.data)
+	unsigned := append([]byte{}, msg[:len(msg)-length]...)
+	binary.BigEndian.PutUint16(unsigned[10:12], binary.BigEndian.Uint16(unsigned[10:12])-1)
+
+	rdata := tsig.data
+	algorithm, n := readName(rdata)
+	if n == 0 || len(rdata) < n+10 {
+		return nil, errors.New("truncated tsig")
+	}
+	timeAndFudge := rdata[n : n+8]
+	macSize := int(binary.BigEndian.Uint16(rdata[n+8 : n+10]))
+	if len(rdata) < n+10+macSize+6 {
+		return nil, errors.New("truncated tsig mac")
+	}
+	sum := rdata[n+10 : n+10+macSize]
+	errorAndOther := rdata[n+10+macSize+2:]
+
+	variables := wireName(keyName)
+	variables = append(variables, 0, byte(dnsmessage.ClassANY), 0, 0, 0, 0)
+	variables = append(variables, wireName(algorithm)...)
+	variables = append(variables, timeAndFudge...)
+	variables = append(variables, errorAndOther...)
+
+	mac := hmac.New(s.hash, s.secret)
+	mac.Write(unsigned)
+	mac.Write(variables)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return &responseTSIG{algorithm: algorithm, error: tsigBadSig}, errors.New("tsig mac does not match")
+	}
+	return &responseTSIG{algorithm: algorithm, requestMAC: append([]byte{}, sum...)}, nil
+}
+
+// sign appends the tsig of the response to resp, its mac covers the mac of the
+// request. A refused request gets the tsig error without a mac.
+func (s *Server) sign(resp []byte, id uint16, tsig *responseTSIG) []byte {
+	timeSigned := uint64(time.Now().Unix())
+	timeAndFudge := []byte{byte(timeSigned >> 40), byte(timeSigned >> 32), byte(timeSigned >> 24), byte(timeSigned >> 16), byte(timeSigned >> 8), byte(timeSigned), 0x01, 0x2c}
+	errorAndOther := []byte{byte(tsig.error >> 8), byte(tsig.error), 0, 0}
+
+	var sum []byte
+	if tsig.error == 0 {
+		variables := wireName(s.keyName)
+		variables = append(variables, 0, byte(dnsmessage.ClassANY), 0, 0, 0, 0)
+		variables = append(variables, wireName(tsig.algorithm)...)
+		variables = append(variables, timeAndFudge...)
+		variables = append(variables, errorAndOther...)
+
+		mac := hmac.New(s.hash, s.secret)
+		mac.Write([]byte{byte(len(tsig.requestMAC) >> 8), byte(len(tsig.requestMAC))})
+		mac.Write(tsig.requestMAC)
+		mac.Write(resp)
+		mac.Write(variables)
+		sum = mac.Sum(nil)
+	}
+
+	rdata := wireName(tsig.algorithm)
+	rdata = append(rdata, timeAndFudge...)
+	rdata = append(rdata, byte(len(sum)>>8), byte(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = append(rdata, byte(id>>8), byte(id))
+	rdata = append(rdata, errorAndOther...)
+
+	signed := append([]byte{}, resp...)
+	signed = append(signed, wireName(s.keyName)...)
+	signed = append(signed, byte(typeTSIG>>8), byte(typeTSIG), 0, byte(dnsmessage.ClassANY), 0, 0, 0, 0)
+	signed = append(signed, byte(len(rdata)>>8), byte(len(rdata)))
+	signed = append(signed, rdata...)
+	binary.BigEndian.PutUint16(signed[10:12], binary.BigEndian.Uint16(signed[10:12])+1)
+	return signed
+}
+
+// wireName is the uncompressed wire form of a lower case fqdn
+func wireName(name string) []byte {
+	var result []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		result = append(result, byte(len(label)))
+		result = append(result, label...)
+	}
+	return append(result, 0)
+}
+
+// readName reads an uncompressed name, n is 0 when it is truncated
+func readName(b []byte) (string, int) {
+	var labels []string
+	for off := 0; off < len(b); {
+		n := int(b[off])
+		if n == 0 {
+			return strings.Join(labels, ".") + ".", off + 1
+		}
+		if off+1+n > len(b) {
+			break
+		}
+		labels = append(labels, string(b[off+1:off+1+n]))
+		off += 1 + n
+	}
+	return "", 0
+}
@@ -0,0 +1,271 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"golang.org/x/net/dns/dnsmessage"
+	"hash"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	typeTSIG = dnsmessage.Type(250)
+
+	// the tsig errors of RFC 8945
+	tsigBadSig  = 16
+	tsigBadKey  = 17
+	tsigBadTime = 18
+
+	// tsigFudge is the clock skew the server accepts, the value of RFC 8945
+	tsigFudge = 300
+
+	defaultTSIGAlgorithm = "hmac-sha256"
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1":   sha1.New,
+	"hmac-sha256": sha256.New,
+	"hmac-sha512": sha512.New,
+}
+
+// TSIGError is the error of the tsig a server answered an update with, it
+// refused the signature of the update
+type TSIGError struct {
+	Code uint16
+}
+
+func (e *TSIGError) Error() string {
+	switch e.Code {
+	case tsigBadSig:
+		return "tsig BADSIG"
+	case tsigBadKey:
+		return "tsig BADKEY"
+	case tsigBadTime:
+		return "tsig BADTIME"
+	}
+	return fmt.Sprintf("tsig error %d", e.Code)
+}
+
+// tsigKey signs a message as in RFC 8945, dnsmessage has no tsig support so the
+// record is appended to the packed message by hand
+type tsigKey struct {
+	name      dnsmessage.Name
+	algorithm dnsmessage.Name
+	hash      func() hash.Hash
+	secret    []byte
+}
+
+func newTSIGKey(cfg config.DNSTSIGConfig) (*tsigKey, error) {
+	algorithm := strings.ToLower(strings.TrimSuffix(cfg.Algorithm, "."))
+	if algorithm == "" {
+		algorithm = defaultTSIGAlgorithm
+	}
+	h, ok := tsigAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tsig algorithm %s", cfg.Algorithm)
+	}
+
+	encoded := cfg.Secret
+	if cfg.SecretFile != "" {
+		data, err := os.ReadFile(cfg.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("tsig secret is not base64: %w", err)
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("tsig key %s needs secret or secretFile", cfg.KeyName)
+	}
+
+	name, err := newName(cfg.KeyName)
+	if err != nil {
+		return nil, err
+	}
+	return &tsigKey{
+		name:      name,
+		algorithm: dnsmessage.MustNewName(algorithm + "."),
+		hash:      h,
+		secret:    secret,
+	}, nil
+}
+
+// sign appends the tsig record to msg, a packed message without compression,
+// and returns the mac the response is signed over
+func (k *tsigKey) sign(msg []byte, id uint16, now time.Time) ([]byte, []byte) {
+	timeSigned := uint64(now.Unix())
+
+	mac := hmac.New(k.hash, k.secret)
+	mac.Write(msg)
+	mac.Write(k.variables(timeSigned, tsigFudge, 0, nil))
+	sum := mac.Sum(nil)
+
+	rdata := appendName(nil, k.algorithm)
+	rdata = appendTime(rdata, timeSigned)
+	rdata = appendUint16(rdata, tsigFudge)
+	rdata = appendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = appendUint16(rdata, id)
+	// error and other len
+	rdata = appendUint16(rdata, 0)
+	rdata = appendUint16(rdata, 0)
+
+	signed := make([]byte, len(msg), len(msg)+len(rdata)+64)
+	copy(signed, msg)
+	signed = appendName(signed, k.name)
+	signed = appendUint16(signed, uint16(typeTSIG))
+	signed = appendUint16(signed, uint16(dnsmessage.ClassANY))
+	signed = appendUint32(signed, 0)
+	signed = appendUint16(signed, uint16(len(rdata)))
+	signed = append(signed, rdata...)
+
+	// one more additional record
+	arcount := binary.BigEndian.Uint16(signed[10:12])
+	binary.BigEndian.PutUint16(signed[10:12], arcount+1)
+	return signed, sum
+}
+
+// variables are the fields of the tsig record the mac covers, the key and
+// algorithm names in canonical form
+func (k *tsigKey) variables(timeSigned uint64, fudge, tsigError uint16, other []byte) []byte {
+	variables := appendName(nil, k.name)
+	variables = appendUint16(variables, uint16(dnsmessage.ClassANY))
+	variables = appendUint32(variables, 0)
+	variables = appendName(variables, k.algorithm)
+	variables = appendTime(variables, timeSigned)
+	variables = appendUint16(variables, fudge)
+	variables = appendUint16(variables, tsigError)
+	variables = appendUint16(variables, uint16(len(other)))
+	return append(variables, other...)
+}
+
+// verify checks the tsig that ends a response as in RFC 8945 section 5.3, its
+// mac covers the mac of the request, so an unsigned or spoofed answer is never
+// taken for the result of the update. A server refusing the tsig of the update
+// answers with a tsig error and no mac, that is returned as a *TSIGError.
+func (k *tsigKey) verify(resp, requestMAC []byte, now time.Time) error {
+	var p dnsmessage.Parser
+	if _, err := p.Start(resp); err != nil {
+		return err
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return err
+	}
+	if err := p.SkipAllAnswers(); err != nil {
+		return err
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return err
+	}
+	var last dnsmessage.ResourceHeader
+	var rdata []byte
+	for {
+		h, err := p.AdditionalHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		r, err := p.UnknownResource()
+		if err != nil {
+			return err
+		}
+		last, rdata = h, r.Data
+	}
+	if last.Type != typeTSIG {
+		return errors.New("response is not signed")
+	}
+	if !strings.EqualFold(last.Name.String(), k.name.String()) {
+		return fmt.Errorf("response is signed by %s, expected %s", last.Name.String(), k.name.String())
+	}
+
+	// the record is not compressed, the unsigned response ends before it
+	name := appendName(nil, k.name)
+	start := len(resp) - len(name) - 10 - len(rdata)
+	if start < 12 || !bytes.EqualFold(resp[start:start+len(name)], name) {
+		return errors.New("tsig of the response is compressed")
+	}
+
+	algorithm := appendName(nil, k.algorithm)
+	if len(rdata) < len(algorithm)+10 || !bytes.EqualFold(rdata[:len(algorithm)], algorithm) {
+		return fmt.Errorf("tsig of the response is not %s", k.algorithm.String())
+	}
+	n := len(algorithm)
+	timeSigned := uint64(binary.BigEndian.Uint16(rdata[n:]))<<32 | uint64(binary.BigEndian.Uint32(rdata[n+2:]))
+	fudge := binary.BigEndian.Uint16(rdata[n+6:])
+	macSize := int(binary.BigEndian.Uint16(rdata[n+8:]))
+	if len(rdata) < n+10+macSize+6 {
+		return errors.New("tsig of the response is truncated")
+	}
+	sum := rdata[n+10 : n+10+macSize]
+	originalID := binary.BigEndian.Uint16(rdata[n+10+macSize:])
+	tsigError := binary.BigEndian.Uint16(rdata[n+12+macSize:])
+	other := rdata[n+16+macSize:]
+	if len(other) != int(binary.BigEndian.Uint16(rdata[n+14+macSize:])) {
+		return errors.New("tsig of the response is truncated")
+	}
+
+	if tsigError != 0 {
+		return &TSIGError{Code: tsigError}
+	}
+	if macSize == 0 {
+		return errors.New("response is not signed")
+	}
+	if skew := now.Unix() - int64(timeSigned); skew > int64(fudge) || -skew > int64(fudge) {
+		return fmt.Errorf("response was signed at %s, outside the fudge of %ds", time.Unix(int64(timeSigned), 0), fudge)
+	}
+
+	unsigned := append([]byte{}, resp[:start]...)
+	binary.BigEndian.PutUint16(unsigned[0:2], originalID)
+	binary.BigEndian.PutUint16(unsigned[10:12], binary.BigEndian.Uint16(unsigned[10:12])-1)
+
+	mac := hmac.New(k.hash, k.secret)
+	mac.Write(appendUint16(nil, uint16(len(requestMAC))))
+	mac.Write(requestMAC)
+	mac.Write(unsigned)
+	mac.Write(k.variables(timeSigned, fudge, tsigError, other))
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return errors.New("tsig mac of the response does not match")
+	}
+	return nil
+}
+
+// appendName writes name uncompressed and lower case
+func appendName(b []byte, name dnsmessage.Name) []byte {
+	s := strings.ToLower(name.String())
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// appendTime writes the 48 bit time signed
+func appendTime(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
@@ -0,0 +1,159 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"io"
+	"time"
+)
+
+const (
+	BackendHTTP = "http"
+	BackendGRPC = "grpc"
+)
+
+// backend carries the single item calls of the client, the batch calls only
+// exist in the rest api and always go over http
+type backend interface {
+	bind(ctx context.Context, m *LoadBalance) error
+	unbind(ctx context.Context, m *LoadBalance) error
+	listPage(ctx context.Context, opts *ListOptions, continueToken string) (*LoadBalanceList, error)
+	watch(ctx context.Context, resourceVersion string, fn func(event WatchEvent) error) error
+	// previous returns the ip the service released last within the sticky retention of the server
+	previous(ctx context.Context, name, namespace string) (string, error)
+}
+
+type httpBackend struct {
+	set    *config.LoadBalanceSetConfig
+	region string
+	client *HTTPClient
+}
+
+func (b *httpBackend) post(ctx context.Context, url string, m *LoadBalance) error {
+	var result *LoadBalanceMetadata
+	body := &PostOrPutParams{
+		URL:         url,
+		Body:        m,
+		Empowerment: &result,
+		Idempotent:  true,
+	}
+	if err := b.client.POST(ctx, body); err != nil {
+		return err
+	}
+	return checkEnvelope("POST", body.URL, result)
+}
+
+func (b *httpBackend) bind(ctx context.Context, m *LoadBalance) error {
+	return b.post(ctx, b.set.Bind, m)
+}
+
+func (b *httpBackend) unbind(ctx context.Context, m *LoadBalance) error {
+	return b.post(ctx, b.set.Released, m)
+}
+
+func (b *httpBackend) listPage(ctx context.Context, opts *ListOptions, continueToken string) (*LoadBalanceList, error) {
+	var metadata *LoadBalanceMetadata
+	var result *LoadBalanceList
+
+	query := opts.params()
+	if continueToken != "" {
+		query["continue"] = continueToken
+	}
+
+	params := &GetOrDeleteParams{
+		URL:         b.set.List,
+		Params:      query,
+		Empowerment: &metadata,
+	}
+	err := b.client.GET(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkEnvelope("GET", params.URL, metadata); err != nil {
+		return nil, err
+	}
+
+	err = parsers.JsonInterface(metadata.Data, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *httpBackend) watch(ctx context.Context, resourceVersion string, fn func(event WatchEvent) error) error {
+	if b.set.Watch == "" {
+		return ErrWatchNotConfigured
+	}
+
+	params := map[string]string{"cluster": b.region}
+	if resourceVersion != "" {
+		params["resourceVersion"] = resourceVersion
+	}
+	return streamWatch(ctx, b.client, &GetOrDeleteParams{URL: b.set.Watch, Params: params}, fn)
+}
+
+func (b *httpBackend) previous(ctx context.Context, name, namespace string) (string, error) {
+	if b.set.Previous == "" {
+		return "", ErrPreviousNotConfigured
+	}
+
+	var metadata *LoadBalanceMetadata
+	var result *LoadBalance
+	params := &GetOrDeleteParams{
+		URL:         b.set.Previous,
+		Params:      map[string]string{"cluster": b.region, "namespace": namespace, "service": name},
+		Empowerment: &metadata,
+	}
+	if err := b.client.GET(ctx, params); err != nil {
+		return "", err
+	}
+	if err := checkEnvelope("GET", params.URL, metadata); err != nil {
+		return "", err
+	}
+	if err := parsers.JsonInterface(metadata.Data, &result); err != nil || result == nil {
+		return "", err
+	}
+	return result.Ip, nil
+}
+
+// streamWatch decodes the newline delimited events of a watch response until
+// the server ends the stream, ctx is cancelled or fn fails
+func streamWatch(ctx context.Context, client *HTTPClient, params *GetOrDeleteParams, fn func(event WatchEvent) error) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	body, err := client.Stream(ctx, params)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	idle := time.AfterFunc(watchIdleTimeout, cancel)
+	defer idle.Stop()
+
+	decoder := json.NewDecoder(body)
+	for {
+		var event WatchEvent
+		if err = decoder.Decode(&event); err != nil {
+			switch {
+			case parent.Err() != nil:
+				return parent.Err()
+			case ctx.Err() != nil:
+				return &transientError{err: fmt.Errorf("watch idle for %s", watchIdleTimeout)}
+			case err == io.EOF:
+				return nil
+			}
+			return &transientError{err: err}
+		}
+		idle.Reset(watchIdleTimeout)
+
+		if err = fn(event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package sdk
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	pb "github.com/YuZongYangHi/cloud-controller-manager/pkg/api/loadbalancer/v1"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"time"
+)
+
+type grpcBackend struct {
+	address string
+	region  string
+	timeout time.Duration
+	client  pb.LoadBalancerServiceClient
+	// signer is nil when signing is disabled
+	signer *HMACSigner
+}
+
+// bearerToken sends the token of the credentials config with every call
+type bearerToken struct {
+	tokens *tokenSource
+	secure bool
+}
+
+// GetRequestMetadata also sets the request id the manager records in its history
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := map[string]string{"x-request-id": newRequestID()}
+	if token := t.tokens.Token(); token != "" {
+		md["authorization"] = "Bearer " + token
+	}
+	return md, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return t.secure
+}
+
+func failedCall(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Internal, codes.Unknown, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+func newGRPCBackend(config *config.LoadBalanceConfig, tlsConfig *tls.Config, tokens *tokenSource, breaker *CircuitBreaker, signer *HMACSigner) (backend, error) {
+	if config.GRPC.Address == "" {
+		return nil, errors.New("backend grpc: grpc.address is required")
+	}
+
+	transport := credentials.NewTLS(tlsConfig)
+	if config.GRPC.Plaintext {
+		transport = insecure.NewCredentials()
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(transport),
+		grpc.WithPerRPCCredentials(bearerToken{tokens: tokens, secure: !config.GRPC.Plaintext}),
+		grpc.WithUserAgent(userAgentComponent),
+	}
+	if breaker != nil {
+		// the same accounting as breaker.Middleware does for http attempts
+		opts = append(opts, grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if err := breaker.allow(); err != nil {
+				return err
+			}
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			breaker.done(failedCall(err), errors.Is(ctx.Err(), context.Canceled))
+			return err
+		}))
+	}
+
+	conn, err := grpc.Dial(config.GRPC.Address, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcBackend{
+		address: config.GRPC.Address,
+		region:  config.Region,
+		timeout: durationOrDefault(config.Timeout, defaultTimeout),
+		client:  pb.NewLoadBalancerServiceClient(conn),
+		signer:  signer,
+	}, nil
+}
+
+// sign adds the signature of the call over req to the metadata of ctx, the
+// grpc counterpart of SigningMiddleware. A call is never retried, so it is
+// signed once.
+func (b *grpcBackend) sign(ctx context.Context, method string, req proto.Message) (context.Context, error) {
+	if b.signer == nil {
+		return ctx, nil
+	}
+	pairs, err := b.signer.grpcMetadata("/"+pb.LoadBalancerService_ServiceDesc.ServiceName+"/"+method, req)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...), nil
+}
+
+// apiError maps a status to the http status of the rest api, so errors.Is
+// against the Err* values behaves the same for both backends
+func (b *grpcBackend) apiError(method string, err error) error {
+	if err == nil || errors.Is(err, ErrCircuitOpen) {
+		return err
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return &transientError{err: err}
+	}
+
+	code, reason := http.StatusInternalServerError, ""
+	switch s.Code() {
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.AlreadyExists:
+		code = http.StatusConflict
+	case codes.ResourceExhausted:
+		code, reason = http.StatusConflict, ReasonPoolExhausted
+	case codes.FailedPrecondition:
+		code, reason = http.StatusConflict, ReasonQuarantined
+	case codes.Unauthenticated:
+		code = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		code = http.StatusForbidden
+	case codes.OutOfRange:
+		code = http.StatusGone
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	case codes.Canceled:
+		return context.Canceled
+	}
+	// the server attaches the reason of the rest api where a code is shared
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason != "" {
+			reason = info.Reason
+		}
+	}
+	return &APIError{Method: method, URL: b.address, StatusCode: code, Reason: reason, Message: s.Message()}
+}
+
+func (b *grpcBackend) bind(ctx context.Context, m *LoadBalance) error {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	req := &pb.BindRequest{Cluster: m.Cluster, Ip: m.Ip, Namespace: m.Namespace, ServiceName: m.ServiceName}
+	ctx, err := b.sign(ctx, "Bind", req)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.Bind(ctx, req)
+	return b.apiError("Bind", err)
+}
+
+func (b *grpcBackend) unbind(ctx context.Context, m *LoadBalance) error {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	req := &pb.ReleaseRequest{Cluster: m.Cluster, Namespace: m.Namespace, ServiceName: m.ServiceName}
+	ctx, err := b.sign(ctx, "Release", req)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.Release(ctx, req)
+	return b.apiError("Release", err)
+}
+
+func (b *grpcBackend) previous(ctx context.Context, name, namespace string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	req := &pb.GetByServiceRequest{Cluster: b.region, Namespace: namespace, ServiceName: name}
+	ctx, err := b.sign(ctx, "GetPrevious", req)
+	if err != nil {
+		return "", err
+	}
+	m, err := b.client.GetPrevious(ctx, req)
+	if err != nil {
+		return "", b.apiError("GetPrevious", err)
+	}
+	return m.Ip, nil
+}
+
+func fromProto(m *pb.LoadBalance) LoadBalance {
+	lb := LoadBalance{
+		Cluster:             m.Cluster,
+		Ip:                  m.Ip,
+		Carriers:            int(m.Carriers),
+		Status:              int(m.Status),
+		Cidr:                m.Cidr,
+		Namespace:           m.Namespace,
+		ServiceName:         m.ServiceName,
+		ReservedNamespace:   m.ReservedNamespace,
+		ReservedServiceName: m.ReservedServiceName,
+	}
+	if m.QuarantineUntil != nil {
+		until := m.QuarantineUntil.AsTime()
+		lb.QuarantineUntil = &until
+	}
+	return lb
+}
+
+func (b *grpcBackend) listPage(ctx context.Context, opts *ListOptions, continueToken string) (*LoadBalanceList, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	cluster := opts.Cluster
+	if cluster == "" {
+		cluster = b.region
+	}
+	req := &pb.ListRequest{
+		Cluster:     cluster,
+		Status:      opts.Status,
+		Cidr:        opts.Cidr,
+		Carrier:     opts.Carrier,
+		Namespace:   opts.Namespace,
+		ServiceName: opts.Service,
+		IpPrefix:    opts.IpPrefix,
+		Sort:        opts.Sort,
+		Limit:       int32(opts.Limit),
+		Continue:    continueToken,
+		ReservedFor: opts.ReservedFor,
+	}
+	ctx, err := b.sign(ctx, "List", req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.List(ctx, req)
+	if err != nil {
+		return nil, b.apiError("List", err)
+	}
+
+	result := &LoadBalanceList{Total: resp.Total, Continue: resp.Continue, ResourceVersion: resp.ResourceVersion}
+	for _, item := range resp.Items {
+		result.Items = append(result.Items, fromProto(item))
+	}
+	return result, nil
+}
+
+func (b *grpcBackend) watch(ctx context.Context, resourceVersion string, fn func(event WatchEvent) error) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req := &pb.WatchRequest{Cluster: b.region, ResourceVersion: resourceVersion}
+	ctx, err := b.sign(ctx, "Watch", req)
+	if err != nil {
+		return err
+	}
+	stream, err := b.client.Watch(ctx, req)
+	if err != nil {
+		return b.apiError("Watch", err)
+	}
+
+	idle := time.AfterFunc(watchIdleTimeout, cancel)
+	defer idle.Stop()
+
+	for {
+		in, err := stream.Recv()
+		if err != nil {
+			switch {
+			case parent.Err() != nil:
+				return parent.Err()
+			case ctx.Err() != nil:
+				return &transientError{err: fmt.Errorf("watch idle for %s", watchIdleTimeout)}
+			case err == io.EOF:
+				return nil
+			}
+			return b.apiError("Watch", err)
+		}
+		idle.Reset(watchIdleTimeout)
+
+		event := WatchEvent{Type: WatchEventType(in.Type), ResourceVersion: in.ResourceVersion}
+		if in.Object != nil {
+			event.Object = fromProto(in.Object)
+		}
+		if err = fn(event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	pb "github.com/YuZongYangHi/cloud-controller-manager/pkg/api/loadbalancer/v1"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeLoadBalancerServer answers from its fields, err is returned by every call when set
+type fakeLoadBalancerServer struct {
+	pb.UnimplementedLoadBalancerServiceServer
+	err   error
+	binds []*pb.BindRequest
+	list  *pb.ListResponse
+}
+
+func (s *fakeLoadBalancerServer) Bind(ctx context.Context, req *pb.BindRequest) (*pb.LoadBalance, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.binds = append(s.binds, req)
+	return &pb.LoadBalance{Cluster: req.Cluster, Ip: req.Ip, Namespace: req.Namespace, ServiceName: req.ServiceName}, nil
+}
+
+func (s *fakeLoadBalancerServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.list, nil
+}
+
+func newTestGRPCBackend(t *testing.T, srv pb.LoadBalancerServiceServer, opts ...grpc.ServerOption) *grpcBackend {
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(opts...)
+	pb.RegisterLoadBalancerServiceServer(s, srv)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &grpcBackend{address: "bufnet", region: "c1", timeout: 5 * time.Second, client: pb.NewLoadBalancerServiceClient(conn)}
+}
+
+func withReason(code codes.Code, reason string) error {
+	s, _ := status.New(code, "refused").WithDetails(&errdetails.ErrorInfo{Reason: reason})
+	return s.Err()
+}
+
+func TestGRPCBackendRoundTrip(t *testing.T) {
+	until := time.Date(2023, 4, 13, 8, 0, 0, 0, time.UTC)
+	srv := &fakeLoadBalancerServer{list: &pb.ListResponse{
+		Items: []*pb.LoadBalance{
+			{Cluster: "c1", Ip: "10.0.0.1", Carriers: 2, Status: 1, Cidr: "10.0.0.0/24", Namespace: "ns", ServiceName: "svc"},
+			{Cluster: "c1", Ip: "10.0.0.2", Carriers: 2, Status: 2, Cidr: "10.0.0.0/24", QuarantineUntil: timestamppb.New(until), ReservedNamespace: "ns", ReservedServiceName: "svc"},
+		},
+		Total:           2,
+		Continue:        "next",
+		ResourceVersion: "7",
+	}}
+	b := newTestGRPCBackend(t, srv)
+
+	if err := b.bind(context.Background(), &LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "svc"}); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if len(srv.binds) != 1 || srv.binds[0].Ip != "10.0.0.1" || srv.binds[0].ServiceName != "svc" {
+		t.Fatalf("server received %v", srv.binds)
+	}
+
+	page, err := b.listPage(context.Background(), &ListOptions{}, "")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	expected := []LoadBalance{
+		{Cluster: "c1", Ip: "10.0.0.1", Carriers: 2, Status: 1, Cidr: "10.0.0.0/24", Namespace: "ns", ServiceName: "svc"},
+		{Cluster: "c1", Ip: "10.0.0.2", Carriers: 2, Status: 2, Cidr: "10.0.0.0/24", QuarantineUntil: &until, ReservedNamespace: "ns", ReservedServiceName: "svc"},
+	}
+	if !reflect.DeepEqual(page.Items, expected) {
+		t.Errorf("items = %+v, expected %+v", page.Items, expected)
+	}
+	if page.Total != 2 || page.Continue != "next" || page.ResourceVersion != "7" {
+		t.Errorf("page = %+v", page)
+	}
+}
+
+func TestGRPCBackendErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{name: "not found", err: status.Error(codes.NotFound, "no ip"), expected: ErrNotFound},
+		{name: "already bound", err: status.Error(codes.AlreadyExists, "bound"), expected: ErrConflict},
+		{name: "pool exhausted", err: status.Error(codes.ResourceExhausted, "empty"), expected: ErrPoolExhausted},
+		{name: "quota exceeded", err: withReason(codes.ResourceExhausted, ReasonQuotaExceeded), expected: ErrQuotaExceeded},
+		{name: "permission denied", err: status.Error(codes.PermissionDenied, "denied"), expected: ErrUnauthorized},
+		{name: "unavailable", err: status.Error(codes.Unavailable, "down"), expected: ErrTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestGRPCBackend(t, &fakeLoadBalancerServer{err: tt.err})
+			err := b.bind(context.Background(), &LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "svc"})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("bind error %v does not match %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+// TestGRPCBackendSigning checks every call carries a signature over its request message
+func TestGRPCBackendSigning(t *testing.T) {
+	var calls []string
+	verify := func(ctx context.Context, fullMethod string, req interface{}) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		header := func(key string) string {
+			if values := md.Get(key); len(values) == 1 {
+				return values[0]
+			}
+			return ""
+		}
+		if header(signature.HeaderAccessKey) != "ak" {
+			return status.Errorf(codes.Unauthenticated, "access key = %q", header(signature.HeaderAccessKey))
+		}
+		stringToSign, err := signature.GRPCStringToSign(fullMethod, header(signature.HeaderTimestamp), header(signature.HeaderNonce), req.(proto.Message))
+		if err != nil {
+			return err
+		}
+		if err = signature.Verify("secret", stringToSign, header(signature.HeaderSignature)); err != nil {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		calls = append(calls, fullMethod)
+		return nil
+	}
+	unary := grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := verify(ctx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	})
+
+	b := newTestGRPCBackend(t, &fakeLoadBalancerServer{list: &pb.ListResponse{}}, unary)
+	b.signer = NewHMACSigner(&signature.Credentials{AccessKeyId: "ak", SecretAccessKey: "secret"})
+
+	if err := b.bind(context.Background(), &LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "svc"}); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if _, err := b.listPage(context.Background(), &ListOptions{Status: "0"}, "next"); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	expected := []string{"/cloudprovider.loadbalancer.v1.LoadBalancerService/Bind", "/cloudprovider.loadbalancer.v1.LoadBalancerService/List"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("verified calls = %v, expected %v", calls, expected)
+	}
+
+	b.signer = NewHMACSigner(&signature.Credentials{AccessKeyId: "ak", SecretAccessKey: "guess"})
+	if err := b.bind(context.Background(), &LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns", ServiceName: "svc"}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("bind with a wrong secret = %v, expected %v", err, ErrUnauthorized)
+	}
+}
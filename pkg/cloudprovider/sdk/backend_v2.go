@@ -0,0 +1,156 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"net/url"
+	"strings"
+)
+
+const (
+	APIVersionV1 = "v1"
+	APIVersionV2 = "v2"
+)
+
+// the route templates of the v2 paths, below the path of the server
+const (
+	routeAddresses = "/clusters/{cluster}/addresses"
+	routeBindings  = "/clusters/{cluster}/bindings"
+	routeBinding   = "/clusters/{cluster}/bindings/{namespace}/{service}"
+	routePrevious  = "/clusters/{cluster}/bindings/{namespace}/{service}/previous"
+	routeWatch     = "/clusters/{cluster}/watch"
+)
+
+var ErrServerNotConfigured = errors.New("loadbalance.server is required by version v2")
+
+// httpV2Backend speaks the resource routes of /api/v2, every path is below the
+// cluster of the client
+type httpV2Backend struct {
+	server string
+	// prefix is the path of server, the routes are reported below it
+	prefix string
+	region string
+	client *HTTPClient
+}
+
+func newHTTPV2Backend(server, region string, client *HTTPClient) (*httpV2Backend, error) {
+	if server == "" {
+		return nil, ErrServerNotConfigured
+	}
+	server = strings.TrimSuffix(server, "/")
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("loadbalance.server: %w", err)
+	}
+	return &httpV2Backend{server: server, prefix: u.Path, region: region, client: client}, nil
+}
+
+func (b *httpV2Backend) route(template string) string {
+	return b.prefix + template
+}
+
+func (b *httpV2Backend) url(cluster string, segments ...string) string {
+	path := b.server + "/clusters/" + url.PathEscape(cluster)
+	for _, segment := range segments {
+		path += "/" + url.PathEscape(segment)
+	}
+	return path
+}
+
+func (b *httpV2Backend) bind(ctx context.Context, m *LoadBalance) error {
+	var result *LoadBalanceMetadata
+	body := &PostOrPutParams{
+		URL:         b.url(m.Cluster, "bindings", m.Namespace, m.ServiceName),
+		Route:       b.route(routeBinding),
+		Body:        map[string]string{"ip": m.Ip},
+		Empowerment: &result,
+	}
+	if err := b.client.PUT(ctx, body); err != nil {
+		return err
+	}
+	return checkEnvelope("PUT", body.URL, result)
+}
+
+func (b *httpV2Backend) unbind(ctx context.Context, m *LoadBalance) error {
+	var result *LoadBalanceMetadata
+	params := &GetOrDeleteParams{
+		URL:         b.url(m.Cluster, "bindings", m.Namespace, m.ServiceName),
+		Route:       b.route(routeBinding),
+		Empowerment: &result,
+	}
+	if err := b.client.DELETE(ctx, params); err != nil {
+		return err
+	}
+	return checkEnvelope("DELETE", params.URL, result)
+}
+
+func (b *httpV2Backend) get(ctx context.Context, params *GetOrDeleteParams) (*LoadBalanceList, error) {
+	var metadata *LoadBalanceMetadata
+	var result *LoadBalanceList
+
+	params.Empowerment = &metadata
+	if err := b.client.GET(ctx, params); err != nil {
+		return nil, err
+	}
+	if err := checkEnvelope("GET", params.URL, metadata); err != nil {
+		return nil, err
+	}
+	if err := parsers.JsonInterface(metadata.Data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *httpV2Backend) listPage(ctx context.Context, opts *ListOptions, continueToken string) (*LoadBalanceList, error) {
+	cluster := opts.Cluster
+	if cluster == "" {
+		cluster = b.region
+	}
+
+	// the cluster is part of the path
+	query := opts.params()
+	delete(query, "cluster")
+	if continueToken != "" {
+		query["continue"] = continueToken
+	}
+	return b.get(ctx, &GetOrDeleteParams{URL: b.url(cluster, "addresses"), Route: b.route(routeAddresses), Params: query})
+}
+
+func (b *httpV2Backend) bindings(ctx context.Context) ([]LoadBalance, error) {
+	result, err := b.get(ctx, &GetOrDeleteParams{URL: b.url(b.region, "bindings"), Route: b.route(routeBindings)})
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+func (b *httpV2Backend) previous(ctx context.Context, name, namespace string) (string, error) {
+	var metadata *LoadBalanceMetadata
+	var result *LoadBalance
+
+	params := &GetOrDeleteParams{
+		URL:         b.url(b.region, "bindings", namespace, name, "previous"),
+		Route:       b.route(routePrevious),
+		Empowerment: &metadata,
+	}
+	if err := b.client.GET(ctx, params); err != nil {
+		return "", err
+	}
+	if err := checkEnvelope("GET", params.URL, metadata); err != nil {
+		return "", err
+	}
+	if err := parsers.JsonInterface(metadata.Data, &result); err != nil || result == nil {
+		return "", err
+	}
+	return result.Ip, nil
+}
+
+func (b *httpV2Backend) watch(ctx context.Context, resourceVersion string, fn func(event WatchEvent) error) error {
+	params := map[string]string{}
+	if resourceVersion != "" {
+		params["resourceVersion"] = resourceVersion
+	}
+	return streamWatch(ctx, b.client, &GetOrDeleteParams{URL: b.url(b.region, "watch"), Route: b.route(routeWatch), Params: params}, fn)
+}
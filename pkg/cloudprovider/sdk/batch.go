@@ -0,0 +1,121 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+)
+
+// MaxBatchItems is the largest batch accepted by the server, larger batches are split by the client
+const MaxBatchItems = 1000
+
+var ErrBatchNotConfigured = errors.New("batch endpoint not configured")
+
+// BatchItem identifies a service and, for bind, the ip it wants
+type BatchItem struct {
+	Ip          string
+	Namespace   string
+	ServiceName string
+}
+
+// BindBatch binds every item and returns one result per item in the same order,
+// the returned error is only set when a whole request failed
+func (c *LoadBalanceClient) BindBatch(ctx context.Context, items []BatchItem) ([]BatchItemResult, error) {
+	results, err := c.batch(ctx, c.LoadBalanceConfig.LoadBalanceSet.BindBatch, items)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		// the ip is either ours now or belongs to someone else, it is not free any more
+		if err := result.Err(); err == nil || errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+			c.serviceCache.delete(result.Ip)
+		}
+	}
+	return results, nil
+}
+
+// UnbindBatch releases the ips bound by every item, the ip of the items is ignored
+func (c *LoadBalanceClient) UnbindBatch(ctx context.Context, items []BatchItem) ([]BatchItemResult, error) {
+	return c.batch(ctx, c.LoadBalanceConfig.LoadBalanceSet.ReleasedBatch, items)
+}
+
+func (c *LoadBalanceClient) batch(ctx context.Context, url string, items []BatchItem) ([]BatchItemResult, error) {
+	if url == "" {
+		return nil, ErrBatchNotConfigured
+	}
+
+	results := make([]BatchItemResult, 0, len(items))
+	for start := 0; start < len(items); start += MaxBatchItems {
+		end := start + MaxBatchItems
+		if end > len(items) {
+			end = len(items)
+		}
+
+		req := &BatchRequest{Cluster: c.LoadBalanceConfig.Region}
+		for _, item := range items[start:end] {
+			req.Items = append(req.Items, LoadBalance{Ip: item.Ip, Namespace: item.Namespace, ServiceName: item.ServiceName})
+		}
+
+		var metadata *LoadBalanceMetadata
+		var result *BatchResult
+		body := &PostOrPutParams{
+			URL:         url,
+			Body:        req,
+			Empowerment: &metadata,
+			Idempotent:  true,
+		}
+		if err := c.httpClient.POST(ctx, body); err != nil {
+			return nil, err
+		}
+		if err := checkEnvelope("POST", url, metadata); err != nil {
+			return nil, err
+		}
+		if err := parsers.JsonInterface(metadata.Data, &result); err != nil {
+			return nil, err
+		}
+		if result == nil || len(result.Items) != end-start {
+			return nil, fmt.Errorf("POST %s: expected %d batch results", url, end-start)
+		}
+
+		for _, item := range result.Items {
+			item.method, item.url = "POST", url
+			results = append(results, item)
+		}
+	}
+	return results, nil
+}
+
+// Bindings returns every ip bound in the cluster of the client in a single call
+func (c *LoadBalanceClient) Bindings(ctx context.Context) ([]LoadBalance, error) {
+	if b, ok := c.backend.(*httpV2Backend); ok {
+		return b.bindings(ctx)
+	}
+
+	url := c.LoadBalanceConfig.LoadBalanceSet.Bindings
+	if url == "" {
+		return nil, ErrBatchNotConfigured
+	}
+
+	var metadata *LoadBalanceMetadata
+	var result *LoadBalanceList
+	params := &GetOrDeleteParams{
+		URL:         url,
+		Params:      map[string]string{"cluster": c.LoadBalanceConfig.Region},
+		Empowerment: &metadata,
+	}
+	if err := c.httpClient.GET(ctx, params); err != nil {
+		return nil, err
+	}
+	if err := checkEnvelope("GET", url, metadata); err != nil {
+		return nil, err
+	}
+	if err := parsers.JsonInterface(metadata.Data, &result); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	return result.Items, nil
+}
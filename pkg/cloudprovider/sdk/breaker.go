@@ -0,0 +1,199 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"k8s.io/klog/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type circuitOpenError struct {
+	retryAfter time.Duration
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrCircuitOpen.Error(), e.retryAfter.Round(time.Millisecond))
+}
+
+func (e *circuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreaker fails requests fast once the cloud provider manager looks
+// down. Transport errors and 5xx responses count as failures, FailureThreshold
+// consecutive failures open the breaker and after OpenTimeout a single probe is
+// let through: it closes the breaker on success and opens it again on failure.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	timeout   time.Duration
+	listeners []func(from, to BreakerState)
+}
+
+// NewCircuitBreaker returns nil when the breaker is disabled, a nil breaker allows every request
+func NewCircuitBreaker(cfg config.CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold < 0 {
+		return nil
+	}
+	return &CircuitBreaker{
+		threshold: intOrDefault(cfg.FailureThreshold, defaultFailureThreshold),
+		timeout:   durationOrDefault(cfg.OpenTimeout, defaultOpenTimeout),
+	}
+}
+
+// OnStateChange registers fn to be called after every transition, fn must not block
+func (b *CircuitBreaker) OnStateChange(fn func(from, to BreakerState)) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, fn)
+}
+
+// State is half-open once the open timeout elapsed, even before the probe is sent
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.timeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// RetryAfter is how long the breaker stays open, zero unless it is open
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerOpen {
+		return 0
+	}
+	if d := b.timeout - time.Since(b.openedAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if d := b.timeout - time.Since(b.openedAt); d > 0 {
+			return &circuitOpenError{retryAfter: d}
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return &circuitOpenError{retryAfter: b.timeout}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// done records the outcome of an allowed attempt, cancelled attempts say nothing about the server
+func (b *CircuitBreaker) done(failed, cancelled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == BreakerHalfOpen
+	if probe {
+		b.probing = false
+	}
+
+	switch {
+	case cancelled:
+	case !failed:
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+		}
+	case probe:
+		b.open()
+	default:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= b.threshold {
+			b.open()
+		}
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(BreakerOpen)
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	from := b.state
+	b.state = state
+	circuitBreakerState.Set(float64(state))
+	if from == state {
+		return
+	}
+
+	klog.V(2).Infof("cloud provider circuit breaker %s -> %s", from, state)
+	for _, fn := range b.listeners {
+		fn(from, state)
+	}
+}
+
+// Middleware fails attempts fast while the breaker is open, a nil breaker returns a no-op middleware
+func (b *CircuitBreaker) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if b == nil {
+			return next
+		}
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if err := b.allow(); err != nil {
+				return nil, err
+			}
+
+			resp, err := next.RoundTrip(req)
+			cancelled := err != nil && errors.Is(req.Context().Err(), context.Canceled)
+			b.done(err != nil || resp.StatusCode >= 500, cancelled)
+			return resp, err
+		})
+	}
+}
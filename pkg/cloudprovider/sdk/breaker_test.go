@@ -0,0 +1,168 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	// each step is one of: ok, fail, cancel, expire (the open timeout elapses),
+	// deny (allow must fail) and allow (allow must succeed without an outcome yet)
+	tests := []struct {
+		name        string
+		steps       []string
+		state       BreakerState
+		transitions []string
+	}{
+		{name: "failures below the threshold", steps: []string{"fail", "fail"}, state: BreakerClosed},
+		{name: "success resets the failures", steps: []string{"fail", "fail", "ok", "fail", "fail"}, state: BreakerClosed},
+		{name: "threshold opens", steps: []string{"fail", "fail", "fail", "deny"}, state: BreakerOpen, transitions: []string{"closed->open"}},
+		{name: "cancelled attempts do not count", steps: []string{"fail", "fail", "cancel", "cancel", "ok"}, state: BreakerClosed},
+		{
+			name:        "probe succeeds",
+			steps:       []string{"fail", "fail", "fail", "expire", "ok", "ok"},
+			state:       BreakerClosed,
+			transitions: []string{"closed->open", "open->half-open", "half-open->closed"},
+		},
+		{
+			name:        "probe fails",
+			steps:       []string{"fail", "fail", "fail", "expire", "fail", "deny"},
+			state:       BreakerOpen,
+			transitions: []string{"closed->open", "open->half-open", "half-open->open"},
+		},
+		{
+			name:        "single probe while half-open",
+			steps:       []string{"fail", "fail", "fail", "expire", "allow", "deny"},
+			state:       BreakerHalfOpen,
+			transitions: []string{"closed->open", "open->half-open"},
+		},
+		{
+			name:        "cancelled probe lets the next one through",
+			steps:       []string{"fail", "fail", "fail", "expire", "cancel", "ok"},
+			state:       BreakerClosed,
+			transitions: []string{"closed->open", "open->half-open", "half-open->closed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker(config.CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute})
+			var transitions []string
+			b.OnStateChange(func(from, to BreakerState) {
+				transitions = append(transitions, from.String()+"->"+to.String())
+			})
+
+			for i, step := range tt.steps {
+				switch step {
+				case "expire":
+					b.openedAt = time.Now().Add(-time.Minute)
+				case "deny":
+					if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+						t.Fatalf("step %d: allow = %v, expected ErrCircuitOpen", i, err)
+					}
+				case "allow":
+					if err := b.allow(); err != nil {
+						t.Fatalf("step %d: allow = %v", i, err)
+					}
+				default:
+					if err := b.allow(); err != nil {
+						t.Fatalf("step %d: allow = %v", i, err)
+					}
+					b.done(step == "fail", step == "cancel")
+				}
+			}
+
+			if state := b.State(); state != tt.state {
+				t.Errorf("state = %s, expected %s", state, tt.state)
+			}
+			if !reflect.DeepEqual(transitions, tt.transitions) {
+				t.Errorf("transitions = %v, expected %v", transitions, tt.transitions)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOpenState(t *testing.T) {
+	b := NewCircuitBreaker(config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	if b.RetryAfter() != 0 {
+		t.Fatalf("closed breaker reports retry after %s", b.RetryAfter())
+	}
+
+	b.allow()
+	b.done(true, false)
+	if d := b.RetryAfter(); d <= 50*time.Second || d > time.Minute {
+		t.Errorf("retry after %s, expected about a minute", d)
+	}
+
+	err := b.allow()
+	var openErr *circuitOpenError
+	if !errors.As(err, &openErr) || !strings.Contains(err.Error(), "retry in") {
+		t.Errorf("allow = %v, expected a circuit open error with the remaining time", err)
+	}
+	if IsRetryable(err) {
+		t.Error("a circuit open error must not be retried by the http client")
+	}
+
+	// the state is reported half-open as soon as the timeout elapsed
+	b.openedAt = time.Now().Add(-time.Minute)
+	if b.State() != BreakerHalfOpen || b.RetryAfter() != 0 {
+		t.Errorf("state %s, retry after %s, expected half-open and 0", b.State(), b.RetryAfter())
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := NewCircuitBreaker(config.CircuitBreakerConfig{FailureThreshold: -1})
+	if b != nil {
+		t.Fatal("a negative threshold must disable the breaker")
+	}
+	if b.State() != BreakerClosed || b.RetryAfter() != 0 {
+		t.Error("a nil breaker must look closed")
+	}
+	b.OnStateChange(func(from, to BreakerState) {})
+
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+	rt := Chain(transport, b.Middleware())
+	for i := 0; i < 10; i++ {
+		if _, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://manager/", nil)); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+}
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	status := http.StatusInternalServerError
+	calls := 0
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	b := NewCircuitBreaker(config.CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	client := NewHTTPClient(transport, time.Second, config.LoadBalanceRetryConfig{MaxRetries: 5, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, b.Middleware())
+
+	// two 5xx open the breaker, the retries after it fail fast without reaching the transport
+	err := client.GET(context.Background(), &GetOrDeleteParams{URL: "http://manager/list"})
+	if !errors.Is(err, ErrCircuitOpen) || calls != 2 {
+		t.Fatalf("err = %v after %d calls, expected ErrCircuitOpen after 2", err, calls)
+	}
+
+	// 4xx responses are answers of a healthy server
+	b.openedAt = time.Now().Add(-time.Minute)
+	status = http.StatusNotFound
+	if err = client.GET(context.Background(), &GetOrDeleteParams{URL: "http://manager/list"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, expected ErrNotFound", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Errorf("state = %s, expected closed after a 404 probe", b.State())
+	}
+}
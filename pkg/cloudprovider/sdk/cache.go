@@ -0,0 +1,117 @@
+package sdk
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheResyncPeriod = time.Minute
+	defaultCacheTTL          = 5 * time.Minute
+)
+
+// serviceCache is a periodically resynced view of the free ips of the cluster.
+// It only supplies bind candidates while the cloud provider list api is
+// failing, an ip taken from it is never used before the server accepted the bind.
+type serviceCache struct {
+	mu             sync.RWMutex
+	loadBalanceMap map[string]*LoadBalance
+	syncedAt       time.Time
+	ttl            time.Duration
+}
+
+func newServiceCache(ttl time.Duration) *serviceCache {
+	return &serviceCache{
+		loadBalanceMap: make(map[string]*LoadBalance),
+		ttl:            ttl,
+	}
+}
+
+func (c *serviceCache) GetByKey(key string) *LoadBalance {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loadBalanceMap[key]
+}
+
+func (c *serviceCache) delete(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.loadBalanceMap, ip)
+	freeIPCacheSize.Set(float64(len(c.loadBalanceMap)))
+}
+
+// add records an ip that became free between two resyncs
+func (c *serviceCache) add(lb LoadBalance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadBalanceMap[lb.Ip] = &lb
+	freeIPCacheSize.Set(float64(len(c.loadBalanceMap)))
+}
+
+func (c *serviceCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.loadBalanceMap)
+}
+
+// replace swaps the content for a fresh list of free ips
+func (c *serviceCache) replace(items []LoadBalance) {
+	m := make(map[string]*LoadBalance, len(items))
+	for i := range items {
+		m[items[i].Ip] = &items[i]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadBalanceMap = m
+	c.syncedAt = time.Now()
+
+	freeIPCacheSize.Set(float64(len(m)))
+	freeIPCacheAge.Set(0)
+	freeIPCacheLastSync.Set(float64(c.syncedAt.Unix()))
+}
+
+// Age is the time since the last successful resync, zero if it never synced
+func (c *serviceCache) Age() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.syncedAt.IsZero() {
+		return 0
+	}
+	return time.Since(c.syncedAt)
+}
+
+// Stale reports whether the cache never synced or is older than its ttl
+func (c *serviceCache) Stale() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.syncedAt.IsZero() || time.Since(c.syncedAt) > c.ttl
+}
+
+// candidates returns up to n cached free ips, nothing once the cache is stale
+func (c *serviceCache) candidates(n int) []string {
+	if c.Stale() {
+		freeIPCacheLookups.WithLabelValues("stale").Inc()
+		return nil
+	}
+
+	c.mu.RLock()
+	result := make([]string, 0, len(c.loadBalanceMap))
+	for ip := range c.loadBalanceMap {
+		result = append(result, ip)
+	}
+	c.mu.RUnlock()
+
+	if len(result) == 0 {
+		freeIPCacheLookups.WithLabelValues("miss").Inc()
+		return nil
+	}
+	freeIPCacheLookups.WithLabelValues("hit").Inc()
+
+	sort.Strings(result)
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package sdk
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServiceCacheCandidates(t *testing.T) {
+	free := []LoadBalance{{Ip: "10.0.0.3"}, {Ip: "10.0.0.1"}, {Ip: "10.0.0.2"}}
+
+	tests := []struct {
+		name       string
+		prepare    func(c *serviceCache)
+		n          int
+		candidates []string
+	}{
+		{name: "never synced", prepare: func(c *serviceCache) {}, n: 5},
+		{name: "synced", prepare: func(c *serviceCache) { c.replace(free) }, n: 5, candidates: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{name: "at most n", prepare: func(c *serviceCache) { c.replace(free) }, n: 2, candidates: []string{"10.0.0.1", "10.0.0.2"}},
+		{name: "synced empty", prepare: func(c *serviceCache) { c.replace(nil) }, n: 5},
+		{
+			name: "stale",
+			prepare: func(c *serviceCache) {
+				c.replace(free)
+				c.syncedAt = time.Now().Add(-2 * time.Minute)
+			},
+			n: 5,
+		},
+		{
+			name: "deleted after the sync",
+			prepare: func(c *serviceCache) {
+				c.replace(free)
+				c.delete("10.0.0.1")
+			},
+			n:          5,
+			candidates: []string{"10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name: "freed after the sync",
+			prepare: func(c *serviceCache) {
+				c.replace(free)
+				c.add(LoadBalance{Ip: "10.0.0.0"})
+			},
+			n:          5,
+			candidates: []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name: "replace drops ips of the previous sync",
+			prepare: func(c *serviceCache) {
+				c.replace(free)
+				c.replace([]LoadBalance{{Ip: "10.0.0.9"}})
+			},
+			n:          5,
+			candidates: []string{"10.0.0.9"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newServiceCache(time.Minute)
+			tt.prepare(c)
+
+			if candidates := c.candidates(tt.n); !reflect.DeepEqual(candidates, tt.candidates) {
+				t.Errorf("candidates = %v, expected %v", candidates, tt.candidates)
+			}
+		})
+	}
+}
+
+func TestServiceCacheAge(t *testing.T) {
+	c := newServiceCache(time.Minute)
+	if c.Age() != 0 || !c.Stale() {
+		t.Fatalf("new cache: age %s, stale %v, expected 0 and stale", c.Age(), c.Stale())
+	}
+
+	c.replace([]LoadBalance{{Ip: "10.0.0.1"}})
+	if c.Stale() || c.Len() != 1 || c.GetByKey("10.0.0.1") == nil {
+		t.Fatalf("synced cache: stale %v, len %d", c.Stale(), c.Len())
+	}
+
+	c.syncedAt = time.Now().Add(-90 * time.Second)
+	if age := c.Age(); age < 90*time.Second || !c.Stale() {
+		t.Errorf("old cache: age %s, stale %v, expected 90s and stale", age, c.Stale())
+	}
+}
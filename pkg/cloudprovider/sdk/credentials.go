@@ -0,0 +1,49 @@
+package sdk
+
+import (
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"k8s.io/klog/v2"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenFileRefreshPeriod matches how often client-go re-reads a projected service account token
+const tokenFileRefreshPeriod = time.Minute
+
+type tokenSource struct {
+	token string
+	file  string
+
+	mu      sync.Mutex
+	expires time.Time
+}
+
+func newTokenSource(cfg config.LoadBalanceCredentialsConfig) *tokenSource {
+	return &tokenSource{token: cfg.Token, file: cfg.TokenFile}
+}
+
+func (t *tokenSource) Token() string {
+	if t.file == "" {
+		return t.token
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if time.Now().Before(t.expires) {
+		return t.token
+	}
+
+	data, err := os.ReadFile(t.file)
+	if err != nil {
+		// keep serving the last token we read, the file may be in the middle of a rotation
+		klog.Errorf("read token file %s error: %s", t.file, err.Error())
+		return t.token
+	}
+
+	t.token = strings.TrimSpace(string(data))
+	t.expires = time.Now().Add(tokenFileRefreshPeriod)
+	return t.token
+}
@@ -0,0 +1,130 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrPoolExhausted = errors.New("no available ip")
+	// ErrQuotaExceeded means the namespace or the cluster holds as many ips as its quota allows
+	ErrQuotaExceeded = errors.New("ip quota exceeded")
+	ErrUnauthorized  = errors.New("unauthorized")
+	// ErrInvalid is a request the server understood but refused for its values, v2 only
+	ErrInvalid = errors.New("invalid")
+	// ErrPreviousNotConfigured means sticky allocation needs loadbalance.previous with version v1
+	ErrPreviousNotConfigured = errors.New("loadbalance.previous is not configured")
+	// ErrGone means a watch resource version expired, list again and watch from the new version
+	ErrGone = errors.New("resource version expired")
+	// ErrCircuitOpen is returned without contacting the server while the circuit breaker is open
+	ErrCircuitOpen = errors.New("cloud provider circuit breaker open")
+	// ErrTransient marks errors worth retrying later, 5xx responses and connection failures
+	ErrTransient = errors.New("transient error")
+)
+
+// maxErrorBody bounds how much of a non json error page ends up in an error message
+const maxErrorBody = 256
+
+// APIError is returned for every response with a non 2xx http status or a non
+// 200 envelope code, match it with errors.Is against the Err* values above.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// Reason is the machine readable reason of the envelope, see the Reason* values
+	Reason  string
+	Message string
+}
+
+// the reasons of the response envelope, set on errors by servers that speak them
+const (
+	ReasonAlreadyBound  = "AlreadyBound"
+	ReasonPoolExhausted = "PoolExhausted"
+	ReasonQuarantined   = "Quarantined"
+	ReasonQuotaExceeded = "QuotaExceeded"
+	ReasonReserved      = "Reserved"
+	ReasonExpired       = "Expired"
+	ReasonInvalid       = "Invalid"
+)
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict && e.Reason != ReasonPoolExhausted && e.Reason != ReasonQuotaExceeded
+	case ErrPoolExhausted:
+		return e.Reason == ReasonPoolExhausted
+	case ErrQuotaExceeded:
+		return e.Reason == ReasonQuotaExceeded
+	case ErrInvalid:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	case ErrGone:
+		return e.StatusCode == http.StatusGone
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrTransient:
+		return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+func (e *transientError) Is(target error) bool {
+	return target == ErrTransient
+}
+
+// IsRetryable reports whether the same request may succeed later without any change
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrTransient)
+}
+
+func newAPIError(method, url string, statusCode int, body []byte) *APIError {
+	e := &APIError{Method: method, URL: url, StatusCode: statusCode}
+
+	var envelope LoadBalanceMetadata
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Message != "" {
+		e.Message, e.Reason = envelope.Message, envelope.Reason
+		return e
+	}
+
+	e.Message = strings.TrimSpace(string(body))
+	if len(e.Message) > maxErrorBody {
+		e.Message = e.Message[:maxErrorBody] + "..."
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(statusCode)
+	}
+	return e
+}
+
+// checkEnvelope turns a 200 response carrying an error code into an APIError
+func checkEnvelope(method, url string, result *LoadBalanceMetadata) error {
+	if result == nil {
+		return &APIError{Method: method, URL: url, StatusCode: http.StatusOK, Message: "empty response body"}
+	}
+	if result.Code != http.StatusOK {
+		return &APIError{Method: method, URL: url, StatusCode: int(result.Code), Reason: result.Reason, Message: result.Message}
+	}
+	return nil
+}
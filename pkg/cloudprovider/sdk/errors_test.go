@@ -0,0 +1,132 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	targets := []error{ErrNotFound, ErrConflict, ErrPoolExhausted, ErrQuotaExceeded, ErrInvalid, ErrGone, ErrUnauthorized, ErrTransient}
+
+	tests := []struct {
+		name    string
+		err     *APIError
+		matches []error
+	}{
+		{name: "404", err: &APIError{StatusCode: 404}, matches: []error{ErrNotFound}},
+		{name: "409", err: &APIError{StatusCode: 409}, matches: []error{ErrConflict}},
+		{name: "already bound", err: &APIError{StatusCode: 409, Reason: ReasonAlreadyBound}, matches: []error{ErrConflict}},
+		{name: "quarantined", err: &APIError{StatusCode: 409, Reason: ReasonQuarantined}, matches: []error{ErrConflict}},
+		{name: "pool exhausted", err: &APIError{StatusCode: 409, Reason: ReasonPoolExhausted}, matches: []error{ErrPoolExhausted}},
+		{name: "quota exceeded", err: &APIError{StatusCode: 409, Reason: ReasonQuotaExceeded}, matches: []error{ErrQuotaExceeded}},
+		{name: "422", err: &APIError{StatusCode: 422, Reason: ReasonInvalid}, matches: []error{ErrInvalid}},
+		{name: "410", err: &APIError{StatusCode: 410, Reason: ReasonExpired}, matches: []error{ErrGone}},
+		{name: "401", err: &APIError{StatusCode: 401}, matches: []error{ErrUnauthorized}},
+		{name: "403", err: &APIError{StatusCode: 403}, matches: []error{ErrUnauthorized}},
+		{name: "429", err: &APIError{StatusCode: 429}, matches: []error{ErrTransient}},
+		{name: "500", err: &APIError{StatusCode: 500}, matches: []error{ErrTransient}},
+		{name: "503", err: &APIError{StatusCode: 503}, matches: []error{ErrTransient}},
+		{name: "400", err: &APIError{StatusCode: 400}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// wrapped like the backends return them
+			err := fmt.Errorf("bind: %w", tt.err)
+			for _, target := range targets {
+				expected := false
+				for _, match := range tt.matches {
+					expected = expected || match == target
+				}
+				if errors.Is(err, target) != expected {
+					t.Errorf("errors.Is(%v, %v) = %v, expected %v", err, target, !expected, expected)
+				}
+			}
+			if IsRetryable(err) != errors.Is(err, ErrTransient) {
+				t.Errorf("IsRetryable disagrees with ErrTransient")
+			}
+		})
+	}
+}
+
+func TestNewAPIError(t *testing.T) {
+	long := strings.Repeat("x", maxErrorBody+10)
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+		reason  string
+	}{
+		{name: "envelope", status: 409, body: `{"code": 409, "message": "ip is bound", "reason": "AlreadyBound"}`, message: "ip is bound", reason: ReasonAlreadyBound},
+		{name: "envelope without reason", status: 404, body: `{"code": 404, "message": "not found"}`, message: "not found"},
+		{name: "plain text", status: 502, body: " bad gateway\n", message: "bad gateway"},
+		{name: "long page is cut", status: 500, body: long, message: long[:maxErrorBody] + "..."},
+		{name: "empty body", status: 503, message: http.StatusText(503)},
+		{name: "json without message", status: 500, body: `{"error": "boom"}`, message: `{"error": "boom"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newAPIError("POST", "/bind", tt.status, []byte(tt.body))
+			if err.StatusCode != tt.status || err.Message != tt.message || err.Reason != tt.reason {
+				t.Errorf("got %d %q %q, expected %d %q %q", err.StatusCode, err.Message, err.Reason, tt.status, tt.message, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCheckEnvelope(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *LoadBalanceMetadata
+		status int
+		err    error
+	}{
+		{name: "success", result: &LoadBalanceMetadata{Code: 200}},
+		{name: "empty body", status: 200},
+		{name: "error code in a 200 response", result: &LoadBalanceMetadata{Code: 404, Message: "not found"}, status: 404, err: ErrNotFound},
+		{name: "reason in a 200 response", result: &LoadBalanceMetadata{Code: 409, Reason: ReasonPoolExhausted}, status: 409, err: ErrPoolExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEnvelope("GET", "/list", tt.result)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("err = %v, expected an APIError with status %d", err, tt.status)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, expected %v", err, tt.err)
+			}
+			if IsRetryable(err) {
+				t.Errorf("err = %v is retryable", err)
+			}
+		})
+	}
+}
+
+func TestTransientError(t *testing.T) {
+	err := fmt.Errorf("list: %w", &transientError{err: context.DeadlineExceeded})
+	if !IsRetryable(err) {
+		t.Error("transient error is not retryable")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("transient error does not unwrap its cause")
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("transient error matches ErrNotFound")
+	}
+}
@@ -2,11 +2,20 @@ package sdk
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"io"
 	"io/ioutil"
 	"k8s.io/klog/v2"
+	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type GetOrDeleteParams struct {
@@ -14,6 +23,11 @@ type GetOrDeleteParams struct {
 	Headers     map[string]string
 	Params      map[string]string
 	Empowerment interface{}
+	// Timeout overrides the client timeout of every attempt
+	Timeout time.Duration
+	// Route is the path template of URL, such as /clusters/{cluster}/watch,
+	// reported as the endpoint by MetricsMiddleware instead of the path
+	Route string
 }
 
 type PostOrPutParams struct {
@@ -21,18 +35,71 @@ type PostOrPutParams struct {
 	Headers     map[string]string
 	Body        interface{}
 	Empowerment interface{}
+	// Timeout overrides the client timeout of every attempt
+	Timeout time.Duration
+	// Idempotent requests are retried on connection errors and 5xx responses like GET/PUT/DELETE
+	Idempotent bool
+	// Route is the path template of URL reported as the endpoint by MetricsMiddleware
+	Route string
 }
 
 type HTTPClient struct {
-	req *http.Client
+	req     *http.Client
+	timeout time.Duration
+	retry   config.LoadBalanceRetryConfig
 }
 
-func NewTransPort() *http.Transport {
+type requestBuilder func(ctx context.Context) (*http.Request, error)
+
+const (
+	defaultMaxIdleConns          = 100
+	defaultMaxIdleConnsPerHost   = 32
+	defaultIdleConnTimeout       = 90 * time.Second
+	defaultDialTimeout           = 10 * time.Second
+	defaultKeepAlive             = 30 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = 30 * time.Second
+
+	defaultTimeout        = 10 * time.Second
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = 200 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+	// maxRetryAfter bounds how long a Retry-After header may hold a worker
+	maxRetryAfter = time.Minute
+)
+
+func intOrDefault(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+func durationOrDefault(v, def time.Duration) time.Duration {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+func NewTransPort(cfg config.LoadBalanceTransportConfig, tlsConfig *tls.Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   durationOrDefault(cfg.DialTimeout, defaultDialTimeout),
+		KeepAlive: durationOrDefault(cfg.KeepAlive, defaultKeepAlive),
+	}
+
 	return &http.Transport{
-		MaxIdleConns:       1024,
-		IdleConnTimeout:    120,
-		DisableCompression: true,
-		TLSClientConfig:    &tls.Config{InsecureSkipVerify: true},
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          intOrDefault(cfg.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost:   intOrDefault(cfg.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost),
+		IdleConnTimeout:       durationOrDefault(cfg.IdleConnTimeout, defaultIdleConnTimeout),
+		TLSHandshakeTimeout:   durationOrDefault(cfg.TLSHandshakeTimeout, defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: durationOrDefault(cfg.ResponseHeaderTimeout, defaultResponseHeaderTimeout),
+		ExpectContinueTimeout: time.Second,
+		DisableCompression:    true,
+		TLSClientConfig:       tlsConfig,
 	}
 }
 
@@ -60,33 +127,61 @@ func (r *HTTPClient) addParams(req *http.Request, params map[string]string) {
 	req.URL.RawQuery = q.Encode()
 }
 
-func (r *HTTPClient) jsonConversion(body interface{}) (*bytes.Buffer, error) {
-	jsonStdout, err := json.Marshal(body)
+func (r *HTTPClient) deleteOrGetMixin(url, method string, headers, params map[string]string) requestBuilder {
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		r.addHeaders(req, headers)
+		r.addParams(req, params)
+		return req, nil
+	}
+}
+
+func (r *HTTPClient) postOrPutMixin(url, method string, body interface{}, headers map[string]string) (requestBuilder, error) {
+	b, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
-	return bytes.NewBuffer(jsonStdout), nil
+
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		r.addHeaders(req, headers)
+		return req, nil
+	}, nil
 }
 
-func (r *HTTPClient) deleteOrGetMixin(url, method string, headers, params map[string]string) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, nil)
-	r.addHeaders(req, headers)
-	r.addParams(req, params)
-	return req, err
+type response struct {
+	statusCode int
+	retryAfter time.Duration
+	body       []byte
 }
 
-func (r *HTTPClient) postOrPutMixin(url, method string, body interface{}, headers map[string]string) (*http.Request, error) {
-	b, _ := r.jsonConversion(body)
-	req, err := http.NewRequest(method, url, b)
-	r.addHeaders(req, headers)
-	return req, err
+// setRequestID keeps an X-Request-ID given by the caller
+func setRequestID(req *http.Request, requestID string) {
+	if req.Header.Get(HeaderRequestID) == "" {
+		req.Header.Set(HeaderRequestID, requestID)
+	}
 }
 
-func (r *HTTPClient) do(obj *http.Request, dst interface{}) error {
-	resp, err := r.req.Do(obj)
+func (r *HTTPClient) attempt(ctx context.Context, build requestBuilder, requestID string, timeout time.Duration) (*response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
+	req, err := build(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	setRequestID(req, requestID)
+
+	resp, err := r.req.Do(req)
+	if err != nil {
+		return nil, err
 	}
 
 	defer resp.Body.Close()
@@ -95,36 +190,193 @@ func (r *HTTPClient) do(obj *http.Request, dst interface{}) error {
 
 	if err != nil {
 		klog.Errorf("[ http-request ] read resp body error: %s", err.Error())
-		return err
+		return nil, err
+	}
+
+	return &response{
+		statusCode: resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		body:       body,
+	}, nil
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = time.Until(t)
 	}
 
-	return r.parser(body, dst)
+	if d < 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
+
+// shouldRetry reports whether a failed attempt may be sent again. Requests that
+// are not idempotent are only repeated when the server explicitly asked for it.
+func (r *HTTPClient) shouldRetry(resp *response, err error, idempotent bool) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if err != nil {
+		return idempotent
+	}
+
+	switch {
+	case resp.statusCode == http.StatusTooManyRequests, resp.statusCode == http.StatusServiceUnavailable:
+		return idempotent || resp.retryAfter > 0
+	case resp.statusCode >= 500:
+		return idempotent
+	}
+	return false
+}
+
+// backoff doubles the initial backoff per attempt up to the max, half of it is jitter
+func (r *HTTPClient) backoff(attempt int) time.Duration {
+	d := r.retry.InitialBackoff
+	for i := 0; i < attempt && d < r.retry.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.retry.MaxBackoff {
+		d = r.retry.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (r *HTTPClient) do(ctx context.Context, method, url string, build requestBuilder, idempotent bool, timeout time.Duration, dst interface{}) error {
+	if timeout <= 0 {
+		timeout = r.timeout
+	}
+
+	// every attempt of a logical request carries the same id, so the server
+	// logs of a retried request can be correlated
+	requestID := newRequestID()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := r.attempt(ctx, build, requestID, timeout)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if attempt >= r.retry.MaxRetries || !r.shouldRetry(resp, err, idempotent) {
+			return r.result(method, url, resp, err, dst)
+		}
+
+		delay := r.backoff(attempt)
+		if resp != nil && resp.retryAfter > delay {
+			delay = resp.retryAfter
+		}
+
+		if err != nil {
+			klog.V(2).Infof("[ http-request ] %s %s request_id=%s attempt %d error: %s, retry in %s", method, url, requestID, attempt+1, err.Error(), delay)
+		} else {
+			klog.V(2).Infof("[ http-request ] %s %s request_id=%s attempt %d status: %d, retry in %s", method, url, requestID, attempt+1, resp.statusCode, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *HTTPClient) result(method, url string, resp *response, err error, dst interface{}) error {
+	if err != nil {
+		return &transientError{err: err}
+	}
+
+	if resp.statusCode < 200 || resp.statusCode > 299 {
+		return newAPIError(method, url, resp.statusCode, resp.body)
+	}
+
+	if err = r.parser(resp.body, dst); err != nil {
+		return fmt.Errorf("%s %s: decode response: %w", method, url, err)
+	}
+	return nil
 }
 
 func (r *HTTPClient) parser(src []byte, dst interface{}) error {
 	return json.Unmarshal(src, &dst)
 }
 
-func (r *HTTPClient) GET(obj *GetOrDeleteParams) error {
-	req, _ := r.deleteOrGetMixin(obj.URL, "GET", obj.Headers, obj.Params)
-	return r.do(req, obj.Empowerment)
+func (r *HTTPClient) GET(ctx context.Context, obj *GetOrDeleteParams) error {
+	build := r.deleteOrGetMixin(obj.URL, "GET", obj.Headers, obj.Params)
+	return r.do(withRoute(ctx, obj.Route), "GET", obj.URL, build, true, obj.Timeout, obj.Empowerment)
+}
+
+func (r *HTTPClient) POST(ctx context.Context, obj *PostOrPutParams) error {
+	build, err := r.postOrPutMixin(obj.URL, "POST", obj.Body, obj.Headers)
+	if err != nil {
+		return err
+	}
+	return r.do(withRoute(ctx, obj.Route), "POST", obj.URL, build, obj.Idempotent, obj.Timeout, obj.Empowerment)
 }
 
-func (r *HTTPClient) POST(obj *PostOrPutParams) error {
-	req, _ := r.postOrPutMixin(obj.URL, "POST", obj.Body, obj.Headers)
-	return r.do(req, obj.Empowerment)
+func (r *HTTPClient) DELETE(ctx context.Context, obj *GetOrDeleteParams) error {
+	build := r.deleteOrGetMixin(obj.URL, "DELETE", obj.Headers, obj.Params)
+	return r.do(withRoute(ctx, obj.Route), "DELETE", obj.URL, build, true, obj.Timeout, obj.Empowerment)
 }
 
-func (r *HTTPClient) DELETE(obj *GetOrDeleteParams) error {
-	req, _ := r.deleteOrGetMixin(obj.URL, "DELETE", obj.Headers, obj.Params)
-	return r.do(req, obj.Empowerment)
+func (r *HTTPClient) PUT(ctx context.Context, obj *PostOrPutParams) error {
+	build, err := r.postOrPutMixin(obj.URL, "PUT", obj.Body, obj.Headers)
+	if err != nil {
+		return err
+	}
+	return r.do(withRoute(ctx, obj.Route), "PUT", obj.URL, build, true, obj.Timeout, obj.Empowerment)
 }
 
-func (r *HTTPClient) PUT(obj *PostOrPutParams) error {
-	req, _ := r.postOrPutMixin(obj.URL, "PUT", obj.Body, obj.Headers)
-	return r.do(req, obj.Empowerment)
+// Stream sends a single GET and returns the body of a 2xx response for the
+// caller to read and close, it is not retried and only bound by ctx
+func (r *HTTPClient) Stream(ctx context.Context, obj *GetOrDeleteParams) (io.ReadCloser, error) {
+	req, err := r.deleteOrGetMixin(obj.URL, "GET", obj.Headers, obj.Params)(withRoute(ctx, obj.Route))
+	if err != nil {
+		return nil, err
+	}
+	setRequestID(req, newRequestID())
+
+	resp, err := r.req.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &transientError{err: err}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody*4))
+		return nil, newAPIError("GET", obj.URL, resp.StatusCode, body)
+	}
+	return resp.Body, nil
 }
 
-func NewHTTPClient() *HTTPClient {
-	return &HTTPClient{req: &http.Client{Transport: NewTransPort()}}
+// NewHTTPClient sends every attempt through middlewares before transport, the
+// first middleware sees the request first
+func NewHTTPClient(transport http.RoundTripper, timeout time.Duration, retry config.LoadBalanceRetryConfig, middlewares ...Middleware) *HTTPClient {
+	switch {
+	case retry.MaxRetries == 0:
+		retry.MaxRetries = defaultMaxRetries
+	case retry.MaxRetries < 0:
+		retry.MaxRetries = 0
+	}
+	retry.InitialBackoff = durationOrDefault(retry.InitialBackoff, defaultInitialBackoff)
+	retry.MaxBackoff = durationOrDefault(retry.MaxBackoff, defaultMaxBackoff)
+
+	return &HTTPClient{
+		req:     &http.Client{Transport: Chain(transport, middlewares...)},
+		timeout: durationOrDefault(timeout, defaultTimeout),
+		retry:   retry,
+	}
 }
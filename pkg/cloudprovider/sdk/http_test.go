@@ -0,0 +1,221 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "empty"},
+		{name: "seconds", value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{name: "negative seconds", value: "-3"},
+		{name: "seconds above the bound", value: "3600", min: maxRetryAfter, max: maxRetryAfter},
+		{name: "http date", value: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), min: 8 * time.Second, max: 10 * time.Second},
+		{name: "http date in the past", value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+		{name: "http date above the bound", value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), min: maxRetryAfter, max: maxRetryAfter},
+		{name: "garbage", value: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := parseRetryAfter(tt.value); d < tt.min || d > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %s, expected between %s and %s", tt.value, d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	client := NewHTTPClient(http.DefaultTransport, 0, config.LoadBalanceRetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 0, max: 100 * time.Millisecond},
+		{attempt: 1, max: 200 * time.Millisecond},
+		{attempt: 2, max: 400 * time.Millisecond},
+		{attempt: 3, max: 800 * time.Millisecond},
+		{attempt: 4, max: time.Second},
+		{attempt: 40, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			// half of the backoff is jitter
+			for i := 0; i < 100; i++ {
+				if d := client.backoff(tt.attempt); d < tt.max/2 || d > tt.max {
+					t.Fatalf("backoff(%d) = %s, expected between %s and %s", tt.attempt, d, tt.max/2, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	client := NewHTTPClient(http.DefaultTransport, 0, config.LoadBalanceRetryConfig{})
+	errConnection := errors.New("connection refused")
+
+	tests := []struct {
+		name       string
+		resp       *response
+		err        error
+		idempotent bool
+		retry      bool
+	}{
+		{name: "connection error", err: errConnection, idempotent: true, retry: true},
+		{name: "connection error of a post", err: errConnection},
+		{name: "circuit open", err: ErrCircuitOpen, idempotent: true},
+		{name: "500", resp: &response{statusCode: 500}, idempotent: true, retry: true},
+		{name: "500 of a post", resp: &response{statusCode: 500}},
+		{name: "503 of a post", resp: &response{statusCode: 503}},
+		{name: "503 of a post with retry after", resp: &response{statusCode: 503, retryAfter: time.Second}, retry: true},
+		{name: "429 with retry after", resp: &response{statusCode: 429, retryAfter: time.Second}, retry: true},
+		{name: "429", resp: &response{statusCode: 429}, idempotent: true, retry: true},
+		{name: "409", resp: &response{statusCode: 409}, idempotent: true},
+		{name: "404", resp: &response{statusCode: 404}, idempotent: true},
+		{name: "200", resp: &response{statusCode: 200}, idempotent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if retry := client.shouldRetry(tt.resp, tt.err, tt.idempotent); retry != tt.retry {
+				t.Errorf("shouldRetry = %v, expected %v", retry, tt.retry)
+			}
+		})
+	}
+}
+
+// statusSequence answers with the statuses in turn and 200 after them
+type statusSequence struct {
+	statuses   []int
+	retryAfter string
+	attempts   int32
+}
+
+func (s *statusSequence) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	attempt := int(atomic.AddInt32(&s.attempts, 1)) - 1
+	if attempt < len(s.statuses) {
+		if s.retryAfter != "" {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		w.WriteHeader(s.statuses[attempt])
+		w.Write([]byte(`{"code": ` + strconv.Itoa(s.statuses[attempt]) + `, "message": "failed"}`))
+		return
+	}
+	w.Write([]byte(`{"code": 200, "message": "success"}`))
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	retry := config.LoadBalanceRetryConfig{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	tests := []struct {
+		name       string
+		method     string
+		idempotent bool
+		retry      config.LoadBalanceRetryConfig
+		statuses   []int
+		retryAfter string
+		attempts   int32
+		err        error
+		minElapsed time.Duration
+	}{
+		{name: "get succeeds after 5xx", method: "GET", statuses: []int{502, 500}, attempts: 3},
+		{name: "get gives up after max retries", method: "GET", statuses: []int{500, 500, 500, 500}, attempts: 3, err: ErrTransient},
+		{name: "get is not retried on 4xx", method: "GET", statuses: []int{404}, attempts: 1, err: ErrNotFound},
+		{name: "retries disabled", method: "GET", retry: config.LoadBalanceRetryConfig{MaxRetries: -1}, statuses: []int{500}, attempts: 1, err: ErrTransient},
+		{name: "put is idempotent", method: "PUT", statuses: []int{503}, attempts: 2},
+		{name: "delete is idempotent", method: "DELETE", statuses: []int{500}, attempts: 2},
+		{name: "post is not retried on 5xx", method: "POST", statuses: []int{500}, attempts: 1, err: ErrTransient},
+		{name: "idempotent post is retried", method: "POST", idempotent: true, statuses: []int{500}, attempts: 2},
+		{name: "post is retried when asked to", method: "POST", statuses: []int{429}, retryAfter: "1", attempts: 2, minElapsed: time.Second},
+		{name: "retry after beats the backoff", method: "GET", statuses: []int{503}, retryAfter: "1", attempts: 2, minElapsed: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &statusSequence{statuses: tt.statuses, retryAfter: tt.retryAfter}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			cfg := retry
+			if tt.retry != (config.LoadBalanceRetryConfig{}) {
+				cfg = tt.retry
+			}
+			client := NewHTTPClient(http.DefaultTransport, time.Second, cfg)
+
+			var result LoadBalanceMetadata
+			start := time.Now()
+			var err error
+			switch tt.method {
+			case "GET":
+				err = client.GET(context.Background(), &GetOrDeleteParams{URL: server.URL, Empowerment: &result})
+			case "DELETE":
+				err = client.DELETE(context.Background(), &GetOrDeleteParams{URL: server.URL, Empowerment: &result})
+			case "PUT":
+				err = client.PUT(context.Background(), &PostOrPutParams{URL: server.URL, Body: map[string]string{}, Empowerment: &result})
+			case "POST":
+				err = client.POST(context.Background(), &PostOrPutParams{URL: server.URL, Body: map[string]string{}, Idempotent: tt.idempotent, Empowerment: &result})
+			}
+
+			if tt.err == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, expected %v", err, tt.err)
+			}
+			if attempts := atomic.LoadInt32(&handler.attempts); attempts != tt.attempts {
+				t.Errorf("attempts = %d, expected %d", attempts, tt.attempts)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("elapsed %s, expected at least %s", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestHTTPClientContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	t.Run("attempt timeout", func(t *testing.T) {
+		client := NewHTTPClient(http.DefaultTransport, 20*time.Millisecond, config.LoadBalanceRetryConfig{MaxRetries: -1})
+		err := client.GET(context.Background(), &GetOrDeleteParams{URL: server.URL})
+		if !errors.Is(err, ErrTransient) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, expected a transient deadline error", err)
+		}
+	})
+
+	t.Run("caller cancels while waiting to retry", func(t *testing.T) {
+		client := NewHTTPClient(http.DefaultTransport, 20*time.Millisecond, config.LoadBalanceRetryConfig{MaxRetries: 5, InitialBackoff: time.Minute, MaxBackoff: time.Minute})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := client.GET(ctx, &GetOrDeleteParams{URL: server.URL})
+		if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTransient) {
+			t.Errorf("err = %v, expected the context error", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("returned after %s, expected the context deadline", elapsed)
+		}
+	})
+}
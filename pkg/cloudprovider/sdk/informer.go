@@ -0,0 +1,225 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"k8s.io/klog/v2"
+	"sync"
+	"time"
+)
+
+const (
+	// watchIdleTimeout closes a watch that received neither events nor bookmarks
+	watchIdleTimeout = 2 * time.Minute
+
+	informerInitialBackoff = time.Second
+	informerMaxBackoff     = 30 * time.Second
+	informerListPageSize   = 1000
+)
+
+var ErrWatchNotConfigured = errors.New("watch endpoint not configured")
+
+// Watch streams the events of the cluster published after resourceVersion to fn,
+// it returns when the server ends the stream, ctx is cancelled or fn fails
+func (c *LoadBalanceClient) Watch(ctx context.Context, resourceVersion string, fn func(event WatchEvent) error) error {
+	return c.backend.watch(ctx, resourceVersion, fn)
+}
+
+// InformerHandler is called for every change of an ip, old is the previous
+// state held by the informer and nil when the ip was unknown
+type InformerHandler func(event WatchEvent, old *LoadBalance)
+
+// LoadBalanceInformer keeps every ip of the cluster current by listing once and
+// then watching. The free ip cache of the client follows the same events, so
+// allocation candidates stay fresh between resyncs.
+type LoadBalanceInformer struct {
+	client *LoadBalanceClient
+
+	mu              sync.RWMutex
+	items           map[string]LoadBalance
+	resourceVersion string
+	synced          bool
+	handlers        []InformerHandler
+}
+
+func NewLoadBalanceInformer(client *LoadBalanceClient) *LoadBalanceInformer {
+	return &LoadBalanceInformer{client: client, items: map[string]LoadBalance{}}
+}
+
+// AddEventHandler must be called before Run
+func (i *LoadBalanceInformer) AddEventHandler(handler InformerHandler) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.handlers = append(i.handlers, handler)
+}
+
+func (i *LoadBalanceInformer) HasSynced() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.synced
+}
+
+func (i *LoadBalanceInformer) Get(ip string) (LoadBalance, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	lb, ok := i.items[ip]
+	return lb, ok
+}
+
+// FreeCount is the number of available ips of the cluster
+func (i *LoadBalanceInformer) FreeCount() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	count := 0
+	for _, lb := range i.items {
+		if lb.Status == StatusAvailable {
+			count++
+		}
+	}
+	return count
+}
+
+// Run lists and watches until ctx is cancelled, an expired resource version lists again
+func (i *LoadBalanceInformer) Run(ctx context.Context) {
+	backoff := informerInitialBackoff
+	for {
+		err := i.listAndWatch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrGone):
+			klog.V(2).Infof("loadbalance watch expired, listing again: %s", err.Error())
+			i.mu.Lock()
+			i.resourceVersion = ""
+			i.mu.Unlock()
+			continue
+		case err == nil:
+			// the server closed the stream, continue from the last version
+			backoff = informerInitialBackoff
+			continue
+		case errors.Is(err, ErrCircuitOpen):
+			klog.V(4).Infof("loadbalance watch paused: %s", err.Error())
+		default:
+			klog.Errorf("loadbalance watch error, retry in %s: %s", backoff, err.Error())
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > informerMaxBackoff {
+			backoff = informerMaxBackoff
+		}
+	}
+}
+
+func (i *LoadBalanceInformer) listAndWatch(ctx context.Context) error {
+	i.mu.RLock()
+	resourceVersion := i.resourceVersion
+	i.mu.RUnlock()
+
+	if resourceVersion == "" {
+		if err := i.list(ctx); err != nil {
+			return err
+		}
+		i.mu.RLock()
+		resourceVersion = i.resourceVersion
+		i.mu.RUnlock()
+	}
+
+	return i.client.Watch(ctx, resourceVersion, func(event WatchEvent) error {
+		i.apply(event)
+		return nil
+	})
+}
+
+// list replaces the content, after the first sync every difference is handed to the handlers
+func (i *LoadBalanceInformer) list(ctx context.Context) error {
+	opts := &ListOptions{Cluster: i.client.LoadBalanceConfig.Region, Limit: informerListPageSize}
+
+	var resourceVersion, token string
+	items := map[string]LoadBalance{}
+	for {
+		page, err := i.client.ListPage(ctx, opts, token)
+		if err != nil {
+			return err
+		}
+		if token == "" {
+			resourceVersion = page.ResourceVersion
+		}
+		for _, item := range page.Items {
+			items[item.Ip] = item
+		}
+		if page.Continue == "" {
+			break
+		}
+		token = page.Continue
+	}
+
+	i.mu.Lock()
+	old, synced := i.items, i.synced
+	i.items, i.resourceVersion, i.synced = items, resourceVersion, true
+	handlers := i.handlers
+	i.mu.Unlock()
+
+	klog.V(2).Infof("loadbalance informer listed %d ips at resource version %s", len(items), resourceVersion)
+	if !synced {
+		return nil
+	}
+
+	for ip, item := range items {
+		if prev, ok := old[ip]; !ok {
+			i.notify(handlers, WatchEvent{Type: WatchAdded, ResourceVersion: resourceVersion, Object: item}, nil)
+		} else if prev != item {
+			i.notify(handlers, WatchEvent{Type: WatchModified, ResourceVersion: resourceVersion, Object: item}, &prev)
+		}
+	}
+	for ip, prev := range old {
+		if _, ok := items[ip]; !ok {
+			prev := prev
+			i.notify(handlers, WatchEvent{Type: WatchDeleted, ResourceVersion: resourceVersion, Object: prev}, &prev)
+		}
+	}
+	return nil
+}
+
+func (i *LoadBalanceInformer) apply(event WatchEvent) {
+	i.mu.Lock()
+	i.resourceVersion = event.ResourceVersion
+	if event.Type == WatchBookmark {
+		i.mu.Unlock()
+		return
+	}
+
+	ip := event.Object.Ip
+	var old *LoadBalance
+	if prev, ok := i.items[ip]; ok {
+		old = &prev
+	}
+	if event.Type == WatchDeleted {
+		delete(i.items, ip)
+	} else {
+		i.items[ip] = event.Object
+	}
+	handlers := i.handlers
+	i.mu.Unlock()
+
+	i.notify(handlers, event, old)
+}
+
+func (i *LoadBalanceInformer) notify(handlers []InformerHandler, event WatchEvent, old *LoadBalance) {
+	if event.Type != WatchDeleted && event.Object.Status == StatusAvailable {
+		i.client.serviceCache.add(event.Object)
+	} else {
+		i.client.serviceCache.delete(event.Object.Ip)
+	}
+
+	for _, handler := range handlers {
+		handler(event, old)
+	}
+}
@@ -0,0 +1,226 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStreamWatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		events []WatchEventType
+		err    error
+	}{
+		{
+			name:   "stream ends",
+			status: http.StatusOK,
+			body:   `{"type":"ADDED","resourceVersion":"2","object":{"ip":"10.0.0.1"}}` + "\n" + `{"type":"BOOKMARK","resourceVersion":"3"}` + "\n",
+			events: []WatchEventType{WatchAdded, WatchBookmark},
+		},
+		{name: "expired", status: http.StatusGone, body: `{"code":410,"message":"too old","reason":"Expired"}`, err: ErrGone},
+		{
+			name:   "truncated event",
+			status: http.StatusOK,
+			body:   `{"type":"ADDED","resourceVersion":"2","object":{"ip":"10.0.0.1"}}` + "\n" + `{"type":"MODI`,
+			events: []WatchEventType{WatchAdded},
+			err:    ErrTransient,
+		},
+		{
+			name:   "handler fails",
+			status: http.StatusOK,
+			body:   `{"type":"ADDED","resourceVersion":"2"}` + "\n" + `{"type":"DELETED","resourceVersion":"3"}` + "\n" + `{"type":"ADDED","resourceVersion":"4"}` + "\n",
+			events: []WatchEventType{WatchAdded, WatchDeleted},
+			err:    errStop,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("resourceVersion") != "1" {
+					t.Errorf("resourceVersion = %q, expected 1", r.URL.Query().Get("resourceVersion"))
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			b := &httpBackend{
+				set:    &config.LoadBalanceSetConfig{Watch: server.URL},
+				region: "c1",
+				client: NewHTTPClient(http.DefaultTransport, time.Second, config.LoadBalanceRetryConfig{}),
+			}
+
+			var events []WatchEventType
+			err := b.watch(context.Background(), "1", func(event WatchEvent) error {
+				events = append(events, event.Type)
+				if event.Type == WatchDeleted {
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, expected %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("events = %v, expected %v", events, tt.events)
+			}
+		})
+	}
+}
+
+var errStop = errors.New("stop")
+
+// scriptedBackend serves pages for list and replays one script per watch call
+type scriptedBackend struct {
+	backend
+
+	mu      sync.Mutex
+	pages   [][]LoadBalance
+	rvs     []string
+	watches []watchScript
+	watched []string
+	done    chan struct{}
+}
+
+type watchScript struct {
+	events []WatchEvent
+	err    error
+}
+
+func (b *scriptedBackend) listPage(ctx context.Context, opts *ListOptions, continueToken string) (*LoadBalanceList, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if opts.Cluster != "c1" {
+		return nil, errors.New("listed another cluster")
+	}
+	// each list hands out the first remaining set of items over two pages
+	items := b.pages[0]
+	if continueToken == "" {
+		return &LoadBalanceList{Items: items[:1], Continue: "next", ResourceVersion: b.rvs[0]}, nil
+	}
+	b.pages, b.rvs = b.pages[1:], b.rvs[1:]
+	return &LoadBalanceList{Items: items[1:]}, nil
+}
+
+func (b *scriptedBackend) watch(ctx context.Context, resourceVersion string, fn func(event WatchEvent) error) error {
+	b.mu.Lock()
+	b.watched = append(b.watched, resourceVersion)
+	if len(b.watches) == 0 {
+		b.mu.Unlock()
+		close(b.done)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	script := b.watches[0]
+	b.watches = b.watches[1:]
+	b.mu.Unlock()
+
+	for _, event := range script.events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return script.err
+}
+
+func TestInformer(t *testing.T) {
+	ip := func(ip string, status int) LoadBalance {
+		return LoadBalance{Cluster: "c1", Ip: ip, Status: status}
+	}
+
+	backend := &scriptedBackend{
+		pages: [][]LoadBalance{
+			{ip("10.0.0.1", 0), ip("10.0.0.2", 1), ip("10.0.0.3", 0)},
+			// the list after the expiry misses the delete of .3 and the bind of .4
+			{ip("10.0.0.1", 0), ip("10.0.0.2", 0), ip("10.0.0.4", 1)},
+		},
+		rvs: []string{"10", "20"},
+		watches: []watchScript{
+			{events: []WatchEvent{
+				{Type: WatchAdded, ResourceVersion: "11", Object: ip("10.0.0.4", 0)},
+				{Type: WatchBookmark, ResourceVersion: "12"},
+			}},
+			{events: []WatchEvent{
+				{Type: WatchModified, ResourceVersion: "13", Object: ip("10.0.0.1", 1)},
+			}, err: &APIError{StatusCode: http.StatusGone}},
+		},
+		done: make(chan struct{}),
+	}
+	client := &LoadBalanceClient{
+		LoadBalanceConfig: &config.LoadBalanceConfig{Region: "c1"},
+		backend:           backend,
+		serviceCache:      newServiceCache(time.Minute),
+	}
+
+	informer := NewLoadBalanceInformer(client)
+	var got []string
+	informer.AddEventHandler(func(event WatchEvent, old *LoadBalance) {
+		change := fmt.Sprintf("%s %s %d", event.Type, event.Object.Ip, event.Object.Status)
+		if old != nil {
+			change += fmt.Sprintf(" from %d", old.Status)
+		}
+		got = append(got, change)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		informer.Run(ctx)
+		close(stopped)
+	}()
+	select {
+	case <-backend.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the informer did not reach the last watch")
+	}
+	cancel()
+	<-stopped
+
+	// the first list is not reported, events are and the relist reports every difference
+	expected := []string{
+		"ADDED 10.0.0.4 0",
+		"MODIFIED 10.0.0.1 1 from 0",
+		"MODIFIED 10.0.0.1 0 from 1",
+		"MODIFIED 10.0.0.2 0 from 1",
+		"MODIFIED 10.0.0.4 1 from 0",
+		"DELETED 10.0.0.3 0 from 0",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("changes = %v, expected %v", got, expected)
+	}
+	// the differences of a relist come in map order
+	sort.Strings(got[2:5])
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("changes = %v, expected %v", got, expected)
+	}
+
+	// the watches continue from the list, the bookmark and the relist
+	if expected := []string{"10", "12", "20"}; !reflect.DeepEqual(backend.watched, expected) {
+		t.Errorf("watched from %v, expected %v", backend.watched, expected)
+	}
+	if !informer.HasSynced() || informer.FreeCount() != 2 {
+		t.Errorf("synced %v with %d free ips, expected 2", informer.HasSynced(), informer.FreeCount())
+	}
+	if lb, ok := informer.Get("10.0.0.4"); !ok || lb.Status != 1 {
+		t.Errorf("10.0.0.4 = %+v, expected bound", lb)
+	}
+	if _, ok := informer.Get("10.0.0.3"); ok {
+		t.Error("10.0.0.3 is still held after the relist")
+	}
+	if client.serviceCache.GetByKey("10.0.0.2") == nil || client.serviceCache.GetByKey("10.0.0.4") != nil {
+		t.Error("the free ip cache does not follow the informer")
+	}
+}
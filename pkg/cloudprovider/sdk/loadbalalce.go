@@ -1,155 +1,318 @@
 package sdk
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
-	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/version"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
-	"sync"
+	"strconv"
+	"time"
 )
 
-type serviceCache struct {
-	mu             sync.RWMutex
-	loadBalanceMap map[string]*LoadBalance
-}
+// allocationCandidates is how many free ips one allocation fetches, so losing
+// a race to another binder falls through to the next ip instead of failing
+const allocationCandidates = 5
+
+const userAgentComponent = "loadbalance-controller"
 
 type LoadBalanceClient struct {
 	LoadBalanceConfig *config.LoadBalanceConfig
 	httpClient        *HTTPClient
+	backend           backend
 	serviceCache      *serviceCache
+	reservations      *reservations
+	tokenSource       *tokenSource
+	breaker           *CircuitBreaker
 }
 
-func (c *serviceCache) GetByKey(key string) *LoadBalance {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.loadBalanceMap[key]
+func (c *LoadBalanceClient) Bind(ctx context.Context, name, namespace, ip string) error {
+	key := namespace + "/" + name
+	if holder, ok := c.reservations.reserve(ip, key); !ok {
+		return &reservedError{ip: ip, holder: holder}
+	}
+	defer c.reservations.release(ip, key)
+
+	err := c.backend.bind(ctx, &LoadBalance{
+		Cluster:     c.LoadBalanceConfig.Region,
+		Ip:          ip,
+		Namespace:   namespace,
+		ServiceName: name,
+	})
+
+	// the ip is either ours now or belongs to someone else, it is not free any more
+	if err == nil || errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+		c.serviceCache.delete(ip)
+	}
+	return err
 }
 
-func (c *serviceCache) delete(ip string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	delete(c.loadBalanceMap, ip)
+func (c *LoadBalanceClient) Unbind(ctx context.Context, name, namespace string) error {
+	return c.backend.unbind(ctx, &LoadBalance{
+		Cluster:     c.LoadBalanceConfig.Region,
+		ServiceName: name,
+		Namespace:   namespace,
+	})
 }
 
-func (c *serviceCache) set(ip string, balance *LoadBalance) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.loadBalanceMap[ip] = balance
+func (c *LoadBalanceClient) availableOptions() *ListOptions {
+	return &ListOptions{Cluster: c.LoadBalanceConfig.Region, Status: "0"}
 }
 
-func (c *serviceCache) pop() (string, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var lastKey string
-	var ip string
-	for key, _ := range c.loadBalanceMap {
-		lastKey = key
-	}
-	if lastKey == "" {
-		return "", errors.New("no available ip by cache")
-	}
-	v := c.loadBalanceMap[lastKey]
-	ip = v.Ip
-	delete(c.loadBalanceMap, lastKey)
-	return ip, nil
+// AllocateOptions change where Allocate takes the ip from
+type AllocateOptions struct {
+	// Sticky tries the ip the service released last first
+	Sticky bool
+	// Reserved only takes ips reserved for the service or its namespace
+	Reserved bool
 }
 
-func (c *LoadBalanceClient) Bind(name, namespace, ip string) error {
-	var result *LoadBalanceMetadata
-	m := &LoadBalance{
-		Cluster:     c.LoadBalanceConfig.Region,
-		Ip:          ip,
-		Namespace:   namespace,
-		ServiceName: name,
+// Allocate binds a free ip of the cluster to the service and returns it. The
+// candidates come from the list api, or from the cache while the list api is
+// failing; an ip is only returned once the server accepted the bind.
+func (c *LoadBalanceClient) Allocate(ctx context.Context, name, namespace string, opts AllocateOptions) (string, error) {
+	if opts.Sticky {
+		if ip, ok := c.allocatePrevious(ctx, name, namespace); ok {
+			return ip, nil
+		}
 	}
-	body := &PostOrPutParams{
-		URL:         c.LoadBalanceConfig.LoadBalanceSet.Bind,
-		Body:        m,
-		Empowerment: &result,
+
+	var candidates []string
+	var err error
+	if opts.Reserved {
+		candidates, err = c.reservedCandidates(ctx, name, namespace)
+	} else {
+		candidates, err = c.candidates(ctx)
 	}
-	err := c.httpClient.POST(body)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if result.Code != 200 {
-		return errors.New(result.Message)
+
+	for _, ip := range candidates {
+		err = c.Bind(ctx, name, namespace, ip)
+		if err == nil {
+			return ip, nil
+		}
+		if !errors.Is(err, ErrConflict) && !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+		klog.V(2).Infof("ip %s not bound by service %s/%s, trying the next one: %s", ip, namespace, name, err.Error())
 	}
-	return nil
+	return "", fmt.Errorf("every candidate ip was taken before bind: %w", err)
 }
 
-func (c *LoadBalanceClient) Unbind(name, namespace string) error {
-	var result *LoadBalanceMetadata
-	m := &LoadBalance{
-		ServiceName: name,
-		Namespace:   namespace,
+// allocatePrevious binds the ip the service released last, any failure falls
+// back to a free ip since sticky is only a preference
+func (c *LoadBalanceClient) allocatePrevious(ctx context.Context, name, namespace string) (string, bool) {
+	ip, err := c.backend.previous(ctx, name, namespace)
+	if err == nil {
+		err = c.Bind(ctx, name, namespace, ip)
 	}
-	body := &PostOrPutParams{
-		URL:         c.LoadBalanceConfig.LoadBalanceSet.Released,
-		Body:        m,
-		Empowerment: &result,
+	switch {
+	case err == nil:
+		klog.V(2).Infof("ip %s bound again by service %s/%s", ip, namespace, name)
+		return ip, true
+	case errors.Is(err, ErrNotFound):
+	default:
+		klog.Warningf("previous ip of service %s/%s not bound, allocating a free one: %s", namespace, name, err.Error())
 	}
-	err := c.httpClient.POST(body)
+	return "", false
+}
+
+// reservedCandidates are never taken from the cache, it only holds available ips
+func (c *LoadBalanceClient) reservedCandidates(ctx context.Context, name, namespace string) ([]string, error) {
+	page, err := c.ListPage(ctx, &ListOptions{
+		Cluster:     c.LoadBalanceConfig.Region,
+		Status:      strconv.Itoa(StatusReserved),
+		ReservedFor: namespace + "/" + name,
+		Limit:       allocationCandidates,
+	}, "")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if result.Code != 200 {
-		return errors.New(result.Message)
+	if len(page.Items) == 0 {
+		return nil, fmt.Errorf("%w reserved for service %s/%s in cluster %s", ErrPoolExhausted, namespace, name, c.LoadBalanceConfig.Region)
 	}
-	return nil
+
+	result := make([]string, 0, len(page.Items))
+	for _, item := range page.Items {
+		result = append(result, item.Ip)
+	}
+	return result, nil
 }
 
-func (c *LoadBalanceClient) GetAvailableIp() (string, error) {
-	ipList, err := c.List()
-	if err == nil && len(*ipList) > 0 {
-		return (*ipList)[0].Ip, nil
+func (c *LoadBalanceClient) candidates(ctx context.Context) ([]string, error) {
+	opts := c.availableOptions()
+	opts.Limit = allocationCandidates
+
+	page, err := c.ListPage(ctx, opts, "")
+	if err == nil {
+		if len(page.Items) == 0 {
+			return nil, fmt.Errorf("%w in cluster %s", ErrPoolExhausted, c.LoadBalanceConfig.Region)
+		}
+		result := make([]string, 0, len(page.Items))
+		for _, item := range page.Items {
+			result = append(result, item.Ip)
+		}
+		return result, nil
 	}
 
-	if err == nil && len(*ipList) == 0 {
-		return "", errors.New("no available ip")
+	cached := c.serviceCache.candidates(allocationCandidates)
+	if len(cached) == 0 {
+		return nil, err
 	}
-	return c.serviceCache.pop()
+	klog.Warningf("list free ips fail, trying %d cached candidates, cache age %s: %s",
+		len(cached), c.serviceCache.Age().Round(time.Second), err.Error())
+	return cached, nil
 }
 
-func (c *LoadBalanceClient) List() (result *[]LoadBalance, err error) {
-	var metadata *LoadBalanceMetadata
-	params := &GetOrDeleteParams{
-		URL:         c.LoadBalanceConfig.LoadBalanceSet.List,
-		Params:      map[string]string{"status": "0"},
-		Empowerment: &metadata,
-	}
-	err = c.httpClient.GET(params)
-	if err != nil {
-		return nil, err
+// ListPage fetches a single page, continueToken is the value returned by the previous page
+func (c *LoadBalanceClient) ListPage(ctx context.Context, opts *ListOptions, continueToken string) (*LoadBalanceList, error) {
+	return c.backend.listPage(ctx, opts, continueToken)
+}
+
+// List walks every page matching opts
+func (c *LoadBalanceClient) List(ctx context.Context, opts *ListOptions) (*[]LoadBalance, error) {
+	var result []LoadBalance
+	var token string
+
+	for {
+		page, err := c.ListPage(ctx, opts, token)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, page.Items...)
+		if page.Continue == "" {
+			return &result, nil
+		}
+		token = page.Continue
 	}
+}
 
-	err = parsers.JsonInterface(metadata.Data, &result)
+func (c *LoadBalanceClient) resyncCache(ctx context.Context) error {
+	fullData, err := c.List(ctx, c.availableOptions())
 	if err != nil {
-		return nil, err
+		freeIPCacheAge.Set(c.serviceCache.Age().Seconds())
+		return err
 	}
-	return
+
+	c.serviceCache.replace(*fullData)
+	klog.V(4).Infof("resync free ip cache success, current cache count: %d", len(*fullData))
+	return nil
 }
 
-func (c *LoadBalanceClient) WaitForCacheSync() bool {
-	fullData, err := c.List()
-	if err != nil {
+func (c *LoadBalanceClient) WaitForCacheSync(ctx context.Context) bool {
+	if err := c.resyncCache(ctx); err != nil {
 		klog.Errorf("sync loadbalance ip list fulldata error: %s", err.Error())
 		return false
 	}
 
-	for _, data := range *fullData {
-		c.serviceCache.set(data.Ip, &data)
-	}
+	klog.Infof("sync full loadbalance success, current cache count: %d", c.serviceCache.Len())
+	return true
+}
 
-	klog.Infof("sync full loadbalance success, current cache count: %d", len(*fullData))
+// RunCacheResync refreshes the free ip cache every resync period until ctx is cancelled
+func (c *LoadBalanceClient) RunCacheResync(ctx context.Context) {
+	period := durationOrDefault(c.LoadBalanceConfig.Cache.ResyncPeriod, defaultCacheResyncPeriod)
+	wait.JitterUntilWithContext(ctx, func(ctx context.Context) {
+		err := c.resyncCache(ctx)
+		if errors.Is(err, ErrCircuitOpen) {
+			klog.V(4).Infof("skip free ip cache resync: %s", err.Error())
+			return
+		}
+		if err != nil {
+			klog.Errorf("resync free ip cache error, cache age %s: %s",
+				c.serviceCache.Age().Round(time.Second), err.Error())
+		}
+	}, period, 0.1, false)
+}
 
+// CacheStale reports whether the free ip cache missed its ttl
+func (c *LoadBalanceClient) CacheStale() bool {
+	return c.serviceCache.Stale()
+}
+
+// CanWatch reports whether Watch is available, the v1 api needs a watch url
+func (c *LoadBalanceClient) CanWatch() bool {
+	if b, ok := c.backend.(*httpBackend); ok {
+		return b.set.Watch != ""
+	}
 	return true
 }
 
-func NewLoadBalance(config *config.LoadBalanceConfig) *LoadBalanceClient {
+// Breaker is nil when the circuit breaker is disabled, its methods are nil safe
+func (c *LoadBalanceClient) Breaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// NewLoadBalance builds the client, middlewares run after the built-in headers
+// are set and before metrics and logging
+func NewLoadBalance(config *config.LoadBalanceConfig, middlewares ...Middleware) (*LoadBalanceClient, error) {
+	tlsConfig, err := newTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	RegisterMetrics()
+
+	tokens := newTokenSource(config.Credentials)
+
+	// outermost first, signing sees the final headers and logging sees every attempt as sent
+	chain := []Middleware{
+		UserAgentMiddleware(userAgentComponent, version.String(), config.Region),
+		BearerTokenMiddleware(tokens.Token),
+	}
+	// the grpc backend signs with the same signer, nil when signing is disabled
+	var signer *HMACSigner
+	if config.Signing.Enabled {
+		credentials, err := signature.LoadCredentials(config.Signing.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		signer = NewHMACSigner(credentials)
+		chain = append(chain, SigningMiddleware(signer))
+	}
+	chain = append(chain, middlewares...)
+
+	// attempts failed fast by the breaker never reach metrics and logging
+	breaker := NewCircuitBreaker(config.CircuitBreaker)
+	chain = append(chain, breaker.Middleware(), MetricsMiddleware(), LoggingMiddleware())
+
+	httpClient := NewHTTPClient(NewTransPort(config.Transport, tlsConfig), config.Timeout, config.Retry, chain...)
+
+	var b backend
+	switch config.Backend {
+	case "", BackendHTTP:
+		switch config.LoadBalanceSet.Version {
+		case "", APIVersionV1:
+			b = &httpBackend{set: &config.LoadBalanceSet, region: config.Region, client: httpClient}
+		case APIVersionV2:
+			if b, err = newHTTPV2Backend(config.LoadBalanceSet.Server, config.Region, httpClient); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown api version %q, expected %s or %s", config.LoadBalanceSet.Version, APIVersionV1, APIVersionV2)
+		}
+	case BackendGRPC:
+		if b, err = newGRPCBackend(config, tlsConfig, tokens, breaker, signer); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown backend %q, expected %s or %s", config.Backend, BackendHTTP, BackendGRPC)
+	}
+
 	c := &LoadBalanceClient{
 		LoadBalanceConfig: config,
-		httpClient:        NewHTTPClient(),
-		serviceCache:      &serviceCache{loadBalanceMap: make(map[string]*LoadBalance)},
+		httpClient:        httpClient,
+		backend:           b,
+		serviceCache:      newServiceCache(durationOrDefault(config.Cache.TTL, defaultCacheTTL)),
+		reservations:      newReservations(durationOrDefault(config.Cache.ReservationTTL, defaultReservationTTL)),
+		tokenSource:       tokens,
+		breaker:           breaker,
 	}
-	return c
+	return c, nil
 }
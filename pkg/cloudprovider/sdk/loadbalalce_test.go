@@ -0,0 +1,111 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// allocateBackend answers previous with a fixed result and fails binds of the ips in conflicts
+type allocateBackend struct {
+	backend
+
+	previousIp  string
+	previousErr error
+	free        []string
+	conflicts   map[string]bool
+	bound       []string
+}
+
+func (b *allocateBackend) previous(ctx context.Context, name, namespace string) (string, error) {
+	return b.previousIp, b.previousErr
+}
+
+func (b *allocateBackend) listPage(ctx context.Context, opts *ListOptions, continueToken string) (*LoadBalanceList, error) {
+	list := &LoadBalanceList{}
+	for _, ip := range b.free {
+		list.Items = append(list.Items, LoadBalance{Ip: ip})
+	}
+	return list, nil
+}
+
+func (b *allocateBackend) bind(ctx context.Context, m *LoadBalance) error {
+	b.bound = append(b.bound, m.Ip)
+	if b.conflicts[m.Ip] {
+		return &APIError{StatusCode: http.StatusConflict, Reason: ReasonAlreadyBound}
+	}
+	return nil
+}
+
+func TestAllocateSticky(t *testing.T) {
+	tests := []struct {
+		name        string
+		previousIp  string
+		previousErr error
+		conflicts   map[string]bool
+		ip          string
+		bound       []string
+	}{
+		{name: "previous ip", previousIp: "10.0.0.9", ip: "10.0.0.9", bound: []string{"10.0.0.9"}},
+		{name: "nothing released", previousErr: &APIError{StatusCode: http.StatusNotFound}, ip: "10.0.0.1", bound: []string{"10.0.0.1"}},
+		{
+			name:       "previous ip taken",
+			previousIp: "10.0.0.9",
+			conflicts:  map[string]bool{"10.0.0.9": true},
+			ip:         "10.0.0.1",
+			bound:      []string{"10.0.0.9", "10.0.0.1"},
+		},
+		{name: "previous not configured", previousErr: ErrPreviousNotConfigured, ip: "10.0.0.1", bound: []string{"10.0.0.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &allocateBackend{
+				previousIp:  tt.previousIp,
+				previousErr: tt.previousErr,
+				free:        []string{"10.0.0.1", "10.0.0.2"},
+				conflicts:   tt.conflicts,
+			}
+			client := &LoadBalanceClient{
+				LoadBalanceConfig: &config.LoadBalanceConfig{Region: "c1"},
+				backend:           backend,
+				serviceCache:      newServiceCache(time.Minute),
+				reservations:      newReservations(time.Minute),
+			}
+
+			ip, err := client.Allocate(context.Background(), "a", "ns", AllocateOptions{Sticky: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ip != tt.ip || !reflect.DeepEqual(backend.bound, tt.bound) {
+				t.Errorf("allocated %s after binding %v, expected %s after %v", ip, backend.bound, tt.ip, tt.bound)
+			}
+		})
+	}
+}
+
+func TestAllocateCandidatesTaken(t *testing.T) {
+	backend := &allocateBackend{
+		free:      []string{"10.0.0.1", "10.0.0.2"},
+		conflicts: map[string]bool{"10.0.0.1": true, "10.0.0.2": true},
+	}
+	client := &LoadBalanceClient{
+		LoadBalanceConfig: &config.LoadBalanceConfig{Region: "c1"},
+		backend:           backend,
+		serviceCache:      newServiceCache(time.Minute),
+		reservations:      newReservations(time.Minute),
+	}
+
+	// sticky is not asked for, previous is never consulted
+	backend.previousErr = errors.New("unexpected previous")
+	if _, err := client.Allocate(context.Background(), "a", "ns", AllocateOptions{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("err = %v, expected the conflict of the last candidate", err)
+	}
+	if len(backend.bound) != 2 {
+		t.Errorf("bound %v, expected every candidate tried", backend.bound)
+	}
+}
@@ -1,10 +1,26 @@
 package sdk
 
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
 type LoadBalanceMetadata struct {
 	Data    interface{} `json:"data"`
 	Code    int64       `json:"code"`
 	Message string      `json:"message"`
+	Reason  string      `json:"reason"`
 }
+
+// the values of LoadBalance.Status
+const (
+	StatusAvailable   = 0
+	StatusBound       = 1
+	StatusQuarantined = 2
+	StatusReserved    = 3
+)
+
 type LoadBalance struct {
 	Cluster     string `json:"cluster"`
 	Ip          string `json:"ip"`
@@ -13,4 +29,105 @@ type LoadBalance struct {
 	Cidr        string `json:"cidr"`
 	Namespace   string `json:"namespace"`
 	ServiceName string `json:"serviceName"`
+	// QuarantineUntil is set while Status is 2, the ip is not allocatable before it
+	QuarantineUntil *time.Time `json:"quarantineUntil,omitempty"`
+	// the reservation, only the service or any service of the namespace when
+	// ReservedServiceName is empty may bind the ip
+	ReservedNamespace   string `json:"reservedNamespace,omitempty"`
+	ReservedServiceName string `json:"reservedServiceName,omitempty"`
+}
+
+type LoadBalanceList struct {
+	Items    []LoadBalance `json:"items"`
+	Total    int64         `json:"total"`
+	Continue string        `json:"continue"`
+	// ResourceVersion of the first page is where a watch continues after listing every page
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type WatchEventType string
+
+const (
+	WatchAdded    WatchEventType = "ADDED"
+	WatchModified WatchEventType = "MODIFIED"
+	WatchDeleted  WatchEventType = "DELETED"
+	WatchBound    WatchEventType = "BOUND"
+	WatchReleased WatchEventType = "RELEASED"
+	WatchBookmark WatchEventType = "BOOKMARK"
+)
+
+type WatchEvent struct {
+	Type            WatchEventType `json:"type"`
+	ResourceVersion string         `json:"resourceVersion"`
+	Object          LoadBalance    `json:"object"`
+}
+
+type BatchRequest struct {
+	Cluster string        `json:"cluster"`
+	Items   []LoadBalance `json:"items"`
+}
+
+// BatchItemResult carries the http status the item would have got from the single item endpoint
+type BatchItemResult struct {
+	Ip          string `json:"ip"`
+	Namespace   string `json:"namespace"`
+	ServiceName string `json:"serviceName"`
+	Code        int    `json:"code"`
+	Reason      string `json:"reason"`
+	Message     string `json:"message"`
+
+	// the batch request, filled in by the client
+	method string
+	url    string
+}
+
+// Err returns nil on success, otherwise an APIError matching the Err* values like a single item call
+func (r *BatchItemResult) Err() error {
+	if r.Code == http.StatusOK {
+		return nil
+	}
+	return &APIError{Method: r.method, URL: r.url, StatusCode: r.Code, Reason: r.Reason, Message: r.Message}
+}
+
+type BatchResult struct {
+	Items []BatchItemResult `json:"items"`
+}
+
+// ListOptions are the filters accepted by the list api, empty fields are not sent
+type ListOptions struct {
+	Cluster   string
+	Status    string
+	Cidr      string
+	Carrier   string
+	Namespace string
+	Service   string
+	IpPrefix  string
+	Sort      string
+	Limit     int
+	// ReservedFor is namespace or namespace/name, the reserved ips they may bind
+	ReservedFor string
+}
+
+func (o *ListOptions) params() map[string]string {
+	params := map[string]string{}
+	fields := map[string]string{
+		"cluster":     o.Cluster,
+		"status":      o.Status,
+		"cidr":        o.Cidr,
+		"carrier":     o.Carrier,
+		"namespace":   o.Namespace,
+		"service":     o.Service,
+		"ip":          o.IpPrefix,
+		"sort":        o.Sort,
+		"reservedFor": o.ReservedFor,
+	}
+	for k, v := range fields {
+		if v != "" {
+			params[k] = v
+		}
+	}
+	if o.Limit > 0 {
+		params["limit"] = strconv.Itoa(o.Limit)
+	}
+	return params
 }
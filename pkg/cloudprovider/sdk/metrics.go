@@ -0,0 +1,67 @@
+package sdk
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"sync"
+)
+
+const metricsSubsystem = "loadbalance_sdk"
+
+var (
+	freeIPCacheSize = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "free_ip_cache_size",
+		Help:           "Number of free ips held in the fallback cache",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	freeIPCacheAge = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "free_ip_cache_age_seconds",
+		Help:           "Seconds since the fallback cache was last resynced, updated on every resync attempt",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	freeIPCacheLastSync = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "free_ip_cache_last_sync_timestamp_seconds",
+		Help:           "Unix time of the last successful resync of the fallback cache",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	freeIPCacheLookups = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "free_ip_cache_lookups_total",
+		Help:           "Fallback cache lookups made because listing free ips failed, by result: hit, miss or stale",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"result"})
+
+	circuitBreakerState = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "circuit_breaker_state",
+		Help:           "State of the cloud provider circuit breaker: 0 closed, 1 open, 2 half-open",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	requestLatency = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Subsystem:      metricsSubsystem,
+		Name:           "request_duration_seconds",
+		Help:           "Latency of every http attempt to the cloud provider manager, by method, endpoint and status code",
+		Buckets:        metrics.DefBuckets,
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"method", "endpoint", "code"})
+)
+
+var registerMetrics sync.Once
+
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(freeIPCacheSize)
+		legacyregistry.MustRegister(freeIPCacheAge)
+		legacyregistry.MustRegister(freeIPCacheLastSync)
+		legacyregistry.MustRegister(freeIPCacheLookups)
+		legacyregistry.MustRegister(requestLatency)
+		legacyregistry.MustRegister(circuitBreakerState)
+	})
+}
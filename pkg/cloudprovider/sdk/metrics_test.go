@@ -0,0 +1,101 @@
+package sdk
+
+import (
+	"context"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"k8s.io/component-base/metrics"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// endpoints returns the method and endpoint labels observed by the request latency histogram
+func endpoints(t *testing.T, registry metrics.KubeRegistry) []string {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			seen[labels["method"]+" "+labels["endpoint"]] = true
+		}
+	}
+
+	result := make([]string, 0, len(seen))
+	for endpoint := range seen {
+		result = append(result, endpoint)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestMetricsEndpointLabel(t *testing.T) {
+	registry := metrics.NewKubeRegistry()
+	registry.MustRegister(requestLatency)
+	requestLatency.Reset()
+	defer requestLatency.Reset()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/clusters/c1/watch" {
+			return
+		}
+		w.Write([]byte(`{"code": 200, "message": "success"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(http.DefaultTransport, time.Second, config.LoadBalanceRetryConfig{}, MetricsMiddleware())
+	b, err := newHTTPV2Backend(server.URL+"/api/v2/", "c1", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, name := range []string{"a", "b", "c"} {
+		m := &LoadBalance{Cluster: "c1", Ip: "10.0.0.1", Namespace: "ns-" + name, ServiceName: name}
+		if err = b.bind(ctx, m); err != nil {
+			t.Fatalf("bind: %v", err)
+		}
+		if err = b.unbind(ctx, m); err != nil {
+			t.Fatalf("unbind: %v", err)
+		}
+		if _, err = b.previous(ctx, name, "ns-"+name); err != nil {
+			t.Fatalf("previous: %v", err)
+		}
+	}
+	if _, err = b.listPage(ctx, &ListOptions{Cluster: "c2"}, ""); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if _, err = b.bindings(ctx); err != nil {
+		t.Fatalf("bindings: %v", err)
+	}
+	if err = b.watch(ctx, "", func(event WatchEvent) error { return nil }); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	// a v1 url configured without a template is reported by its path
+	if err = client.GET(ctx, &GetOrDeleteParams{URL: server.URL + "/api/v1/cloudprovider/loadbalance/list"}); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	expected := []string{
+		"DELETE /api/v2/clusters/{cluster}/bindings/{namespace}/{service}",
+		"GET /api/v1/cloudprovider/loadbalance/list",
+		"GET /api/v2/clusters/{cluster}/addresses",
+		"GET /api/v2/clusters/{cluster}/bindings",
+		"GET /api/v2/clusters/{cluster}/bindings/{namespace}/{service}/previous",
+		"GET /api/v2/clusters/{cluster}/watch",
+		"PUT /api/v2/clusters/{cluster}/bindings/{namespace}/{service}",
+	}
+	if got := endpoints(t, registry); !reflect.DeepEqual(got, expected) {
+		t.Errorf("endpoints = %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,266 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"k8s.io/klog/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderRequestID is set once per logical request by HTTPClient, retries reuse it
+	HeaderRequestID = "X-Request-ID"
+
+	// maxLoggedBody bounds the request and response bodies written to the log
+	maxLoggedBody = 2048
+	redacted      = "[REDACTED]"
+)
+
+// sensitiveHeaders and sensitiveFields are never written to the log in clear text
+var (
+	sensitiveHeaders = []string{"Authorization", "X-CloudProvider-Signature"}
+	sensitiveFields  = map[string]bool{
+		"password":        true,
+		"token":           true,
+		"secret":          true,
+		"secretaccesskey": true,
+		"authorization":   true,
+	}
+)
+
+// Middleware wraps the next round tripper of the chain
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps transport so that middlewares[0] is the outermost round tripper
+func Chain(transport http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+	return transport
+}
+
+// withHeader sets a header on a copy of req, round trippers must not modify their input
+func withHeader(req *http.Request, key, value string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set(key, value)
+	return req
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	// random uuid, version 4 variant 1
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// UserAgentMiddleware identifies the component, its version and the cluster region to the server
+func UserAgentMiddleware(component, version, region string) Middleware {
+	userAgent := fmt.Sprintf("%s/%s (region=%s)", component, version, region)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return next.RoundTrip(withHeader(req, "User-Agent", userAgent))
+		})
+	}
+}
+
+// BearerTokenMiddleware sets the Authorization header from token, empty tokens are not sent
+func BearerTokenMiddleware(token func() string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if t := token(); t != "" {
+				req = withHeader(req, "Authorization", "Bearer "+t)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+type routeContextKey struct{}
+
+// withRoute hands the path template of a request to MetricsMiddleware
+func withRoute(ctx context.Context, route string) context.Context {
+	if route == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+// MetricsMiddleware observes the latency of every attempt by method, endpoint
+// and status code. The endpoint is the route template of the request so the
+// names in the path do not grow the label values, or the path without one.
+func MetricsMiddleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			code := "error"
+			if err == nil {
+				code = strconv.Itoa(resp.StatusCode)
+			}
+			endpoint := req.URL.Path
+			if route, ok := req.Context().Value(routeContextKey{}).(string); ok {
+				endpoint = route
+			}
+			requestLatency.WithLabelValues(req.Method, endpoint, code).Observe(time.Since(start).Seconds())
+			return resp, err
+		})
+	}
+}
+
+// LoggingMiddleware logs every attempt at level 4 and the redacted bodies at level 6
+func LoggingMiddleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !klog.V(4).Enabled() {
+				return next.RoundTrip(req)
+			}
+
+			requestID := req.Header.Get(HeaderRequestID)
+			if klog.V(6).Enabled() {
+				klog.Infof("[ http-request ] %s %s request_id=%s headers=%v body=%s",
+					req.Method, req.URL.String(), requestID, redactHeaders(req.Header), requestBody(req))
+			}
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			latency := time.Since(start)
+
+			if err != nil {
+				klog.Infof("[ http-request ] %s %s request_id=%s latency=%s error=%s",
+					req.Method, req.URL.String(), requestID, latency, err.Error())
+				return resp, err
+			}
+
+			klog.Infof("[ http-request ] %s %s request_id=%s status=%d latency=%s",
+				req.Method, req.URL.String(), requestID, resp.StatusCode, latency)
+
+			if klog.V(6).Enabled() {
+				// the body is logged as the caller reads it, so a watch stream is not held back
+				prefix := fmt.Sprintf("[ http-request ] %s %s request_id=%s", req.Method, req.URL.String(), requestID)
+				resp.Body = &loggedBody{ReadCloser: resp.Body, prefix: prefix}
+			}
+			return resp, nil
+		})
+	}
+}
+
+// loggedBody keeps the first maxLoggedBody bytes read from a response body and
+// logs them once, when they are complete, at EOF or on close
+type loggedBody struct {
+	io.ReadCloser
+	prefix string
+	buf    bytes.Buffer
+	logged bool
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := maxLoggedBody - b.buf.Len(); room > 0 {
+		if n < room {
+			room = n
+		}
+		b.buf.Write(p[:room])
+	}
+	if err != nil || b.buf.Len() >= maxLoggedBody {
+		b.log()
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	b.log()
+	return b.ReadCloser.Close()
+}
+
+func (b *loggedBody) log() {
+	if b.logged {
+		return
+	}
+	b.logged = true
+	klog.Infof("%s response=%s", b.prefix, redactBody(b.buf.Bytes()))
+}
+
+func redactHeaders(header http.Header) http.Header {
+	result := header.Clone()
+	for _, key := range sensitiveHeaders {
+		if result.Get(key) != "" {
+			result.Set(key, redacted)
+		}
+	}
+	return result
+}
+
+func requestBody(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+
+	body, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return ""
+	}
+	return redactBody(body)
+}
+
+// redactBody hides sensitive json fields, bodies that are not json are only logged by length
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	b, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+	if len(b) > maxLoggedBody {
+		return string(b[:maxLoggedBody]) + "..."
+	}
+	return string(b)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if sensitiveFields[strings.ToLower(k)] {
+				value[k] = redacted
+			} else {
+				value[k] = redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,261 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"io"
+	"k8s.io/klog/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	record := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "transport")
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://manager/", nil)
+	if _, err := Chain(transport, record("first"), record("second")).RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, ","); got != "first,second,transport" {
+		t.Errorf("order = %s, expected first,second,transport", got)
+	}
+}
+
+func TestHeaderMiddlewares(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware Middleware
+		header     string
+		value      string
+	}{
+		{name: "user agent", middleware: UserAgentMiddleware("loadbalance-controller", "v1.2.3", "c1"), header: "User-Agent", value: "loadbalance-controller/v1.2.3 (region=c1)"},
+		{name: "bearer token", middleware: BearerTokenMiddleware(func() string { return "t1" }), header: "Authorization", value: "Bearer t1"},
+		{name: "empty bearer token", middleware: BearerTokenMiddleware(func() string { return "" }), header: "Authorization"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen http.Header
+			transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				seen = req.Header
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "http://manager/", nil)
+			if _, err := Chain(transport, tt.middleware).RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			if got := seen.Get(tt.header); got != tt.value {
+				t.Errorf("%s = %q, expected %q", tt.header, got, tt.value)
+			}
+			if len(req.Header) != 0 {
+				t.Errorf("the middleware modified its input: %v", req.Header)
+			}
+		})
+	}
+}
+
+func TestRequestIDPerLogicalRequest(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get(HeaderRequestID))
+		attempt := len(ids)
+		mu.Unlock()
+
+		if attempt%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"code": 200, "message": "success"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(http.DefaultTransport, time.Second,
+		config.LoadBalanceRetryConfig{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	for i := 0; i < 2; i++ {
+		if err := client.GET(context.Background(), &GetOrDeleteParams{URL: server.URL}); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := client.GET(context.Background(), &GetOrDeleteParams{URL: server.URL, Headers: map[string]string{HeaderRequestID: "from-caller"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ids) != 9 {
+		t.Fatalf("attempts = %d, expected 9", len(ids))
+	}
+	for i := 0; i < 9; i += 3 {
+		if ids[i] == "" || ids[i] != ids[i+1] || ids[i] != ids[i+2] {
+			t.Errorf("retries of request %d carry ids %v, expected one id", i/3, ids[i:i+3])
+		}
+	}
+	if ids[0] == ids[3] {
+		t.Errorf("two requests share the id %s", ids[0])
+	}
+	if ids[6] != "from-caller" {
+		t.Errorf("id = %s, expected the id given by the caller", ids[6])
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		out  string
+	}{
+		{name: "empty"},
+		{name: "plain", body: `{"ip":"10.0.0.1"}`, out: `{"ip":"10.0.0.1"}`},
+		{name: "sensitive fields", body: `{"Token":"t","nested":{"secretAccessKey":"s"},"items":[{"password":"p"}]}`, out: `{"Token":"[REDACTED]","items":[{"password":"[REDACTED]"}],"nested":{"secretAccessKey":"[REDACTED]"}}`},
+		{name: "not json", body: "<html>", out: "<6 bytes>"},
+		{name: "long", body: `{"data":"` + strings.Repeat("x", maxLoggedBody) + `"}`, out: `{"data":"` + strings.Repeat("x", maxLoggedBody-9) + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := redactBody([]byte(tt.body)); out != tt.out {
+				t.Errorf("redactBody = %s, expected %s", out, tt.out)
+			}
+		})
+	}
+}
+
+// setVerbosity raises the klog verbosity and captures its output for the test
+func setVerbosity(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	if err := flags.Set("v", level); err != nil {
+		t.Fatal(err)
+	}
+	flags.Set("logtostderr", "false")
+	flags.Set("alsologtostderr", "false")
+
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	klog.SetOutput(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(p)
+	}))
+	t.Cleanup(func() {
+		flags.Set("v", "0")
+		flags.Set("logtostderr", "true")
+		klog.SetOutput(io.Discard)
+	})
+	return &buf
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestLoggingMiddlewareStream(t *testing.T) {
+	logs := setVerbosity(t, "6")
+
+	events := make(chan string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for event := range events {
+			w.Write([]byte(event + "\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+	defer close(events)
+
+	client := NewHTTPClient(http.DefaultTransport, time.Second, config.LoadBalanceRetryConfig{}, LoggingMiddleware())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the stream must be handed over while the server keeps it open
+	body, err := client.Stream(ctx, &GetOrDeleteParams{URL: server.URL})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	events <- `{"type":"ADDED","object":{"token":"t"}}`
+	line := make([]byte, 64)
+	n, err := body.Read(line)
+	if err != nil || !strings.Contains(string(line[:n]), "ADDED") {
+		t.Fatalf("read event: %q, %v", line[:n], err)
+	}
+	body.Close()
+
+	klog.Flush()
+	if !strings.Contains(logs.String(), `response={"object":{"token":"[REDACTED]"},"type":"ADDED"}`) {
+		t.Errorf("expected the event read before close to be logged, got %s", logs.String())
+	}
+	if strings.Contains(logs.String(), `"token":"t"`) {
+		t.Errorf("the log contains a sensitive field: %s", logs.String())
+	}
+}
+
+func TestLoggedBody(t *testing.T) {
+	logs := setVerbosity(t, "6")
+
+	tests := []struct {
+		name string
+		body string
+		read int
+		out  string
+	}{
+		{name: "read to the end", body: `{"token":"t","ip":"10.0.0.1"}`, read: -1, out: `response={"ip":"10.0.0.1","token":"[REDACTED]"}`},
+		{name: "closed early", body: `{"ip":"10.0.0.1"}`, read: 4, out: "response=<4 bytes>"},
+		{name: "larger than the cap", body: strings.Repeat("x", 3*maxLoggedBody), read: -1, out: "response=<2048 bytes>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			b := &loggedBody{ReadCloser: io.NopCloser(strings.NewReader(tt.body)), prefix: tt.name}
+
+			var got []byte
+			var err error
+			if tt.read < 0 {
+				got, err = io.ReadAll(b)
+			} else {
+				got = make([]byte, tt.read)
+				_, err = io.ReadFull(b, got)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.read < 0 && string(got) != tt.body {
+				t.Errorf("the caller read %d bytes, expected the whole body", len(got))
+			}
+			b.Close()
+
+			klog.Flush()
+			if !strings.Contains(logs.String(), tt.out) || strings.Count(logs.String(), tt.name) != 1 {
+				t.Errorf("log = %s, expected %s once", logs.String(), tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package sdk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultReservationTTL = time.Minute
+
+type reservation struct {
+	key     string
+	expires time.Time
+}
+
+// reservations keeps ips that a worker of this process is binding, so that
+// concurrent allocations pick distinct ips instead of racing for the first
+// one returned by the list api. A reservation lives for the duration of one
+// bind call and expires after ttl in case that call never returns.
+type reservations struct {
+	mu   sync.Mutex
+	byIP map[string]reservation
+	ttl  time.Duration
+}
+
+func newReservations(ttl time.Duration) *reservations {
+	return &reservations{byIP: map[string]reservation{}, ttl: ttl}
+}
+
+// reserve returns the current holder when ip is reserved by another service key
+func (r *reservations) reserve(ip, key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if held, ok := r.byIP[ip]; ok && held.key != key && now.Before(held.expires) {
+		return held.key, false
+	}
+
+	r.byIP[ip] = reservation{key: key, expires: now.Add(r.ttl)}
+	return "", true
+}
+
+func (r *reservations) release(ip, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if held, ok := r.byIP[ip]; ok && held.key == key {
+		delete(r.byIP, ip)
+	}
+}
+
+type reservedError struct {
+	ip     string
+	holder string
+}
+
+func (e *reservedError) Error() string {
+	return fmt.Sprintf("ip %s is being bound by %s", e.ip, e.holder)
+}
+
+func (e *reservedError) Is(target error) bool {
+	return target == ErrConflict
+}
@@ -0,0 +1,123 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReservations(t *testing.T) {
+	type step struct {
+		action string
+		ip     string
+		key    string
+		ok     bool
+		holder string
+	}
+
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		steps []step
+	}{
+		{
+			name: "distinct keys",
+			ttl:  time.Minute,
+			steps: []step{
+				{action: "reserve", ip: "10.0.0.1", key: "ns/a", ok: true},
+				{action: "reserve", ip: "10.0.0.1", key: "ns/b", holder: "ns/a"},
+				{action: "reserve", ip: "10.0.0.2", key: "ns/b", ok: true},
+			},
+		},
+		{
+			name: "same key reserves again",
+			ttl:  time.Minute,
+			steps: []step{
+				{action: "reserve", ip: "10.0.0.1", key: "ns/a", ok: true},
+				{action: "reserve", ip: "10.0.0.1", key: "ns/a", ok: true},
+			},
+		},
+		{
+			name: "released",
+			ttl:  time.Minute,
+			steps: []step{
+				{action: "reserve", ip: "10.0.0.1", key: "ns/a", ok: true},
+				{action: "release", ip: "10.0.0.1", key: "ns/a"},
+				{action: "reserve", ip: "10.0.0.1", key: "ns/b", ok: true},
+			},
+		},
+		{
+			name: "release by another key is ignored",
+			ttl:  time.Minute,
+			steps: []step{
+				{action: "reserve", ip: "10.0.0.1", key: "ns/a", ok: true},
+				{action: "release", ip: "10.0.0.1", key: "ns/b"},
+				{action: "reserve", ip: "10.0.0.1", key: "ns/b", holder: "ns/a"},
+			},
+		},
+		{
+			name: "expired",
+			ttl:  -time.Second,
+			steps: []step{
+				{action: "reserve", ip: "10.0.0.1", key: "ns/a", ok: true},
+				{action: "reserve", ip: "10.0.0.1", key: "ns/b", ok: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReservations(tt.ttl)
+			for i, s := range tt.steps {
+				switch s.action {
+				case "reserve":
+					holder, ok := r.reserve(s.ip, s.key)
+					if ok != s.ok || holder != s.holder {
+						t.Fatalf("step %d: reserve(%s, %s) = %q, %v, expected %q, %v", i, s.ip, s.key, holder, ok, s.holder, s.ok)
+					}
+				case "release":
+					r.release(s.ip, s.key)
+				}
+			}
+		})
+	}
+}
+
+func TestReservationsConcurrent(t *testing.T) {
+	r := newReservations(time.Minute)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := map[string]string{}
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+				if _, ok := r.reserve(ip, key); ok {
+					mu.Lock()
+					if other, taken := winners[ip]; taken {
+						t.Errorf("%s reserved by %s and %s", ip, other, key)
+					}
+					winners[ip] = key
+					mu.Unlock()
+					return
+				}
+			}
+		}(fmt.Sprintf("ns/svc-%d", worker))
+	}
+	wg.Wait()
+
+	if len(winners) != 3 {
+		t.Errorf("reserved %v, expected every ip once", winners)
+	}
+}
+
+func TestReservedError(t *testing.T) {
+	err := fmt.Errorf("bind: %w", &reservedError{ip: "10.0.0.1", holder: "ns/a"})
+	if !errors.Is(err, ErrConflict) || IsRetryable(err) {
+		t.Errorf("err = %v, expected a non retryable conflict", err)
+	}
+}
@@ -0,0 +1,93 @@
+package sdk
+
+import (
+	"context"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/signature"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHMACSigner(t *testing.T) {
+	creds := &signature.Credentials{AccessKeyId: "ak", SecretAccessKey: "secret"}
+
+	var mu sync.Mutex
+	nonces := map[string]bool{}
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		stringToSign := signature.StringToSign(r.Method, r.URL.EscapedPath(), r.URL.Query().Encode(),
+			r.Header.Get(signature.HeaderTimestamp), r.Header.Get(signature.HeaderNonce), body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if r.Header.Get(signature.HeaderAccessKey) != "ak" {
+			t.Errorf("access key = %q", r.Header.Get(signature.HeaderAccessKey))
+		}
+		if err := signature.Verify("secret", stringToSign, r.Header.Get(signature.HeaderSignature)); err != nil {
+			t.Errorf("attempt %d: %v", attempts, err)
+		}
+		unix, _ := strconv.ParseInt(r.Header.Get(signature.HeaderTimestamp), 10, 64)
+		if d := time.Since(time.Unix(unix, 0)); d < -time.Second || d > 5*time.Second {
+			t.Errorf("timestamp is %s off", d)
+		}
+		nonce := r.Header.Get(signature.HeaderNonce)
+		if nonces[nonce] {
+			t.Errorf("attempt %d reused nonce %s", attempts, nonce)
+		}
+		nonces[nonce] = true
+
+		// the first attempt fails so the retry has to be signed again
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"code": 200, "message": "success"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(http.DefaultTransport, time.Second,
+		config.LoadBalanceRetryConfig{MaxRetries: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		SigningMiddleware(NewHMACSigner(creds)))
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "put with body and query",
+			call: func() error {
+				return client.PUT(context.Background(), &PostOrPutParams{URL: server.URL + "/loadbalance/bind?cluster=c1&b=2", Body: map[string]string{"ip": "10.0.0.1"}})
+			},
+		},
+		{
+			name: "get with params",
+			call: func() error {
+				return client.GET(context.Background(), &GetOrDeleteParams{URL: server.URL + "/loadbalance/list", Params: map[string]string{"status": "0", "cluster": "c1"}})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			attempts = 0
+			mu.Unlock()
+
+			if err := tt.call(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if attempts != 2 {
+				t.Errorf("attempts = %d, expected 2", attempts)
+			}
+		})
+	}
+}
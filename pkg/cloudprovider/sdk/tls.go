@@ -0,0 +1,227 @@
+package sdk
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"k8s.io/klog/v2"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileCheckPeriod bounds how often the certificate files are stat'ed for changes
+const fileCheckPeriod = 10 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// reloadableFiles re-runs load whenever the modification time of one of the
+// files changes, the last good result is kept if loading fails.
+type reloadableFiles struct {
+	files []string
+	load  func() error
+
+	mu        sync.Mutex
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+func newReloadableFiles(load func() error, files ...string) (*reloadableFiles, error) {
+	r := &reloadableFiles{files: files, load: load}
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = load(); err != nil {
+		return nil, err
+	}
+	r.modTimes = modTimes
+	r.checkedAt = time.Now()
+	return r, nil
+}
+
+func (r *reloadableFiles) stat() ([]time.Time, error) {
+	result := make([]time.Time, 0, len(r.files))
+	for _, file := range r.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, info.ModTime())
+	}
+	return result, nil
+}
+
+func (r *reloadableFiles) check() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) < fileCheckPeriod {
+		return
+	}
+	r.checkedAt = time.Now()
+
+	modTimes, err := r.stat()
+	if err != nil {
+		klog.Errorf("stat tls files %v error: %s", r.files, err.Error())
+		return
+	}
+
+	changed := false
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err = r.load(); err != nil {
+		klog.Errorf("reload tls files %v error: %s", r.files, err.Error())
+		return
+	}
+	r.modTimes = modTimes
+	klog.Infof("reloaded tls files %v", r.files)
+}
+
+type clientCertificate struct {
+	*reloadableFiles
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newClientCertificate(certFile, keyFile string) (*clientCertificate, error) {
+	c := &clientCertificate{}
+	files, err := newReloadableFiles(func() error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.cert = &cert
+		c.mu.Unlock()
+		return nil
+	}, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	c.reloadableFiles = files
+	return c, nil
+}
+
+func (c *clientCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.check()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+type caBundle struct {
+	*reloadableFiles
+
+	mu   sync.RWMutex
+	pool *x509.CertPool
+}
+
+func newCABundle(caFile string) (*caBundle, error) {
+	c := &caBundle{}
+	files, err := newReloadableFiles(func() error {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", caFile)
+		}
+		c.mu.Lock()
+		c.pool = pool
+		c.mu.Unlock()
+		return nil
+	}, caFile)
+	if err != nil {
+		return nil, err
+	}
+	c.reloadableFiles = files
+	return c, nil
+}
+
+func (c *caBundle) Pool() *x509.CertPool {
+	c.check()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pool
+}
+
+// verifyConnection replaces the built in verification so that a rotated ca
+// bundle is picked up without rebuilding the transport.
+func (c *caBundle) verifyConnection(serverName string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server did not present a certificate")
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         c.Pool(),
+			DNSName:       cs.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+		if serverName != "" {
+			opts.DNSName = serverName
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+}
+
+func newTLSConfig(cfg config.LoadBalanceTLSConfig) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tls minVersion %q", cfg.MinVersion)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.InsecureSkipVerify {
+		klog.Warning("tls insecureSkipVerify is enabled, the cloud provider certificate is not verified")
+	} else if cfg.CAFile != "" {
+		bundle, err := newCABundle(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = bundle.verifyConnection(cfg.ServerName)
+	}
+
+	if cfg.CertFile == "" && cfg.KeyFile == "" {
+		return tlsConfig, nil
+	}
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls certFile and keyFile must be set together")
+	}
+
+	cert, err := newClientCertificate(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.GetClientCertificate = cert.GetClientCertificate
+	return tlsConfig, nil
+}
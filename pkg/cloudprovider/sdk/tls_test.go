@@ -0,0 +1,323 @@
+package sdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/config"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a leaf certificate for the dns names and 127.0.0.1
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage, dnsNames ...string) (tls.Certificate, []byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair, certPEM, keyPEM
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTLSServer answers 200 with the common name of the client certificate
+func newTLSServer(t *testing.T, cert tls.Certificate, clientCAs *x509.CertPool) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCAs != nil {
+		server.TLS.ClientCAs = clientCAs
+		server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, tlsConfig *tls.Config, url string) (string, error) {
+	t.Helper()
+
+	client := &http.Client{Transport: NewTransPort(config.LoadBalanceTransportConfig{}, tlsConfig)}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	_, certPEM, keyPEM := ca.issue(t, "controller", x509.ExtKeyUsageClientAuth)
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+	emptyCA := writeFile(t, dir, "empty.crt", []byte("not a certificate"))
+
+	tests := []struct {
+		name string
+		cfg  config.LoadBalanceTLSConfig
+		err  string
+	}{
+		{name: "unknown version", cfg: config.LoadBalanceTLSConfig{MinVersion: "1.1"}, err: `unsupported tls minVersion "1.1"`},
+		{name: "cert without key", cfg: config.LoadBalanceTLSConfig{CertFile: certFile}, err: "must be set together"},
+		{name: "key without cert", cfg: config.LoadBalanceTLSConfig{KeyFile: keyFile}, err: "must be set together"},
+		{name: "missing ca file", cfg: config.LoadBalanceTLSConfig{CAFile: filepath.Join(dir, "missing.crt")}, err: "no such file"},
+		{name: "ca file without certificates", cfg: config.LoadBalanceTLSConfig{CAFile: emptyCA}, err: "no certificate found"},
+		{name: "key of another certificate", cfg: config.LoadBalanceTLSConfig{CertFile: certFile, KeyFile: writeFile(t, dir, "other.key", func() []byte {
+			_, _, other := ca.issue(t, "other", x509.ExtKeyUsageClientAuth)
+			return other
+		}())}, err: "private key does not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTLSConfig(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestTLSVerification(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	otherCA := newTestCA(t, "other-ca")
+	serverCert, _, _ := ca.issue(t, "manager", x509.ExtKeyUsageServerAuth, "manager.example.com")
+	server := newTLSServer(t, serverCert, nil)
+	caFile := writeFile(t, dir, "ca.crt", ca.pem)
+	otherCAFile := writeFile(t, dir, "other-ca.crt", otherCA.pem)
+
+	tests := []struct {
+		name string
+		cfg  config.LoadBalanceTLSConfig
+		err  string
+	}{
+		{name: "ca file", cfg: config.LoadBalanceTLSConfig{CAFile: caFile}},
+		{name: "server name", cfg: config.LoadBalanceTLSConfig{CAFile: caFile, ServerName: "manager.example.com"}},
+		{name: "wrong server name", cfg: config.LoadBalanceTLSConfig{CAFile: caFile, ServerName: "other.example.com"}, err: "certificate is valid for"},
+		{name: "other ca", cfg: config.LoadBalanceTLSConfig{CAFile: otherCAFile}, err: "certificate signed by unknown authority"},
+		{name: "system roots", cfg: config.LoadBalanceTLSConfig{}, err: "certificate"},
+		{name: "insecure", cfg: config.LoadBalanceTLSConfig{CAFile: otherCAFile, InsecureSkipVerify: true}},
+		{name: "tls 1.3", cfg: config.LoadBalanceTLSConfig{CAFile: caFile, MinVersion: "1.3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(tt.cfg)
+			if err != nil {
+				t.Fatalf("tls config: %v", err)
+			}
+
+			_, err = get(t, tlsConfig, server.URL)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	serverCert, _, _ := ca.issue(t, "manager", x509.ExtKeyUsageServerAuth)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	server := newTLSServer(t, serverCert, clientCAs)
+
+	rotatedCA := newTestCA(t, "rotated-ca")
+	_, certPEM, keyPEM := ca.issue(t, "controller-1", x509.ExtKeyUsageClientAuth)
+	caFile := writeFile(t, dir, "ca.crt", rotatedCA.pem)
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+
+	bundle, err := newCABundle(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := newClientCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as built by newTLSConfig
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify:   true,
+		VerifyConnection:     bundle.verifyConnection(""),
+		GetClientCertificate: cert.GetClientCertificate,
+	}
+
+	if _, err = get(t, tlsConfig, server.URL); err == nil || !strings.Contains(err.Error(), "unknown authority") {
+		t.Fatalf("expected the server to be rejected by the rotated ca, got %v", err)
+	}
+
+	// the ca bundle and the client certificate are rotated on disk
+	_, certPEM, keyPEM = ca.issue(t, "controller-2", x509.ExtKeyUsageClientAuth)
+	writeFile(t, dir, "ca.crt", ca.pem)
+	writeFile(t, dir, "client.crt", certPEM)
+	writeFile(t, dir, "client.key", keyPEM)
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{caFile, certFile, keyFile} {
+		if err = os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// within fileCheckPeriod the files are not looked at
+	if _, err = get(t, tlsConfig, server.URL); err == nil {
+		t.Fatal("expected the old ca bundle before the check period passed")
+	}
+
+	bundle.checkedAt = time.Now().Add(-fileCheckPeriod)
+	cert.checkedAt = time.Now().Add(-fileCheckPeriod)
+	name, err := get(t, tlsConfig, server.URL)
+	if err != nil || name != "controller-2" {
+		t.Fatalf("got %q, %v, expected controller-2", name, err)
+	}
+}
+
+func TestReloadableFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "value", []byte("one"))
+
+	var value string
+	load := func() error {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if len(b) == 0 {
+			return os.ErrInvalid
+		}
+		value = string(b)
+		return nil
+	}
+
+	r, err := newReloadableFiles(load, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		content string
+		expired bool
+		value   string
+	}{
+		{name: "unchanged", expired: true, value: "one"},
+		{name: "changed within the period", content: "two", value: "one"},
+		{name: "changed after the period", content: "two", expired: true, value: "two"},
+		{name: "broken file keeps the last value", content: "", expired: true, value: "two"},
+		{name: "fixed file is loaded", content: "three", expired: true, value: "three"},
+	}
+
+	for i, step := range steps {
+		if i > 0 {
+			writeFile(t, dir, "value", []byte(step.content))
+			mtime := time.Now().Add(time.Duration(i) * time.Minute)
+			if err = os.Chtimes(file, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if step.expired {
+			r.checkedAt = time.Now().Add(-fileCheckPeriod)
+		}
+
+		r.check()
+		if value != step.value {
+			t.Errorf("%s: value = %q, expected %q", step.name, value, step.value)
+		}
+	}
+}
@@ -1,22 +1,261 @@
 package config
 
-import "github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+import (
+	"time"
+)
 
 type LoadBalanceConfig struct {
-	LoadBalanceSet LoadBalanceSetConfig `yaml:"loadbalance"`
-	Region         string               `yaml:"region"`
+	LoadBalanceSet LoadBalanceSetConfig         `yaml:"loadbalance"`
+	Region         string                       `yaml:"region"`
+	Credentials    LoadBalanceCredentialsConfig `yaml:"credentials"`
+	TLS            LoadBalanceTLSConfig         `yaml:"tls"`
+	Transport      LoadBalanceTransportConfig   `yaml:"transport"`
+	// Timeout bounds every attempt of a request, default 10s
+	Timeout time.Duration          `yaml:"timeout"`
+	Retry   LoadBalanceRetryConfig `yaml:"retry"`
+	Cache   LoadBalanceCacheConfig `yaml:"cache"`
+	Signing SigningConfig          `yaml:"signing"`
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"`
+
+	// Backend is http (default) or grpc, the batch calls always use the rest api
+	Backend string                `yaml:"backend"`
+	GRPC    LoadBalanceGRPCConfig `yaml:"grpc"`
+
+	DNS LoadBalanceDNSConfig `yaml:"dns"`
+}
+
+// LoadBalanceDNSConfig keeps the A or AAAA record of every service annotated
+// with loadbalance.cloudprovider.io/hostname in Zone by RFC 2136 dynamic updates
+// sent to Server, host:port with 53 by default. Network is udp (default) or tcp,
+// TTL defaults to 5m and Timeout to 5s.
+type LoadBalanceDNSConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Server  string        `yaml:"server"`
+	Zone    string        `yaml:"zone"`
+	Network string        `yaml:"network"`
+	TTL     time.Duration `yaml:"ttl"`
+	Timeout time.Duration `yaml:"timeout"`
+	TSIG    DNSTSIGConfig `yaml:"tsig"`
+}
+
+// DNSTSIGConfig signs the updates when KeyName is set. Secret is base64 as in a
+// bind key file, SecretFile is read instead when set. Algorithm is hmac-sha256
+// (default), hmac-sha512 or hmac-sha1.
+type DNSTSIGConfig struct {
+	KeyName    string `yaml:"keyName"`
+	Algorithm  string `yaml:"algorithm"`
+	Secret     string `yaml:"secret"`
+	SecretFile string `yaml:"secretFile"`
+}
+
+// LoadBalanceGRPCConfig is used by the grpc backend. Tls, credentials, timeout
+// and the circuit breaker are shared with the http backend.
+type LoadBalanceGRPCConfig struct {
+	// Address is host:port of the grpc api of cloud-provider-manager
+	Address string `yaml:"address"`
+	// Plaintext disables tls, bearer tokens are then sent in the clear
+	Plaintext bool `yaml:"plaintext"`
+}
+
+// CircuitBreakerConfig opens the breaker after FailureThreshold consecutive
+// failed attempts, 0 means the default of 5 and a negative value disables it.
+// An open breaker lets a single probe through after OpenTimeout.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failureThreshold"`
+	OpenTimeout      time.Duration `yaml:"openTimeout"`
+}
+
+// SigningConfig enables HMAC request signatures, CredentialsFile is a yaml file
+// with accessKeyId and secretAccessKey, the CLOUD_PROVIDER_ACCESS_KEY_ID and
+// CLOUD_PROVIDER_SECRET_ACCESS_KEY environment variables are used when it is empty
+type SigningConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	CredentialsFile string `yaml:"credentialsFile"`
+}
+
+// LoadBalanceCacheConfig controls the free ip cache used while the list api is
+// failing, it is ignored once older than TTL
+type LoadBalanceCacheConfig struct {
+	ResyncPeriod time.Duration `yaml:"resyncPeriod"`
+	TTL          time.Duration `yaml:"ttl"`
+	// ReservationTTL bounds how long an ip stays reserved for an unfinished bind
+	ReservationTTL time.Duration `yaml:"reservationTTL"`
+}
+
+type LoadBalanceCredentialsConfig struct {
+	// Token is sent as a bearer token, TokenFile takes precedence and is re-read periodically
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"tokenFile"`
+}
+
+// LoadBalanceTLSConfig files are reloaded when they change on disk
+type LoadBalanceTLSConfig struct {
+	// CAFile verifies the server, the system roots are used when empty
+	CAFile   string `yaml:"caFile"`
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// ServerName overrides the host name checked against the server certificate
+	ServerName string `yaml:"serverName"`
+	// MinVersion is 1.2 or 1.3, default 1.2
+	MinVersion         string `yaml:"minVersion"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// LoadBalanceRetryConfig applies to idempotent requests, MaxRetries 0 means
+// the default of 3 and a negative value disables retries
+type LoadBalanceRetryConfig struct {
+	MaxRetries     int           `yaml:"maxRetries"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+}
+
+// LoadBalanceTransportConfig zero values fall back to the sdk defaults
+type LoadBalanceTransportConfig struct {
+	MaxIdleConns          int           `yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost   int           `yaml:"maxIdleConnsPerHost"`
+	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout"`
+	DialTimeout           time.Duration `yaml:"dialTimeout"`
+	KeepAlive             time.Duration `yaml:"keepAlive"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout"`
 }
 
 type CloudProviderConfig struct {
 	HTTP CloudProviderHTTPConfig `yaml:"http"`
 	DB   CloudProviderDBConfig   `yaml:"db"`
+	Auth CloudProviderAuthConfig `yaml:"auth"`
+
+	Watch      CloudProviderWatchConfig      `yaml:"watch"`
+	GRPC       CloudProviderGRPCConfig       `yaml:"grpc"`
+	Quarantine CloudProviderQuarantineConfig `yaml:"quarantine"`
+	Sticky     CloudProviderStickyConfig     `yaml:"sticky"`
+	Stats      CloudProviderStatsConfig      `yaml:"stats"`
+	Webhook    CloudProviderWebhookConfig    `yaml:"webhook"`
 }
 
-type CloudProviderHTTPConfig struct {
+// CloudProviderStatsConfig refreshes the pool gauges and checks the low
+// watermarks every Interval, default 30s
+type CloudProviderStatsConfig struct {
+	Interval      time.Duration                     `yaml:"interval"`
+	LowWatermarks []CloudProviderLowWatermarkConfig `yaml:"lowWatermarks"`
+}
+
+// CloudProviderLowWatermarkConfig notifies the webhook once the free ips of a
+// cluster, or of a cidr of it, drop below MinFree or below MinFreePercent of its
+// ips, and again once they recovered. Cluster "*" matches every cluster.
+type CloudProviderLowWatermarkConfig struct {
+	Cluster        string  `yaml:"cluster"`
+	Cidr           string  `yaml:"cidr"`
+	MinFree        int64   `yaml:"minFree"`
+	MinFreePercent float64 `yaml:"minFreePercent"`
+}
+
+// CloudProviderWebhookConfig posts the events of the manager as signed json to
+// every subscriber. Events are queued in the database and each subscriber gets
+// them in order, a failed post is retried after RetryInterval, doubled on every
+// attempt up to MaxRetryInterval, until MaxAttempts. Interval is how often the
+// queue is polled. The defaults are 10s Timeout, 5s Interval, 5s RetryInterval,
+// 10m MaxRetryInterval and 10 MaxAttempts.
+type CloudProviderWebhookConfig struct {
+	Subscribers      []CloudProviderWebhookSubscriberConfig `yaml:"subscribers"`
+	Timeout          time.Duration                          `yaml:"timeout"`
+	Interval         time.Duration                          `yaml:"interval"`
+	RetryInterval    time.Duration                          `yaml:"retryInterval"`
+	MaxRetryInterval time.Duration                          `yaml:"maxRetryInterval"`
+	MaxAttempts      int                                    `yaml:"maxAttempts"`
+}
+
+// CloudProviderWebhookSubscriberConfig is one receiver of events. Name keys its
+// queued deliveries and must stay the same across restarts. SecretFile is read
+// instead of Secret when set. An empty Events receives every event type.
+type CloudProviderWebhookSubscriberConfig struct {
+	Name       string   `yaml:"name"`
+	URL        string   `yaml:"url"`
+	Secret     string   `yaml:"secret"`
+	SecretFile string   `yaml:"secretFile"`
+	Events     []string `yaml:"events"`
+}
+
+// CloudProviderStickyConfig is how long a released ip is offered back to the
+// service it was released from, 0 means the default of 24h and a negative value
+// disables it
+type CloudProviderStickyConfig struct {
+	Retention time.Duration `yaml:"retention"`
+}
+
+// CloudProviderQuarantineConfig keeps a released ip out of allocation for
+// Cooldown, 0 frees it at once. Interval is how often expired ips are freed,
+// default 10s.
+type CloudProviderQuarantineConfig struct {
+	Cooldown time.Duration `yaml:"cooldown"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// CloudProviderGRPCConfig serves the grpc api next to the rest api when Port is
+// set, it shares the tls files and authenticators of the http server.
+type CloudProviderGRPCConfig struct {
 	Host string `yaml:"host"`
 	Port int64  `yaml:"port"`
 }
 
+// CloudProviderWatchConfig sizes the in-memory event history a watch can resume
+// from, Timeout closes a watch so clients reconnect and BookmarkInterval keeps
+// idle watches alive. Zero values fall back to the defaults.
+type CloudProviderWatchConfig struct {
+	BufferSize       int           `yaml:"bufferSize"`
+	Timeout          time.Duration `yaml:"timeout"`
+	BookmarkInterval time.Duration `yaml:"bookmarkInterval"`
+}
+
+type CloudProviderHTTPConfig struct {
+	Host string                 `yaml:"host"`
+	Port int64                  `yaml:"port"`
+	TLS  CloudProviderTLSConfig `yaml:"tls"`
+}
+
+type CloudProviderTLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// ClientCAFile enables client certificate authentication
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+type CloudProviderAuthConfig struct {
+	// TokenFile is a csv file of token,user,uid,"group1,group2"
+	TokenFile     string                           `yaml:"tokenFile"`
+	TokenReview   CloudProviderTokenReviewConfig   `yaml:"tokenReview"`
+	Authorization []CloudProviderAuthorizationRule `yaml:"authorization"`
+	// QuotaAdmins may change the quotas of their clusters, access to a cluster only reads them
+	QuotaAdmins []CloudProviderAuthorizationRule `yaml:"quotaAdmins"`
+	Signature   CloudProviderSignatureConfig     `yaml:"signature"`
+}
+
+// CloudProviderSignatureConfig requires HMAC signed requests, CredentialsFile is
+// a yaml list of accessKeyId and secretAccessKey, the environment variables of
+// SigningConfig are used when it is empty
+type CloudProviderSignatureConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	CredentialsFile string        `yaml:"credentialsFile"`
+	MaxClockSkew    time.Duration `yaml:"maxClockSkew"`
+}
+
+type CloudProviderTokenReviewConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// KubeConfig is empty when running inside the cluster
+	KubeConfig string   `yaml:"kubeconfig"`
+	Audiences  []string `yaml:"audiences"`
+	// CacheTTL is a duration such as 2m, default 2m
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+}
+
+// CloudProviderAuthorizationRule grants a user or a group access to clusters, "*" matches every cluster
+type CloudProviderAuthorizationRule struct {
+	User     string   `yaml:"user"`
+	Group    string   `yaml:"group"`
+	Clusters []string `yaml:"clusters"`
+}
+
 type CloudProviderDBConfig struct {
 	User     string `yaml:"user"`
 	Host     string `yaml:"host"`
@@ -29,16 +268,33 @@ type LoadBalanceSetConfig struct {
 	Bind     string `yaml:"bind"`
 	Released string `yaml:"released"`
 	List     string `yaml:"list"`
+
+	// batch endpoints, the controller reconciles service by service when they are empty
+	BindBatch     string `yaml:"bindBatch"`
+	ReleasedBatch string `yaml:"releasedBatch"`
+	Bindings      string `yaml:"bindings"`
+
+	// Watch keeps a local cache of the pool current, the controller polls when it is empty
+	Watch string `yaml:"watch"`
+
+	// Previous finds the ip a service released last, used for services opting in to sticky ips
+	Previous string `yaml:"previous"`
+
+	// Version v2 sends bind, unbind, list, bindings, watch and previous to the resource routes
+	// below Server, e.g. http://localhost:9999/api/v2/cloudprovider, the batch urls
+	// above stay on v1. Empty or v1 uses the urls above.
+	Version string `yaml:"version"`
+	Server  string `yaml:"server"`
 }
 
 func NewLoadBalanceConfig(in string) (*LoadBalanceConfig, error) {
 	var config *LoadBalanceConfig
-	err := parsers.ParserConfigurationByFile(parsers.YAML, in, &config)
+	err := load(in, &config)
 	return config, err
 }
 
 func NewCloudProviderHTTPConfig(in string) (*CloudProviderConfig, error) {
 	var config *CloudProviderConfig
-	err := parsers.ParserConfigurationByFile(parsers.YAML, in, &config)
+	err := load(in, &config)
 	return config, err
 }
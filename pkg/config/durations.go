@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// load decodes the yaml file in into out, a pointer to a config, and rejects
+// durations written as bare numbers
+func load(in string, out interface{}) error {
+	if err := parsers.ParserConfigurationByFile(parsers.YAML, in, out); err != nil {
+		return err
+	}
+	var raw interface{}
+	if err := parsers.ParserConfigurationByFile(parsers.YAML, in, &raw); err != nil {
+		return err
+	}
+	return checkDurations(raw, reflect.TypeOf(out), "")
+}
+
+// checkDurations walks the raw yaml document along the type it was decoded
+// into. yaml decodes a bare number into a time.Duration as nanoseconds, so
+// idleConnTimeout: 120 is 120ns rather than two minutes; every duration but 0
+// has to be a string such as 2m or 500ms.
+func checkDurations(raw interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := raw.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			value, ok := fields[name]
+			if !ok {
+				continue
+			}
+			if err := checkDurations(value, field.Type, strings.TrimPrefix(path+"."+name, ".")); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			if err := checkDurations(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Int64:
+		if t != durationType {
+			return nil
+		}
+		switch raw.(type) {
+		case int, int64, uint64, float64:
+			if !reflect.ValueOf(raw).IsZero() {
+				return fmt.Errorf("%s: %v is a bare number and would be read as nanoseconds, write a duration such as 2m or 500ms", path, raw)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBalanceConfigDurations(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "duration strings", data: "timeout: 10s\ntransport:\n  idleConnTimeout: 2m\nretry:\n  initialBackoff: 200ms\n"},
+		{name: "zero", data: "timeout: 0\n"},
+		{name: "bare timeout", data: "timeout: 10\n", err: "timeout: 10 is a bare number"},
+		{name: "bare transport", data: "transport:\n  maxIdleConns: 100\n  idleConnTimeout: 120\n", err: "transport.idleConnTimeout: 120 is a bare number"},
+		{name: "bare retry", data: "retry:\n  maxBackoff: 5.5\n", err: "retry.maxBackoff: 5.5 is a bare number"},
+		{name: "bare cache", data: "cache:\n  reservationTTL: 60\n", err: "cache.reservationTTL: 60 is a bare number"},
+		{name: "bare dns", data: "dns:\n  ttl: 300\n", err: "dns.ttl: 300 is a bare number"},
+		{name: "bare circuit breaker", data: "circuitBreaker:\n  openTimeout: 30\n", err: "circuitBreaker.openTimeout: 30 is a bare number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLoadBalanceConfig(writeConfig(t, tt.data))
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("err = %v, expected %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCloudProviderConfigDurations(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "duration strings", data: "watch:\n  timeout: 5m\nwebhook:\n  subscribers:\n  - name: ops\n    url: http://ops\n  retryInterval: 5s\n"},
+		{name: "bare watch", data: "watch:\n  bufferSize: 1000\n  bookmarkInterval: 30\n", err: "watch.bookmarkInterval: 30 is a bare number"},
+		{name: "bare webhook", data: "webhook:\n  maxAttempts: 10\n  maxRetryInterval: 600\n", err: "webhook.maxRetryInterval: 600 is a bare number"},
+		{name: "bare quarantine", data: "quarantine:\n  cooldown: 600\n", err: "quarantine.cooldown: 600 is a bare number"},
+		{name: "bare sticky", data: "sticky:\n  retention: -1\n", err: "sticky.retention: -1 is a bare number"},
+		{name: "bare stats", data: "stats:\n  lowWatermarks:\n  - cluster: c1\n    minFree: 10\n  interval: 30\n", err: "stats.interval: 30 is a bare number"},
+		{name: "bare token review", data: "auth:\n  tokenReview:\n    cacheTTL: 120\n", err: "auth.tokenReview.cacheTTL: 120 is a bare number"},
+		{name: "bare signature", data: "auth:\n  signature:\n    maxClockSkew: 300\n", err: "auth.signature.maxClockSkew: 300 is a bare number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCloudProviderHTTPConfig(writeConfig(t, tt.data))
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("err = %v, expected %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExampleConfigs(t *testing.T) {
+	lb, err := NewLoadBalanceConfig("../../cmd/loadbalance-controller/loadbalance.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb.LoadBalanceSet.Bind == "" {
+		t.Error("loadbalance.yml decoded without a bind url")
+	}
+	if _, err = NewCloudProviderHTTPConfig("../../cmd/cloud-provider-manager/cloud-provider-manager.yml"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"gopkg.in/yaml.v2"
-	"io/fs"
 	"os"
 	"strconv"
 )
@@ -15,7 +14,7 @@ const (
 )
 
 func ParserConfigurationByFile(format, in string, out interface{}) error {
-	data, err := fs.ReadFile(os.DirFS("."), in)
+	data, err := os.ReadFile(in)
 
 	if err != nil {
 		return err
@@ -0,0 +1,96 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/YuZongYangHi/cloud-controller-manager/pkg/util/parsers"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	HeaderAccessKey = "X-CloudProvider-Access-Key"
+	HeaderTimestamp = "X-CloudProvider-Timestamp"
+	HeaderNonce     = "X-CloudProvider-Nonce"
+	HeaderSignature = "X-CloudProvider-Signature"
+
+	// EnvAccessKeyId and EnvSecretAccessKey are read when no credentials file is configured
+	EnvAccessKeyId     = "CLOUD_PROVIDER_ACCESS_KEY_ID"
+	EnvSecretAccessKey = "CLOUD_PROVIDER_SECRET_ACCESS_KEY"
+)
+
+type Credentials struct {
+	AccessKeyId     string `yaml:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+}
+
+// LoadCredentials reads a yaml credentials file, or the environment when file is empty
+func LoadCredentials(file string) (*Credentials, error) {
+	creds := &Credentials{}
+	if file != "" {
+		if err := parsers.ParserConfigurationByFile(parsers.YAML, file, creds); err != nil {
+			return nil, err
+		}
+	} else {
+		creds.AccessKeyId = os.Getenv(EnvAccessKeyId)
+		creds.SecretAccessKey = os.Getenv(EnvSecretAccessKey)
+	}
+
+	if creds.AccessKeyId == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("signing credentials need both accessKeyId and secretAccessKey")
+	}
+	return creds, nil
+}
+
+// StringToSign is the canonical form of a request, the query is sorted by
+// url.Values.Encode on both sides and the body is hashed.
+func StringToSign(method, path, query, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		query,
+		timestamp,
+		nonce,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+}
+
+// GRPCStringToSign is the canonical form of a grpc call, a POST of its full
+// method name without query whose body is the request message in deterministic
+// encoding. The signature headers are sent as metadata with lower case keys.
+func GRPCStringToSign(fullMethod, timestamp, nonce string, req proto.Message) (string, error) {
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return StringToSign(http.MethodPost, fullMethod, "", timestamp, nonce, body), nil
+}
+
+func Sign(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(secret, stringToSign, signature string) error {
+	expected, err := hex.DecodeString(Sign(secret, stringToSign))
+	if err != nil {
+		return err
+	}
+
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature")
+	}
+
+	if !hmac.Equal(expected, actual) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package signature
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStringToSign(t *testing.T) {
+	got := StringToSign("post", "/loadbalance/bind", "cluster=c1", "1680000000", "n1", []byte("{}"))
+	expected := "POST\n/loadbalance/bind\ncluster=c1\n1680000000\nn1\n44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+	if got != expected {
+		t.Errorf("StringToSign = %q, expected %q", got, expected)
+	}
+}
+
+func TestGRPCStringToSign(t *testing.T) {
+	req := wrapperspb.String("10.0.0.1")
+	got, err := GRPCStringToSign("/cloudprovider.loadbalancer.v1.LoadBalancerService/Bind", "1680000000", "n1", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StringToSign("POST", "/cloudprovider.loadbalancer.v1.LoadBalancerService/Bind", "", "1680000000", "n1", body)
+	if got != expected {
+		t.Errorf("GRPCStringToSign = %q, expected %q", got, expected)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	stringToSign := StringToSign("GET", "/loadbalance/list", "", "1680000000", "n1", nil)
+	valid := Sign("secret", stringToSign)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		err       string
+	}{
+		{name: "valid", secret: "secret", signature: valid},
+		{name: "upper case hex", secret: "secret", signature: strings.ToUpper(valid)},
+		{name: "other secret", secret: "other", signature: valid, err: "signature mismatch"},
+		{name: "truncated", secret: "secret", signature: valid[:32], err: "signature mismatch"},
+		{name: "not hex", secret: "secret", signature: "xyz", err: "malformed signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, stringToSign, tt.signature)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name   string
+		file   string
+		env    [2]string
+		access string
+		err    bool
+	}{
+		{name: "file", file: write("full.yml", "accessKeyId: ak\nsecretAccessKey: sk\n"), access: "ak"},
+		{name: "file without secret", file: write("partial.yml", "accessKeyId: ak\n"), err: true},
+		{name: "missing file", file: filepath.Join(dir, "missing.yml"), err: true},
+		{name: "environment", env: [2]string{"env-ak", "env-sk"}, access: "env-ak"},
+		{name: "empty environment", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAccessKeyId, tt.env[0])
+			t.Setenv(EnvSecretAccessKey, tt.env[1])
+
+			creds, err := LoadCredentials(tt.file)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", creds)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if creds.AccessKeyId != tt.access {
+				t.Errorf("accessKeyId = %q, expected %q", creds.AccessKeyId, tt.access)
+			}
+		})
+	}
+}
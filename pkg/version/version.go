@@ -0,0 +1,15 @@
+package version
+
+// Version and GitCommit are set at build time with
+// -ldflags "-X github.com/YuZongYangHi/cloud-controller-manager/pkg/version.Version=v0.1.0"
+var (
+	Version   = "dev"
+	GitCommit = ""
+)
+
+func String() string {
+	if GitCommit == "" {
+		return Version
+	}
+	return Version + "+" + GitCommit
+}